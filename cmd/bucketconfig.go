@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"s3migration/migration"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	bucketConfigDest string
+	bucketConfigs    []string
+	lifecycleFile    string
+	lifecycleExport  string
+	policyMapping    map[string]string
+	policyFile       string
+	policyExport     string
+	logTargetBucket  string
+	policyAnalyzer   string
+)
+
+func init() {
+	rootCmd.AddCommand(bucketConfigCommand)
+	bucketConfigCommand.Flags().StringVar(&bucketConfigDest, destinationBucketArgName, "", "Destination bucket name")
+	bucketConfigCommand.Flags().StringSliceVar(&bucketConfigs, bucketConfigsArgName, migration.BucketConfigs,
+		fmt.Sprintf("[Optional] Bucket settings to copy, any of %s", strings.Join(migration.BucketConfigs, ", ")))
+	bucketConfigCommand.Flags().StringVar(&lifecycleFile, lifecycleFileArgName, "", "[Optional] Apply the lifecycle rules of this JSON file instead of the source bucket's, eg. once reviewed")
+	bucketConfigCommand.Flags().StringVar(&lifecycleExport, lifecycleExportArgName, "", "[Optional] Write the source bucket's lifecycle rules to this JSON file for review, instead of copying them")
+	bucketConfigCommand.Flags().StringToStringVar(&policyMapping, policyMapArgName, nil,
+		"[Optional] Values replaced in the source bucket's policy, as old=new pairs, eg. source account ID=destination account ID")
+	bucketConfigCommand.Flags().StringVar(&policyFile, policyFileArgName, "", "[Optional] Apply the bucket policy of this JSON file instead of the source bucket's, eg. once reviewed")
+	bucketConfigCommand.Flags().StringVar(&policyExport, policyExportArgName, "", "[Optional] Write the source bucket's translated policy to this JSON file for review, instead of applying it")
+	bucketConfigCommand.Flags().StringVar(&logTargetBucket, logTargetBucketArgName, "", "[Optional] Bucket the destination's access logs are delivered to instead of the source's log target")
+	bucketConfigCommand.Flags().StringVar(&policyAnalyzer, analyzerArnArgName, "", "[Optional] Access Analyzer ARN used to list active external access findings for the destination bucket once its policy is copied")
+	_ = bucketConfigCommand.MarkFlagRequired(destinationBucketArgName)
+}
+
+var bucketConfigCommand = &cobra.Command{
+	Use:          "migrate-bucket-config",
+	Short:        "Copy bucket-level configuration, such as default encryption and versioning, from the source bucket to the destination",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireFlags(cmd, regionArgName, sourceBucketArgName); err != nil {
+			return err
+		}
+		selected := []string{}
+		for _, name := range bucketConfigs {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !slices.Contains(migration.BucketConfigs, name) {
+				return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+					bucketConfigsArgName, name, strings.Join(migration.BucketConfigs, ", "))
+			}
+			selected = append(selected, name)
+		}
+		if lifecycleFile != "" || lifecycleExport != "" {
+			if !slices.Contains(selected, migration.BucketConfigLifecycle) {
+				return fmt.Errorf("input args '%s' and '%s' require '%s' to include %s",
+					lifecycleFileArgName, lifecycleExportArgName, bucketConfigsArgName, migration.BucketConfigLifecycle)
+			}
+			if lifecycleFile != "" && lifecycleExport != "" {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", lifecycleFileArgName, lifecycleExportArgName)
+			}
+		}
+		if len(policyMapping) > 0 || policyFile != "" || policyExport != "" || policyAnalyzer != "" {
+			if !slices.Contains(selected, migration.BucketConfigPolicy) {
+				return fmt.Errorf("input args '%s', '%s', '%s' and '%s' require '%s' to include %s",
+					policyMapArgName, policyFileArgName, policyExportArgName, analyzerArnArgName, bucketConfigsArgName, migration.BucketConfigPolicy)
+			}
+			if policyFile != "" && policyExport != "" {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", policyFileArgName, policyExportArgName)
+			}
+		}
+		if logTargetBucket != "" && !slices.Contains(selected, migration.BucketConfigLogging) {
+			return fmt.Errorf("input arg '%s' requires '%s' to include %s", logTargetBucketArgName, bucketConfigsArgName, migration.BucketConfigLogging)
+		}
+		// Copied in the order of migration.BucketConfigs whatever the order given
+		bucketConfigs = slices.DeleteFunc(slices.Clone(migration.BucketConfigs), func(name string) bool {
+			return !slices.Contains(selected, name)
+		})
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		_, err := migration.MigrateBucketConfig(migration.BucketConfigArgs{
+			SourceRegion:      sourceRegion,
+			SourceBucket:      migrationSrc,
+			DestinationBucket: bucketConfigDest,
+			AccountID:         migrationAcctId,
+			Configs:           bucketConfigs,
+			LifecycleFile:     lifecycleFile,
+			LifecycleExport:   lifecycleExport,
+			PolicyMapping:     policyMapping,
+			PolicyFile:        policyFile,
+			PolicyExport:      policyExport,
+			LogTargetBucket:   logTargetBucket,
+			AnalyzerArn:       policyAnalyzer,
+		})
+		exitOn(err)
+	},
+	TraverseChildren: true,
+}
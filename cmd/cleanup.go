@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"s3migration/migration"
+	"s3migration/util"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	manifestsAge   string
+	manifestsOlder time.Duration
+	cleanupDryRun  bool
+	cleanupInvCfg  bool
+)
+
+func init() {
+	rootCmd.AddCommand(cleanupCommand)
+	cleanupCommand.Flags().StringVar(&manifestsAge, manifestsOlderArgName, "7d", "[Optional] Delete manifests written by previous runs older than this age, eg. 7d, 36h")
+	cleanupCommand.Flags().BoolVar(&cleanupDryRun, dryRunArgName, false, "[Optional] Only log the manifests that would be deleted")
+	cleanupCommand.Flags().BoolVar(&cleanupInvCfg, inventoryArgName, false, "[Optional] Also delete the tool's inventory configuration and the inventory reports it delivered to the source bucket")
+}
+
+var cleanupCommand = &cobra.Command{
+	Use:          "cleanup",
+	Short:        "Delete filtered manifests and chunk files written to the source bucket by previous runs",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireFlags(cmd, regionArgName, sourceBucketArgName); err != nil {
+			return err
+		}
+		var err error
+		if manifestsOlder, err = util.ParseAge(manifestsAge); err != nil || manifestsOlder <= 0 {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, eg. 7d or 36h", manifestsOlderArgName, manifestsAge)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := migration.Cleanup(sourceRegion, migrationSrc, inventoryDest, inventoryConfig, manifestsOlder, cleanupInvCfg, cleanupDryRun); err != nil {
+			log.Fatal(err)
+		}
+	},
+	TraverseChildren: true,
+}
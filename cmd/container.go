@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"s3migration/migration"
+	"s3migration/util"
+	"strings"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// Prefix of the environment variables flags are read from in container mode
+const containerEnvPrefix = "S3MIGRATION_"
+
+// Set the flags not given on the command line from S3MIGRATION_<FLAG> environment variables, eg.
+// S3MIGRATION_DESTINATIONBUCKET or S3MIGRATION_POLL_INTERVAL, then from the JSON object of flag names and
+// values in the --config-parameter SSM parameter
+func applyContainerConfig(cmd *cobra.Command) error {
+	flags := cmd.Flags()
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		value, ok := os.LookupEnv(containerEnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_")))
+		if ok && !f.Changed && err == nil {
+			if serr := flags.Set(f.Name, value); serr != nil {
+				err = fmt.Errorf("environment variable for input arg '%s': %w", f.Name, serr)
+			}
+		}
+	})
+	if err != nil || configParam == "" {
+		return err
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(sourceRegion))
+	if err != nil {
+		return err
+	}
+	value, err := util.GetSSMParameter(ctx, ssm.NewFromConfig(cfg), configParam)
+	if err != nil {
+		return fmt.Errorf("unable to read input arg '%s' parameter '%s': %w", configParameterArgName, configParam, err)
+	}
+	return applyConfigValues(flags, fmt.Sprintf("input arg '%s' parameter '%s'", configParameterArgName, configParam), value)
+}
+
+// Set the flags not given on the command line from the JSON object of flag names and values read from source,
+// eg. input arg 'config-file' file 's3migration.json', which names it in errors
+func applyConfigValues(flags *pflag.FlagSet, source, value string) error {
+	values, err := parseConfigParameter(value)
+	if err != nil {
+		return fmt.Errorf("%s is not valid: %w", source, err)
+	}
+	for name, v := range values {
+		f := flags.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("%s sets unknown flag '%s'", source, name)
+		}
+		if f.Changed {
+			continue
+		}
+		if serr := flags.Set(name, v); serr != nil {
+			return fmt.Errorf("%s value of '%s': %w", source, name, serr)
+		}
+	}
+	return nil
+}
+
+// Flag values of a JSON object, eg. {"chunks": 4, "latest-only": "Yes", "metadata": {"project": "alpha*"}}.
+// Lists are comma separated and objects are key=value pairs, as on the command line.
+func parseConfigParameter(value string) (map[string]string, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for name, v := range raw {
+		switch v := v.(type) {
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case map[string]any:
+			pairs := []string{}
+			for k, item := range v {
+				pairs = append(pairs, fmt.Sprintf("%s=%v", k, item))
+			}
+			values[name] = strings.Join(pairs, ",")
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// Run, or resume the run recorded in the state that a stopped task left unfinished, returning the exit code.
+// A stop signal, eg. from ECS stopping the task, suspends polling and exits, leaving the batch jobs running.
+func runContainer(args migration.MigrationArgs) int {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-stop
+		migration.StopRun(sig.String())
+		zap.L().Warn("Stop requested, suspending polling. The batch jobs keep running and the next task resumes them",
+			zap.String("signal", sig.String()),
+			zap.String("stateFile", args.StateFile),
+			zap.String("stateTable", args.StateTable),
+		)
+		util.ZapLogSync()
+		os.Exit(util.ExitStopped)
+	}()
+
+	pending, err := migration.PendingRun(args.StateFile, args.StateTable, args.SourceRegion)
+	if err != nil {
+		zap.L().Error("Unable to read the state of a previous task", zap.Error(err))
+		return util.ExitFailed
+	}
+	if pending {
+		zap.L().Info("Resuming the run a previous task left unfinished", zap.String("stateFile", args.StateFile))
+		err = migration.Resume(args.StateFile, args.StateTable, args.SourceRegion, args.Quiet, args.Heartbeat)
+	} else {
+		err = migration.Run(args)
+	}
+	if err != nil && !errors.Is(err, migration.ErrThresholdNotMet) {
+		zap.L().Error("Migration failed", zap.Error(err))
+	}
+	return exitCode(err)
+}
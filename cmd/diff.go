@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+	"s3migration/migration"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	diffDest   string
+	diffList   bool
+	diffETag   bool
+	diffOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(diffCommand)
+	diffCommand.Flags().StringVar(&diffDest, destinationBucketArgName, "", "Destination bucket name")
+	diffCommand.Flags().BoolVar(&diffList, listModeArgName, false, "[Optional] List both buckets instead of reading their latest inventory reports")
+	diffCommand.Flags().BoolVar(&diffETag, compareETagArgName, false, "[Optional] Also report objects of the same size whose ETags differ. Multipart ETags are skipped, KMS encrypted copies have different ETags")
+	diffCommand.Flags().StringVar(&diffOutput, outputArgName, "", "[Optional] File to write the CSV of missing and differing objects to, defaults to stdout")
+	_ = diffCommand.MarkFlagRequired(destinationBucketArgName)
+}
+
+var diffCommand = &cobra.Command{
+	Use:          "diff",
+	Short:        "List objects missing in the destination bucket or differing from the source, without creating any job",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return requireFlags(cmd, regionArgName, sourceBucketArgName)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var w io.Writer = os.Stdout
+		if diffOutput != "" {
+			f, err := os.Create(diffOutput)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		_, err := migration.Diff(migration.DiffArgs{
+			SourceRegion:      sourceRegion,
+			SourceBucket:      migrationSrc,
+			DestinationBucket: diffDest,
+			ConfigName:        inventoryConfig,
+			InventoryBucket:   inventoryDest,
+			ListMode:          diffList,
+			CompareETag:       diffETag,
+		}, w)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+	TraverseChildren: true,
+}
@@ -10,20 +10,38 @@ import (
 // Subcommand argument values
 var (
 	localInventoryFile string
+	dryRunDest         string
 )
 
 func init() {
 	rootCmd.AddCommand(dryRunCommand)
 	dryRunCommand.Flags()
 	dryRunCommand.Flags().StringVar(&localInventoryFile, localInventoryArgName, "", "Destination bucket name")
+	dryRunCommand.Flags().StringVar(&kmsID, kmsIDArgName, migration.KmsSSES3, "[Optional] KMS key ID or ARN the run will encrypt manifests with, to check the role can use it")
+	dryRunCommand.Flags().StringVar(&planFile, planArgName, "", "[Optional] Write the resolved checks, inventory manifest, S3 Select expression and cost estimate to this file as JSON. - writes to stdout")
+	dryRunCommand.Flags().StringVar(&dryRunDest, destinationBucketArgName, "", "[Optional] Destination bucket name, to include inter-region transfer and KMS requests in the cost estimate")
 }
 
 var dryRunCommand = &cobra.Command{
 	Use:          "dry-run",
 	Short:        "Dry Run S3 migration, it validates the required setting to run the actual operation",
 	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return requireFlags(cmd, regionArgName, sourceBucketArgName, accountIdArgName, roleArgName)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := migration.DryRun(sourceRegion, migrationAcctId, migrationSrc, migrationRole, inventoryConfig, localInventoryFile); err != nil {
+		if err := migration.DryRun(migration.DryRunArgs{
+			SourceRegion:      sourceRegion,
+			AccountID:         migrationAcctId,
+			SourceBucket:      migrationSrc,
+			DestinationBucket: dryRunDest,
+			RoleArn:           migrationRole,
+			ConfigName:        inventoryConfig,
+			LocalFile:         localInventoryFile,
+			InventoryBucket:   inventoryDest,
+			KmsID:             kmsID,
+			PlanFile:          planFile,
+		}); err != nil {
 			log.Fatal(err)
 		}
 	},
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"s3migration/migration"
+	"s3migration/util"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var initOutput string
+
+func init() {
+	rootCmd.AddCommand(initCommand)
+	initCommand.Flags().StringVar(&initOutput, outputArgName, "s3migration.json", "[Optional] Config file to write, read by run --config-file")
+}
+
+var initCommand = &cobra.Command{
+	Use:          "init",
+	Short:        "Set up a first migration interactively, writing a config file and the equivalent command line",
+	SilenceUsage: false,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runWizard(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// Prompts for the answers to init, asking again until each answer is valid
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// Ask the question until validate accepts the answer, or def when the answer is empty, returning the
+// value validate normalizes it to.  Reaching the end of the input, eg. with Ctrl-D, gives up.
+func (w *wizard) ask(question, def string, validate func(string) (string, error)) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", question)
+		}
+		line, err := w.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			fmt.Fprintln(w.out)
+			return "", errors.New("init stopped before every question was answered")
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		value, verr := validate(answer)
+		if verr == nil {
+			return value, nil
+		}
+		fmt.Fprintf(w.out, "  %v\n", verr)
+	}
+}
+
+func (w *wizard) confirm(question string) (bool, error) {
+	answer, err := w.ask(question+" [y/N]", "", func(v string) (string, error) {
+		switch strings.ToLower(v) {
+		case "y", "yes":
+			return "y", nil
+		case "", "n", "no":
+			return "n", nil
+		}
+		return "", fmt.Errorf("answer y or n")
+	})
+	return answer == "y", err
+}
+
+// Ask for the source and destination buckets, account and role of a migration, checking the buckets with
+// HeadBucket as they're given, then write them as a config file and print the equivalent command lines.
+// The flags given to init are the default answers.
+func runWizard(in io.Reader, out io.Writer) error {
+	w := &wizard{in: bufio.NewReader(in), out: out}
+	if _, err := os.Stat(initOutput); err == nil {
+		overwrite, err := w.confirm(fmt.Sprintf("%s already exists, overwrite it?", initOutput))
+		if err != nil || !overwrite {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "Answer a few questions to set up a migration, writing the answers to %s.\n", initOutput)
+
+	var region string
+	source, err := w.ask("Source bucket", migrationSrc, func(v string) (string, error) {
+		if v == "" {
+			return "", errors.New("the source bucket is required")
+		}
+		location, err := migration.LocateBucket(v)
+		switch {
+		case err != nil:
+			return "", fmt.Errorf("unable to check bucket %s: %v", v, err)
+		case !location.Exists:
+			return "", fmt.Errorf("bucket %s doesn't exist", v)
+		case !location.Readable:
+			return "", fmt.Errorf("bucket %s can't be read with these credentials, which inventory and the manifests need", v)
+		}
+		// The jobs run, and the inventory is configured, in the source bucket's region
+		region = location.Region
+		if region == "" {
+			region = sourceRegion
+		}
+		return v, nil
+	})
+	if err != nil {
+		return err
+	}
+	if region == "" {
+		if region, err = w.ask("AWS region of the source bucket", "", func(v string) (string, error) {
+			if v == "" {
+				return "", errors.New("the region is required")
+			}
+			return v, nil
+		}); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "  Bucket %s is in %s, the batch jobs will run there.\n", source, region)
+
+	createDestination := false
+	destination, err := w.ask("Destination bucket, or Multi-Region Access Point ARN or alias", migrationDest, func(v string) (string, error) {
+		createDestination = false
+		switch {
+		case v == "":
+			return "", errors.New("the destination bucket is required")
+		case v == source:
+			return "", errors.New("the destination must be another bucket than the source")
+		case util.IsMultiRegionAccessPoint(v) || util.IsDirectoryBucket(v):
+			fmt.Fprintf(out, "  %s isn't checked, make sure it exists before running.\n", v)
+			return v, nil
+		}
+		location, err := migration.LocateBucket(v)
+		switch {
+		case err != nil:
+			return "", fmt.Errorf("unable to check bucket %s: %v", v, err)
+		case !location.Exists:
+			create, cerr := w.confirm(fmt.Sprintf("  Bucket %s doesn't exist. Create it, with the source bucket's settings, when the migration runs?", v))
+			if cerr != nil || !create {
+				return "", fmt.Errorf("bucket %s doesn't exist", v)
+			}
+			createDestination = true
+		case !location.Readable:
+			fmt.Fprintf(out, "  Bucket %s exists but can't be read with these credentials, eg. as another account owns it. The role needs write access to it.\n", v)
+		case location.Region != "" && location.Region != region:
+			fmt.Fprintf(out, "  Bucket %s is in %s, the copy will transfer data between regions.\n", v, location.Region)
+		}
+		return v, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	account, err := w.ask("AWS account ID the batch jobs run in, usually the source bucket's", migrationAcctId, func(v string) (string, error) {
+		if ok, _ := regexp.MatchString(`^\d{12}$`, v); !ok {
+			return "", fmt.Errorf("'%s' isn't an account ID, which is a 12 digit number", v)
+		}
+		return v, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	roleName := ""
+	role, err := w.ask("ARN of the role S3 Batch Operations assumes, or the name of a role to create", migrationRole, func(v string) (string, error) {
+		roleName = ""
+		switch {
+		case strings.HasPrefix(v, "arn:"):
+			if !strings.Contains(v, ":role/") || !roleArnPattern.MatchString(v) {
+				return "", fmt.Errorf("'%s' isn't a role ARN, eg. arn:aws:iam::%s:role/BatchOperationsCopyRole", v, account)
+			}
+			if roleAccount := strings.Split(v, ":")[4]; roleAccount != account {
+				return "", fmt.Errorf("role %s is in account %s, it must be in the account the jobs run in, %s", v, roleAccount, account)
+			}
+		case roleNamePattern.MatchString(v):
+			if util.IsMultiRegionAccessPoint(destination) || util.IsDirectoryBucket(destination) {
+				return "", errors.New("a role can't be created for a Multi-Region Access Point or directory bucket destination, give the ARN of one created by hand")
+			}
+			roleName = v
+			fmt.Fprintf(out, "  Role %s will be created, or updated, with least-privilege access for the jobs when the migration runs.\n", v)
+		default:
+			return "", fmt.Errorf("'%s' isn't a role ARN or a role name", v)
+		}
+		return v, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Flag names and values in the order they are written on the command line
+	flags := [][2]string{{regionArgName, region}, {sourceBucketArgName, source}, {destinationBucketArgName, destination},
+		{accountIdArgName, account}}
+	if roleName != "" {
+		flags = append(flags, [2]string{createRoleArgName, roleName})
+	} else {
+		flags = append(flags, [2]string{roleArgName, role})
+	}
+	if createDestination {
+		flags = append(flags, [2]string{createDestArgName, "true"})
+	}
+	// Written like a --config-parameter value, so the file can be stored in SSM for container runs too
+	values := map[string]any{}
+	for _, f := range flags {
+		if f[1] == "true" {
+			values[f[0]] = true
+		} else {
+			values[f[0]] = f[1]
+		}
+	}
+	body, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(initOutput, append(body, '\n'), 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\nWrote %s.\n", initOutput)
+	if roleName == "" {
+		fmt.Fprintf(out, "Check the role, inventory and cost first with:\n  %s\n", commandLine("dry-run", flags, createDestArgName))
+	}
+	fmt.Fprintf(out, "Run the migration with:\n  s3migration run --%s %s\nor the equivalent:\n  %s\n",
+		configFileArgName, shellWord(initOutput), commandLine("run", flags))
+	return nil
+}
+
+// The s3migration command line of the subcommand with the flags, except those skipped
+func commandLine(subcommand string, flags [][2]string, skip ...string) string {
+	words := []string{"s3migration", subcommand}
+	for _, f := range flags {
+		switch {
+		case slices.Contains(skip, f[0]):
+		case f[1] == "true":
+			words = append(words, "--"+f[0])
+		default:
+			words = append(words, "--"+f[0], shellWord(f[1]))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// Quote a word for a POSIX shell when it has characters the shell would interpret
+func shellWord(s string) string {
+	if ok, _ := regexp.MatchString(`^[\w@%+=:,./-]+$`, s); ok {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
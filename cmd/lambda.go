@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"log"
+	"s3migration/migration"
+	"s3migration/util"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(lambdaCommand)
+}
+
+var lambdaCommand = &cobra.Command{
+	Use:          "lambda",
+	Short:        "Serve invocations running a migration with the arguments in the event, as the bootstrap of a Lambda function with a custom runtime",
+	SilenceUsage: false,
+	Run: func(cmd *cobra.Command, args []string) {
+		runtime, err := util.NewLambdaRuntime()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runtime.Serve(migration.HandleRunInvocation); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"s3migration/migration"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	planFormat string
+	planOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(planCommand)
+	planCommand.AddCommand(planExportCommand)
+	planExportCommand.Flags().StringVar(&planFormat, formatArgName, migration.PlanFormatAWSCLI, "[Optional] Export format, awscli or json")
+	planExportCommand.Flags().StringVar(&planOutput, outputArgName, "", "[Optional] File to write the export to, defaults to stdout")
+}
+
+var planCommand = &cobra.Command{
+	Use:   "plan",
+	Short: "Work with the batch job plan recorded in the state file, see run --plan-only",
+}
+
+var planExportCommand = &cobra.Command{
+	Use:          "export",
+	Short:        "Export the batch job plan, eg. as a script of equivalent AWS CLI commands",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains(migration.PlanFormats, planFormat) {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+				formatArgName, planFormat, strings.Join(migration.PlanFormats, ", "))
+		}
+		if stateFile == "" && migrationSrc == "" {
+			return fmt.Errorf("either '%s' or '%s' is required to locate the state file", stateFileArgName, sourceBucketArgName)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var w io.Writer = os.Stdout
+		if planOutput != "" {
+			f, err := os.OpenFile(planOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := migration.ExportPlan(stateFilePath(), planFormat, w); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"s3migration/migration"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	programDir    string
+	programOutput string
+	summaryReport string
+	summaryFormat string
+	summaryOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(reportCommand)
+	reportCommand.AddCommand(reportProgramCommand, reportSummaryCommand)
+	reportProgramCommand.Flags().StringVar(&programDir, dirArgName, ".", "[Optional] Workspace directory holding the state files and reports of the runs")
+	reportProgramCommand.Flags().StringVar(&programOutput, outputArgName, "", "[Optional] File to write the HTML dashboard to, defaults to stdout")
+	reportSummaryCommand.Flags().StringVar(&summaryReport, reportFileArgName, "", "Migration report written by run --report-file")
+	reportSummaryCommand.Flags().StringVar(&summaryFormat, formatArgName, migration.SummaryFormatHTML, "[Optional] Summary format, html or csv")
+	reportSummaryCommand.Flags().StringVar(&summaryOutput, outputArgName, "", "[Optional] File to write the summary to, defaults to stdout")
+	_ = reportSummaryCommand.MarkFlagRequired(reportFileArgName)
+}
+
+var reportCommand = &cobra.Command{
+	Use:   "report",
+	Short: "Summarize migration runs from their state files and reports",
+}
+
+var reportProgramCommand = &cobra.Command{
+	Use:          "program",
+	Short:        "Write a single page HTML dashboard summarizing every run in a workspace",
+	SilenceUsage: false,
+	Run: func(cmd *cobra.Command, args []string) {
+		var w io.Writer = os.Stdout
+		if programOutput != "" {
+			f, err := os.Create(programOutput)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := migration.WriteProgramDashboard(programDir, w); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var reportSummaryCommand = &cobra.Command{
+	Use:          "summary",
+	Short:        "Summarize a completed run's jobs, failures and threshold outcome as HTML or CSV, eg. for a change ticket",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains(migration.SummaryFormats, summaryFormat) {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+				formatArgName, summaryFormat, strings.Join(migration.SummaryFormats, ", "))
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		report, err := migration.LoadReport(summaryReport)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var w io.Writer = os.Stdout
+		if summaryOutput != "" {
+			f, err := os.Create(summaryOutput)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := migration.WriteReportSummary(report, summaryFormat, w); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -3,6 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"s3migration/util"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -14,13 +17,132 @@ const (
 	destinationBucketArgName = "destinationbucket"
 	accountIdArgName         = "account"
 	roleArgName              = "role"
+	createRoleArgName        = "create-role"
 	retryArgName             = "retry"
 	inventoryConfigArgName   = "inventoryconfig"
 	localInventoryArgName    = "local-inventory"
 	startAtArgName           = "start"
 	endAtArgName             = "end"
 	latestOnlyArgName        = "latest-only"
+	orderVersionsArgName     = "order-versions"
+	maxVersionsArgName       = "max-versions"
 	kmsIDArgName             = "kms-id"
+	quietArgName             = "quiet"
+	logLevelArgName          = "log-level"
+	logFormatArgName         = "log-format"
+	logFileArgName           = "log-file"
+	logFileMaxSizeArgName    = "log-file-max-size"
+	logFileMaxAgeArgName     = "log-file-max-age"
+	logFileBackupsArgName    = "log-file-max-backups"
+	logSampleInitialArgName  = "log-sample-initial"
+	logSampleAfterArgName    = "log-sample-thereafter"
+	healthAddrArgName        = "health-addr"
+	livenessFileArgName      = "liveness-file"
+	healthStaleAfterArgName  = "health-stale-after"
+	confirmArgName           = "confirm"
+	pollIntervalArgName      = "poll-interval"
+	pollTimeoutArgName       = "poll-timeout"
+	reportFileArgName        = "report-file"
+	cannedACLArgName         = "canned-acl"
+	accessAnalyzerArgName    = "access-analyzer"
+	analyzerArnArgName       = "analyzer-arn"
+	maxWaitArgName           = "max-wait"
+	stateFileArgName         = "state-file"
+	resumeArgName            = "resume"
+	listModeArgName          = "list-mode"
+	listInventoryArgName     = "list-inventory"
+	contentTypeArgName       = "content-type"
+	keysFileArgName          = "keys-file"
+	keysStdinArgName         = "keys-stdin"
+	metadataArgName          = "metadata"
+	headConcurrencyArgName   = "head-concurrency"
+	planOnlyArgName          = "plan-only"
+	planArgName              = "plan"
+	chunksArgName            = "chunks"
+	manifestFormatArgName    = "manifest-format"
+	manifestsOlderArgName    = "manifests-older-than"
+	cleanupOlderArgName      = "cleanup-older-than"
+	dryRunArgName            = "dry-run"
+	driftSampleArgName       = "drift-sample"
+	driftKeysFileArgName     = "drift-keys-file"
+	manifestGeneratorArgName = "manifest-generator"
+	manifestArnArgName       = "manifest-arn"
+	manifestETagArgName      = "manifest-etag"
+	replicationStatusArgName = "replication-status"
+	formatArgName            = "format"
+	outputArgName            = "output"
+	dirArgName               = "dir"
+	inventoryFreqArgName     = "inventory-frequency"
+	inventoryFieldsArgName   = "inventory-fields"
+	replayDeletesArgName     = "replay-deletes"
+	analyzeMarkersArgName    = "analyze-delete-markers"
+	purgeEligibleArgName     = "purge-eligible-file"
+	modeArgName              = "mode"
+	operationArgName         = "operation"
+	moveArgName              = "move"
+	moveReportArgName        = "move-report"
+	objectLockArgName        = "preserve-object-lock"
+	timelineArgName          = "timeline"
+	preserveACLArgName       = "preserve-acl"
+	grantArgName             = "grant"
+	grantsFileArgName        = "grants-file"
+	thresholdsArgName        = "thresholds"
+	successThresholdArgName  = "success-threshold"
+	maxFailedArgName         = "max-failed-objects"
+	cancelRatioArgName       = "cancel-failure-ratio"
+	cancelMinTasksArgName    = "cancel-min-tasks"
+	checksumArgName          = "checksum-algorithm"
+	metricsNamespaceArgName  = "metrics-namespace"
+	metricsFileArgName       = "metrics-file"
+	assertOwnershipArgName   = "assert-destination-ownership"
+	eventBusArgName          = "event-bus"
+	eventStreamArgName       = "event-stream"
+	accessGrantsArgName      = "access-grants"
+	cronArgName              = "cron"
+	historyDirArgName        = "history-dir"
+	keepRunsArgName          = "keep-runs"
+	overlapArgName           = "overlap"
+	intervalArgName          = "interval"
+	untilArgName             = "until"
+	onInventoryArgName       = "on-inventory"
+	checkIntervalArgName     = "check-interval"
+	stateTableArgName        = "state-table"
+	functionArnArgName       = "function-arn"
+	sfnInputArgName          = "step-functions-input"
+	containerArgName         = "container"
+	configParameterArgName   = "config-parameter"
+	configFileArgName        = "config-file"
+	noWaitArgName            = "no-wait"
+	jobIDArgName             = "job-id"
+	failureReportArgName     = "failure-report"
+	failedObjectsArgName     = "failed-objects-file"
+	cleanupInventoryArgName  = "cleanup-inventory"
+	inventoryArgName         = "inventory"
+	inventoryDestArgName     = "inventory-dest-bucket"
+	inventoryPolicyArgName   = "configure-inventory-policy"
+	localFilterArgName       = "local-filter"
+	filterSQLArgName         = "filter-sql"
+	modifiedAfterArgName     = "modified-after"
+	modifiedBeforeArgName    = "modified-before"
+	timezoneArgName          = "timezone"
+	selectConcurrencyArgName = "select-concurrency"
+	encryptionStatusArgName  = "encryption-status"
+	skipReplicatedArgName    = "skip-replicated"
+	skipExistingArgName      = "skip-existing"
+	compareETagArgName       = "compare-etag"
+	maxAPITPSArgName         = "max-api-tps"
+	sdkMaxAttemptsArgName    = "sdk-max-attempts"
+	sdkRetryModeArgName      = "sdk-retry-mode"
+	requestPayerArgName      = "request-payer"
+	createDestArgName        = "create-destination"
+	bucketConfigsArgName     = "configs"
+	lifecycleFileArgName     = "lifecycle-file"
+	lifecycleExportArgName   = "export-lifecycle"
+	policyMapArgName         = "policy-map"
+	policyFileArgName        = "policy-file"
+	policyExportArgName      = "export-policy"
+	logTargetBucketArgName   = "log-target-bucket"
+	replaceMetadataArgName   = "replace-metadata"
 )
 
 // Persistent argument values
@@ -30,7 +152,15 @@ var (
 	migrationSrc    string
 	migrationRole   string
 	inventoryConfig string
+	inventoryDest   string
 	kmsID           string
+	quiet           bool
+	logOptions      util.LogOptions
+	healthAddr      string
+	livenessFile    string
+	healthStale     time.Duration
+	stateFile       string
+	stateTable      string
 )
 
 func init() {
@@ -40,14 +170,66 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&migrationAcctId, accountIdArgName, "", "AWS account ID where S3 Batch job will run (typically account with source bucket)")
 	rootCmd.PersistentFlags().StringVar(&migrationRole, roleArgName, "", "Role for batch operation to access cross account bucket")
 	rootCmd.PersistentFlags().StringVar(&inventoryConfig, inventoryConfigArgName, "bulk-copy-inventory", "Name of inventory configuration")
+	rootCmd.PersistentFlags().StringVar(&inventoryDest, inventoryDestArgName, "", "[Optional] Bucket inventory reports, filtered manifests and job reports are written to instead of the source bucket, eg. when the source bucket is read-only")
+	rootCmd.PersistentFlags().BoolVar(&quiet, quietArgName, false, "[Optional] Only log job and manifest state transitions while polling")
+	rootCmd.PersistentFlags().StringVar(&logOptions.Level, logLevelArgName, "info", "[Optional] Minimum level of the log entries written: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logOptions.Format, logFormatArgName, util.LogFormatJSON, "[Optional] Log encoding, 'json' or 'console' for human-friendly lines in a terminal")
+	rootCmd.PersistentFlags().StringVar(&logOptions.File, logFileArgName, "", "[Optional] Also write the log, as JSON and unsampled, to this file, which is rotated by size and age")
+	rootCmd.PersistentFlags().IntVar(&logOptions.FileMaxSize, logFileMaxSizeArgName, 100, "[Optional] Rotate the log file once it reaches this many MB, 0 disables")
+	rootCmd.PersistentFlags().DurationVar(&logOptions.FileMaxAge, logFileMaxAgeArgName, 24*time.Hour, "[Optional] Rotate the log file once it has been written to for this long, 0 disables")
+	rootCmd.PersistentFlags().IntVar(&logOptions.FileMaxBackups, logFileBackupsArgName, 7, "[Optional] Number of rotated log files kept, 0 keeps them all")
+	rootCmd.PersistentFlags().IntVar(&logOptions.SamplingInitial, logSampleInitialArgName, 100, "[Optional] Number of identical log entries per second written before sampling starts")
+	rootCmd.PersistentFlags().IntVar(&logOptions.SamplingThereafter, logSampleAfterArgName, 100, "[Optional] Once sampling starts, write every Nth identical log entry, 0 disables sampling")
+	rootCmd.PersistentFlags().StringVar(&healthAddr, healthAddrArgName, "", "[Optional] Address to serve the /healthz and Prometheus /metrics endpoints on, eg. :8080")
+	rootCmd.PersistentFlags().StringVar(&livenessFile, livenessFileArgName, "", "[Optional] File touched on every polling loop iteration")
+	rootCmd.PersistentFlags().DurationVar(&healthStale, healthStaleAfterArgName, 2*time.Hour, "[Optional] Report unhealthy when no polling loop iteration completed within this duration")
+	rootCmd.PersistentFlags().StringVar(&stateFile, stateFileArgName, "", "[Optional] File recording in-flight batch jobs, defaults to s3migration-<sourcebucket>.state.json")
+	rootCmd.PersistentFlags().StringVar(&stateTable, stateTableArgName, "", "[Optional] DynamoDB table the state is also checkpointed to, keyed by the state file path, so a run can be resumed from another machine")
+}
 
-	_ = rootCmd.MarkPersistentFlagRequired(regionArgName)
-	_ = rootCmd.MarkPersistentFlagRequired(sourceBucketArgName)
-	_ = rootCmd.MarkPersistentFlagRequired(accountIdArgName)
-	_ = rootCmd.MarkPersistentFlagRequired(roleArgName)
+// Persistent flags are shared by every subcommand, so they can't be marked as required
+// on the root command when some subcommands (eg. watch) don't need them
+func requireFlags(cmd *cobra.Command, names ...string) error {
+	missing := []string{}
+	for _, name := range names {
+		if !cmd.Flags().Changed(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(`required flag(s) "%s" not set`, strings.Join(missing, `", "`))
+	}
+	return nil
 }
 
-func initConfig() {}
+// Path of the state file for the current source bucket
+func stateFilePath() string {
+	if stateFile != "" {
+		return stateFile
+	}
+	return fmt.Sprintf("s3migration-%s.state.json", migrationSrc)
+}
+
+func initConfig() {
+	if err := util.InitLogger(logOptions); err != nil {
+		fmt.Println(err)
+		os.Exit(util.ExitInvalidArgs)
+	}
+}
+
+// Start the health endpoint and/or liveness file heartbeat when requested.
+// Returns nil when neither is configured.
+func startHeartbeat() *util.Heartbeat {
+	if healthAddr == "" && livenessFile == "" {
+		return nil
+	}
+	hb := util.NewHeartbeat(healthStale, livenessFile)
+	if healthAddr != "" {
+		hb.ListenAndServe(healthAddr)
+	}
+	hb.Beat()
+	return hb
+}
 
 var rootCmd = &cobra.Command{
 	Use:              "s3-migration",
@@ -58,6 +240,6 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(util.ExitInvalidArgs)
 	}
 }
@@ -3,13 +3,20 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
+	"path"
 	"regexp"
 	"s3migration/migration"
 	"s3migration/util"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -20,19 +27,198 @@ var (
 	latestOnly    string
 	startDt       time.Time
 	endDt         time.Time
+	confirmMode   string
+	pollInterval  time.Duration
+	pollTimeout   time.Duration
+	reportFile    string
+	cannedACL     string
+	checkAccess   bool
+	analyzerArn   string
+	maxWait       time.Duration
+	listMode      bool
+	listInventory bool
+	createRole    string
+	localInput    string
+	keysFile      string
+	keysStdin     bool
+	planOnly      bool
+	planFile      string
+	configFile    string
+	chunks        int
+	manifestFmt   string
+	cleanupAge    string
+	cleanupOlder  time.Duration
+	driftSample   int
+	driftKeysFile string
+	contentTypes  []string
+	metadata      map[string]string
+	headWorkers   int
+	useGenerator  bool
+	manifestArn   string
+	manifestETag  string
+	replStatuses  []string
+	inventoryFreq string
+	invFields     []string
+	replayDeletes bool
+	analyzeMarks  bool
+	purgeFile     string
+	jobMode       string
+	lambdaArn     string
+	move          bool
+	moveReport    string
+	objectLock    bool
+	timelineAge   string
+	timeline      time.Duration
+	preserveACL   bool
+	grantArgs     []string
+	grantsFile    string
+	grants        []s3controltypes.S3Grant
+	checksumAlgo  string
+	replaceMeta   map[string]string
+	newMetadata   *s3controltypes.S3ObjectMetadata
+	metricsNS     string
+	metricsFile   string
+	ownershipName string
+	eventBus      string
+	eventStream   string
+	accessGrants  bool
+	sfnInput      string
+	container     bool
+	configParam   string
+	noWait        bool
+	failureReport bool
+	failedObjects string
+	cleanupInv    bool
+	invPolicy     bool
+	localFilter   bool
+	filterSQL     string
+	modAfter      string
+	modBefore     string
+	timezone      string
+	modified      util.ModifiedRange
+	selectWorkers int
+	encStatuses   []string
+	skipRepl      bool
+	maxAPITPS     float64
+	maxAttempts   int
+	retryMode     string
+	requestPayer  string
+	createDest    bool
+	successRatio  float32
+	maxFailed     int64
+	cancelRatio   float64
+	cancelMin     int64
+	orderVersions bool
+	maxVersions   int
+	skipExisting  bool
+)
+
+// Values accepted by --role, and role names accepted by --create-role
+var (
+	roleArnPattern  = regexp.MustCompile(`^(?:\d{12}|(arn:(aws|aws-us-gov|aws-cn):iam::\d{12}(?:|:(?:role\/[0-9A-Za-z\+\.@_,-]{1,64}))))$`)
+	roleNamePattern = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
 )
 
 func init() {
 	rootCmd.AddCommand(runCommand)
 
-	runCommand.Flags().StringVar(&migrationDest, destinationBucketArgName, "", "Destination bucket name")
+	runCommand.Flags().StringVar(&migrationDest, destinationBucketArgName, "", "Destination bucket name, including directory buckets, or Multi-Region Access Point ARN or alias, eg. mfzwi23gnjvgw.mrap")
 	runCommand.Flags().StringVar(&retryInterval, retryArgName, "1h", "[Optional] Retry duration if inventory not available, eg. 1h, 30m, 10s")
+	runCommand.Flags().DurationVar(&maxWait, maxWaitArgName, 0, "[Optional] Maximum time to wait for an inventory manifest, eg. 48h. Defaults to 24 retry intervals")
 	runCommand.Flags().StringVar(&latestOnly, latestOnlyArgName, "", "[Optional] Copy only Latest/Non-latest version objects, eg. Yes/No")
 	runCommand.Flags().StringVar(&startAt, startAtArgName, "", "[Optional] Start Datetime filter against object last updated date, eg '2023-09-30 12:00:00'")
 	runCommand.Flags().StringVar(&endAt, endAtArgName, "", "[Optional] End Datetime filter against object last updated date, eg '2023-12-31 12:00:00'")
-	runCommand.Flags().StringVar(&kmsID, kmsIDArgName, "SSE-S3", "[Optional] KMS key id")
+	runCommand.Flags().StringVar(&kmsID, kmsIDArgName, migration.KmsSSES3, "[Optional] KMS key ID or ARN the filtered manifests and other files the tool uploads are encrypted with (SSE-KMS), SSE-S3 by default")
+	runCommand.Flags().StringVar(&confirmMode, confirmArgName, "", "[Optional] Require job confirmation before it runs, --confirm or --confirm=prompt asks on stdin, --confirm=external waits for activation elsewhere")
+	runCommand.Flags().DurationVar(&pollInterval, pollIntervalArgName, time.Minute, "[Optional] Interval between batch job status checks, eg. 30s, 5m")
+	runCommand.Flags().DurationVar(&pollTimeout, pollTimeoutArgName, 0, "[Optional] Maximum time to wait for a batch job to complete, eg. 12h. Waits forever by default")
+	runCommand.Flags().StringVar(&reportFile, reportFileArgName, "", "[Optional] Write the final migration report, including per-phase timings, to this JSON file")
+	runCommand.Flags().StringVar(&cannedACL, cannedACLArgName, migration.CannedACLAuto, "[Optional] Canned ACL for copied objects, eg. none, private, bucket-owner-full-control. auto uses bucket-owner-full-control when destination ownership is enforced")
+	runCommand.Flags().BoolVar(&checkAccess, accessAnalyzerArgName, false, "[Optional] Check the destination bucket policy with IAM Access Analyzer before completing")
+	runCommand.Flags().StringVar(&analyzerArn, analyzerArnArgName, "", "[Optional] Access Analyzer ARN used to list active external access findings for the destination bucket")
+	runCommand.Flags().BoolVar(&listMode, listModeArgName, false, "[Optional] Build the batch manifest by listing the source bucket instead of waiting for an inventory report")
+	runCommand.Flags().StringVar(&createRole, createRoleArgName, "", "[Optional] Create, or update, an IAM role of this name with least-privilege access for the jobs and use it instead of --role")
+	runCommand.Flags().BoolVar(&listInventory, listInventoryArgName, false, "[Optional] Build an inventory report, with the version stacks and delete markers of a versioned bucket, by listing the source bucket instead of waiting for S3 to deliver one")
+	runCommand.Flags().StringVar(&localInput, localInventoryArgName, "", "[Optional] Build the batch job from a local inventory manifest.json, with its data files in the same directory, instead of configuring inventory")
+	runCommand.Flags().StringVar(&keysFile, keysFileArgName, "", "[Optional] Copy only the objects listed in this file, one key or key,versionId per line, instead of using inventory. - reads standard input")
+	runCommand.Flags().BoolVar(&keysStdin, keysStdinArgName, false, "[Optional] Read the keys to copy from standard input, same as --keys-file -")
+	runCommand.Flags().BoolVar(&planOnly, planOnlyArgName, false, "[Optional] Build the manifests and record the batch job plan in the state file without creating any job")
+	runCommand.Flags().StringVar(&planFile, planArgName, "", "[Optional] Write the resolved plan, with the S3 Select expressions, CreateJob inputs and preflight results, to this file as JSON without creating any job, implies --plan-only. - writes to stdout")
+	runCommand.Flags().StringVar(&configFile, configFileArgName, "", "[Optional] Read the flags not given on the command line from this JSON file of flag names and values, eg. written by init")
+	runCommand.Flags().IntVar(&chunks, chunksArgName, 1, "[Optional] Split each batch job into up to this many concurrent jobs over key ranges with similar total bytes")
+	runCommand.Flags().StringVar(&manifestFmt, manifestFormatArgName, migration.ManifestFormatInventory, "[Optional] Format of the manifest filtered from inventory, inventory or batch (S3BatchOperations_CSV_20180820 with Bucket, Key and VersionId)")
+	runCommand.Flags().StringVar(&cleanupAge, cleanupOlderArgName, "", "[Optional] Before starting, delete manifests written by previous runs older than this age, eg. 7d, 36h")
+	runCommand.Flags().IntVar(&driftSample, driftSampleArgName, 0, "[Optional] Once copied, check this many objects per job for changes on the source during the migration, 0 disables")
+	runCommand.Flags().StringVar(&driftKeysFile, driftKeysFileArgName, "", "[Optional] Write the keys changed during the migration to this file, for an incremental pass with --keys-file")
+	runCommand.Flags().StringSliceVar(&contentTypes, contentTypeArgName, nil, "[Optional] Only copy objects whose Content-Type matches one of these patterns, eg. image/*")
+	runCommand.Flags().StringToStringVar(&metadata, metadataArgName, nil, "[Optional] Only copy objects whose user metadata matches these key=pattern pairs, eg. project=alpha*")
+	runCommand.Flags().IntVar(&headWorkers, headConcurrencyArgName, 16, "[Optional] Number of concurrent HeadObject calls used by the metadata filters and --preserve-object-lock")
+	runCommand.Flags().BoolVar(&useGenerator, manifestGeneratorArgName, false, "[Optional] Let S3 Batch Operations generate the manifest from the source bucket when the job is created instead of using inventory")
+	runCommand.Flags().StringVar(&manifestArn, manifestArnArgName, "", "[Optional] ARN of an existing inventory manifest.json or S3 Batch Operations CSV to copy the objects of as-is, skipping inventory and filtering")
+	runCommand.Flags().StringVar(&manifestETag, manifestETagArgName, "", "[Optional] ETag of the --manifest-arn object, read from the object when not given")
+	runCommand.Flags().StringSliceVar(&replStatuses, replicationStatusArgName, nil, "[Optional] With --manifest-generator, only copy objects with one of these replication statuses, eg. NONE,FAILED")
+	runCommand.Flags().StringVar(&inventoryFreq, inventoryFreqArgName, "daily", "[Optional] Frequency of the inventory configuration when the tool creates it, daily or weekly")
+	runCommand.Flags().StringSliceVar(&invFields, inventoryFieldsArgName, slices.Clone(migration.DefaultInventoryFields), "[Optional] Optional fields of the inventory configuration when the tool creates it, eg. add StorageClass,ObjectLockMode")
+	runCommand.Flags().BoolVar(&replayDeletes, replayDeletesArgName, false, "[Optional] Once copied, delete keys in the destination whose latest source version is a delete marker, mirroring the source version stack")
+	runCommand.Flags().BoolVar(&analyzeMarks, analyzeMarkersArgName, false, "[Optional] Report delete marker counts in the source bucket's version stacks, including markers eligible for purging")
+	runCommand.Flags().StringVar(&purgeFile, purgeEligibleArgName, "", "[Optional] Write the purge-eligible delete markers found by --analyze-delete-markers to this file as key,versionId")
+	runCommand.Flags().StringVar(&jobMode, modeArgName, migration.ModeCopy, "[Optional] Batch job operation, copy, replicate or lambda, also given as --operation. replicate creates a Batch Replication job for buckets with replication to the destination configured, preserving version IDs, and lambda invokes --function-arn for each object")
+	runCommand.Flags().StringVar(&lambdaArn, functionArnArgName, "", "[Optional] With --mode lambda, ARN of the Lambda function invoked for each object instead of copying it")
+	runCommand.Flags().BoolVar(&move, moveArgName, false, "[Optional] Once the copy meets the success threshold, delete the copied objects from the source bucket")
+	runCommand.Flags().StringVar(&moveReport, moveReportArgName, "", "[Optional] File listing each source object deleted by --move, defaults to <state-file>.deletions.csv")
+	runCommand.Flags().StringVar(&timelineAge, timelineArgName, "", "[Optional] Time the migration must complete in, eg. 14d, weighed by the engine recommendation of --plan-only")
+	runCommand.Flags().BoolVar(&objectLock, objectLockArgName, false, "[Optional] Copy each object's Object Lock retention and legal hold, read with HeadObject. The destination bucket must have Object Lock enabled")
+	runCommand.Flags().BoolVar(&preserveACL, preserveACLArgName, false, "[Optional] Copy each object's ACL, read with GetObjectAcl. The destination bucket must not enforce object ownership")
+	runCommand.Flags().StringArrayVar(&grantArgs, grantArgName, nil, "[Optional] Grant for copied objects instead of a canned ACL, as permission=type:identifier, eg. read=id:<canonical user ID>. Repeat for several grants")
+	runCommand.Flags().StringVar(&grantsFile, grantsFileArgName, "", "[Optional] JSON file of grants for copied objects, in the AccessControlGrants format of the S3 Batch Operations copy operation")
+	runCommand.Flags().StringVar(&checksumAlgo, checksumArgName, "", "[Optional] Additional checksum S3 calculates for copied objects, eg. SHA256, recorded in the report for verifying the copies")
+	runCommand.Flags().StringToStringVar(&replaceMeta, replaceMetadataArgName, nil, "[Optional] Replace the metadata of copied objects with these header=value pairs, eg. Content-Type=text/html,Cache-Control=max-age=3600 or x-amz-meta-project=alpha. Metadata not given is dropped")
+	runCommand.Flags().StringVar(&metricsNS, metricsNamespaceArgName, "", "[Optional] Publish objects copied and failed, bytes, job duration and success ratio as CloudWatch metrics in this namespace, in Embedded Metric Format")
+	runCommand.Flags().StringVar(&metricsFile, metricsFileArgName, "", "[Optional] File the --metrics-namespace records are appended to, for the CloudWatch agent. Defaults to stdout")
+	runCommand.Flags().StringVar(&ownershipName, assertOwnershipArgName, "", "[Optional] Fail before planning unless the destination bucket's object ownership is this, eg. bucket-owner-enforced, bucket-owner-preferred or object-writer")
+	runCommand.Flags().StringVar(&eventStream, eventStreamArgName, "", "[Optional] File, or fd:N file descriptor, to write phase, job status and error events to as newline delimited JSON")
+	runCommand.Flags().StringVar(&eventBus, eventBusArgName, "", "[Optional] Send MigrationStarted, JobCreated, JobCompleted, ThresholdFailed and MigrationCompleted events to this EventBridge event bus, eg. default")
+	runCommand.Flags().BoolVar(&accessGrants, accessGrantsArgName, false, "[Optional] Read and write the source and destination buckets' objects with temporary credentials from S3 Access Grants instead of the tool's own credentials")
+	runCommand.Flags().StringVar(&sfnInput, sfnInputArgName, "", "[Optional] Write the input of a 'stepfunctions' state machine execution migrating with these arguments to this file instead of running")
+	runCommand.Flags().BoolVar(&container, containerArgName, false, "[Optional] Run as a container task, eg. on Fargate: read unset flags from S3MIGRATION_<FLAG> environment variables and --config-parameter, and resume the run a stopped task left unfinished")
+	runCommand.Flags().StringVar(&configParam, configParameterArgName, "", "[Optional] With --container, SSM parameter holding a JSON object of flag values, eg. {\"chunks\": 4}")
+	runCommand.Flags().BoolVar(&noWait, noWaitArgName, false, "[Optional] Exit once the batch jobs are created, printing their IDs and the state file, and watch them later with 'watch --resume'")
+	runCommand.Flags().StringVar(&failedObjects, failedObjectsArgName, "", "[Optional] Write each failed task, with its error code and message, to this CSV file once the jobs complete. Implies --failure-report")
+	runCommand.Flags().BoolVar(&failureReport, failureReportArgName, false, "[Optional] Have each batch job write a completion report of its failed tasks, summarized by error code in the migration report")
+	runCommand.Flags().BoolVar(&cleanupInv, cleanupInventoryArgName, false, "[Optional] Once the copy meets the success threshold, delete the inventory configuration this run created and the reports it delivered")
+	runCommand.Flags().BoolVar(&invPolicy, inventoryPolicyArgName, false, "[Optional] Add the statement letting S3 deliver inventory reports to the inventory destination bucket's policy when it is missing, instead of failing")
+	runCommand.Flags().BoolVar(&localFilter, localFilterArgName, false, "[Optional] Download inventory data files and filter them locally instead of with S3 Select, eg. where S3 Select isn't available. Used automatically when S3 Select is refused")
+	runCommand.Flags().StringVar(&filterSQL, filterSQLArgName, "", "[Optional] S3 Select WHERE clause over inventory field names, combined with the other filters, eg. \"StorageClass <> 'GLACIER' AND CAST(Size AS INT) > 0\"")
+	runCommand.Flags().StringVar(&modAfter, modifiedAfterArgName, "", "[Optional] Only copy objects last modified at or after this time, eg. 2024-01-01, '2024-01-01 12:00:00' or 2024-01-01T12:00:00+01:00")
+	runCommand.Flags().StringVar(&modBefore, modifiedBeforeArgName, "", "[Optional] Only copy objects last modified before this time, excluding it, eg. 2024-02-01")
+	runCommand.Flags().StringVar(&timezone, timezoneArgName, "UTC", "[Optional] Time zone of date filter values without an offset, eg. Local or Europe/Paris")
+	runCommand.Flags().IntVar(&selectWorkers, selectConcurrencyArgName, 4, "[Optional] Number of inventory data files filtered with S3 Select at once")
+	runCommand.Flags().StringSliceVar(&encStatuses, encryptionStatusArgName, nil, "[Optional] Only copy objects with one of these inventory encryption statuses, eg. NOT-SSE to remediate unencrypted objects, or SSE-KMS")
+	runCommand.Flags().BoolVar(&skipRepl, skipReplicatedArgName, false, "[Optional] Skip objects whose replication status is COMPLETED, ie. already replicated to the destination")
+	runCommand.Flags().Float64Var(&maxAPITPS, maxAPITPSArgName, 0, "[Optional] Maximum AWS requests per second made by the tool, retries included, so large runs don't throttle production workloads. 0 is unlimited")
+	runCommand.Flags().IntVar(&maxAttempts, sdkMaxAttemptsArgName, 0, "[Optional] Maximum attempts of each AWS request, retries included, eg. 10 for long unattended runs. 0 keeps the SDK default of 3")
+	runCommand.Flags().StringVar(&retryMode, sdkRetryModeArgName, "", "[Optional] SDK retry mode, 'standard' or 'adaptive', which also slows requests down while they're throttled. Defaults to the SDK's")
+	runCommand.Flags().StringVar(&requestPayer, requestPayerArgName, "", "[Optional] Set to 'requester' to read inventories and manifests in Requester Pays buckets, paying for the requests")
+	runCommand.Flags().BoolVar(&createDest, createDestArgName, false, "[Optional] Create the destination bucket when it doesn't exist, with the source bucket's versioning, default encryption, object ownership and public access block")
+	runCommand.Flags().Float32Var(&successRatio, successThresholdArgName, 0.8, "[Optional] Ratio of objects, between 0 and 1, that must be copied for the migration to succeed, eg. 1 to require every object")
+	runCommand.Flags().Int64Var(&maxFailed, maxFailedArgName, 0, "[Optional] Fail the migration when more objects than this fail to copy, even when the success threshold is met. 0 disables")
+	runCommand.Flags().Float64Var(&cancelRatio, cancelRatioArgName, 0, "[Optional] Cancel a batch job and exit when more than this ratio of its completed tasks failed, eg. 0.5. 0 disables")
+	runCommand.Flags().Int64Var(&cancelMin, cancelMinTasksArgName, migration.DefaultCancelMinTasks, "[Optional] Tasks a batch job completes before --cancel-failure-ratio is checked")
+	runCommand.Flags().BoolVar(&orderVersions, orderVersionsArgName, false, "[Optional] Copy non-current versions in passes, oldest first, so destination version stacks keep the source's order")
+	runCommand.Flags().IntVar(&maxVersions, maxVersionsArgName, 0, "[Optional] Copy only the latest N versions of each key, ordered by the inventory's last modified dates. 0 copies every version")
+	runCommand.Flags().BoolVar(&skipExisting, skipExistingArgName, false, "[Optional] Skip objects already in the destination with the same size and ETag, eg. when rerunning after a partial failure")
+	runCommand.Flags().Lookup(confirmArgName).NoOptDefVal = migration.ConfirmPrompt
+	runCommand.Flags().SetNormalizeFunc(runFlagAlias)
+}
+
+// Other names run flags are given by, eg. --operation lambda for --mode lambda
+var runFlagAliases = map[string]string{operationArgName: modeArgName}
 
-	_ = runCommand.MarkFlagRequired(destinationBucketArgName)
+func runFlagAlias(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if flag, ok := runFlagAliases[name]; ok {
+		name = flag
+	}
+	return pflag.NormalizedName(name)
 }
 
 var runCommand = &cobra.Command{
@@ -43,31 +229,139 @@ var runCommand = &cobra.Command{
 		if _, err := time.ParseDuration(retryInterval); err != nil {
 			log.Fatalf("Invalid input param value '%s': '%s', error: %v", retryArgName, retryInterval, err)
 		}
-		var regSuccessThreshold float32 = 0.8
 		migrationArgs := migration.MigrationArgs{
 			SourceRegion:        sourceRegion,
 			AccountID:           migrationAcctId,
 			SourceBucket:        migrationSrc,
 			RoleArn:             migrationRole,
+			CreateRole:          createRole,
 			DestinationBucket:   migrationDest,
 			RetryInterval:       retryInterval,
+			MaxWait:             maxWait,
 			ConfigName:          inventoryConfig,
+			InventoryBucket:     inventoryDest,
+			InventoryPolicy:     invPolicy,
+			LocalFilter:         localFilter,
+			SelectConcurrency:   selectWorkers,
+			MaxAPITPS:           maxAPITPS,
+			SDKMaxAttempts:      maxAttempts,
+			SDKRetryMode:        retryMode,
+			RequestPayer:        requestPayer,
+			CreateDestination:   createDest,
+			FilterSQL:           filterSQL,
+			EncryptionStatuses:  encStatuses,
+			SkipReplicated:      skipRepl,
+			SkipExisting:        skipExisting,
 			LatestOnly:          latestOnly,
-			ReqSuccessThreshold: regSuccessThreshold,
+			OrderVersions:       orderVersions,
+			MaxVersions:         maxVersions,
+			ReqSuccessThreshold: successRatio,
+			MaxFailedObjects:    maxFailed,
+			CancelFailureRatio:  cancelRatio,
+			CancelMinTasks:      cancelMin,
 			KmsID:               kmsID,
 			Region:              sourceRegion,
 			StartDt:             startDt,
 			EndDt:               endDt,
+			Modified:            modified,
+			Quiet:               quiet,
+			Heartbeat:           startHeartbeat(),
+			ConfirmMode:         confirmMode,
+			PollInterval:        pollInterval,
+			PollTimeout:         pollTimeout,
+			ReportFile:          reportFile,
+			CannedACL:           cannedACL,
+			AccessAnalyzer:      checkAccess || analyzerArn != "",
+			AnalyzerArn:         analyzerArn,
+			StateFile:           stateFilePath(),
+			ListMode:            listMode,
+			ListInventory:       listInventory,
+			LocalInventory:      localInput,
+			KeysFile:            keysFile,
+			PlanOnly:            planOnly,
+			PlanFile:            planFile,
+			Chunks:              chunks,
+			ManifestFormat:      manifestFmt,
+			CleanupOlderThan:    cleanupOlder,
+			DriftSample:         driftSample,
+			DriftKeysFile:       driftKeysFile,
+			ManifestGenerator:   useGenerator,
+			ManifestArn:         manifestArn,
+			ManifestETag:        manifestETag,
+			ReplicationStatuses: replStatuses,
+			InventoryFrequency:  inventoryFreq,
+			InventoryFields:     invFields,
+			ReplayDeletes:       replayDeletes,
+			AnalyzeMarkers:      analyzeMarks,
+			PurgeEligibleFile:   purgeFile,
+			Mode:                jobMode,
+			FunctionArn:         lambdaArn,
+			Move:                move,
+			MoveReportFile:      moveReport,
+			PreserveObjectLock:  objectLock,
+			Timeline:            timeline,
+			PreserveACL:         preserveACL,
+			Grants:              grants,
+			ChecksumAlgorithm:   checksumAlgo,
+			NewMetadata:         newMetadata,
+			MetricsNamespace:    metricsNS,
+			MetricsFile:         metricsFile,
+			AssertOwnership:     migration.OwnershipNames[ownershipName],
+			EventBus:            eventBus,
+			EventStream:         eventStream,
+			AccessGrants:        accessGrants,
+			StateTable:          stateTable,
+			NoWait:              noWait,
+			FailureReport:       failureReport || failedObjects != "",
+			FailedObjectsFile:   failedObjects,
+			CleanupInventory:    cleanupInv,
+			MetadataFilter: &migration.MetadataFilter{
+				ContentTypes: contentTypes,
+				Metadata:     metadata,
+				Concurrency:  headWorkers,
+				Checkpoint:   stateFilePath() + ".metadata.csv",
+			},
 		}
-		if err := migration.Run(migrationArgs); err != nil {
-			log.Fatal(err)
+		if sfnInput != "" {
+			input, err := migration.NewExecutionInput(migrationArgs)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := os.WriteFile(sfnInput, input, 0600); err != nil {
+				log.Fatal(err)
+			}
+			return nil
 		}
+		if container {
+			os.Exit(runContainer(migrationArgs))
+		}
+		stopOnSignal()
+		exitOn(migration.Run(migrationArgs))
 		return nil
 	},
 	PreRunE: validateArgs,
 }
 
 func validateArgs(cmd *cobra.Command, args []string) error {
+	if container {
+		if err := applyContainerConfig(cmd); err != nil {
+			return err
+		}
+	} else if configParam != "" {
+		return fmt.Errorf("input arg '%s' requires '%s'", configParameterArgName, containerArgName)
+	}
+	if configFile != "" {
+		body, err := os.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("unable to read input arg '%s' file '%s': %w", configFileArgName, configFile, err)
+		}
+		if err := applyConfigValues(cmd.Flags(), fmt.Sprintf("input arg '%s' file '%s'", configFileArgName, configFile), string(body)); err != nil {
+			return err
+		}
+	}
+	if err := validateCreateRole(cmd); err != nil {
+		return err
+	}
 	// Validate latest-only flag
 	if strings.TrimSpace(latestOnly) != "" {
 		switch strings.ToUpper(latestOnly) {
@@ -79,14 +373,407 @@ func validateArgs(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("input arg '%s' value '%v' is not valid", latestOnlyArgName, latestOnly)
 		}
 	}
-	// Validate date filters
+	// Passes only order the versions within a job, and replication keeps the source's versions as they are
+	if orderVersions {
+		if latestOnly == util.IsLatestYes {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=Yes'", orderVersionsArgName, latestOnlyArgName)
+		}
+		if jobMode == migration.ModeReplicate {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", orderVersionsArgName, modeArgName, migration.ModeReplicate)
+		}
+		for _, name := range []string{manifestGeneratorArgName, objectLockArgName, preserveACLArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", orderVersionsArgName, name)
+			}
+		}
+	}
+	// The versions of each key are ordered using the inventory
+	if maxVersions < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", maxVersionsArgName, maxVersions)
+	}
+	if maxVersions > 0 {
+		if latestOnly == util.IsLatestYes {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=Yes'", maxVersionsArgName, latestOnlyArgName)
+		}
+		for _, name := range []string{listModeArgName, keysFileArgName, keysStdinArgName, manifestGeneratorArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", maxVersionsArgName, name)
+			}
+		}
+	}
+	if err := validateInventoryFrequency(&inventoryFreq); err != nil {
+		return err
+	}
+	if err := validateInventoryFields(cmd); err != nil {
+		return err
+	}
+	// Validate job confirmation mode
+	switch confirmMode {
+	case migration.ConfirmNone, migration.ConfirmPrompt, migration.ConfirmExternal:
+	default:
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are '%s' or '%s'",
+			confirmArgName, confirmMode, migration.ConfirmPrompt, migration.ConfirmExternal)
+	}
+	// Validate canned ACL
+	validACLs := []string{migration.CannedACLAuto, migration.CannedACLNone}
+	for _, acl := range s3controltypes.S3CannedAccessControlList("").Values() {
+		validACLs = append(validACLs, string(acl))
+	}
+	if !slices.Contains(validACLs, cannedACL) {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+			cannedACLArgName, cannedACL, strings.Join(validACLs, ", "))
+	}
+	if !slices.Contains(migration.Modes, jobMode) {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+			modeArgName, jobMode, strings.Join(migration.Modes, ", "))
+	}
+	if jobMode == migration.ModeLambda {
+		if lambdaArn == "" {
+			return fmt.Errorf("input arg '%s=%s' requires '%s'", modeArgName, migration.ModeLambda, functionArnArgName)
+		}
+		if parts := strings.Split(lambdaArn, ":"); len(parts) < 7 || parts[0] != "arn" || parts[2] != "lambda" {
+			return fmt.Errorf("input arg '%s' value '%v' is not a Lambda function ARN", functionArnArgName, lambdaArn)
+		}
+		// The function decides what happens to each object, so the copy's settings and a move's deletes don't apply
+		for _, name := range []string{cannedACLArgName, checksumArgName, replaceMetadataArgName, objectLockArgName, preserveACLArgName,
+			grantArgName, grantsFileArgName, moveArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", name, modeArgName, migration.ModeLambda)
+			}
+		}
+	} else if lambdaArn != "" {
+		return fmt.Errorf("input arg '%s' requires '%s=%s'", functionArnArgName, modeArgName, migration.ModeLambda)
+	}
+	// Replicas take their ACL, like their storage class and encryption, from the replication configuration
+	if jobMode == migration.ModeReplicate && cmd.Flags().Changed(cannedACLArgName) {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", cannedACLArgName, modeArgName, migration.ModeReplicate)
+	}
+	if checksumAlgo != "" {
+		if err := validateChecksumAlgorithm(&checksumAlgo); err != nil {
+			return err
+		}
+		if jobMode == migration.ModeReplicate {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", checksumArgName, modeArgName, migration.ModeReplicate)
+		}
+	}
+	if len(replaceMeta) > 0 {
+		var err error
+		if newMetadata, err = migration.ParseObjectMetadata(replaceMeta); err != nil {
+			return fmt.Errorf("input arg '%s' is not valid: %w", replaceMetadataArgName, err)
+		}
+		if jobMode == migration.ModeReplicate {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", replaceMetadataArgName, modeArgName, migration.ModeReplicate)
+		}
+	}
+	if ownershipName != "" {
+		if _, ok := migration.OwnershipNames[ownershipName]; !ok {
+			names := []string{}
+			for name := range migration.OwnershipNames {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+				assertOwnershipArgName, ownershipName, strings.Join(names, ", "))
+		}
+	}
+	if err := validateACLArgs(cmd); err != nil {
+		return err
+	}
+	if keysStdin {
+		if keysFile != "" && keysFile != migration.KeysStdin {
+			return fmt.Errorf("input args '%s' and '%s' cannot be used together", keysFileArgName, keysStdinArgName)
+		}
+		keysFile = migration.KeysStdin
+	}
+	// Validate manifest source, at most one of list mode, a local inventory or a keys file
+	sources := []string{}
+	for name, set := range map[string]bool{listModeArgName: listMode, listInventoryArgName: listInventory, localInventoryArgName: localInput != "", keysFileArgName: keysFile != "",
+		manifestGeneratorArgName: useGenerator, manifestArnArgName: manifestArn != ""} {
+		if set {
+			sources = append(sources, name)
+		}
+	}
+	if len(sources) > 1 {
+		slices.Sort(sources)
+		return fmt.Errorf("input args '%s' cannot be used together", strings.Join(sources, "', '"))
+	}
+	if err := validateManifestArn(cmd); err != nil {
+		return err
+	}
+	// Listings only have the fields of the inventory filters, so a SQL filter needs an inventory
+	if listMode && filterSQL != "" {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s'", filterSQLArgName, listModeArgName)
+	}
+	if localInput != "" {
+		if _, err := os.Stat(localInput); err != nil {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid: %v", localInventoryArgName, localInput, err)
+		}
+	}
+	if keysFile == migration.KeysStdin && confirmMode == migration.ConfirmPrompt {
+		return fmt.Errorf("input arg '%s=%s' reads standard input, which is used for keys, use '%s=%s' instead",
+			confirmArgName, migration.ConfirmPrompt, confirmArgName, migration.ConfirmExternal)
+	}
+	if keysFile != "" {
+		if _, err := os.Stat(keysFile); err != nil && keysFile != migration.KeysStdin {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid: %v", keysFileArgName, keysFile, err)
+		}
+		// The keys file names exact objects, so the inventory filters don't apply
+		for name, value := range map[string]string{latestOnlyArgName: latestOnly, startAtArgName: startAt, endAtArgName: endAt,
+			filterSQLArgName: filterSQL, modifiedAfterArgName: modAfter, modifiedBeforeArgName: modBefore} {
+			if strings.TrimSpace(value) != "" {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, keysFileArgName)
+			}
+		}
+	}
+	// Validate metadata filter patterns
+	for _, pattern := range contentTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid '%s' pattern '%s': %v", contentTypeArgName, pattern, err)
+		}
+	}
+	for key, pattern := range metadata {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid '%s' pattern '%s=%s': %v", metadataArgName, key, pattern, err)
+		}
+	}
+	if selectWorkers < 1 {
+		return fmt.Errorf("input arg '%s' value '%v' must be at least 1", selectConcurrencyArgName, selectWorkers)
+	}
+	if err := validateSuccessThreshold(successRatio, maxFailed); err != nil {
+		return err
+	}
+	if cancelRatio < 0 || cancelRatio >= 1 {
+		return fmt.Errorf("input arg '%s' value '%v' must be at least 0 and less than 1", cancelRatioArgName, cancelRatio)
+	}
+	if cancelMin < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", cancelMinTasksArgName, cancelMin)
+	}
+	if maxAPITPS < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", maxAPITPSArgName, maxAPITPS)
+	}
+	if maxAttempts < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", sdkMaxAttemptsArgName, maxAttempts)
+	}
+	if retryMode != "" {
+		if _, err := aws.ParseRetryMode(retryMode); err != nil {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are 'standard' or 'adaptive'", sdkRetryModeArgName, retryMode)
+		}
+	}
+	if requestPayer != "" && requestPayer != string(s3types.RequestPayerRequester) {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are '%s'", requestPayerArgName, requestPayer, s3types.RequestPayerRequester)
+	}
+	if headWorkers < 1 {
+		return fmt.Errorf("input arg '%s' value '%v' must be at least 1", headConcurrencyArgName, headWorkers)
+	}
+	if manifestFmt != migration.ManifestFormatInventory && manifestFmt != migration.ManifestFormatBatch {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are '%s' or '%s'",
+			manifestFormatArgName, manifestFmt, migration.ManifestFormatInventory, migration.ManifestFormatBatch)
+	}
+	if cleanupAge != "" {
+		var err error
+		if cleanupOlder, err = util.ParseAge(cleanupAge); err != nil || cleanupOlder <= 0 {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, eg. 7d or 36h", cleanupOlderArgName, cleanupAge)
+		}
+	}
+	// The plan is for review before any job is created, see 'watch --resume' to run it
+	if planFile != "" {
+		planOnly = true
+	}
+	if timelineAge != "" {
+		var err error
+		if timeline, err = util.ParseAge(timelineAge); err != nil || timeline <= 0 {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, eg. 14d or 36h", timelineArgName, timelineAge)
+		}
+		if !planOnly {
+			return fmt.Errorf("input arg '%s' requires '%s'", timelineArgName, planOnlyArgName)
+		}
+	}
+	// The plan would be interleaved with the other output written to stdout
+	if planFile == "-" {
+		if cmd.Flags().Changed(confirmArgName) {
+			return fmt.Errorf("input arg '%s' value '-' cannot be used with '%s'", planArgName, confirmArgName)
+		}
+		if metricsNS != "" && metricsFile == "" {
+			return fmt.Errorf("input arg '%s' value '-' cannot be used with '%s' without '%s'", planArgName, metricsNamespaceArgName, metricsFileArgName)
+		}
+	}
+	if metricsFile != "" && metricsNS == "" {
+		return fmt.Errorf("input arg '%s' requires '%s'", metricsFileArgName, metricsNamespaceArgName)
+	}
+	if driftSample < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", driftSampleArgName, driftSample)
+	}
+	if driftKeysFile != "" && driftSample == 0 {
+		return fmt.Errorf("input arg '%s' requires '%s'", driftKeysFileArgName, driftSampleArgName)
+	}
+	if chunks < 1 || chunks > migration.MaxChunks {
+		return fmt.Errorf("input arg '%s' value '%v' must be between 1 and %d", chunksArgName, chunks, migration.MaxChunks)
+	}
+	// The generated manifest only exists once the job is created, so nothing can read or rewrite it beforehand
+	if useGenerator {
+		for name, set := range map[string]bool{
+			chunksArgName:         chunks > 1,
+			contentTypeArgName:    len(contentTypes) > 0,
+			metadataArgName:       len(metadata) > 0,
+			driftSampleArgName:    driftSample > 0,
+			manifestFormatArgName: manifestFmt != migration.ManifestFormatInventory,
+			filterSQLArgName:      filterSQL != "",
+		} {
+			if set {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, manifestGeneratorArgName)
+			}
+		}
+	}
+	// Delete markers are found from the inventory or a listing, the other manifest sources don't see them
+	for name, set := range map[string]bool{replayDeletesArgName: replayDeletes, analyzeMarkersArgName: analyzeMarks} {
+		if set && (keysFile != "" || useGenerator) {
+			source := keysFileArgName
+			if useGenerator {
+				source = manifestGeneratorArgName
+			}
+			return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, source)
+		}
+	}
+	// The objects to delete are read from the manifests, which the generator only writes once the job runs
+	if move && useGenerator {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s'", moveArgName, manifestGeneratorArgName)
+	}
+	// Replication keeps the lock settings itself, and generated manifests can't be split by them
+	if objectLock && (useGenerator || jobMode == migration.ModeReplicate) {
+		other := manifestGeneratorArgName
+		if jobMode == migration.ModeReplicate {
+			other = modeArgName + "=" + migration.ModeReplicate
+		}
+		return fmt.Errorf("input arg '%s' cannot be used with '%s'", objectLockArgName, other)
+	}
+	// Steps of a state machine can't read local files or the terminal, and only run the copy
+	if sfnInput != "" {
+		for _, name := range []string{keysFileArgName, keysStdinArgName, localInventoryArgName, planOnlyArgName, planArgName, confirmArgName,
+			contentTypeArgName, metadataArgName, replayDeletesArgName, analyzeMarkersArgName, moveArgName, driftSampleArgName,
+			accessAnalyzerArgName, analyzerArnArgName, reportFileArgName, metricsFileArgName, eventStreamArgName,
+			failedObjectsArgName, cancelRatioArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, sfnInputArgName)
+			}
+		}
+	}
+	// Bucket settings can't be read or checked through a Multi-Region Access Point
+	if util.IsMultiRegionAccessPoint(migrationDest) {
+		for _, name := range []string{replayDeletesArgName, objectLockArgName, assertOwnershipArgName, preserveACLArgName, grantArgName,
+			accessAnalyzerArgName, accessGrantsArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with a Multi-Region Access Point destination", name)
+			}
+		}
+		if jobMode == migration.ModeReplicate {
+			return fmt.Errorf("input arg '%s=%s' cannot be used with a Multi-Region Access Point destination", modeArgName, migration.ModeReplicate)
+		}
+	}
+	// Directory buckets have no versions, ACLs, Object Lock or ownership controls
+	if util.IsDirectoryBucket(migrationDest) {
+		for _, name := range []string{replayDeletesArgName, objectLockArgName, assertOwnershipArgName, preserveACLArgName, grantArgName,
+			accessGrantsArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with a directory bucket destination", name)
+			}
+		}
+		if cannedACL != migration.CannedACLAuto && cannedACL != migration.CannedACLNone {
+			return fmt.Errorf("input arg '%s' value '%v' cannot be used with a directory bucket destination", cannedACLArgName, cannedACL)
+		}
+		if jobMode == migration.ModeReplicate {
+			return fmt.Errorf("input arg '%s=%s' cannot be used with a directory bucket destination", modeArgName, migration.ModeReplicate)
+		}
+	}
+	if createDest && (util.IsMultiRegionAccessPoint(migrationDest) || util.IsDirectoryBucket(migrationDest)) {
+		return fmt.Errorf("input arg '%s' can only create general purpose buckets", createDestArgName)
+	}
+	if noWait {
+		for _, name := range []string{planOnlyArgName, planArgName, containerArgName, sfnInputArgName} {
+			if cmd.Flags().Changed(name) {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, noWaitArgName)
+			}
+		}
+	}
+	if moveReport != "" && !move {
+		return fmt.Errorf("input arg '%s' requires '%s'", moveReportArgName, moveArgName)
+	}
+	if move && moveReport == "" {
+		moveReport = stateFilePath() + ".deletions.csv"
+	}
+	if purgeFile != "" && !analyzeMarks {
+		return fmt.Errorf("input arg '%s' requires '%s'", purgeEligibleArgName, analyzeMarkersArgName)
+	}
+	validStatuses := []string{}
+	for _, status := range s3controltypes.ReplicationStatus("").Values() {
+		validStatuses = append(validStatuses, string(status))
+	}
+	for i, status := range replStatuses {
+		replStatuses[i] = strings.ToUpper(status)
+		if !slices.Contains(validStatuses, replStatuses[i]) {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+				replicationStatusArgName, status, strings.Join(validStatuses, ", "))
+		}
+	}
+	for i, status := range encStatuses {
+		encStatuses[i] = strings.ToUpper(status)
+		if !slices.Contains(migration.EncryptionStatuses, encStatuses[i]) {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+				encryptionStatusArgName, status, strings.Join(migration.EncryptionStatuses, ", "))
+		}
+	}
+	// Only inventory reports delivered by S3 have the encryption status of each object
+	if len(encStatuses) > 0 {
+		for name, set := range map[string]bool{listModeArgName: listMode, listInventoryArgName: listInventory, keysFileArgName: keysFile != "",
+			manifestGeneratorArgName: useGenerator} {
+			if set {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", encryptionStatusArgName, name)
+			}
+		}
+	}
+	// Listings don't have replication statuses, and the keys file names exact objects
+	if skipRepl {
+		for name, set := range map[string]bool{listModeArgName: listMode, listInventoryArgName: listInventory, keysFileArgName: keysFile != ""} {
+			if set {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", skipReplicatedArgName, name)
+			}
+		}
+	}
+	// Only latest versions are compared, and the generated manifest doesn't exist before the job
+	if skipExisting {
+		if latestOnly == util.IsLatestNo {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=No'", skipExistingArgName, latestOnlyArgName)
+		}
+		if jobMode == migration.ModeReplicate {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", skipExistingArgName, modeArgName, migration.ModeReplicate)
+		}
+		if useGenerator {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s'", skipExistingArgName, manifestGeneratorArgName)
+		}
+	}
+	if len(replStatuses) > 0 && !useGenerator {
+		return fmt.Errorf("input arg '%s' requires '%s'", replicationStatusArgName, manifestGeneratorArgName)
+	}
+	// Validate polling durations
+	if maxWait < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", maxWaitArgName, maxWait)
+	}
+	if pollInterval <= 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must be greater than zero", pollIntervalArgName, pollInterval)
+	}
+	if pollTimeout < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", pollTimeoutArgName, pollTimeout)
+	}
+	// Validate date filters, whose values are in the given time zone
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid: %v", timezoneArgName, timezone, err)
+	}
 	validateDateFlag := func(dtstr string) (time.Time, error) {
 		if strings.TrimSpace(dtstr) != "" {
-			return util.ParseDateTime(dtstr)
+			return time.ParseInLocation(time.DateTime, dtstr, loc)
 		}
 		return time.Time{}, nil
 	}
-	var err error
 	startDt, err = validateDateFlag(startAt)
 	if err != nil {
 		return fmt.Errorf("invalid '%s' date time arg value, '%v', valid date time formate is '%s'",
@@ -98,6 +785,30 @@ func validateArgs(cmd *cobra.Command, args []string) error {
 			endAtArgName, err.Error(), time.DateTime)
 
 	}
+	// The modified range replaces the start and end filters, whose single bound semantics are inverted
+	if (modAfter != "" || modBefore != "") && (startAt != "" || endAt != "") {
+		return fmt.Errorf("input args '%s' and '%s' cannot be used with '%s' or '%s'",
+			modifiedAfterArgName, modifiedBeforeArgName, startAtArgName, endAtArgName)
+	}
+	parseModified := func(name, value string) (time.Time, error) {
+		if value == "" {
+			return time.Time{}, nil
+		}
+		t, err := util.ParseDateTimeIn(value, loc)
+		if err != nil {
+			return t, fmt.Errorf("input arg '%s' value '%v' is not valid: %v", name, value, err)
+		}
+		return t, nil
+	}
+	if modified.After, err = parseModified(modifiedAfterArgName, modAfter); err != nil {
+		return err
+	}
+	if modified.Before, err = parseModified(modifiedBeforeArgName, modBefore); err != nil {
+		return err
+	}
+	if !modified.After.IsZero() && !modified.Before.IsZero() && !modified.After.Before(modified.Before) {
+		return fmt.Errorf("input arg '%s' must be before '%s'", modifiedAfterArgName, modifiedBeforeArgName)
+	}
 
 	// AccountID validation
 	if ok, _ := regexp.MatchString(`\d{12}`, migrationAcctId); !ok {
@@ -105,9 +816,173 @@ func validateArgs(cmd *cobra.Command, args []string) error {
 	}
 
 	//  Role ARN validation=
-	if ok, _ := regexp.MatchString(`^(?:\d{12}|(arn:(aws|aws-us-gov|aws-cn):iam::\d{12}(?:|:(?:role\/[0-9A-Za-z\+\.@_,-]{1,64}))))$`, migrationRole); !ok {
+	if !roleArnPattern.MatchString(migrationRole) && createRole == "" {
 		return fmt.Errorf("invalid '%s' arg value '%v'. it must be an AWS ARN eg. arn:aws:iam::<ACCOUNT_NUM>:role/BatchOperationsCopyRole", roleArgName, migrationRole)
 	}
 
 	return nil
 }
+
+// Normalize the inventory frequency to its S3 value, Daily or Weekly
+func validateInventoryFrequency(freq *string) error {
+	switch strings.ToUpper(*freq) {
+	case "DAILY":
+		*freq = string(s3types.InventoryFrequencyDaily)
+	case "WEEKLY":
+		*freq = string(s3types.InventoryFrequencyWeekly)
+	default:
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are 'daily' or 'weekly'", inventoryFreqArgName, *freq)
+	}
+	return nil
+}
+
+// The created role replaces --role, and its policy only names plain S3 buckets
+func validateCreateRole(cmd *cobra.Command) error {
+	if createRole == "" {
+		return requireFlags(cmd, regionArgName, sourceBucketArgName, destinationBucketArgName, accountIdArgName, roleArgName)
+	}
+	if err := requireFlags(cmd, regionArgName, sourceBucketArgName, destinationBucketArgName, accountIdArgName); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed(roleArgName) {
+		return fmt.Errorf("input args '%s' and '%s' cannot be used together", roleArgName, createRoleArgName)
+	}
+	if !roleNamePattern.MatchString(createRole) {
+		return fmt.Errorf("input arg '%s' value '%v' is not a valid IAM role name", createRoleArgName, createRole)
+	}
+	if cmd.Flags().Changed(sfnInputArgName) {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s'", createRoleArgName, sfnInputArgName)
+	}
+	if util.IsMultiRegionAccessPoint(migrationDest) || util.IsDirectoryBucket(migrationDest) {
+		return fmt.Errorf("input arg '%s' cannot be used with a Multi-Region Access Point or directory bucket destination", createRoleArgName)
+	}
+	return nil
+}
+
+// An existing manifest is copied as-is, so nothing may filter, split or rewrite it
+func validateManifestArn(cmd *cobra.Command) error {
+	if manifestArn == "" {
+		if manifestETag != "" {
+			return fmt.Errorf("input arg '%s' requires '%s'", manifestETagArgName, manifestArnArgName)
+		}
+		return nil
+	}
+	if _, _, err := migration.ParseObjectArn(manifestArn); err != nil {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, eg. arn:aws:s3:::bucket/manifest.csv", manifestArnArgName, manifestArn)
+	}
+	for _, name := range []string{latestOnlyArgName, startAtArgName, endAtArgName, modifiedAfterArgName, modifiedBeforeArgName,
+		filterSQLArgName, encryptionStatusArgName, skipReplicatedArgName, skipExistingArgName, contentTypeArgName, metadataArgName,
+		chunksArgName, manifestFormatArgName, maxVersionsArgName, orderVersionsArgName, driftSampleArgName, replayDeletesArgName,
+		analyzeMarkersArgName, moveArgName, objectLockArgName, preserveACLArgName} {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, manifestArnArgName)
+		}
+	}
+	return nil
+}
+
+// Match the inventory fields to S3's names, case insensitively, and check the
+// filters reading inventory columns have the fields they need
+func validateInventoryFields(cmd *cobra.Command) error {
+	validFields := []string{}
+	for _, field := range s3types.InventoryOptionalField("").Values() {
+		validFields = append(validFields, string(field))
+	}
+	for i, field := range invFields {
+		idx := slices.IndexFunc(validFields, func(valid string) bool { return strings.EqualFold(valid, field) })
+		if idx < 0 {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+				inventoryFieldsArgName, field, strings.Join(validFields, ", "))
+		}
+		invFields[i] = validFields[idx]
+	}
+	if !cmd.Flags().Changed(inventoryFieldsArgName) {
+		return nil
+	}
+	required := map[string]s3types.InventoryOptionalField{
+		startAtArgName:          s3types.InventoryOptionalFieldLastModifiedDate,
+		endAtArgName:            s3types.InventoryOptionalFieldLastModifiedDate,
+		modifiedAfterArgName:    s3types.InventoryOptionalFieldLastModifiedDate,
+		modifiedBeforeArgName:   s3types.InventoryOptionalFieldLastModifiedDate,
+		orderVersionsArgName:    s3types.InventoryOptionalFieldLastModifiedDate,
+		maxVersionsArgName:      s3types.InventoryOptionalFieldLastModifiedDate,
+		encryptionStatusArgName: s3types.InventoryOptionalFieldEncryptionStatus,
+		skipReplicatedArgName:   s3types.InventoryOptionalFieldReplicationStatus,
+	}
+	for name, field := range required {
+		if cmd.Flags().Changed(name) && !slices.Contains(invFields, string(field)) {
+			return fmt.Errorf("input arg '%s' requires '%s' to include %s", name, inventoryFieldsArgName, field)
+		}
+	}
+	return nil
+}
+
+// Upper case the checksum algorithm and check it's one batch copies support
+func validateChecksumAlgorithm(algo *string) error {
+	*algo = strings.ToUpper(*algo)
+	validAlgos := []string{}
+	for _, a := range s3controltypes.S3ChecksumAlgorithm("").Values() {
+		validAlgos = append(validAlgos, string(a))
+	}
+	if !slices.Contains(validAlgos, *algo) {
+		return fmt.Errorf("input arg '%s' value '%v' is not valid, valid values are %s",
+			checksumArgName, *algo, strings.Join(validAlgos, ", "))
+	}
+	return nil
+}
+
+// Validate --preserve-acl and the explicit grants, which replace the canned ACL
+func validateACLArgs(cmd *cobra.Command) error {
+	grants = nil
+	for _, arg := range grantArgs {
+		g, err := migration.ParseGrant(arg)
+		if err != nil {
+			return fmt.Errorf("input arg '%s' value '%v' is not valid: %w", grantArgName, arg, err)
+		}
+		grants = append(grants, g)
+	}
+	if grantsFile != "" {
+		if len(grantArgs) > 0 {
+			return fmt.Errorf("input args '%s' and '%s' cannot be used together", grantArgName, grantsFileArgName)
+		}
+		var err error
+		if grants, err = migration.LoadGrantsFile(grantsFile); err != nil {
+			return err
+		}
+	}
+	if !preserveACL && len(grants) == 0 {
+		return nil
+	}
+	name := preserveACLArgName
+	if len(grants) > 0 {
+		if preserveACL {
+			return fmt.Errorf("input arg '%s' cannot be used with grants", preserveACLArgName)
+		}
+		name = grantArgName
+		if grantsFile != "" {
+			name = grantsFileArgName
+		}
+	}
+	// S3 rejects a copy with both grants and a canned ACL, and replicas take their ACL from the replication configuration
+	if cmd.Flags().Changed(cannedACLArgName) {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, cannedACLArgName)
+	}
+	if jobMode == migration.ModeReplicate {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s=%s'", name, modeArgName, migration.ModeReplicate)
+	}
+	// Generated manifests can't be split by the objects' ACLs
+	if preserveACL && useGenerator {
+		return fmt.Errorf("input arg '%s' cannot be used with '%s'", preserveACLArgName, manifestGeneratorArgName)
+	}
+	return nil
+}
+
+func validateSuccessThreshold(ratio float32, maxFailed int64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("input arg '%s' value '%v' must be between 0 and 1", successThresholdArgName, ratio)
+	}
+	if maxFailed < 0 {
+		return fmt.Errorf("input arg '%s' value '%v' must not be negative", maxFailedArgName, maxFailed)
+	}
+	return nil
+}
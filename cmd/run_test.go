@@ -0,0 +1,68 @@
+package cmd
+
+import "testing"
+
+func TestValidateSuccessThreshold(t *testing.T) {
+	testCases := []struct {
+		ratio     float32
+		maxFailed int64
+		valid     bool
+	}{
+		{ratio: 0, valid: true},
+		{ratio: 0.8, valid: true},
+		{ratio: 1, valid: true},
+		{ratio: 1, maxFailed: 100, valid: true},
+		{ratio: -0.1, valid: false},
+		{ratio: 1.01, valid: false},
+		{ratio: 0.8, maxFailed: -1, valid: false},
+	}
+	for _, tc := range testCases {
+		if err := validateSuccessThreshold(tc.ratio, tc.maxFailed); (err == nil) != tc.valid {
+			t.Errorf("validateSuccessThreshold(%v, %v) error = %v, expected valid %v", tc.ratio, tc.maxFailed, err, tc.valid)
+		}
+	}
+}
+
+func TestSuccessThresholdFlag(t *testing.T) {
+	defer func(run, wait float32) { successRatio, waitRatio = run, wait }(successRatio, waitRatio)
+	for _, cmd := range []struct {
+		name  string
+		ratio *float32
+		parse func([]string) error
+		def   string
+	}{
+		{name: runCommand.Name(), ratio: &successRatio, parse: runCommand.Flags().Parse, def: runCommand.Flags().Lookup(successThresholdArgName).DefValue},
+		{name: waitCommand.Name(), ratio: &waitRatio, parse: waitCommand.Flags().Parse, def: waitCommand.Flags().Lookup(successThresholdArgName).DefValue},
+	} {
+		if cmd.def != "0.8" {
+			t.Errorf("%s '%s' default = %s, expected 0.8", cmd.name, successThresholdArgName, cmd.def)
+		}
+		if err := cmd.parse([]string{"--" + successThresholdArgName, "1"}); err != nil || *cmd.ratio != 1 {
+			t.Errorf("%s '%s' 1 = %v, error = %v", cmd.name, successThresholdArgName, *cmd.ratio, err)
+		}
+		if err := cmd.parse([]string{"--" + successThresholdArgName + "=0.95"}); err != nil || *cmd.ratio != 0.95 {
+			t.Errorf("%s '%s' 0.95 = %v, error = %v", cmd.name, successThresholdArgName, *cmd.ratio, err)
+		}
+		if err := cmd.parse([]string{"--" + successThresholdArgName, "all"}); err == nil {
+			t.Errorf("%s '%s' all, expected an error", cmd.name, successThresholdArgName)
+		}
+	}
+}
+
+func TestOperationFlag(t *testing.T) {
+	defer func(mode, arn string) { jobMode, lambdaArn = mode, arn }(jobMode, lambdaArn)
+	arn := "arn:aws:lambda:us-east-1:111122223333:function:transcode"
+	if err := runCommand.Flags().Parse([]string{"--operation", "lambda", "--function-arn", arn}); err != nil {
+		t.Fatal(err)
+	}
+	if jobMode != "lambda" || lambdaArn != arn {
+		t.Errorf("'%s' lambda = '%s' '%s', expected '%s' lambda", operationArgName, modeArgName, jobMode, modeArgName)
+	}
+	if err := runCommand.Flags().Parse([]string{"--operation=replicate"}); err != nil || jobMode != "replicate" {
+		t.Errorf("'%s=replicate' = '%s', error = %v", operationArgName, jobMode, err)
+	}
+	// Config files and parameters name it too
+	if err := applyConfigValues(runCommand.Flags(), "test", `{"operation": "copy"}`); err != nil {
+		t.Errorf("applyConfigValues() error = %v", err)
+	}
+}
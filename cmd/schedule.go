@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"s3migration/migration"
+	"s3migration/util"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// Subcommand argument values
+var (
+	cronExpr       string
+	historyDir     string
+	keepRuns       int
+	overlap        time.Duration
+	interval       time.Duration
+	until          string
+	onInventory    bool
+	checkInterval  time.Duration
+	cronSchedule   *util.CronSchedule
+	cutover        time.Time
+	incrementalRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(scheduleCommand)
+	scheduleCommand.Flags().StringVar(&cronExpr, cronArgName, "", "Cron expression of when to run, minute hour day-of-month month day-of-week in local time, eg. '0 2 * * *'")
+	scheduleCommand.Flags().DurationVar(&interval, intervalArgName, 0, "Time between the starts of runs, eg. 6h, instead of a cron expression. The first run starts immediately")
+	scheduleCommand.Flags().BoolVar(&onInventory, onInventoryArgName, false, "Start a run as soon as a new inventory report is delivered, instead of a cron expression")
+	scheduleCommand.Flags().DurationVar(&checkInterval, checkIntervalArgName, 5*time.Minute, "[Optional] How often to check for a new inventory report with --on-inventory")
+	scheduleCommand.Flags().StringVar(&until, untilArgName, "", "[Optional] Cutover datetime in local time, eg '2024-06-30 18:00:00', after which no run is started and the schedule exits")
+	scheduleCommand.Flags().StringVar(&historyDir, historyDirArgName, "schedule-history", "[Optional] Directory keeping the state file, report and log of each run")
+	scheduleCommand.Flags().IntVar(&keepRuns, keepRunsArgName, 30, "[Optional] Number of runs kept in the history, older runs are deleted")
+	scheduleCommand.Flags().DurationVar(&overlap, overlapArgName, 48*time.Hour, "[Optional] How far before the last successful run's start each incremental run starts copying, covering the inventory's age")
+}
+
+var scheduleCommand = &cobra.Command{
+	Use:          "schedule (--cron EXPR | --interval DURATION | --on-inventory) [flags] -- [run flags]",
+	Short:        "Run the migration on a schedule, each run copying objects changed since the last successful run",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		triggers := 0
+		for _, set := range []bool{cronExpr != "", interval != 0, onInventory} {
+			if set {
+				triggers++
+			}
+		}
+		if triggers != 1 {
+			return fmt.Errorf("exactly one of input args '%s', '%s' or '%s' is required", cronArgName, intervalArgName, onInventoryArgName)
+		}
+		if checkInterval <= 0 {
+			return fmt.Errorf("input arg '%s' value '%v' must be positive", checkIntervalArgName, checkInterval)
+		}
+		if cronExpr != "" {
+			if cronSchedule, err = util.ParseCron(cronExpr); err != nil {
+				return err
+			}
+		}
+		if interval < 0 {
+			return fmt.Errorf("input arg '%s' value '%v' must not be negative", intervalArgName, interval)
+		}
+		if until != "" {
+			if cutover, err = util.ParseDateTimeIn(until, time.Local); err != nil {
+				return fmt.Errorf("input arg '%s' value '%v' is not valid, expected format is '%s'", untilArgName, until, time.DateTime)
+			}
+		}
+		if keepRuns < 1 {
+			return fmt.Errorf("input arg '%s' value '%v' must be at least 1", keepRunsArgName, keepRuns)
+		}
+		if overlap < 0 {
+			return fmt.Errorf("input arg '%s' value '%v' must not be negative", overlapArgName, overlap)
+		}
+		// Each run's state file and report are kept in the history
+		for _, name := range []string{stateFileArgName, reportFileArgName, resumeArgName, planOnlyArgName} {
+			if hasFlag(args, name) {
+				return fmt.Errorf("input arg '%s' cannot be used with '%s'", name, cmd.Name())
+			}
+		}
+		// The inventory watched is the one of the runs
+		if onInventory {
+			for _, name := range []string{regionArgName, sourceBucketArgName} {
+				if flagValue(args, name) == "" {
+					return fmt.Errorf("input arg '%s' requires '%s' in the run flags", onInventoryArgName, name)
+				}
+			}
+		}
+		incrementalRun = incrementalArgs(args)
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		executable, err := os.Executable()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if onInventory {
+			watchInventory(executable, args)
+			return
+		}
+		var last time.Time
+		for {
+			next := nextRun(last, time.Now())
+			if next.IsZero() {
+				log.Fatalf("cron expression '%s' never matches", cronExpr)
+			}
+			if pastCutover(next) {
+				zap.L().Info("Schedule reached its cutover, no more runs are started", zap.Time("cutover", cutover))
+				return
+			}
+			zap.L().Info("Waiting for the next scheduled run", zap.Time("at", next))
+			time.Sleep(time.Until(next))
+			last = time.Now()
+			runScheduled(executable, args)
+		}
+	},
+}
+
+// Time of the next run after the one started at last, zero when never.  With an interval the first run
+// starts immediately, and a run that took longer than the interval is followed by the next one at once.
+func nextRun(last, now time.Time) time.Time {
+	if cronSchedule != nil {
+		return cronSchedule.Next(now)
+	}
+	if last.IsZero() || now.Sub(last) >= interval {
+		return now
+	}
+	return last.Add(interval)
+}
+
+// Whether a run starting at next would start at or after the cutover
+func pastCutover(next time.Time) bool {
+	return !cutover.IsZero() && !next.Before(cutover)
+}
+
+// Start a run each time a new inventory report is delivered, until the cutover.  The first run starts
+// immediately, creating the inventory configuration if needed, unless a run in the history succeeded.
+func watchInventory(executable string, runArgs []string) {
+	ctx := context.Background()
+	if !cutover.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, cutover)
+		defer cancel()
+	}
+	watcher, err := migration.NewManifestWatcher(ctx, migration.ManifestWatchArgs{
+		SourceRegion:    flagValue(runArgs, regionArgName),
+		SourceBucket:    flagValue(runArgs, sourceBucketArgName),
+		ConfigName:      runFlag(runArgs, inventoryConfigArgName, inventoryConfig),
+		InventoryBucket: runFlag(runArgs, inventoryDestArgName, inventoryDest),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	since, waitForNew, err := migration.LastSuccessfulRunStart(historyDir)
+	if err != nil {
+		zap.L().Error("Unable to read run history, starting a run", zap.String("dir", historyDir), zap.Error(err))
+	}
+	for {
+		if waitForNew {
+			zap.L().Info("Waiting for a new inventory report", zap.Time("since", since), zap.Duration("checkInterval", checkInterval))
+			if _, err := watcher.WaitForNewer(ctx, since, checkInterval); err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					zap.L().Info("Schedule reached its cutover, no more runs are started", zap.Time("cutover", cutover))
+					return
+				}
+				log.Fatal(err)
+			}
+		}
+		// Each run uses the latest report, so the next one waits for a report delivered after it started
+		since = time.Now()
+		waitForNew = true
+		runScheduled(executable, runArgs)
+	}
+}
+
+// Value the run args give the flag, or fallback when absent
+func runFlag(args []string, name, fallback string) string {
+	if value := flagValue(args, name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Value the run args give the flag, as --name value or --name=value, or "" when absent
+func flagValue(args []string, name string) string {
+	for i, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--"+name+"="); ok {
+			return value
+		}
+		if arg == "--"+name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// Whether the run args include the flag, as --name or --name=value
+func hasFlag(args []string, name string) bool {
+	return slices.ContainsFunc(args, func(arg string) bool {
+		return arg == "--"+name || strings.HasPrefix(arg, "--"+name+"=")
+	})
+}
+
+// Whether runs with these args only copy objects changed since the last successful run.  Runs copying
+// exact keys or a given manifest, or with their own date filters, copy the same selection every time.
+func incrementalArgs(args []string) bool {
+	return !slices.ContainsFunc([]string{startAtArgName, endAtArgName, modifiedAfterArgName, modifiedBeforeArgName,
+		keysFileArgName, keysStdinArgName, manifestArnArgName}, func(name string) bool { return hasFlag(args, name) })
+}
+
+// Args of the child run keeping its state file and report in dir, copying only the objects modified at or
+// after since unless it's zero.  The bound is passed with its offset, so the run's --timezone doesn't apply.
+func scheduledRunArgs(runArgs []string, dir string, since time.Time) []string {
+	childArgs := append([]string{"run"}, runArgs...)
+	childArgs = append(childArgs,
+		"--"+stateFileArgName, filepath.Join(dir, migration.ScheduledStateFile),
+		"--"+reportFileArgName, filepath.Join(dir, migration.ScheduledReportFile),
+	)
+	if !since.IsZero() {
+		childArgs = append(childArgs, "--"+modifiedAfterArgName, since.Format(time.RFC3339))
+	}
+	return childArgs
+}
+
+// Run the migration in a child process, so a failed run doesn't stop the schedule, then prune the history
+func runScheduled(executable string, runArgs []string) {
+	started := time.Now()
+	dir := migration.ScheduledRunDir(historyDir, started)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		zap.L().Error("Unable to create run directory", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+	var since time.Time
+	if incrementalRun {
+		last, ok, err := migration.LastSuccessfulRunStart(historyDir)
+		if err != nil {
+			zap.L().Error("Unable to read run history, copying everything", zap.String("dir", historyDir), zap.Error(err))
+		}
+		if ok {
+			since = last.Add(-overlap)
+		}
+	}
+	childArgs := scheduledRunArgs(runArgs, dir, since)
+
+	logFile, err := os.Create(filepath.Join(dir, migration.ScheduledLogFile))
+	if err != nil {
+		zap.L().Error("Unable to create run log", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+	defer logFile.Close()
+	zap.L().Info("Starting scheduled run", zap.String("dir", dir), zap.Strings("args", childArgs))
+	child := exec.Command(executable, childArgs...)
+	child.Stdout = logFile
+	child.Stderr = logFile
+	if err := child.Run(); err != nil {
+		zap.L().Error("Scheduled run failed", zap.String("dir", dir), zap.Duration("elapsed", time.Since(started)), zap.Error(err))
+	} else {
+		zap.L().Info("Scheduled run completed", zap.String("dir", dir), zap.Duration("elapsed", time.Since(started)))
+	}
+
+	removed, err := migration.PruneRunHistory(historyDir, keepRuns)
+	if err != nil {
+		zap.L().Error("Unable to prune run history", zap.String("dir", historyDir), zap.Error(err))
+	}
+	if len(removed) > 0 {
+		zap.L().Info("Pruned run history", zap.Strings("removed", removed))
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"s3migration/util"
+	"testing"
+	"time"
+)
+
+func TestScheduledRunArgsModifiedAfter(t *testing.T) {
+	since := time.Date(2024, 4, 15, 10, 0, 0, 0, time.UTC)
+	childArgs := scheduledRunArgs([]string{"--region", "us-east-1"}, "history/run", since)
+	if childArgs[0] != "run" || flagValue(childArgs, regionArgName) != "us-east-1" {
+		t.Fatalf("scheduledRunArgs() = %v, expected the run args", childArgs)
+	}
+	if hasFlag(childArgs, startAtArgName) || hasFlag(childArgs, endAtArgName) {
+		t.Fatalf("scheduledRunArgs() = %v, expected no '%s' or '%s'", childArgs, startAtArgName, endAtArgName)
+	}
+	// The run parses the bound as it does --modified-after
+	after, err := util.ParseDateTimeIn(flagValue(childArgs, modifiedAfterArgName), time.UTC)
+	if err != nil {
+		t.Fatalf("scheduledRunArgs() = %v, '%s' error = %v", childArgs, modifiedAfterArgName, err)
+	}
+	modified := util.ModifiedRange{After: after}
+	testCases := []struct {
+		lastModified time.Time
+		expected     bool
+	}{
+		{lastModified: since.Add(-time.Hour), expected: false},
+		{lastModified: since, expected: true},
+		{lastModified: since.Add(time.Hour), expected: true},
+	}
+	for _, tc := range testCases {
+		if got := modified.Matches(tc.lastModified); got != tc.expected {
+			t.Errorf("modified after %v matches %v = %v, expected %v", after, tc.lastModified, got, tc.expected)
+		}
+	}
+
+	if childArgs := scheduledRunArgs(nil, "history/run", time.Time{}); hasFlag(childArgs, modifiedAfterArgName) {
+		t.Errorf("scheduledRunArgs() = %v, expected the first run to copy everything", childArgs)
+	}
+}
+
+func TestIncrementalArgs(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected bool
+	}{
+		{args: []string{"--region", "us-east-1"}, expected: true},
+		{args: []string{"--start", "2024-01-01 00:00:00"}, expected: false},
+		{args: []string{"--end=2024-01-01 00:00:00"}, expected: false},
+		{args: []string{"--modified-after", "2024-01-01"}, expected: false},
+		{args: []string{"--modified-before=2024-01-01"}, expected: false},
+		{args: []string{"--keys-file", "keys.csv"}, expected: false},
+		{args: []string{"--keys-stdin"}, expected: false},
+		{args: []string{"--manifest-arn", "arn:aws:s3:::bucket/manifest.csv"}, expected: false},
+	}
+	for _, tc := range testCases {
+		if got := incrementalArgs(tc.args); got != tc.expected {
+			t.Errorf("incrementalArgs(%v) = %v, expected %v", tc.args, got, tc.expected)
+		}
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	defer func(c *util.CronSchedule, i time.Duration) { cronSchedule, interval = c, i }(cronSchedule, interval)
+	now := time.Date(2024, 4, 15, 10, 30, 20, 0, time.UTC)
+	daily, err := util.ParseCron("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name     string
+		cron     *util.CronSchedule
+		interval time.Duration
+		last     time.Time
+		expected time.Time
+	}{
+		{name: "first interval run starts immediately", interval: 6 * time.Hour, expected: now},
+		{name: "interval not elapsed", interval: 6 * time.Hour, last: now.Add(-time.Hour), expected: now.Add(5 * time.Hour)},
+		{name: "interval just elapsed", interval: 6 * time.Hour, last: now.Add(-6 * time.Hour), expected: now},
+		{name: "run longer than the interval catches up at once", interval: 6 * time.Hour, last: now.Add(-8 * time.Hour), expected: now},
+		{name: "cron waits for the next match", cron: daily, expected: time.Date(2024, 4, 16, 2, 0, 0, 0, time.UTC)},
+		{name: "cron skips matches missed by a long run", cron: daily, last: now.Add(-30 * time.Hour), expected: time.Date(2024, 4, 16, 2, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		cronSchedule, interval = tc.cron, tc.interval
+		if got := nextRun(tc.last, now); !got.Equal(tc.expected) {
+			t.Errorf("%s: nextRun() = %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestPastCutover(t *testing.T) {
+	defer func(c time.Time) { cutover = c }(cutover)
+	at := time.Date(2024, 6, 30, 18, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		cutover  time.Time
+		next     time.Time
+		expected bool
+	}{
+		{next: at, expected: false},
+		{cutover: at, next: at.Add(-time.Second), expected: false},
+		{cutover: at, next: at, expected: true},
+		{cutover: at, next: at.Add(time.Hour), expected: true},
+	}
+	for _, tc := range testCases {
+		cutover = tc.cutover
+		if got := pastCutover(tc.next); got != tc.expected {
+			t.Errorf("pastCutover(%v) with cutover %v = %v, expected %v", tc.next, tc.cutover, got, tc.expected)
+		}
+	}
+}
+
+func TestFlagValue(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		name     string
+		expected string
+	}{
+		{args: []string{"--region", "us-east-1"}, name: "region", expected: "us-east-1"},
+		{args: []string{"--region=us-east-1"}, name: "region", expected: "us-east-1"},
+		{args: []string{"--sourcebucket", "src", "--region", "eu-west-1"}, name: "region", expected: "eu-west-1"},
+		{args: []string{"--region"}, name: "region", expected: ""},
+		{args: []string{"--regions", "us-east-1"}, name: "region", expected: ""},
+		{args: []string{"--region-x=us-east-1"}, name: "region", expected: ""},
+		{args: nil, name: "region", expected: ""},
+	}
+	for _, tc := range testCases {
+		if got := flagValue(tc.args, tc.name); got != tc.expected {
+			t.Errorf("flagValue(%v, %q) = %q, expected %q", tc.args, tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestScheduledRunArgsTimezone(t *testing.T) {
+	since := time.Date(2024, 4, 15, 10, 0, 0, 0, time.UTC)
+	childArgs := scheduledRunArgs([]string{"--timezone", "America/New_York"}, "history/run", since)
+	if flagValue(childArgs, timezoneArgName) != "America/New_York" {
+		t.Fatalf("scheduledRunArgs() = %v, expected the run's '%s'", childArgs, timezoneArgName)
+	}
+	// The bound carries its offset, so it's the same time whatever the run's timezone
+	for _, loc := range []*time.Location{time.UTC, time.FixedZone("EDT", -4*60*60), time.FixedZone("JST", 9*60*60)} {
+		after, err := util.ParseDateTimeIn(flagValue(childArgs, modifiedAfterArgName), loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !after.Equal(since) {
+			t.Errorf("'%s' in %v = %v, expected %v", modifiedAfterArgName, loc, after, since)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"s3migration/migration"
+	"s3migration/util"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	functionArn string
+)
+
+func init() {
+	rootCmd.AddCommand(stepFunctionsCommand)
+	stepFunctionsCommand.AddCommand(stepFunctionsDefinitionCommand, stepFunctionsLambdaCommand, stepFunctionsStepCommand)
+	stepFunctionsDefinitionCommand.Flags().StringVar(&functionArn, functionArnArgName, "", "ARN of the Lambda function running this tool with 'stepfunctions lambda'")
+	_ = stepFunctionsDefinitionCommand.MarkFlagRequired(functionArnArgName)
+}
+
+var stepFunctionsCommand = &cobra.Command{
+	Use:   "stepfunctions",
+	Short: "Run the migration as an AWS Step Functions state machine",
+}
+
+var stepFunctionsDefinitionCommand = &cobra.Command{
+	Use:          "definition",
+	Short:        "Write the Amazon States Language definition of the state machine",
+	SilenceUsage: false,
+	Run: func(cmd *cobra.Command, args []string) {
+		definition, err := migration.StateMachineDefinition(functionArn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(definition))
+	},
+}
+
+var stepFunctionsLambdaCommand = &cobra.Command{
+	Use:          "lambda",
+	Short:        "Serve the state machine's step invocations, as the bootstrap of a Lambda function with a custom runtime",
+	SilenceUsage: false,
+	Run: func(cmd *cobra.Command, args []string) {
+		runtime, err := util.NewLambdaRuntime()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := runtime.Serve(migration.HandleStepInvocation); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+var stepFunctionsStepCommand = &cobra.Command{
+	Use:          "step NAME",
+	Short:        "Run a single step with the execution state read from stdin, writing the next state to stdout",
+	SilenceUsage: false,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || !slices.Contains(migration.Steps, args[0]) {
+			return fmt.Errorf("expected one step, valid steps are %v", migration.Steps)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		output, err := migration.RunStep(context.Background(), args[0], input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(output))
+	},
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"s3migration/migration"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	simulateReport     string
+	simulateThresholds []float32
+)
+
+func init() {
+	rootCmd.AddCommand(thresholdCommand)
+	thresholdCommand.AddCommand(thresholdSimulateCommand)
+	thresholdSimulateCommand.Flags().StringVar(&simulateReport, reportFileArgName, "", "Migration report written by run --report-file")
+	thresholdSimulateCommand.Flags().Float32SliceVar(&simulateThresholds, thresholdsArgName, migration.DefaultSimulatedThresholds, "[Optional] Success thresholds to simulate, eg. 0.9,0.99")
+	_ = thresholdSimulateCommand.MarkFlagRequired(reportFileArgName)
+}
+
+var thresholdCommand = &cobra.Command{
+	Use:   "threshold",
+	Short: "Analyze success threshold policies",
+}
+
+var thresholdSimulateCommand = &cobra.Command{
+	Use:          "simulate",
+	Short:        "Show whether a completed run would have met other success thresholds, by objects or bytes, per job or in aggregate",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		for _, t := range simulateThresholds {
+			if t < 0 || t > 1 {
+				return fmt.Errorf("input arg '%s' value '%v' is not valid, thresholds are between 0 and 1", thresholdsArgName, t)
+			}
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		report, err := migration.LoadReport(simulateReport)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := migration.WriteThresholdSimulation(report, simulateThresholds, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"s3migration/migration"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	verifyDest     string
+	verifyETag     bool
+	verifyChecksum string
+	verifyOutput   string
+	verifyPolicy   bool
+	verifyRetry    time.Duration
+	verifyMaxWait  time.Duration
+	verifyFreq     string
+)
+
+func init() {
+	rootCmd.AddCommand(verifyCommand)
+	verifyCommand.Flags().StringVar(&verifyDest, destinationBucketArgName, "", "Destination bucket name")
+	verifyCommand.Flags().BoolVar(&verifyETag, compareETagArgName, false, "[Optional] Also report objects of the same size whose ETags differ. Multipart ETags are skipped, KMS encrypted copies have different ETags")
+	verifyCommand.Flags().StringVar(&verifyChecksum, checksumArgName, "", "[Optional] Additional checksum algorithm the destination inventory must list for every object, eg. SHA256, as given to run")
+	verifyCommand.Flags().StringVar(&verifyOutput, outputArgName, "", "[Optional] File to write the CSV of missing and differing objects to, defaults to stdout")
+	verifyCommand.Flags().BoolVar(&verifyPolicy, inventoryPolicyArgName, false, "[Optional] Add the statement letting S3 deliver the destination's inventory reports to the inventory bucket's policy when it is missing")
+	verifyCommand.Flags().DurationVar(&verifyRetry, retryArgName, time.Hour, "[Optional] Interval between checks for the destination's inventory report")
+	verifyCommand.Flags().DurationVar(&verifyMaxWait, maxWaitArgName, 0, "[Optional] Maximum time to wait for the destination's inventory report, eg. 48h. Checks once by default")
+	verifyCommand.Flags().StringVar(&verifyFreq, inventoryFreqArgName, "daily", "[Optional] Frequency of the destination's inventory configuration when the tool creates it, daily or weekly")
+	_ = verifyCommand.MarkFlagRequired(destinationBucketArgName)
+}
+
+var verifyCommand = &cobra.Command{
+	Use:          "verify",
+	Short:        "Check the copy end to end by joining the destination's inventory report with the source's",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireFlags(cmd, regionArgName, sourceBucketArgName); err != nil {
+			return err
+		}
+		if err := validateInventoryFrequency(&verifyFreq); err != nil {
+			return err
+		}
+		if verifyChecksum != "" {
+			return validateChecksumAlgorithm(&verifyChecksum)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var w io.Writer = os.Stdout
+		if verifyOutput != "" {
+			f, err := os.Create(verifyOutput)
+			if err != nil {
+				exitOn(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		_, err := migration.Verify(migration.VerifyArgs{
+			SourceRegion:       sourceRegion,
+			SourceBucket:       migrationSrc,
+			DestinationBucket:  verifyDest,
+			ConfigName:         inventoryConfig,
+			InventoryBucket:    inventoryDest,
+			InventoryPolicy:    verifyPolicy,
+			InventoryFrequency: verifyFreq,
+			CompareETag:        verifyETag,
+			ChecksumAlgorithm:  verifyChecksum,
+			RetryInterval:      verifyRetry,
+			MaxWait:            verifyMaxWait,
+			Heartbeat:          startHeartbeat(),
+		}, w)
+		exitOn(err)
+	},
+	TraverseChildren: true,
+}
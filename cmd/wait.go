@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"s3migration/migration"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Subcommand argument values
+var (
+	waitJobIDs   []string
+	waitInterval time.Duration
+	waitTimeout  time.Duration
+	waitReport   string
+	waitRatio    float32
+	waitFailed   int64
+)
+
+func init() {
+	rootCmd.AddCommand(waitCommand)
+	waitCommand.Flags().StringSliceVar(&waitJobIDs, jobIDArgName, nil, "ID of the batch job to wait for, repeat or comma separate for several jobs")
+	waitCommand.Flags().DurationVar(&waitInterval, pollIntervalArgName, time.Minute, "[Optional] Interval between batch job status checks, eg. 30s, 5m")
+	waitCommand.Flags().DurationVar(&waitTimeout, pollTimeoutArgName, 0, "[Optional] Maximum time to wait for a batch job to complete, eg. 12h. Waits forever by default")
+	waitCommand.Flags().StringVar(&waitReport, reportFileArgName, "", "[Optional] Write the migration report of the jobs to this JSON file")
+	waitCommand.Flags().Float32Var(&waitRatio, successThresholdArgName, 0.8, "[Optional] Ratio of objects, between 0 and 1, the jobs must copy for the wait to succeed")
+	waitCommand.Flags().Int64Var(&waitFailed, maxFailedArgName, 0, "[Optional] Fail the wait when more objects than this failed to copy, even when the success threshold is met. 0 disables")
+	_ = waitCommand.MarkFlagRequired(jobIDArgName)
+}
+
+var waitCommand = &cobra.Command{
+	Use:          "wait",
+	Short:        "Wait for existing S3 batch jobs to complete and check the success threshold across them",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireFlags(cmd, accountIdArgName, regionArgName); err != nil {
+			return err
+		}
+		if waitInterval <= 0 {
+			return fmt.Errorf("input arg '%s' value '%v' must be greater than zero", pollIntervalArgName, waitInterval)
+		}
+		if waitTimeout < 0 {
+			return fmt.Errorf("input arg '%s' value '%v' must not be negative", pollTimeoutArgName, waitTimeout)
+		}
+		return validateSuccessThreshold(waitRatio, waitFailed)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		waitArgs := migration.MigrationArgs{
+			SourceRegion:        sourceRegion,
+			AccountID:           migrationAcctId,
+			SourceBucket:        migrationSrc,
+			ReqSuccessThreshold: waitRatio,
+			MaxFailedObjects:    waitFailed,
+			Quiet:               quiet,
+			Heartbeat:           startHeartbeat(),
+			PollInterval:        waitInterval,
+			PollTimeout:         waitTimeout,
+			ReportFile:          waitReport,
+		}
+		exitOn(migration.Wait(waitArgs, waitJobIDs))
+	},
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"s3migration/migration"
+	"s3migration/util"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// Subcommand argument values
+var (
+	resume bool
+)
+
+func init() {
+	rootCmd.AddCommand(watchCommand)
+	watchCommand.Flags().BoolVar(&resume, resumeArgName, false, "Reattach to the in-flight batch jobs recorded in the state file")
+}
+
+var watchCommand = &cobra.Command{
+	Use:          "watch",
+	Short:        "Watch in-flight S3 migration batch jobs, eg. after the machine running the migration rebooted",
+	SilenceUsage: false,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !resume {
+			return fmt.Errorf("nothing to watch, use --%s to reattach to the jobs recorded in the state file", resumeArgName)
+		}
+		if stateFile == "" && migrationSrc == "" {
+			return fmt.Errorf("either '%s' or '%s' is required to locate the state file", stateFileArgName, sourceBucketArgName)
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		stopOnSignal()
+		exitOn(migration.Resume(stateFilePath(), stateTable, sourceRegion, quiet, startHeartbeat()))
+	},
+	TraverseChildren: true,
+}
+
+// On SIGTERM or SIGINT, eg. Kubernetes or ECS stopping the pod or task, record the stop in the state and
+// print the command resuming the run, then exit leaving the batch jobs running
+func stopOnSignal() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-stop
+		phase, path := migration.StopRun(sig.String())
+		if path == "" {
+			zap.L().Warn("Stopped with nothing to resume, run again to start over",
+				zap.String("signal", sig.String()),
+				zap.String("phase", phase),
+			)
+		} else {
+			command := migration.ResumeCommand(path, stateTable, sourceRegion)
+			zap.L().Warn("Stopped, the batch jobs keep running. Resume watching them with the resume command",
+				zap.String("signal", sig.String()),
+				zap.String("phase", phase),
+				zap.String("stateFile", path),
+				zap.String("resume", command),
+			)
+			fmt.Fprintf(os.Stderr, "Resume with: %s\n", command)
+		}
+		util.ZapLogSync()
+		os.Exit(util.ExitStopped)
+	}()
+}
+
+// Exit code of a run, resume or wait returning err, see the util.Exit codes
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, migration.ErrThresholdNotMet):
+		return util.ExitThresholdNotMet
+	case errors.Is(err, migration.ErrInventoryPending):
+		return util.ExitInventoryTimeout
+	case err != nil:
+		return util.ExitFailed
+	case migration.CompletedWithFailures():
+		return util.ExitPartialSuccess
+	}
+	return util.ExitCompleted
+}
+
+// Log err if any and exit with its exit code, unless the migration completed
+func exitOn(err error) {
+	code := exitCode(err)
+	if err != nil {
+		log.Print(err)
+	}
+	if code != util.ExitCompleted {
+		util.ZapLogSync()
+		os.Exit(code)
+	}
+}
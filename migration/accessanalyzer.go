@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"s3migration/util"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+)
+
+// Sources of access findings
+const (
+	FindingSourceValidatePolicy = "validate-policy"
+	FindingSourcePublicAccess   = "public-access"
+	FindingSourceExternalAccess = "external-access"
+)
+
+// A policy validation issue or access exposure reported by IAM Access Analyzer
+type AccessFinding struct {
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	Code   string `json:"code,omitempty"`
+	Detail string `json:"detail"`
+}
+
+type accessAnalyzerAPI interface {
+	ValidatePolicy(ctx context.Context, policyDocument string) ([]AccessFinding, error)
+	CheckNoPublicAccess(ctx context.Context, policyDocument string) ([]AccessFinding, error)
+	ListActiveFindings(ctx context.Context, analyzerArn, resourceArn string) ([]AccessFinding, error)
+}
+
+// IAM Access Analyzer REST API client
+type accessAnalyzer struct {
+	client *util.AWSJSONClient
+}
+
+func newAccessAnalyzer(cfg aws.Config) *accessAnalyzer {
+	return &accessAnalyzer{client: util.NewAWSJSONClient(cfg, "access-analyzer", "access-analyzer")}
+}
+
+func (a *accessAnalyzer) ValidatePolicy(ctx context.Context, policyDocument string) ([]AccessFinding, error) {
+	var out struct {
+		Findings []struct {
+			FindingDetails string `json:"findingDetails"`
+			FindingType    string `json:"findingType"`
+			IssueCode      string `json:"issueCode"`
+		} `json:"findings"`
+	}
+	err := a.client.Do(ctx, http.MethodPost, "/policy/validation", nil, map[string]string{
+		"policyDocument":             policyDocument,
+		"policyType":                 "RESOURCE_POLICY",
+		"validatePolicyResourceType": "AWS::S3::Bucket",
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	findings := []AccessFinding{}
+	for _, f := range out.Findings {
+		findings = append(findings, AccessFinding{
+			Source: FindingSourceValidatePolicy,
+			Type:   f.FindingType,
+			Code:   f.IssueCode,
+			Detail: f.FindingDetails,
+		})
+	}
+	return findings, nil
+}
+
+func (a *accessAnalyzer) CheckNoPublicAccess(ctx context.Context, policyDocument string) ([]AccessFinding, error) {
+	var out struct {
+		Result  string `json:"result"`
+		Message string `json:"message"`
+	}
+	err := a.client.Do(ctx, http.MethodPost, "/policy/check-no-public-access", nil, map[string]string{
+		"policyDocument": policyDocument,
+		"resourceType":   "AWS::S3::Bucket",
+	}, &out)
+	if err != nil || out.Result != "FAIL" {
+		return nil, err
+	}
+	return []AccessFinding{{Source: FindingSourcePublicAccess, Type: "PUBLIC", Detail: out.Message}}, nil
+}
+
+// Active findings of the analyzer for the resource, following nextToken through every page
+func (a *accessAnalyzer) ListActiveFindings(ctx context.Context, analyzerArn, resourceArn string) ([]AccessFinding, error) {
+	findings := []AccessFinding{}
+	nextToken := ""
+	for {
+		var out struct {
+			Findings []struct {
+				ID        string            `json:"id"`
+				Principal map[string]string `json:"principal"`
+				Action    []string          `json:"action"`
+				IsPublic  bool              `json:"isPublic"`
+			} `json:"findings"`
+			NextToken string `json:"nextToken"`
+		}
+		in := map[string]any{
+			"analyzerArn": analyzerArn,
+			"filter": map[string]any{
+				"resource": map[string][]string{"eq": {resourceArn}},
+				"status":   map[string][]string{"eq": {"ACTIVE"}},
+			},
+		}
+		if nextToken != "" {
+			in["nextToken"] = nextToken
+		}
+		if err := a.client.Do(ctx, http.MethodPost, "/finding", nil, in, &out); err != nil {
+			return nil, err
+		}
+		for _, f := range out.Findings {
+			findingType := "EXTERNAL"
+			if f.IsPublic {
+				findingType = "PUBLIC"
+			}
+			findings = append(findings, AccessFinding{
+				Source: FindingSourceExternalAccess,
+				Type:   findingType,
+				Code:   f.ID,
+				Detail: fmt.Sprintf("principal %v allowed %s", f.Principal, strings.Join(f.Action, ", ")),
+			})
+		}
+		if out.NextToken == "" {
+			return findings, nil
+		}
+		nextToken = out.NextToken
+	}
+}
+
+// Run Access Analyzer against the bucket's policy.  Buckets without a policy have no findings.
+// External access findings are only listed when an analyzer ARN is given.
+func (s3obj *s3migration) checkBucketPolicyExposure(ctx context.Context, bucket, analyzerArn string) ([]AccessFinding, error) {
+	out, err := s3obj.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		var ae smithy.APIError
+		if errors.As(err, &ae) && ae.ErrorCode() == "NoSuchBucketPolicy" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	findings, err := s3obj.analyzer.ValidatePolicy(ctx, *out.Policy)
+	if err != nil {
+		return nil, err
+	}
+	public, err := s3obj.analyzer.CheckNoPublicAccess(ctx, *out.Policy)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, public...)
+	if analyzerArn != "" {
+		external, err := s3obj.analyzer.ListActiveFindings(ctx, analyzerArn, *util.GetArn(s3obj.cfg.Region, bucket))
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, external...)
+	}
+	for _, f := range findings {
+		zap.L().Warn("Access Analyzer finding on destination bucket policy",
+			zap.String("bucket", bucket),
+			zap.String("source", f.Source),
+			zap.String("type", f.Type),
+			zap.String("code", f.Code),
+			zap.String("detail", f.Detail),
+		)
+	}
+	return findings, nil
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+type analyzerMock struct{}
+
+func (a *analyzerMock) ValidatePolicy(ctx context.Context, policyDocument string) ([]AccessFinding, error) {
+	return []AccessFinding{{Source: FindingSourceValidatePolicy, Type: "SECURITY_WARNING", Code: "PASS_ROLE_WITH_STAR_IN_RESOURCE"}}, nil
+}
+
+func (a *analyzerMock) CheckNoPublicAccess(ctx context.Context, policyDocument string) ([]AccessFinding, error) {
+	return nil, nil
+}
+
+func (a *analyzerMock) ListActiveFindings(ctx context.Context, analyzerArn, resourceArn string) ([]AccessFinding, error) {
+	return []AccessFinding{{Source: FindingSourceExternalAccess, Type: "EXTERNAL", Detail: resourceArn}}, nil
+}
+
+func TestCheckBucketPolicyExposure(t *testing.T) {
+	// No bucket policy means nothing to analyze
+	s3mig = &s3migration{s3Client: new(mock), analyzer: new(analyzerMock)}
+	findings, err := s3mig.checkBucketPolicyExposure(context.TODO(), "dummybucket", "")
+	assert.NoError(t, err)
+	assert.Empty(t, findings)
+
+	s3mig = &s3migration{s3Client: &mock{bucketPolicy: `{"Version":"2012-10-17","Statement":[]}`}, analyzer: new(analyzerMock)}
+	findings, err = s3mig.checkBucketPolicyExposure(context.TODO(), "dummybucket", "")
+	assert.NoError(t, err)
+	assert.Len(t, findings, 1)
+
+	findings, err = s3mig.checkBucketPolicyExposure(context.TODO(), "dummybucket", "arn:aws:access-analyzer:us-east-1:111122223333:analyzer/test")
+	assert.NoError(t, err)
+	assert.Len(t, findings, 2)
+	assert.Equal(t, "arn:aws:s3:::dummybucket", findings[1].Detail)
+}
+
+func TestAccessAnalyzerListActiveFindings(t *testing.T) {
+	var tokens []any
+	throttled := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !throttled {
+			throttled = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"__type": "ThrottlingException", "message": "slow down"}`))
+			return
+		}
+		var in map[string]any
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &in)
+		tokens = append(tokens, in["nextToken"])
+		if in["nextToken"] == nil {
+			_, _ = w.Write([]byte(`{"findings": [{"id": "one", "isPublic": true, "action": ["s3:GetObject"]}], "nextToken": "page2"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"findings": [{"id": "two", "principal": {"AWS": "444455556666"}, "action": ["s3:PutObject"]}]}`))
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", BaseEndpoint: aws.String(server.URL), Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	}), Retryer: func() aws.Retryer {
+		return retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) { return 0, nil })
+		})
+	}}
+	findings, err := newAccessAnalyzer(cfg).ListActiveFindings(context.TODO(), "arn:aws:access-analyzer:us-east-1:111122223333:analyzer/test", "arn:aws:s3:::dummybucket")
+	assert.NoError(t, err)
+	// The throttled request is retried, then every page is read
+	assert.Equal(t, []any{nil, "page2"}, tokens)
+	assert.Len(t, findings, 2)
+	assert.Equal(t, "PUBLIC", findings[0].Type)
+	assert.Equal(t, "two", findings[1].Code)
+}
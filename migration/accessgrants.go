@@ -0,0 +1,137 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+type dataAccessAPI interface {
+	GetDataAccess(ctx context.Context, params *s3control.GetDataAccessInput, optFns ...func(*s3control.Options)) (*s3control.GetDataAccessOutput, error)
+}
+
+// Temporary credentials for a bucket's objects vended by S3 Access Grants, cached until shortly before
+// they expire
+func accessGrantsCredentials(api dataAccessAPI, accountID, bucket string, permission s3controltypes.Permission) aws.CredentialsProvider {
+	target := fmt.Sprintf("s3://%s/*", bucket)
+	return aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		out, err := api.GetDataAccess(ctx, &s3control.GetDataAccessInput{
+			AccountId:  aws.String(accountID),
+			Target:     aws.String(target),
+			Permission: permission,
+			Privilege:  s3controltypes.PrivilegeDefault,
+		})
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("unable to get %s access to %s from S3 Access Grants: %w", permission, target, err)
+		}
+		if out.Credentials == nil {
+			return aws.Credentials{}, fmt.Errorf("S3 Access Grants returned no credentials for %s", target)
+		}
+		zap.L().Info("Got temporary credentials from S3 Access Grants",
+			zap.String("target", target),
+			zap.String("matchedGrant", aws.ToString(out.MatchedGrantTarget)),
+			zap.String("permission", string(permission)),
+		)
+		creds := aws.Credentials{
+			AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(out.Credentials.SessionToken),
+			Source:          "S3AccessGrants",
+		}
+		if out.Credentials.Expiration != nil {
+			creds.CanExpire = true
+			creds.Expires = *out.Credentials.Expiration
+		}
+		return creds, nil
+	}))
+}
+
+// S3 client whose object operations on the granted buckets use credentials from S3 Access Grants.  Access
+// Grants only cover objects, so bucket configuration calls still use the tool's own credentials.
+type accessGrantsClient struct {
+	s3API
+	credentials map[string]aws.CredentialsProvider // By bucket
+}
+
+// Wrap the S3 client so the source bucket's objects are read and written (for the manifests kept there,
+// unless they are kept in --inventory-dest-bucket) with Access Grants credentials, and the destination's
+// read, or written when deletes are replayed
+func newAccessGrantsClient(client s3API, api dataAccessAPI, args MigrationArgs) *accessGrantsClient {
+	source := s3controltypes.PermissionReadwrite
+	if args.InventoryBucket != "" {
+		source = s3controltypes.PermissionRead
+	}
+	destination := s3controltypes.PermissionRead
+	if args.ReplayDeletes {
+		destination = s3controltypes.PermissionReadwrite
+	}
+	return &accessGrantsClient{
+		s3API: client,
+		credentials: map[string]aws.CredentialsProvider{
+			args.SourceBucket:      accessGrantsCredentials(api, args.AccountID, args.SourceBucket, source),
+			args.DestinationBucket: accessGrantsCredentials(api, args.AccountID, args.DestinationBucket, destination),
+		},
+	}
+}
+
+// Options for a call on bucket, using its Access Grants credentials when it has any
+func (c *accessGrantsClient) options(bucket *string, optFns []func(*s3.Options)) []func(*s3.Options) {
+	provider, ok := c.credentials[aws.ToString(bucket)]
+	if !ok {
+		return optFns
+	}
+	return append(optFns[:len(optFns):len(optFns)], func(o *s3.Options) { o.Credentials = provider })
+}
+
+func (c *accessGrantsClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return c.s3API.ListObjectsV2(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	return c.s3API.ListObjectVersions(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return c.s3API.GetObject(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return c.s3API.HeadObject(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return c.s3API.PutObject(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error) {
+	return c.s3API.SelectObjectContent(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return c.s3API.UploadPart(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return c.s3API.CreateMultipartUpload(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return c.s3API.CompleteMultipartUpload(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return c.s3API.AbortMultipartUpload(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	return c.s3API.DeleteObjects(ctx, params, c.options(params.Bucket, optFns)...)
+}
+
+func (c *accessGrantsClient) GetObjectAcl(ctx context.Context, params *s3.GetObjectAclInput, optFns ...func(*s3.Options)) (*s3.GetObjectAclOutput, error) {
+	return c.s3API.GetObjectAcl(ctx, params, c.options(params.Bucket, optFns)...)
+}
@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type dataAccessMock struct {
+	requests []*s3control.GetDataAccessInput
+	err      error
+}
+
+func (m *dataAccessMock) GetDataAccess(ctx context.Context, params *s3control.GetDataAccessInput, optFns ...func(*s3control.Options)) (*s3control.GetDataAccessOutput, error) {
+	m.requests = append(m.requests, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &s3control.GetDataAccessOutput{Credentials: &s3controltypes.Credentials{
+		AccessKeyId:     aws.String("AKID-" + string(params.Permission)),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+func grantedCredentials(t *testing.T, c *accessGrantsClient, bucket string) *aws.Credentials {
+	o := &s3.Options{}
+	for _, fn := range c.options(aws.String(bucket), nil) {
+		fn(o)
+	}
+	if o.Credentials == nil {
+		return nil
+	}
+	creds, err := o.Credentials.Retrieve(context.TODO())
+	assert.NoError(t, err)
+	return &creds
+}
+
+func TestAccessGrantsClient(t *testing.T) {
+	api := &dataAccessMock{}
+	c := newAccessGrantsClient(new(mock), api, MigrationArgs{AccountID: "111122223333", SourceBucket: "src", DestinationBucket: "dst"})
+
+	creds := grantedCredentials(t, c, "src")
+	assert.Equal(t, "AKID-READWRITE", creds.AccessKeyID)
+	assert.True(t, creds.CanExpire)
+	assert.Equal(t, "AKID-READ", grantedCredentials(t, c, "dst").AccessKeyID)
+	// Other buckets, eg. a shared inventory destination, use the tool's credentials
+	assert.Nil(t, grantedCredentials(t, c, "inventory"))
+
+	// Credentials are cached until they expire
+	grantedCredentials(t, c, "src")
+	assert.Len(t, api.requests, 2)
+	assert.Equal(t, "s3://src/*", *api.requests[0].Target)
+	assert.Equal(t, "111122223333", *api.requests[0].AccountId)
+
+	// Replaying deletes writes to the destination
+	c = newAccessGrantsClient(new(mock), api, MigrationArgs{SourceBucket: "src", DestinationBucket: "dst", ReplayDeletes: true})
+	assert.Equal(t, "AKID-READWRITE", grantedCredentials(t, c, "dst").AccessKeyID)
+}
+
+func TestAccessGrantsCredentialsError(t *testing.T) {
+	provider := accessGrantsCredentials(&dataAccessMock{err: errors.New("AccessDenied")}, "111122223333", "src", s3controltypes.PermissionRead)
+	_, err := provider.Retrieve(context.TODO())
+	assert.ErrorContains(t, err, "s3://src/*")
+}
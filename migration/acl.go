@@ -0,0 +1,190 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
+)
+
+// Grant permissions as named in --grant, eg. read=id:<canonical user ID>
+var grantPermissions = map[string]s3controltypes.S3Permission{
+	"read":         s3controltypes.S3PermissionRead,
+	"write":        s3controltypes.S3PermissionWrite,
+	"read-acp":     s3controltypes.S3PermissionReadAcp,
+	"write-acp":    s3controltypes.S3PermissionWriteAcp,
+	"full-control": s3controltypes.S3PermissionFullControl,
+}
+
+// Parse a grant of the form permission=type:identifier, where type is id, emailAddress or uri,
+// eg. read=uri:http://acs.amazonaws.com/groups/global/AuthenticatedUsers
+func ParseGrant(s string) (s3controltypes.S3Grant, error) {
+	name, grantee, _ := strings.Cut(s, "=")
+	permission, ok := grantPermissions[name]
+	if !ok {
+		return s3controltypes.S3Grant{}, fmt.Errorf("grant '%s' has an unknown permission, eg. read or full-control", s)
+	}
+	typ, id, _ := strings.Cut(grantee, ":")
+	if id == "" {
+		return s3controltypes.S3Grant{}, fmt.Errorf("grant '%s' has no grantee, eg. id:<canonical user ID>", s)
+	}
+	g := s3controltypes.S3Grant{
+		Grantee:    &s3controltypes.S3Grantee{TypeIdentifier: s3controltypes.S3GranteeTypeIdentifier(typ), Identifier: aws.String(id)},
+		Permission: permission,
+	}
+	if !slices.Contains(g.Grantee.TypeIdentifier.Values(), g.Grantee.TypeIdentifier) {
+		return s3controltypes.S3Grant{}, fmt.Errorf("grant '%s' has an unknown grantee type, eg. id, emailAddress or uri", s)
+	}
+	return g, nil
+}
+
+// Read grants from a JSON file in the AccessControlGrants format of the S3 Batch Operations copy operation
+func LoadGrantsFile(path string) ([]s3controltypes.S3Grant, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	grants := []s3controltypes.S3Grant{}
+	if err := json.Unmarshal(body, &grants); err != nil {
+		return nil, fmt.Errorf("grants file %s is corrupt or malformed: %w", path, err)
+	}
+	for _, g := range grants {
+		if g.Grantee == nil || aws.ToString(g.Grantee.Identifier) == "" || g.Permission == "" {
+			return nil, fmt.Errorf("grants file %s has a grant without a grantee or permission", path)
+		}
+	}
+	return grants, nil
+}
+
+// ACL grants of a source object.  Objects only granting their owner full control, the default private
+// ACL, have no grants so the copy's ACL is left to the copy operation.
+type aclSettings struct {
+	Grants []s3controltypes.S3Grant
+}
+
+func grantString(g s3controltypes.S3Grant) string {
+	return fmt.Sprintf("%s=%s:%s", g.Permission, g.Grantee.TypeIdentifier, aws.ToString(g.Grantee.Identifier))
+}
+
+func (a aclSettings) key() string {
+	keys := make([]string, len(a.Grants))
+	for i, g := range a.Grants {
+		keys[i] = grantString(g)
+	}
+	return strings.Join(keys, ",")
+}
+
+func (a aclSettings) apply(op *s3controltypes.S3CopyObjectOperation) {
+	if len(a.Grants) > 0 {
+		op.AccessControlGrants = a.Grants
+		op.CannedAccessControlList = ""
+	}
+}
+
+// Convert an object's ACL to copy operation grants, in a stable order
+func aclOf(out *s3.GetObjectAclOutput) aclSettings {
+	a := aclSettings{}
+	for _, g := range out.Grants {
+		if g.Grantee == nil {
+			continue
+		}
+		grantee := &s3controltypes.S3Grantee{DisplayName: g.Grantee.DisplayName}
+		switch g.Grantee.Type {
+		case s3types.TypeCanonicalUser:
+			grantee.TypeIdentifier, grantee.Identifier = s3controltypes.S3GranteeTypeIdentifierCanonical, g.Grantee.ID
+		case s3types.TypeAmazonCustomerByEmail:
+			grantee.TypeIdentifier, grantee.Identifier = s3controltypes.S3GranteeTypeIdentifierEmailAddress, g.Grantee.EmailAddress
+		case s3types.TypeGroup:
+			grantee.TypeIdentifier, grantee.Identifier = s3controltypes.S3GranteeTypeIdentifierGroup, g.Grantee.URI
+		default:
+			continue
+		}
+		a.Grants = append(a.Grants, s3controltypes.S3Grant{Grantee: grantee, Permission: s3controltypes.S3Permission(g.Permission)})
+	}
+	slices.SortFunc(a.Grants, func(x, y s3controltypes.S3Grant) int { return strings.Compare(grantString(x), grantString(y)) })
+	if len(a.Grants) == 1 && out.Owner != nil && a.Grants[0].Permission == s3controltypes.S3PermissionFullControl &&
+		a.Grants[0].Grantee.TypeIdentifier == s3controltypes.S3GranteeTypeIdentifierCanonical &&
+		aws.ToString(a.Grants[0].Grantee.Identifier) == aws.ToString(out.Owner.ID) {
+		return aclSettings{}
+	}
+	return a
+}
+
+// Read an object's ACL
+func (s3obj *s3migration) readACL(ctx context.Context, bucket, key, versionID string) (copySetting, error) {
+	input := &s3.GetObjectAclInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	out, err := s3obj.s3Client.GetObjectAcl(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ACL of %s: %w", key, err)
+	}
+	return aclOf(out), nil
+}
+
+// Split each job by the ACLs of its objects, so each copy job grants what the objects it copies grant.
+// Jobs whose objects all have the default private ACL are kept as they are.
+func (s3obj *s3migration) splitStepsByACL(ctx context.Context, steps []*jobStep, concurrency int) ([]*jobStep, error) {
+	return s3obj.splitStepsBySetting(ctx, steps, concurrency, "acl", s3obj.readACL)
+}
+
+// Object ownership names as used on the command line, eg. bucket-owner-enforced
+var OwnershipNames = map[string]s3types.ObjectOwnership{
+	"bucket-owner-enforced":  s3types.ObjectOwnershipBucketOwnerEnforced,
+	"bucket-owner-preferred": s3types.ObjectOwnershipBucketOwnerPreferred,
+	"object-writer":          s3types.ObjectOwnershipObjectWriter,
+}
+
+// Object ownership of a bucket.  Buckets without ownership controls behave as ObjectWriter.
+func (s3obj *s3migration) bucketOwnership(ctx context.Context, bucket string) (s3types.ObjectOwnership, error) {
+	out, err := s3obj.s3Client.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{Bucket: aws.String(bucket)})
+	var ae smithy.APIError
+	if errors.As(err, &ae) && ae.ErrorCode() == "OwnershipControlsNotFoundError" {
+		return s3types.ObjectOwnershipObjectWriter, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if out.OwnershipControls == nil || len(out.OwnershipControls.Rules) == 0 {
+		return s3types.ObjectOwnershipObjectWriter, nil
+	}
+	return out.OwnershipControls.Rules[0].ObjectOwnership, nil
+}
+
+// Fail unless the bucket's object ownership is the expected one, including when it can't be read
+func (s3obj *s3migration) assertOwnership(ctx context.Context, bucket string, expected s3types.ObjectOwnership) error {
+	ownership, err := s3obj.bucketOwnership(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("unable to read object ownership of bucket %s: %w", bucket, err)
+	}
+	if ownership != expected {
+		return fmt.Errorf("bucket %s object ownership is %s, expected %s", bucket, ownership, expected)
+	}
+	return nil
+}
+
+// Copied objects can only have ACLs when the destination bucket's object ownership isn't enforced
+func (s3obj *s3migration) checkACLsEnabled(ctx context.Context, bucket string) error {
+	enforced, err := s3obj.isOwnershipEnforced(ctx, bucket)
+	var ae smithy.APIError
+	if errors.As(err, &ae) && ae.ErrorCode() == "OwnershipControlsNotFoundError" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if enforced {
+		return fmt.Errorf("bucket %s has ACLs disabled, its object ownership is %s", bucket, s3types.ObjectOwnershipBucketOwnerEnforced)
+	}
+	return nil
+}
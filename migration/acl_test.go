@@ -0,0 +1,141 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGrant(t *testing.T) {
+	g, err := ParseGrant("read=uri:http://acs.amazonaws.com/groups/global/AuthenticatedUsers")
+	assert.NoError(t, err)
+	assert.Equal(t, s3controltypes.S3PermissionRead, g.Permission)
+	assert.Equal(t, s3controltypes.S3GranteeTypeIdentifierGroup, g.Grantee.TypeIdentifier)
+	assert.Equal(t, "http://acs.amazonaws.com/groups/global/AuthenticatedUsers", *g.Grantee.Identifier)
+
+	g, err = ParseGrant("full-control=id:79a59df900b949e55d96a1e698fbacedfd6e09d98eacf8f8d5218e7cd47ef2be")
+	assert.NoError(t, err)
+	assert.Equal(t, s3controltypes.S3PermissionFullControl, g.Permission)
+	assert.Equal(t, s3controltypes.S3GranteeTypeIdentifierCanonical, g.Grantee.TypeIdentifier)
+
+	for _, bad := range []string{"", "read", "read=id:", "list=id:abc", "read=user:abc", "read=abc"} {
+		_, err = ParseGrant(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestLoadGrantsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grants.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[
+		{"Grantee": {"TypeIdentifier": "emailAddress", "Identifier": "owner@example.com"}, "Permission": "READ"}
+	]`), 0600))
+	grants, err := LoadGrantsFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, grants, 1)
+	assert.Equal(t, s3controltypes.S3GranteeTypeIdentifierEmailAddress, grants[0].Grantee.TypeIdentifier)
+	assert.Equal(t, s3controltypes.S3PermissionRead, grants[0].Permission)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"Permission": "READ"}]`), 0600))
+	_, err = LoadGrantsFile(path)
+	assert.Error(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(`{`), 0600))
+	_, err = LoadGrantsFile(path)
+	assert.Error(t, err)
+}
+
+func ownerACL(extra ...s3types.Grant) *s3.GetObjectAclOutput {
+	owner := &s3types.Owner{ID: aws.String("owner")}
+	grants := append([]s3types.Grant{{Grantee: &s3types.Grantee{Type: s3types.TypeCanonicalUser, ID: owner.ID}, Permission: s3types.PermissionFullControl}}, extra...)
+	return &s3.GetObjectAclOutput{Owner: owner, Grants: grants}
+}
+
+var publicRead = s3types.Grant{
+	Grantee:    &s3types.Grantee{Type: s3types.TypeGroup, URI: aws.String("http://acs.amazonaws.com/groups/global/AllUsers")},
+	Permission: s3types.PermissionRead,
+}
+
+func TestACLOf(t *testing.T) {
+	// The default private ACL
+	assert.Equal(t, "", aclOf(ownerACL()).key())
+
+	acl := aclOf(ownerACL(publicRead))
+	assert.Equal(t, "FULL_CONTROL=id:owner,READ=uri:http://acs.amazonaws.com/groups/global/AllUsers", acl.key())
+	op := &s3controltypes.S3CopyObjectOperation{}
+	acl.apply(op)
+	assert.Len(t, op.AccessControlGrants, 2)
+	assert.Empty(t, op.CannedAccessControlList)
+}
+
+func TestSplitStepsByACL(t *testing.T) {
+	m := &mock{
+		objects: map[string]string{"manifest.csv": "src,a\nsrc,b\nsrc,c\n"},
+		acls: map[string]*s3.GetObjectAclOutput{
+			"a": ownerACL(publicRead),
+			"b": ownerACL(),
+			"c": ownerACL(publicRead),
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	jobArgs := &batchJobArgs{
+		TargetBucketName:   aws.String("dst"),
+		ManifestArn:        aws.String("arn:aws:s3:::src/manifest.csv"),
+		VersioningDisabled: true,
+		PreserveACL:        true,
+	}
+	input := NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Empty(t, input.Operation.S3PutObjectCopy.CannedAccessControlList)
+
+	split, err := s3mig.splitStepsByACL(context.TODO(), []*jobStep{{Kind: jobKindNonVersion, Input: input}}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, split, 2)
+	assert.Equal(t, "src,b\n", m.objects["manifest-acl-001.csv"])
+	assert.Empty(t, split[0].Input.Operation.S3PutObjectCopy.AccessControlGrants)
+	assert.Equal(t, "src,a\nsrc,c\n", m.objects["manifest-acl-002.csv"])
+	assert.Len(t, split[1].Input.Operation.S3PutObjectCopy.AccessControlGrants, 2)
+
+	// Objects whose ACL can't be read fail the plan
+	delete(m.acls, "c")
+	_, err = s3mig.splitStepsByACL(context.TODO(), []*jobStep{{Kind: jobKindNonVersion, Input: input}}, 2)
+	assert.Error(t, err)
+}
+
+func TestSetJobOperationGrants(t *testing.T) {
+	g, err := ParseGrant("read=id:reader")
+	assert.NoError(t, err)
+	s3mig := &s3migration{s3Client: &mock{objectOwnership: s3types.ObjectOwnershipBucketOwnerEnforced}}
+	jobArgs := &batchJobArgs{TargetBucketName: aws.String("dst"), Grants: []s3controltypes.S3Grant{g}}
+	input := NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Equal(t, []s3controltypes.S3Grant{g}, input.Operation.S3PutObjectCopy.AccessControlGrants)
+	assert.Empty(t, input.Operation.S3PutObjectCopy.CannedAccessControlList)
+}
+
+func TestCheckACLsEnabled(t *testing.T) {
+	s3mig := &s3migration{s3Client: &mock{objectOwnership: s3types.ObjectOwnershipBucketOwnerPreferred}}
+	assert.NoError(t, s3mig.checkACLsEnabled(context.TODO(), "dst"))
+	s3mig = &s3migration{s3Client: &mock{objectOwnership: s3types.ObjectOwnershipBucketOwnerEnforced}}
+	assert.Error(t, s3mig.checkACLsEnabled(context.TODO(), "dst"))
+}
+
+func TestAssertOwnership(t *testing.T) {
+	s3mig := &s3migration{s3Client: &mock{objectOwnership: s3types.ObjectOwnershipBucketOwnerEnforced}}
+	assert.NoError(t, s3mig.assertOwnership(context.TODO(), "dst", s3types.ObjectOwnershipBucketOwnerEnforced))
+	assert.ErrorContains(t, s3mig.assertOwnership(context.TODO(), "dst", s3types.ObjectOwnershipObjectWriter), "object ownership is BucketOwnerEnforced")
+
+	// Buckets without ownership controls are ObjectWriter
+	s3mig = &s3migration{s3Client: &mock{ownershipErr: &smithy.GenericAPIError{Code: "OwnershipControlsNotFoundError"}}}
+	assert.NoError(t, s3mig.assertOwnership(context.TODO(), "dst", s3types.ObjectOwnershipObjectWriter))
+
+	// Unlike the canned ACL selection, an unreadable ownership fails the assertion
+	s3mig = &s3migration{s3Client: &mock{ownershipErr: &smithy.GenericAPIError{Code: "AccessDenied"}}}
+	assert.Error(t, s3mig.assertOwnership(context.TODO(), "dst", s3types.ObjectOwnershipObjectWriter))
+}
@@ -0,0 +1,307 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"s3migration/util"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Bucket-level settings copied by MigrateBucketConfig
+const (
+	BucketConfigVersioning        = "versioning"
+	BucketConfigEncryption        = "encryption"
+	BucketConfigOwnership         = "ownership"
+	BucketConfigPublicAccessBlock = "public-access-block"
+	BucketConfigLifecycle         = "lifecycle"
+	BucketConfigPolicy            = "policy"
+	BucketConfigNotifications     = "notifications"
+	BucketConfigCORS              = "cors"
+	BucketConfigWebsite           = "website"
+	BucketConfigTags              = "tags"
+	BucketConfigLogging           = "logging"
+)
+
+// Every bucket-level setting, in the order they are copied.  Versioning comes first as other settings,
+// eg. replication, require it.
+var BucketConfigs = []string{BucketConfigVersioning, BucketConfigEncryption, BucketConfigOwnership, BucketConfigPublicAccessBlock,
+	BucketConfigLifecycle, BucketConfigPolicy, BucketConfigNotifications, BucketConfigCORS, BucketConfigWebsite,
+	BucketConfigTags, BucketConfigLogging}
+
+// Outcomes of copying a bucket setting
+const (
+	settingCopied   = "copied"
+	settingAbsent   = "absent"   // The source doesn't have it
+	settingExported = "exported" // Written to a file for review rather than copied
+)
+
+type BucketConfigArgs struct {
+	SourceRegion      string
+	SourceBucket      string
+	DestinationBucket string
+	AccountID         string            // Account event notifications are sent from, checked against the targets' source account conditions when set
+	Configs           []string          // Settings to copy, see BucketConfigs
+	LifecycleFile     string            // Lifecycle rules applied instead of the source's, eg. once reviewed
+	LifecycleExport   string            // File the source's lifecycle rules are written to for review, instead of being copied
+	PolicyMapping     map[string]string // Values replaced in the source's bucket policy, eg. account IDs or principal ARNs
+	PolicyFile        string            // Bucket policy applied instead of the source's translated one, eg. once reviewed
+	PolicyExport      string            // File the translated bucket policy is written to for review, instead of being applied
+	LogTargetBucket   string            // Bucket access logs are delivered to instead of the source's target
+	AnalyzerArn       string            // Access Analyzer listing external access findings for the copied policy, when set
+}
+
+// Outcome of MigrateBucketConfig, the names of the settings in each case
+type BucketConfigSummary struct {
+	Copied   []string `json:"copied"`
+	Absent   []string `json:"absent"`   // The source doesn't have them, so the destination keeps its own
+	Exported []string `json:"exported"` // Written to a file for review
+	Failed   []string `json:"failed"`
+	// Access Analyzer findings on the destination's policy once copied
+	AccessFindings []AccessFinding `json:"accessFindings,omitempty"`
+}
+
+// Copies a setting from the source bucket to the destination, returning the outcome, eg. settingCopied
+type bucketSetting struct {
+	name string
+	copy func(ctx context.Context, source, destination string) (string, error)
+}
+
+// The settings of args.Configs
+func (s3obj *s3migration) bucketSettings(args BucketConfigArgs) []bucketSetting {
+	all := map[string]func(ctx context.Context, source, destination string) (string, error){
+		BucketConfigVersioning:        s3obj.copyVersioning,
+		BucketConfigEncryption:        s3obj.copyEncryption,
+		BucketConfigOwnership:         s3obj.copyOwnership,
+		BucketConfigPublicAccessBlock: s3obj.copyPublicAccessBlock,
+		BucketConfigLifecycle: func(ctx context.Context, source, destination string) (string, error) {
+			return s3obj.copyLifecycle(ctx, source, destination, args.LifecycleFile, args.LifecycleExport)
+		},
+		BucketConfigPolicy: func(ctx context.Context, source, destination string) (string, error) {
+			return s3obj.copyPolicy(ctx, source, destination, args.PolicyMapping, args.PolicyFile, args.PolicyExport)
+		},
+		BucketConfigNotifications: func(ctx context.Context, source, destination string) (string, error) {
+			return s3obj.copyNotifications(ctx, source, destination, args.AccountID)
+		},
+		BucketConfigCORS:    s3obj.copyCORS,
+		BucketConfigWebsite: s3obj.copyWebsite,
+		BucketConfigTags:    s3obj.copyTags,
+		BucketConfigLogging: func(ctx context.Context, source, destination string) (string, error) {
+			return s3obj.copyLogging(ctx, source, destination, args.LogTargetBucket)
+		},
+	}
+	settings := []bucketSetting{}
+	for _, name := range args.Configs {
+		settings = append(settings, bucketSetting{name: name, copy: all[name]})
+	}
+	return settings
+}
+
+// Copy bucket-level configuration from the source bucket to the destination, so the destination behaves like
+// the source from the cutover.  Each setting is copied even when another fails, the failures are returned
+// together.  A copied policy is checked with Access Analyzer, as it may grant access outside the destination's
+// account the source's didn't.
+func MigrateBucketConfig(args BucketConfigArgs) (*BucketConfigSummary, error) {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", args.SourceRegion),
+			zap.Error(err),
+		)
+	}
+	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg), targets: newNotificationTargets(cfg), analyzer: newAccessAnalyzer(cfg), cfg: cfg}
+	return s3mig.migrateBucketConfig(ctx, args)
+}
+
+func (s3obj *s3migration) migrateBucketConfig(ctx context.Context, args BucketConfigArgs) (*BucketConfigSummary, error) {
+	summary := &BucketConfigSummary{Copied: []string{}, Absent: []string{}, Exported: []string{}, Failed: []string{}}
+	var errs []error
+	for _, setting := range s3obj.bucketSettings(args) {
+		outcome, err := setting.copy(ctx, args.SourceBucket, args.DestinationBucket)
+		switch {
+		case err != nil:
+			zap.L().Error("Failed to copy bucket setting", zap.String("setting", setting.name), zap.Error(err))
+			summary.Failed = append(summary.Failed, setting.name)
+			errs = append(errs, fmt.Errorf("%s: %w", setting.name, err))
+		case outcome == settingCopied:
+			summary.Copied = append(summary.Copied, setting.name)
+		case outcome == settingExported:
+			summary.Exported = append(summary.Exported, setting.name)
+		default:
+			zap.L().Info("Source bucket has no such setting, destination keeps its own", zap.String("setting", setting.name))
+			summary.Absent = append(summary.Absent, setting.name)
+		}
+	}
+	if s3obj.analyzer != nil && slices.Contains(summary.Copied, BucketConfigPolicy) {
+		findings, err := s3obj.checkBucketPolicyExposure(ctx, args.DestinationBucket, args.AnalyzerArn)
+		if err != nil {
+			zap.L().Error("Failed to check destination bucket policy with Access Analyzer", zap.Error(err))
+		}
+		summary.AccessFindings = findings
+	}
+	zap.L().Info("Copied bucket configuration",
+		zap.String("source", args.SourceBucket),
+		zap.String("destination", args.DestinationBucket),
+		zap.Strings("copied", summary.Copied),
+		zap.Strings("absent", summary.Absent),
+		zap.Strings("exported", summary.Exported),
+		zap.Strings("failed", summary.Failed),
+		zap.Int("accessFindings", len(summary.AccessFindings)),
+	)
+	return summary, errors.Join(errs...)
+}
+
+// Only enabled versioning is copied, suspending it on a destination that was never versioned would version it
+func (s3obj *s3migration) copyVersioning(ctx context.Context, source, destination string) (string, error) {
+	versioning, err := s3obj.s3Client.GetBucketVersioning(ctx, &s3.GetBucketVersioningInput{Bucket: aws.String(source)})
+	if err != nil {
+		return "", err
+	}
+	if versioning.Status != s3types.BucketVersioningStatusEnabled {
+		return settingAbsent, nil
+	}
+	if _, err := s3obj.s3Client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(destination),
+		VersioningConfiguration: &s3types.VersioningConfiguration{Status: s3types.BucketVersioningStatusEnabled},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Enabled versioning on destination bucket", zap.String("bucket", destination))
+	return settingCopied, nil
+}
+
+func (s3obj *s3migration) copyEncryption(ctx context.Context, source, destination string) (string, error) {
+	encryption, err := s3obj.s3Client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(source)})
+	if isAPIErrorCode(err, "ServerSideEncryptionConfigurationNotFoundError") {
+		return settingAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if encryption.ServerSideEncryptionConfiguration == nil {
+		return settingAbsent, nil
+	}
+	if _, err := s3obj.s3Client.PutBucketEncryption(ctx, &s3.PutBucketEncryptionInput{
+		Bucket:                            aws.String(destination),
+		ServerSideEncryptionConfiguration: encryption.ServerSideEncryptionConfiguration,
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied default encryption to destination bucket", zap.String("bucket", destination))
+	return settingCopied, nil
+}
+
+func (s3obj *s3migration) copyOwnership(ctx context.Context, source, destination string) (string, error) {
+	ownership, err := s3obj.s3Client.GetBucketOwnershipControls(ctx, &s3.GetBucketOwnershipControlsInput{Bucket: aws.String(source)})
+	if isAPIErrorCode(err, "OwnershipControlsNotFoundError") {
+		return settingAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if ownership.OwnershipControls == nil {
+		return settingAbsent, nil
+	}
+	if _, err := s3obj.s3Client.PutBucketOwnershipControls(ctx, &s3.PutBucketOwnershipControlsInput{
+		Bucket:            aws.String(destination),
+		OwnershipControls: ownership.OwnershipControls,
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied object ownership to destination bucket", zap.String("bucket", destination))
+	return settingCopied, nil
+}
+
+// New buckets block all public access, so a source without a block doesn't loosen it
+func (s3obj *s3migration) copyPublicAccessBlock(ctx context.Context, source, destination string) (string, error) {
+	block, err := s3obj.s3Client.GetPublicAccessBlock(ctx, &s3.GetPublicAccessBlockInput{Bucket: aws.String(source)})
+	if isAPIErrorCode(err, "NoSuchPublicAccessBlockConfiguration") {
+		return settingAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if block.PublicAccessBlockConfiguration == nil {
+		return settingAbsent, nil
+	}
+	if _, err := s3obj.s3Client.PutPublicAccessBlock(ctx, &s3.PutPublicAccessBlockInput{
+		Bucket:                         aws.String(destination),
+		PublicAccessBlockConfiguration: block.PublicAccessBlockConfiguration,
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied public access block to destination bucket", zap.String("bucket", destination))
+	return settingCopied, nil
+}
+
+// Tags with the reserved aws: prefix, eg. CloudFormation's, can't be put and are left out
+func (s3obj *s3migration) copyTags(ctx context.Context, source, destination string) (string, error) {
+	tagging, err := s3obj.s3Client.GetBucketTagging(ctx, &s3.GetBucketTaggingInput{Bucket: aws.String(source)})
+	if isAPIErrorCode(err, "NoSuchTagSet") {
+		return settingAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	tags := []s3types.Tag{}
+	for _, tag := range tagging.TagSet {
+		if strings.HasPrefix(aws.ToString(tag.Key), "aws:") {
+			zap.L().Info("Skipping reserved bucket tag", zap.String("key", aws.ToString(tag.Key)))
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return settingAbsent, nil
+	}
+	if _, err := s3obj.s3Client.PutBucketTagging(ctx, &s3.PutBucketTaggingInput{
+		Bucket:  aws.String(destination),
+		Tagging: &s3types.Tagging{TagSet: tags},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied bucket tags to destination bucket", zap.String("bucket", destination), zap.Int("tags", len(tags)))
+	return settingCopied, nil
+}
+
+// Access logs go to targetBucket when set.  A source logging to itself has the destination log to itself,
+// rather than mixing both buckets' logs in the source.
+func (s3obj *s3migration) copyLogging(ctx context.Context, source, destination, targetBucket string) (string, error) {
+	logging, err := s3obj.s3Client.GetBucketLogging(ctx, &s3.GetBucketLoggingInput{Bucket: aws.String(source)})
+	if err != nil {
+		return "", err
+	}
+	if logging.LoggingEnabled == nil {
+		return settingAbsent, nil
+	}
+	enabled := *logging.LoggingEnabled
+	switch {
+	case targetBucket != "":
+		enabled.TargetBucket = aws.String(targetBucket)
+	case aws.ToString(enabled.TargetBucket) == source:
+		enabled.TargetBucket = aws.String(destination)
+	}
+	if _, err := s3obj.s3Client.PutBucketLogging(ctx, &s3.PutBucketLoggingInput{
+		Bucket:              aws.String(destination),
+		BucketLoggingStatus: &s3types.BucketLoggingStatus{LoggingEnabled: &enabled},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied access logging to destination bucket",
+		zap.String("bucket", destination),
+		zap.String("targetBucket", aws.ToString(enabled.TargetBucket)),
+		zap.String("targetPrefix", aws.ToString(enabled.TargetPrefix)),
+	)
+	return settingCopied, nil
+}
@@ -0,0 +1,93 @@
+package migration
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateBucketConfig(t *testing.T) {
+	m := &mock{ownershipErr: &smithy.GenericAPIError{Code: "AccessDenied"}}
+	s3mig := &s3migration{s3Client: m}
+	args := BucketConfigArgs{SourceBucket: "src", DestinationBucket: "dst", Configs: BucketConfigs}
+
+	// A failed setting doesn't stop the others
+	summary, err := s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.ErrorContains(t, err, "ownership: api error AccessDenied")
+	assert.Equal(t, &BucketConfigSummary{
+		Copied:   []string{BucketConfigEncryption},
+		Absent:   []string{BucketConfigVersioning, BucketConfigPublicAccessBlock, BucketConfigLifecycle, BucketConfigPolicy, BucketConfigNotifications, BucketConfigCORS, BucketConfigWebsite, BucketConfigTags, BucketConfigLogging},
+		Exported: []string{},
+		Failed:   []string{BucketConfigOwnership},
+	}, summary)
+	assert.Equal(t, []string{"PutBucketEncryption dst"}, m.bucketCalls)
+
+	// Only the selected settings are copied
+	m.bucketCalls = nil
+	args.Configs = []string{BucketConfigPublicAccessBlock}
+	summary, err = s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigPublicAccessBlock}, summary.Absent)
+	assert.Empty(t, m.bucketCalls)
+}
+
+func TestCopyTagsAndLogging(t *testing.T) {
+	m := &mock{
+		bucketTags: []s3types.Tag{
+			{Key: aws.String("team"), Value: aws.String("media")},
+			{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("legacy")},
+		},
+		logging: &s3types.LoggingEnabled{TargetBucket: aws.String("src"), TargetPrefix: aws.String("logs/")},
+	}
+	s3mig := &s3migration{s3Client: m}
+	args := BucketConfigArgs{SourceBucket: "src", DestinationBucket: "dst", Configs: []string{BucketConfigTags, BucketConfigLogging}}
+
+	// Reserved tags are left out, and a source logging to itself has the destination log to itself
+	summary, err := s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigTags, BucketConfigLogging}, summary.Copied)
+	assert.Equal(t, []s3types.Tag{{Key: aws.String("team"), Value: aws.String("media")}}, m.bucketTags)
+	assert.Equal(t, "dst", aws.ToString(m.logging.TargetBucket))
+	assert.Equal(t, "logs/", aws.ToString(m.logging.TargetPrefix))
+
+	// The log target bucket can be rewritten
+	args.Configs = []string{BucketConfigLogging}
+	args.LogTargetBucket = "dst-logs"
+	_, err = s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, "dst-logs", aws.ToString(m.logging.TargetBucket))
+
+	m.bucketTags, m.logging = []s3types.Tag{{Key: aws.String("aws:createdBy"), Value: aws.String("x")}}, nil
+	args.Configs = []string{BucketConfigTags, BucketConfigLogging}
+	summary, err = s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigTags, BucketConfigLogging}, summary.Absent)
+}
+
+func TestMigrateBucketConfigPolicyFindings(t *testing.T) {
+	m := &mock{bucketPolicy: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"111122223333"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::src/*"}]}`}
+	s3mig := &s3migration{s3Client: m, analyzer: new(analyzerMock)}
+	args := BucketConfigArgs{SourceBucket: "src", DestinationBucket: "dst", Configs: []string{BucketConfigPolicy},
+		AnalyzerArn: "arn:aws:access-analyzer:us-east-1:111122223333:analyzer/test"}
+
+	// The policy written to the destination is checked once copied
+	summary, err := s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigPolicy}, summary.Copied)
+	if assert.Len(t, summary.AccessFindings, 2) {
+		assert.Equal(t, FindingSourceValidatePolicy, summary.AccessFindings[0].Source)
+		assert.Equal(t, "arn:aws:s3:::dst", summary.AccessFindings[1].Detail)
+	}
+
+	// A policy exported for review isn't on the destination yet
+	args.PolicyExport = filepath.Join(t.TempDir(), "policy.json")
+	summary, err = s3mig.migrateBucketConfig(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigPolicy}, summary.Exported)
+	assert.Empty(t, summary.AccessFindings)
+}
@@ -0,0 +1,167 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+// Returned by copyPolicy when statements of the source's policy can't be safely translated
+var errPolicyUntranslatable = errors.New("bucket policy statements can't be safely translated, review them with --export-policy and apply the policy with --policy-file")
+
+// Condition keys whose values are specific to the source's account or region, see untranslatable
+var accountSpecificConditionKeys = []string{"aws:sourcevpce", "aws:sourcevpc"}
+
+// Rewrite the source bucket's ARNs in a policy value to the destination's, and replace the mapped values, eg.
+// account IDs or principal ARNs.  A mapped value replaces whole strings and colon separated ARN segments, so
+// an account ID is replaced in the ARNs of its principals.
+func rewritePolicyValue(v any, source, destination string, mapping map[string]string) any {
+	switch v := v.(type) {
+	case string:
+		if to, ok := mapping[v]; ok {
+			return to
+		}
+		segments := strings.Split(v, ":")
+		// arn:partition:s3:::bucket[/key]
+		if len(segments) == 6 && segments[0] == "arn" && segments[2] == "s3" {
+			if bucket, key, found := strings.Cut(segments[5], "/"); bucket == source {
+				segments[5] = destination
+				if found {
+					segments[5] += "/" + key
+				}
+			}
+		}
+		for i, segment := range segments {
+			if to, ok := mapping[segment]; ok {
+				segments[i] = to
+			}
+		}
+		return strings.Join(segments, ":")
+	case []any:
+		for i := range v {
+			v[i] = rewritePolicyValue(v[i], source, destination, mapping)
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = rewritePolicyValue(v[k], source, destination, mapping)
+		}
+	}
+	return v
+}
+
+// Reasons a statement can't be copied as it is: canonical user principals are specific to the source's
+// account, and VPC and VPC endpoint conditions to its network, unless their values were mapped
+func untranslatable(statement map[string]any, mapping map[string]string) []string {
+	reasons := []string{}
+	if principal, ok := statement["Principal"].(map[string]any); ok {
+		if _, ok := principal["CanonicalUser"]; ok {
+			reasons = append(reasons, "CanonicalUser principal")
+		}
+	}
+	conditions, _ := statement["Condition"].(map[string]any)
+	for _, operator := range conditions {
+		keys, _ := operator.(map[string]any)
+		for key, values := range keys {
+			for _, specific := range accountSpecificConditionKeys {
+				if strings.EqualFold(key, specific) && !allMapped(values, mapping) {
+					reasons = append(reasons, fmt.Sprintf("%s condition", key))
+				}
+			}
+		}
+	}
+	return reasons
+}
+
+func allMapped(values any, mapping map[string]string) bool {
+	switch v := values.(type) {
+	case string:
+		_, ok := mapping[v]
+		return ok
+	case []any:
+		for _, value := range v {
+			if !allMapped(value, mapping) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// The source's policy translated for the destination.  Statements that can't be translated are logged and
+// make translatePolicy return errPolicyUntranslatable, along with the policy so it can be reviewed.
+func translatePolicy(policy, source, destination string, mapping map[string]string) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return nil, fmt.Errorf("invalid bucket policy: %w", err)
+	}
+	// Check the statements before they are rewritten, mapped values being matched as they are in the source
+	statements := policyStatements(doc)
+	flagged := 0
+	for i, statement := range statements {
+		if reasons := untranslatable(statement, mapping); len(reasons) > 0 {
+			flagged++
+			zap.L().Warn("Bucket policy statement can't be safely translated",
+				zap.Int("statement", i),
+				zap.Any("sid", statement["Sid"]),
+				zap.Strings("reasons", reasons),
+			)
+		}
+	}
+	body, err := json.MarshalIndent(rewritePolicyValue(doc, source, destination, mapping), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if flagged > 0 {
+		return body, fmt.Errorf("%w: %d of %d statements", errPolicyUntranslatable, flagged, len(statements))
+	}
+	return body, nil
+}
+
+// Copy the source bucket's policy, with its ARNs rewritten to the destination bucket and the mapped values
+// replaced, or the policy of file when set.  With export set the translated policy is written there for
+// review instead, to be applied with file once edited.
+func (s3obj *s3migration) copyPolicy(ctx context.Context, source, destination string, mapping map[string]string, file, export string) (string, error) {
+	var body []byte
+	if file != "" {
+		var err error
+		if body, err = os.ReadFile(file); err != nil {
+			return "", err
+		}
+	} else {
+		out, err := s3obj.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(source)})
+		if isAPIErrorCode(err, "NoSuchBucketPolicy") {
+			return settingAbsent, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		body, err = translatePolicy(aws.ToString(out.Policy), source, destination, mapping)
+		if export != "" && body != nil {
+			if werr := os.WriteFile(export, body, 0644); werr != nil {
+				return "", werr
+			}
+			zap.L().Info("Wrote translated bucket policy for review, apply it with --policy-file once reviewed", zap.String("file", export))
+			return settingExported, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := s3obj.s3Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(destination),
+		Policy: aws.String(string(body)),
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied bucket policy to destination bucket", zap.String("bucket", destination))
+	return settingCopied, nil
+}
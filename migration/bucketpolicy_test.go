@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyPolicy(t *testing.T) {
+	policy := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Sid": "Read",
+      "Effect": "Allow",
+      "Principal": {"AWS": "arn:aws:iam::111122223333:role/reader"},
+      "Action": "s3:GetObject",
+      "Resource": ["arn:aws:s3:::src/*", "arn:aws:s3:::src-logs/*"]
+    },
+    {
+      "Sid": "List",
+      "Effect": "Allow",
+      "Principal": {"AWS": "111122223333"},
+      "Action": "s3:ListBucket",
+      "Resource": "arn:aws:s3:::src"
+    }
+  ]
+}`
+	m := &mock{bucketPolicy: policy}
+	s3mig := &s3migration{s3Client: m}
+	mapping := map[string]string{"111122223333": "444455556666"}
+
+	outcome, err := s3mig.copyPolicy(context.TODO(), "src", "dst", mapping, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, settingCopied, outcome)
+	assert.Equal(t, []string{"PutBucketPolicy dst"}, m.bucketCalls)
+	var copied map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(m.bucketPolicy), &copied))
+	statements := copied["Statement"].([]any)
+	read := statements[0].(map[string]any)
+	assert.Equal(t, map[string]any{"AWS": "arn:aws:iam::444455556666:role/reader"}, read["Principal"])
+	// Only the source bucket's ARNs are rewritten
+	assert.Equal(t, []any{"arn:aws:s3:::dst/*", "arn:aws:s3:::src-logs/*"}, read["Resource"])
+	list := statements[1].(map[string]any)
+	assert.Equal(t, map[string]any{"AWS": "444455556666"}, list["Principal"])
+	assert.Equal(t, "arn:aws:s3:::dst", list["Resource"])
+
+	// A VPC endpoint condition can't be translated without a mapping, the policy is only exported
+	m.bucketCalls = nil
+	m.bucketPolicy = `{"Statement": {"Sid": "Vpce", "Effect": "Deny", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::src/*",
+	  "Condition": {"StringNotEquals": {"aws:SourceVpce": "vpce-1a2b3c4d"}}}}`
+	_, err = s3mig.copyPolicy(context.TODO(), "src", "dst", mapping, "", "")
+	assert.ErrorIs(t, err, errPolicyUntranslatable)
+	assert.Empty(t, m.bucketCalls)
+	export := filepath.Join(t.TempDir(), "policy.json")
+	outcome, err = s3mig.copyPolicy(context.TODO(), "src", "dst", mapping, "", export)
+	assert.NoError(t, err)
+	assert.Equal(t, settingExported, outcome)
+	assert.Empty(t, m.bucketCalls)
+
+	// Once reviewed, the exported policy is applied as it is
+	outcome, err = s3mig.copyPolicy(context.TODO(), "src", "dst", nil, export, "")
+	assert.NoError(t, err)
+	assert.Equal(t, settingCopied, outcome)
+	assert.Contains(t, m.bucketPolicy, "arn:aws:s3:::dst/*")
+
+	// Mapping the endpoint makes the statement translatable
+	m.bucketPolicy = `{"Statement": [{"Effect": "Deny", "Condition": {"StringNotEquals": {"aws:SourceVpce": ["vpce-1a2b3c4d"]}}}]}`
+	_, err = s3mig.copyPolicy(context.TODO(), "src", "dst", map[string]string{"vpce-1a2b3c4d": "vpce-9f8e7d6c"}, "", "")
+	assert.NoError(t, err)
+	assert.Contains(t, m.bucketPolicy, "vpce-9f8e7d6c")
+
+	// Nothing to copy without a policy
+	m.bucketPolicy = ""
+	outcome, err = s3mig.copyPolicy(context.TODO(), "src", "dst", nil, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, settingAbsent, outcome)
+}
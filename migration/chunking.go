@@ -0,0 +1,371 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"s3migration/util"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	SizeColumn = "Size"
+	MaxChunks  = 100
+
+	maxHistogramBins   = 10000 // Bins are merged by shortening the key prefix once this is exceeded
+	maxHistogramPrefix = 1024  // Longest S3 object key
+)
+
+// Bytes and objects under a key prefix
+type histogramBin struct {
+	Bytes int64
+	Count int64
+}
+
+// Distribution of bytes across the key space, binned by key prefix.  The prefix length adapts so the
+// histogram stays within maxHistogramBins however many objects are added, in whatever order.
+type keyHistogram struct {
+	depth int
+	bins  map[string]*histogramBin
+}
+
+func newKeyHistogram() *keyHistogram {
+	return &keyHistogram{depth: maxHistogramPrefix, bins: map[string]*histogramBin{}}
+}
+
+func (h *keyHistogram) prefix(key string) string {
+	if len(key) > h.depth {
+		return key[:h.depth]
+	}
+	return key
+}
+
+func (h *keyHistogram) add(key string, size int64) {
+	h.addBin(h.prefix(key), histogramBin{Bytes: size, Count: 1})
+	for len(h.bins) > maxHistogramBins && h.depth > 1 {
+		h.depth = max(h.depth/2, 1)
+		bins := h.bins
+		h.bins = map[string]*histogramBin{}
+		for p, b := range bins {
+			h.addBin(h.prefix(p), *b)
+		}
+	}
+}
+
+func (h *keyHistogram) addBin(prefix string, b histogramBin) {
+	bin, ok := h.bins[prefix]
+	if !ok {
+		bin = &histogramBin{}
+		h.bins[prefix] = bin
+	}
+	bin.Bytes += b.Bytes
+	bin.Count += b.Count
+}
+
+func (h *keyHistogram) totalBytes() int64 {
+	var total int64
+	for _, b := range h.bins {
+		total += b.Bytes
+	}
+	return total
+}
+
+// Average size of the objects in key's bin, as the manifest rows don't have sizes.  A nil histogram
+// knows no sizes.
+func (h *keyHistogram) averageSize(key string) int64 {
+	if h == nil {
+		return 0
+	}
+	b, ok := h.bins[h.prefix(key)]
+	if !ok || b.Count == 0 {
+		return 0
+	}
+	return b.Bytes / b.Count
+}
+
+// Choose up to n-1 bin prefixes splitting the key space into n chunks with similar bytes.
+// Objects without a known size count as one byte, so a histogram without sizes balances by object count.
+func (h *keyHistogram) boundaries(n int) []string {
+	prefixes := make([]string, 0, len(h.bins))
+	var total int64
+	for p, b := range h.bins {
+		prefixes = append(prefixes, p)
+		total += max(b.Bytes, b.Count)
+	}
+	slices.Sort(prefixes)
+
+	bounds := []string{}
+	var cumulative int64
+	for i, p := range prefixes {
+		// A boundary is the first prefix of the next chunk
+		if i > 0 && len(bounds) < n-1 && cumulative >= total*int64(len(bounds)+1)/int64(n) {
+			bounds = append(bounds, p)
+		}
+		b := h.bins[p]
+		cumulative += max(b.Bytes, b.Count)
+	}
+	return bounds
+}
+
+// Index of the chunk holding key, given boundaries from the same histogram
+func (h *keyHistogram) chunkOf(key string, bounds []string) int {
+	p := h.prefix(key)
+	i, found := slices.BinarySearch(bounds, p)
+	if found {
+		return i + 1
+	}
+	return i
+}
+
+// Build the histogram from the inventory data files' key and size columns.  Returns nil when the
+// inventory doesn't include sizes, so chunks are balanced by object count from the manifest instead.
+func (s3obj *s3migration) inventoryHistogram(ctx context.Context, bucket string, manifest s3types.Object) (*keyHistogram, error) {
+	manifestJson, err := s3obj.readInventoryManifest(ctx, bucket, manifest)
+	if err != nil {
+		return nil, err
+	}
+	sizeCol := -1
+	for i, col := range strings.Split(manifestJson.FileSchema, ",") {
+		if strings.TrimSpace(col) == SizeColumn {
+			sizeCol = i + 1
+		}
+	}
+	if sizeCol < 0 {
+		zap.L().Warn("Inventory has no Size column, balancing chunks by object count",
+			zap.String("fileSchema", manifestJson.FileSchema),
+		)
+		return nil, nil
+	}
+
+	h := newKeyHistogram()
+	expression := fmt.Sprintf("SELECT s._2, s._%d FROM s3object s", sizeCol)
+	r := csv.NewReader(s3obj.filterDataFiles(ctx, bucket, manifestJson.dataFileKeys(), expression))
+	for {
+		rec, rerr := r.Read()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+		key, kerr := util.DecodeManifestKey(rec[0])
+		if kerr != nil {
+			return nil, kerr
+		}
+		// Size is empty for delete markers
+		size, _ := strconv.ParseInt(rec[1], 10, 64)
+		h.add(key, size)
+	}
+	zap.L().Info("Built key space histogram from inventory",
+		zap.Int("bins", len(h.bins)),
+		zap.Int("prefixLength", h.depth),
+	)
+	return h, nil
+}
+
+func (s3obj *s3migration) readManifestRows(ctx context.Context, input *s3control.CreateJobInput) ([][]string, error) {
+	var rows [][]string
+	err := s3obj.eachManifestRow(ctx, input, func(row []string) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// Stream the rows of the job's manifest to fn, without holding the manifest in memory
+func (s3obj *s3migration) eachManifestRow(ctx context.Context, input *s3control.CreateJobInput, fn func(row []string) error) error {
+	bucket, key, err := ParseObjectArn(*input.Manifest.Location.ObjectArn)
+	if err != nil {
+		return err
+	}
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+	r := csv.NewReader(out.Body)
+	r.FieldsPerRecord = -1
+	for {
+		row, rerr := r.Read()
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// Key of a manifest row, which has the bucket and URL encoded key first
+func manifestRowKey(row []string) (string, error) {
+	if len(row) < 2 {
+		return "", fmt.Errorf("invalid manifest row %v", row)
+	}
+	return util.DecodeManifestKey(row[1])
+}
+
+// Rows of a chunk written to a temporary file as they are read, so the manifest is never held in memory
+type chunkFile struct {
+	f     *os.File
+	w     *csv.Writer
+	rows  int
+	bytes int64
+}
+
+func (c *chunkFile) write(row []string) error {
+	if c.f == nil {
+		f, err := os.CreateTemp("", "s3migration-chunk-*.csv")
+		if err != nil {
+			return err
+		}
+		c.f, c.w = f, csv.NewWriter(f)
+	}
+	c.rows++
+	return c.w.Write(row)
+}
+
+func (c *chunkFile) close() {
+	if c.f != nil {
+		c.f.Close()
+		os.Remove(c.f.Name())
+	}
+}
+
+// Split each job into up to n jobs over contiguous key ranges with similar bytes, using the
+// inventory histogram when available.  Empty chunks are dropped.  Each manifest is streamed twice
+// without the inventory histogram, once to build one from its keys and once to write the chunks.
+func (s3obj *s3migration) splitSteps(ctx context.Context, steps []*jobStep, n int, hist *keyHistogram) ([]*jobStep, error) {
+	split := []*jobStep{}
+	for _, step := range steps {
+		h := hist
+		if h == nil {
+			h = newKeyHistogram()
+			err := s3obj.eachManifestRow(ctx, step.Input, func(row []string) error {
+				key, err := manifestRowKey(row)
+				if err != nil {
+					return err
+				}
+				h.add(key, 0)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		bounds := h.boundaries(n)
+		chunks := make([]chunkFile, len(bounds)+1)
+		chunkSteps, rows, err := s3obj.writeChunks(ctx, step, h, hist, bounds, chunks)
+		for i := range chunks {
+			chunks[i].close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if rows == 0 {
+			split = append(split, step)
+			continue
+		}
+		split = append(split, chunkSteps...)
+		zap.L().Info("Split batch job manifest into chunks",
+			zap.String("kind", step.Kind),
+			zap.String("manifest", *step.Input.Manifest.Location.ObjectArn),
+			zap.Int("rows", rows),
+			zap.Strings("boundaries", bounds),
+		)
+	}
+	return split, nil
+}
+
+// Write the step's manifest rows to the chunks holding their keys and upload the chunks that have rows,
+// returning a job for each and the number of rows.  Chunk bytes are estimated from hist, when known.
+func (s3obj *s3migration) writeChunks(ctx context.Context, step *jobStep, h, hist *keyHistogram, bounds []string, chunks []chunkFile) ([]*jobStep, int, error) {
+	rows := 0
+	err := s3obj.eachManifestRow(ctx, step.Input, func(row []string) error {
+		key, err := manifestRowKey(row)
+		if err != nil {
+			return err
+		}
+		c := &chunks[h.chunkOf(key, bounds)]
+		c.bytes += hist.averageSize(key)
+		rows++
+		return c.write(row)
+	})
+	if err != nil || rows == 0 {
+		return nil, rows, err
+	}
+
+	manifestArn := *step.Input.Manifest.Location.ObjectArn
+	bucket, manifestKey, err := ParseObjectArn(manifestArn)
+	if err != nil {
+		return nil, rows, err
+	}
+	steps := []*jobStep{}
+	for i := range chunks {
+		chunk := &chunks[i]
+		if chunk.rows == 0 {
+			continue
+		}
+		chunk.w.Flush()
+		if err := chunk.w.Error(); err != nil {
+			return nil, rows, err
+		}
+		if _, err := chunk.f.Seek(0, io.SeekStart); err != nil {
+			return nil, rows, err
+		}
+		key := fmt.Sprintf("%s-chunk-%03d-of-%03d.csv", strings.TrimSuffix(manifestKey, ".csv"), i+1, len(chunks))
+		obj, uerr := s3obj.uploadS3File(ctx, bucket, key, chunk.f)
+		if uerr != nil {
+			return nil, rows, uerr
+		}
+		input, cerr := cloneJobInput(step.Input)
+		if cerr != nil {
+			return nil, rows, cerr
+		}
+		input.ClientRequestToken = aws.String(uuid.NewString())
+		input.Manifest.Location.ObjectArn = objectArnLike(manifestArn, bucket, key)
+		input.Manifest.Location.ETag = obj.ETag
+		steps = append(steps, &jobStep{Kind: step.Kind, Input: input, Bytes: chunk.bytes})
+	}
+	return steps, rows, nil
+}
+
+func (s3obj *s3migration) uploadRows(ctx context.Context, bucket, key string, rows [][]string) (*s3types.Object, error) {
+	f, err := os.CreateTemp("", "s3migration-chunk-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s3obj.uploadS3File(ctx, bucket, key, f)
+}
+
+func cloneJobInput(in *s3control.CreateJobInput) (*s3control.CreateJobInput, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	out := new(s3control.CreateJobInput)
+	return out, json.Unmarshal(body, out)
+}
@@ -0,0 +1,133 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyHistogramBoundaries(t *testing.T) {
+	h := newKeyHistogram()
+	// One large object followed by many small ones
+	h.add("a/big", 1000)
+	for i := 0; i < 10; i++ {
+		h.add(fmt.Sprintf("b/%02d", i), 100)
+	}
+	bounds := h.boundaries(2)
+	assert.Equal(t, []string{"b/00"}, bounds)
+	assert.Equal(t, 0, h.chunkOf("a/big", bounds))
+	assert.Equal(t, 1, h.chunkOf("b/00", bounds))
+	assert.Equal(t, 1, h.chunkOf("b/09", bounds))
+	// Keys not in the histogram still land in the key range holding them
+	assert.Equal(t, 0, h.chunkOf("a/other", bounds))
+	assert.Equal(t, 1, h.chunkOf("c", bounds))
+
+	// Without sizes chunks balance by object count
+	h = newKeyHistogram()
+	for i := 0; i < 9; i++ {
+		h.add(fmt.Sprintf("%d", i), 0)
+	}
+	assert.Equal(t, []string{"3", "6"}, h.boundaries(3))
+}
+
+func TestKeyHistogramMergesBins(t *testing.T) {
+	h := newKeyHistogram()
+	for i := 0; i < maxHistogramBins*2; i++ {
+		h.add(fmt.Sprintf("logs/%08d", i), 1)
+	}
+	assert.LessOrEqual(t, len(h.bins), maxHistogramBins)
+	assert.Less(t, h.depth, maxHistogramPrefix)
+	var count int64
+	for _, b := range h.bins {
+		count += b.Count
+	}
+	assert.Equal(t, int64(maxHistogramBins*2), count)
+}
+
+func TestSplitSteps(t *testing.T) {
+	m := &mock{objects: map[string]string{
+		"manifest.csv": "src,a1\nsrc,a2\nsrc,b1\nsrc,b2\n",
+		"empty.csv":    "",
+	}}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{
+		AccountId:          aws.String("111122223333"),
+		RoleArn:            aws.String("arn:aws:iam::111122223333:role/somedummyrole"),
+		TargetBucketName:   aws.String("dst"),
+		ManifestETag:       aws.String("etag"),
+		ManifestArn:        aws.String("arn:aws:s3:::src/manifest.csv"),
+		VersioningDisabled: true,
+	})
+	empty := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName: aws.String("dst"),
+		ManifestArn:      aws.String("arn:aws:s3:::src/empty.csv"),
+	})
+	steps := []*jobStep{{Kind: jobKindNonVersion, Input: input}, {Kind: jobKindVersion, Input: empty}}
+
+	split, err := s3mig.splitSteps(context.TODO(), steps, 2, nil)
+	assert.NoError(t, err)
+	assert.Len(t, split, 3)
+	assert.Equal(t, "arn:aws:s3:::src/manifest-chunk-001-of-002.csv", *split[0].Input.Manifest.Location.ObjectArn)
+	assert.Equal(t, "src,a1\nsrc,a2\n", m.objects["manifest-chunk-001-of-002.csv"])
+	assert.Equal(t, "src,b1\nsrc,b2\n", m.objects["manifest-chunk-002-of-002.csv"])
+	assert.Equal(t, "test-etag", *split[1].Input.Manifest.Location.ETag)
+	assert.NotEqual(t, *split[0].Input.ClientRequestToken, *split[1].Input.ClientRequestToken)
+	assert.Equal(t, jobKindNonVersion, split[1].Kind)
+	// The original input is unchanged
+	assert.Equal(t, "arn:aws:s3:::src/manifest.csv", *input.Manifest.Location.ObjectArn)
+	// Empty manifests are kept as is
+	assert.Same(t, steps[1], split[2])
+	assert.True(t, strings.HasSuffix(*split[2].Input.Manifest.Location.ObjectArn, "empty.csv"))
+}
+
+func TestSplitStepsBytes(t *testing.T) {
+	m := &mock{objects: map[string]string{"manifest.csv": "src,a1\nsrc,a2\nsrc,b1\nsrc,b2\n"}}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName: aws.String("dst"),
+		ManifestArn:      aws.String("arn:aws-cn:s3:::src/manifest.csv"),
+	})
+	h := newKeyHistogram()
+	h.add("a1", 100)
+	h.add("a2", 300)
+	h.add("b1", 50)
+	h.add("b2", 50)
+
+	split, err := s3mig.splitSteps(context.TODO(), []*jobStep{{Kind: jobKindNonVersion, Input: input}}, 2, h)
+	assert.NoError(t, err)
+	assert.Len(t, split, 2)
+	assert.Equal(t, int64(400), split[0].Bytes)
+	assert.Equal(t, int64(100), split[1].Bytes)
+	// Chunk manifests are in the manifest's partition
+	assert.Equal(t, "arn:aws-cn:s3:::src/manifest-chunk-001-of-002.csv", *split[0].Input.Manifest.Location.ObjectArn)
+}
+
+func TestSplitStepsStreamed(t *testing.T) {
+	m := &mock{objects: map[string]string{"empty.csv": "", "invalid.csv": "src,a1\nsrc\n"}}
+	s3mig := &s3migration{s3Client: m}
+	step := func(manifest string) *jobStep {
+		return &jobStep{Kind: jobKindNonVersion, Input: NewCreateJobInput(&batchJobArgs{
+			TargetBucketName: aws.String("dst"),
+			ManifestArn:      aws.String("arn:aws:s3:::src/" + manifest),
+		})}
+	}
+	h := newKeyHistogram()
+	h.add("a1", 100)
+	h.add("b1", 100)
+
+	// Empty manifests are kept as is with the inventory histogram too, which skips the first pass
+	empty := step("empty.csv")
+	split, err := s3mig.splitSteps(context.TODO(), []*jobStep{empty}, 2, h)
+	assert.NoError(t, err)
+	assert.Equal(t, []*jobStep{empty}, split)
+
+	// Rows are checked as they are streamed, in either pass
+	for _, hist := range []*keyHistogram{nil, h} {
+		_, err = s3mig.splitSteps(context.TODO(), []*jobStep{step("invalid.csv")}, 2, hist)
+		assert.ErrorContains(t, err, "invalid manifest row")
+	}
+}
@@ -0,0 +1,199 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"s3migration/util"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+)
+
+const deleteObjectsMaxKeys = 1000
+
+// Scratch prefixes holding only files written by this tool or the jobs it creates, see listManifest,
+// keysBuilder, uploadLocalInventory, generatorJobInput, collectDeleteMarkers, enableFailureReport and
+// filteredManifestKey
+var scratchPrefixes = []string{"list/", "keys/", "local/", "generated/", "deletes/", "reports/", "filtered/"}
+
+// Reports whether key is a manifest written by a previous run.  Older runs wrote filtered, metadata filtered
+// and chunk manifests as uncompressed .csv files next to the gzipped inventory data files.
+func isScratchManifest(prefix, key string) bool {
+	for _, p := range scratchPrefixes {
+		if strings.HasPrefix(key, prefix+p) {
+			return true
+		}
+	}
+	return strings.HasSuffix(key, ".csv")
+}
+
+// Delete manifests written by previous runs to the source bucket's scratch location that are older than
+// olderThan.  Inventory reports themselves are left to the inventory configuration.  Returns the number of
+// objects deleted, or that would have been deleted when dryRun is set.
+func (s3obj *s3migration) cleanupManifests(ctx context.Context, bucket, configName string, olderThan time.Duration, dryRun bool) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	prefixes := []string{fmt.Sprintf("%s/%s/", bucket, inventoryConfigName)}
+	if configName != "" && configName != inventoryConfigName {
+		prefixes = append(prefixes, fmt.Sprintf("%s/%s/", bucket, configName))
+	}
+
+	deleted := 0
+	for _, prefix := range prefixes {
+		stale := []s3types.ObjectIdentifier{}
+		paginator := s3.NewListObjectsV2Paginator(s3obj.s3Client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(s3obj.scratchBucket(bucket)),
+			Prefix: aws.String(prefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return deleted, err
+			}
+			for _, obj := range page.Contents {
+				if obj.LastModified.Before(cutoff) && isScratchManifest(prefix, *obj.Key) {
+					stale = append(stale, s3types.ObjectIdentifier{Key: obj.Key})
+				}
+			}
+		}
+
+		for start := 0; start < len(stale); start += deleteObjectsMaxKeys {
+			batch := stale[start:min(start+deleteObjectsMaxKeys, len(stale))]
+			for _, obj := range batch {
+				zap.L().Debug("Stale manifest", zap.String("key", *obj.Key), zap.Bool("dryRun", dryRun))
+			}
+			if dryRun {
+				deleted += len(batch)
+				continue
+			}
+			out, err := s3obj.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(s3obj.scratchBucket(bucket)),
+				Delete: &s3types.Delete{Objects: batch, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return deleted, err
+			}
+			deleted += len(batch) - len(out.Errors)
+			for _, e := range out.Errors {
+				zap.L().Warn("Unable to delete stale manifest",
+					zap.String("key", aws.ToString(e.Key)),
+					zap.String("code", aws.ToString(e.Code)),
+					zap.String("message", aws.ToString(e.Message)),
+				)
+			}
+		}
+	}
+	zap.L().Info("Cleaned up stale manifests",
+		zap.String("bucket", bucket),
+		zap.Duration("olderThan", olderThan),
+		zap.Int("count", deleted),
+		zap.Bool("dryRun", dryRun),
+	)
+	return deleted, nil
+}
+
+// Delete the tool's inventory configuration, and the reports it delivered to the source bucket, leaving the
+// manifests written by runs to cleanupManifests.  A configuration that doesn't exist is already removed.
+// Returns the number of reports deleted, or that would have been deleted when dryRun is set.
+func (s3obj *s3migration) removeInventory(ctx context.Context, bucket string, dryRun bool) (int, error) {
+	if !dryRun {
+		_, err := s3obj.s3Client.DeleteBucketInventoryConfiguration(ctx, &s3.DeleteBucketInventoryConfigurationInput{
+			Bucket: aws.String(bucket),
+			Id:     aws.String(inventoryConfigName),
+		})
+		var ae smithy.APIError
+		if err != nil && !(errors.As(err, &ae) && ae.ErrorCode() == "NoSuchConfiguration") {
+			return 0, err
+		}
+	}
+
+	prefix := fmt.Sprintf("%s/%s/", bucket, inventoryConfigName)
+	reports := []s3types.ObjectIdentifier{}
+	paginator := s3.NewListObjectsV2Paginator(s3obj.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3obj.scratchBucket(bucket)),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, obj := range page.Contents {
+			if !isScratchManifest(prefix, *obj.Key) {
+				reports = append(reports, s3types.ObjectIdentifier{Key: obj.Key})
+			}
+		}
+	}
+
+	deleted := 0
+	for start := 0; start < len(reports) && !dryRun; start += deleteObjectsMaxKeys {
+		batch := reports[start:min(start+deleteObjectsMaxKeys, len(reports))]
+		out, err := s3obj.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s3obj.scratchBucket(bucket)),
+			Delete: &s3types.Delete{Objects: batch, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += len(batch) - len(out.Errors)
+		for _, e := range out.Errors {
+			zap.L().Warn("Unable to delete inventory report",
+				zap.String("key", aws.ToString(e.Key)),
+				zap.String("code", aws.ToString(e.Code)),
+				zap.String("message", aws.ToString(e.Message)),
+			)
+		}
+	}
+	if dryRun {
+		deleted = len(reports)
+	}
+	zap.L().Info("Removed inventory configuration and reports",
+		zap.String("bucket", bucket),
+		zap.String("configName", inventoryConfigName),
+		zap.Int("reports", deleted),
+		zap.Bool("dryRun", dryRun),
+	)
+	return deleted, nil
+}
+
+// Remove the inventory configuration once the copy has succeeded, when this run created it
+func (s3obj *s3migration) removeCreatedInventory(ctx context.Context, st *runState) {
+	if !st.Args.CleanupInventory {
+		return
+	}
+	if !st.InventoryCreated {
+		zap.L().Info("Keeping the inventory configuration, which this run didn't create. Use \"cleanup --inventory\" to remove it")
+		return
+	}
+	if _, err := s3obj.removeInventory(ctx, st.Args.SourceBucket, false); err != nil {
+		zap.L().Error("Failed to remove the inventory configuration", zap.String("bucket", st.Args.SourceBucket), zap.Error(err))
+	}
+}
+
+// Delete manifests and chunk files older than olderThan written by previous runs to the source bucket, or
+// inventoryBucket when set, and the tool's inventory configuration and reports when inventory is set
+func Cleanup(sourceRegion, sourceBucket, inventoryBucket, configName string, olderThan time.Duration, inventory, dryRun bool) error {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(sourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", sourceRegion),
+			zap.Error(err),
+		)
+	}
+	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg), inventoryBucket: inventoryBucket}
+	if _, err = s3mig.cleanupManifests(ctx, sourceBucket, configName, olderThan, dryRun); err != nil || !inventory {
+		return err
+	}
+	_, err = s3mig.removeInventory(ctx, sourceBucket, dryRun)
+	return err
+}
@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanupManifests(t *testing.T) {
+	old := aws.Time(time.Now().AddDate(0, 0, -10))
+	recent := aws.Time(time.Now())
+	object := func(key string, lastModified *time.Time) s3types.Object {
+		return s3types.Object{Key: aws.String(key), LastModified: lastModified}
+	}
+	m := &mock{listObjectsV2Output: &s3.ListObjectsV2Output{Contents: []s3types.Object{
+		object("src/bulk-copy-inventory/data/abc.csv.gz", old),
+		object("src/bulk-copy-inventory/data/abc.csv", old),
+		object("src/bulk-copy-inventory/data/abc-chunk-001-of-002.csv", old),
+		object("src/bulk-copy-inventory/data/def.csv", recent),
+		object("src/bulk-copy-inventory/2024-01-01T01-00Z/manifest.json", old),
+		object("src/bulk-copy-inventory/local/2024-01-01T00-00-00Z/manifest.json", old),
+		object("src/bulk-copy-inventory/list/2024-01-01T00-00-00Z-all.csv", old),
+	}}}
+	s3mig := &s3migration{s3Client: m}
+
+	count, err := s3mig.cleanupManifests(context.TODO(), "src", inventoryConfigName, 7*24*time.Hour, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Empty(t, m.deleted)
+
+	count, err = s3mig.cleanupManifests(context.TODO(), "src", inventoryConfigName, 7*24*time.Hour, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []string{
+		"src/bulk-copy-inventory/data/abc.csv",
+		"src/bulk-copy-inventory/data/abc-chunk-001-of-002.csv",
+		"src/bulk-copy-inventory/local/2024-01-01T00-00-00Z/manifest.json",
+		"src/bulk-copy-inventory/list/2024-01-01T00-00-00Z-all.csv",
+	}, m.deleted)
+}
+
+func TestRemoveInventory(t *testing.T) {
+	object := func(key string) s3types.Object {
+		return s3types.Object{Key: aws.String(key), LastModified: aws.Time(time.Now())}
+	}
+	m := &mock{
+		inventoryConfig: &s3types.InventoryConfiguration{Id: aws.String(inventoryConfigName)},
+		listObjectsV2Output: &s3.ListObjectsV2Output{Contents: []s3types.Object{
+			object("src/bulk-copy-inventory/data/abc.csv.gz"),
+			object("src/bulk-copy-inventory/data/abc.csv"),
+			object("src/bulk-copy-inventory/2024-01-01T01-00Z/manifest.json"),
+			object("src/bulk-copy-inventory/filtered/2024-01-01T00-00-00Z.csv"),
+		}},
+	}
+	s3mig := &s3migration{s3Client: m}
+
+	count, err := s3mig.removeInventory(context.TODO(), "src", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Empty(t, m.deletedConfig)
+	assert.Empty(t, m.deleted)
+
+	// Runs that found the configuration already there leave it alone
+	st := &runState{Args: MigrationArgs{SourceBucket: "src", CleanupInventory: true}}
+	s3mig.removeCreatedInventory(context.TODO(), st)
+	assert.Empty(t, m.deletedConfig)
+
+	st.InventoryCreated = true
+	s3mig.removeCreatedInventory(context.TODO(), st)
+	assert.Equal(t, inventoryConfigName, m.deletedConfig)
+	assert.Nil(t, m.inventoryConfig)
+	assert.Equal(t, []string{
+		"src/bulk-copy-inventory/data/abc.csv.gz",
+		"src/bulk-copy-inventory/2024-01-01T01-00Z/manifest.json",
+	}, m.deleted)
+}
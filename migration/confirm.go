@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Job confirmation modes for change-controlled environments
+const (
+	ConfirmNone     = ""         // Jobs run as soon as they are prepared
+	ConfirmPrompt   = "prompt"   // Print the planned job and ask on stdin before activating it
+	ConfirmExternal = "external" // Print the planned job and wait for an operator to activate it elsewhere
+)
+
+// Create the batch job, honouring the requested confirmation mode
+func (s3obj *s3migration) createJob(ctx context.Context, accountID string, params *s3control.CreateJobInput, confirmMode string) (*s3control.CreateJobOutput, error) {
+	params.ConfirmationRequired = aws.Bool(confirmMode != ConfirmNone)
+	job, err := s3obj.s3CtrClient.CreateJob(ctx, params)
+	if err != nil || confirmMode == ConfirmNone {
+		return job, err
+	}
+	return job, s3obj.confirmJob(ctx, accountID, params, job, confirmMode, os.Stdin)
+}
+
+// Wait for the job to finish preparing, print its parameters and either activate it on operator
+// approval (prompt) or leave it for the operator to activate (external)
+func (s3obj *s3migration) confirmJob(ctx context.Context, accountID string, params *s3control.CreateJobInput,
+	job *s3control.CreateJobOutput, confirmMode string, in io.Reader) error {
+	for {
+		out, err := s3obj.describeJob(ctx, accountID, *job.JobId)
+		if err != nil {
+			return err
+		}
+		if out.Job.Status == s3controltypes.JobStatusSuspended {
+			break
+		}
+		if out.Job.Status == s3controltypes.JobStatusFailed {
+			return fmt.Errorf("job %s failed while preparing", *job.JobId)
+		}
+		zap.L().Info("Waiting for job to be ready for confirmation",
+			zap.String("jobId", *job.JobId),
+			zap.Any("status", out.Job.Status),
+		)
+		time.Sleep(15 * time.Second)
+	}
+
+	planned, _ := json.MarshalIndent(params, "", "  ")
+	fmt.Printf("Planned batch job %s:\n%s\n", *job.JobId, planned)
+
+	if confirmMode == ConfirmExternal {
+		zap.L().Info("Job is awaiting confirmation, activate it from the S3 console or with UpdateJobStatus",
+			zap.String("jobId", *job.JobId),
+		)
+		return nil
+	}
+
+	fmt.Printf("Activate job %s? [y/N]: ", *job.JobId)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	requested, reason := s3controltypes.RequestedJobStatusCancelled, "Rejected by operator"
+	if strings.EqualFold(strings.TrimSpace(answer), "y") {
+		requested, reason = s3controltypes.RequestedJobStatusReady, "Confirmed by operator"
+	}
+	if _, err := s3obj.s3CtrClient.UpdateJobStatus(ctx, &s3control.UpdateJobStatusInput{
+		AccountId:          aws.String(accountID),
+		JobId:              job.JobId,
+		RequestedJobStatus: requested,
+		StatusUpdateReason: aws.String(reason),
+	}); err != nil {
+		return err
+	}
+	zap.L().Info("Updated job status", zap.String("jobId", *job.JobId), zap.Any("requested", requested))
+	if requested == s3controltypes.RequestedJobStatusCancelled {
+		return fmt.Errorf("job %s was not confirmed", *job.JobId)
+	}
+	return nil
+}
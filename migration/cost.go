@@ -0,0 +1,161 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// List prices the estimate is based on, in USD for S3 Standard in us-east-1.  Prices vary by region and
+// storage class and change over time, so the estimate gives the order of magnitude of a migration's cost.
+const (
+	batchJobPrice      = 0.25  // Per batch job
+	batchObjectPrice   = 1.00  // Per million objects processed by batch jobs
+	putRequestPrice    = 0.005 // Per 1,000 PUT or COPY requests
+	kmsRequestPrice    = 0.03  // Per 10,000 KMS requests
+	crossRegionGBPrice = 0.02  // Per GB transferred between regions
+)
+
+// Estimated cost of copying the objects of an inventory, in USD
+type CostEstimate struct {
+	Objects     int64   `json:"objects"`
+	Bytes       int64   `json:"bytes"` // 0 when the inventory has no Size column
+	Jobs        int     `json:"jobs"`
+	BatchFees   float64 `json:"batchFees"` // Per job and per object fees of S3 Batch Operations
+	Requests    float64 `json:"requests"`  // COPY requests to the destination
+	KMS         float64 `json:"kms"`       // Data key requests encrypting the copies with --kms-id
+	Transfer    float64 `json:"transfer"`  // Inter-region data transfer
+	Total       float64 `json:"total"`
+	CrossRegion bool    `json:"crossRegion"`
+}
+
+// Estimate the cost of copying objects with the given number of batch jobs.  Each object is one COPY
+// request, and one KMS request when the copies are encrypted with a KMS key without a Bucket Key.
+// Decrypting source objects encrypted with KMS keys is not included.
+func estimateCost(objects, bytes int64, jobs int, kms, crossRegion bool) *CostEstimate {
+	c := &CostEstimate{Objects: objects, Bytes: bytes, Jobs: jobs, CrossRegion: crossRegion}
+	c.BatchFees = float64(jobs)*batchJobPrice + float64(objects)/1e6*batchObjectPrice
+	c.Requests = float64(objects) / 1000 * putRequestPrice
+	if kms {
+		c.KMS = float64(objects) / 10000 * kmsRequestPrice
+	}
+	if crossRegion {
+		c.Transfer = float64(bytes) / (1 << 30) * crossRegionGBPrice
+	}
+	c.Total = c.BatchFees + c.Requests + c.KMS + c.Transfer
+	return c
+}
+
+// Format a cost in dollars and cents, eg. $1,234.57
+func formatCost(usd float64) string {
+	cents := strconv.FormatInt(int64(math.Round(usd*100)), 10)
+	for len(cents) < 3 {
+		cents = "0" + cents
+	}
+	dollars := cents[:len(cents)-2]
+	for i := len(dollars) - 3; i > 0; i -= 3 {
+		dollars = dollars[:i] + "," + dollars[i:]
+	}
+	return "$" + dollars + "." + cents[len(cents)-2:]
+}
+
+// Log the estimate, with the share of each charge
+func (c *CostEstimate) log() {
+	zap.L().Info("Estimated migration cost, from list prices in us-east-1",
+		zap.String("total", formatCost(c.Total)),
+		zap.String("batchFees", formatCost(c.BatchFees)),
+		zap.String("copyRequests", formatCost(c.Requests)),
+		zap.String("kmsRequests", formatCost(c.KMS)),
+		zap.String("crossRegionTransfer", formatCost(c.Transfer)),
+		zap.Int64("objects", c.Objects),
+		zap.String("bytes", formatBytes(c.Bytes)),
+		zap.Int("jobs", c.Jobs),
+		zap.Bool("crossRegion", c.CrossRegion),
+	)
+}
+
+// Whether objects written to the bucket are encrypted with a KMS key by default, without an S3 Bucket Key,
+// so each copy makes a KMS request
+func (s3obj *s3migration) kmsPerObject(ctx context.Context, bucket string) (bool, error) {
+	out, err := s3obj.s3Client.GetBucketEncryption(ctx, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range out.ServerSideEncryptionConfiguration.Rules {
+		if rule.ApplyServerSideEncryptionByDefault == nil {
+			continue
+		}
+		switch rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm {
+		case s3types.ServerSideEncryptionAwsKms, s3types.ServerSideEncryptionAwsKmsDsse:
+			return !aws.ToBool(rule.BucketKeyEnabled), nil
+		}
+	}
+	return false, nil
+}
+
+// Count the objects of an inventory report and their total size.  Rows without a size, ie. delete
+// markers, aren't copied and aren't counted.  Without a Size column every row is counted and the size is 0.
+func (s3obj *s3migration) inventoryTotals(ctx context.Context, bucket string, manifest s3types.Object) (objects, bytes int64, err error) {
+	manifestJson, err := s3obj.readInventoryManifest(ctx, bucket, manifest)
+	if err != nil {
+		return 0, 0, err
+	}
+	sizeCol := -1
+	for i, col := range strings.Split(manifestJson.FileSchema, ",") {
+		if strings.TrimSpace(col) == SizeColumn {
+			sizeCol = i + 1
+		}
+	}
+	expression := "SELECT s._2 FROM s3object s"
+	if sizeCol > 0 {
+		expression = fmt.Sprintf("SELECT s._%d FROM s3object s", sizeCol)
+	}
+	r := csv.NewReader(s3obj.filterDataFiles(ctx, bucket, manifestJson.dataFileKeys(), expression))
+	for {
+		rec, rerr := r.Read()
+		if rerr == io.EOF {
+			return objects, bytes, nil
+		}
+		if rerr != nil {
+			return 0, 0, rerr
+		}
+		if sizeCol < 0 {
+			objects++
+			continue
+		}
+		if size, serr := strconv.ParseInt(rec[0], 10, 64); serr == nil {
+			objects++
+			bytes += size
+		}
+	}
+}
+
+// Estimate the cost of copying the objects of the inventory with the given number of jobs, and log it.
+// The inter-region transfer and KMS charges are only known when the destination bucket is given.
+func (s3obj *s3migration) estimateInventoryCost(ctx context.Context, args MigrationArgs, bucket string, manifest s3types.Object, jobs int) (*CostEstimate, error) {
+	objects, bytes, err := s3obj.inventoryTotals(ctx, bucket, manifest)
+	if err != nil {
+		return nil, err
+	}
+	var crossRegion, kms bool
+	if args.DestinationBucket != "" {
+		if crossRegion, _, err = s3obj.destinationTopology(ctx, args); err != nil {
+			zap.L().Warn("Unable to find the destination bucket's region, assuming the same region", zap.Error(err))
+		}
+		if kms, err = s3obj.kmsPerObject(ctx, args.DestinationBucket); err != nil {
+			zap.L().Warn("Unable to get the destination bucket's default encryption, assuming no KMS requests", zap.Error(err))
+		}
+	}
+	c := estimateCost(objects, bytes, jobs, kms, crossRegion)
+	c.log()
+	return c, nil
+}
@@ -0,0 +1,57 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateCost(t *testing.T) {
+	// 100 million objects, 1 PiB, one job for each version kind
+	c := estimateCost(100_000_000, 1<<50, 2, false, false)
+	assert.InDelta(t, 100.50, c.BatchFees, 0.001)
+	assert.InDelta(t, 500, c.Requests, 0.001)
+	assert.Zero(t, c.KMS)
+	assert.Zero(t, c.Transfer)
+	assert.InDelta(t, 600.50, c.Total, 0.001)
+
+	c = estimateCost(100_000_000, 1<<50, 2, true, true)
+	assert.InDelta(t, 300, c.KMS, 0.001)
+	assert.InDelta(t, 20971.52, c.Transfer, 0.001)
+	assert.InDelta(t, 21872.02, c.Total, 0.001)
+}
+
+func TestFormatCost(t *testing.T) {
+	tests := map[float64]string{
+		0:           "$0.00",
+		0.004:       "$0.00",
+		0.25:        "$0.25",
+		12.345:      "$12.35",
+		1234567.891: "$1,234,567.89",
+	}
+	for usd, want := range tests {
+		assert.Equal(t, want, formatCost(usd))
+	}
+}
+
+func TestKMSPerObject(t *testing.T) {
+	m := new(mock)
+	s3mig := &s3migration{s3Client: m}
+	kms, err := s3mig.kmsPerObject(context.TODO(), "dst")
+	assert.NoError(t, err)
+	assert.False(t, kms)
+
+	m.encryption = &s3types.ServerSideEncryptionRule{ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: s3types.ServerSideEncryptionAwsKms}}
+	kms, err = s3mig.kmsPerObject(context.TODO(), "dst")
+	assert.NoError(t, err)
+	assert.True(t, kms)
+
+	// A Bucket Key saves the per-object requests
+	m.encryption.BucketKeyEnabled = aws.Bool(true)
+	kms, err = s3mig.kmsPerObject(context.TODO(), "dst")
+	assert.NoError(t, err)
+	assert.False(t, kms)
+}
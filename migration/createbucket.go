@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+)
+
+// Create the destination bucket in the region when it doesn't exist, rather than failing every task of the
+// batch jobs, with the source bucket's versioning, default encryption, object ownership and public access
+// block.  Settings the source doesn't have keep the new bucket's defaults.  Returns whether it was created.
+func (s3obj *s3migration) ensureDestinationBucket(ctx context.Context, source, destination, region string) (bool, error) {
+	_, err := s3obj.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(destination)})
+	var notFound *s3types.NotFound
+	if !errors.As(err, &notFound) {
+		// A bucket we can't read, eg. one owned by another account, still exists
+		return false, nil
+	}
+
+	input := &s3.CreateBucketInput{Bucket: aws.String(destination)}
+	// us-east-1 is the default location and can't be given as a constraint
+	if region != "" && region != "us-east-1" {
+		input.CreateBucketConfiguration = &s3types.CreateBucketConfiguration{LocationConstraint: s3types.BucketLocationConstraint(region)}
+	}
+	if _, err := s3obj.s3Client.CreateBucket(ctx, input); err != nil {
+		return false, fmt.Errorf("unable to create destination bucket %s: %w", destination, err)
+	}
+	zap.L().Info("Created destination bucket", zap.String("bucket", destination), zap.String("region", region))
+
+	if err := s3obj.mirrorBucketSettings(ctx, source, destination); err != nil {
+		return true, fmt.Errorf("created destination bucket %s but couldn't copy the source bucket's settings: %w", destination, err)
+	}
+	return true, nil
+}
+
+// Copy the source bucket's versioning, default encryption, object ownership and public access block
+func (s3obj *s3migration) mirrorBucketSettings(ctx context.Context, source, destination string) error {
+	configs := []string{BucketConfigVersioning, BucketConfigEncryption, BucketConfigOwnership, BucketConfigPublicAccessBlock}
+	for _, setting := range s3obj.bucketSettings(BucketConfigArgs{Configs: configs}) {
+		if _, err := setting.copy(ctx, source, destination); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAPIErrorCode(err error, code string) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && ae.ErrorCode() == code
+}
@@ -0,0 +1,39 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureDestinationBucket(t *testing.T) {
+	m := &mock{
+		missingBuckets:    []string{"dst"},
+		objectOwnership:   s3types.ObjectOwnershipBucketOwnerEnforced,
+		publicAccessBlock: &s3types.PublicAccessBlockConfiguration{BlockPublicAcls: aws.Bool(true)},
+	}
+	s3mig := &s3migration{s3Client: m}
+
+	created, err := s3mig.ensureDestinationBucket(context.TODO(), "src", "dst", "eu-west-1")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	// The source bucket isn't versioned, so neither is the destination
+	assert.Equal(t, []string{"CreateBucket dst", "PutBucketEncryption dst", "PutBucketOwnershipControls dst", "PutPublicAccessBlock dst"}, m.bucketCalls)
+
+	// An existing bucket is left alone
+	m.bucketCalls = nil
+	created, err = s3mig.ensureDestinationBucket(context.TODO(), "src", "dst", "eu-west-1")
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Empty(t, m.bucketCalls)
+
+	// Without a source public access block the new bucket keeps blocking all public access
+	m.missingBuckets = []string{"other"}
+	m.publicAccessBlock = nil
+	_, err = s3mig.ensureDestinationBucket(context.TODO(), "src", "other", "us-east-1")
+	assert.NoError(t, err)
+	assert.NotContains(t, m.bucketCalls, "PutPublicAccessBlock other")
+}
@@ -0,0 +1,177 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"s3migration/util"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// Inline policy of the roles created or updated with --create-role
+	batchRolePolicyName = "s3migration-batch-operations"
+
+	batchRoleTrustPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow",` +
+		`"Principal":{"Service":"batchoperations.s3.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+)
+
+// Time for a new role to become assumable by S3 Batch Operations, as IAM is eventually consistent
+var roleSettleDelay = 10 * time.Second
+
+type iamRoleAPI interface {
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error)
+	UpdateAssumeRolePolicy(ctx context.Context, params *iam.UpdateAssumeRolePolicyInput, optFns ...func(*iam.Options)) (*iam.UpdateAssumeRolePolicyOutput, error)
+	PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error)
+}
+
+// Actions the batch role is allowed on resources, one statement of its policy
+type roleGrant struct {
+	Sid       string
+	Actions   []string
+	Resources []string
+}
+
+// The permissions the batch jobs of a run need: reading the source objects, writing the destination
+// objects, reading the manifests and writing the completion reports under the source bucket's prefix
+// of the scratch bucket, listing the source for a generated manifest, and the KMS key and Lambda function
+// when used.  ARNs are in the partition of the run's region.
+func batchRoleGrants(args MigrationArgs, scratchBucket string) []roleGrant {
+	s3Arn := func(resource string) string {
+		return fmt.Sprintf("arn:%s:s3:::%s", util.Partition(args.SourceRegion), resource)
+	}
+	source, destination := s3Arn(args.SourceBucket), s3Arn(args.DestinationBucket)
+	grants := []roleGrant{}
+	switch args.Mode {
+	case ModeReplicate:
+		grants = append(grants,
+			roleGrant{Sid: "ReplicateSourceObjects", Actions: []string{"s3:InitiateReplication"}, Resources: []string{source + "/*"}},
+			roleGrant{Sid: "ReadSourceReplication", Actions: []string{"s3:GetReplicationConfiguration", "s3:PutInventoryConfiguration"},
+				Resources: []string{source}},
+		)
+	case ModeLambda:
+		grants = append(grants, roleGrant{Sid: "InvokeFunction", Actions: []string{"lambda:InvokeFunction"}, Resources: []string{args.FunctionArn}})
+	default:
+		read := []string{"s3:GetObject", "s3:GetObjectVersion", "s3:GetObjectTagging", "s3:GetObjectVersionTagging"}
+		write := []string{"s3:PutObject", "s3:PutObjectTagging"}
+		if args.PreserveACL {
+			read = append(read, "s3:GetObjectAcl", "s3:GetObjectVersionAcl")
+		}
+		if args.PreserveACL || len(args.Grants) > 0 || args.CannedACL != CannedACLNone {
+			write = append(write, "s3:PutObjectAcl")
+		}
+		if args.PreserveObjectLock {
+			write = append(write, "s3:PutObjectRetention", "s3:PutObjectLegalHold")
+		}
+		grants = append(grants, roleGrant{Sid: "ReadSourceObjects", Actions: read, Resources: []string{source + "/*"}})
+		// The destination is optional for dry runs
+		if args.DestinationBucket != "" {
+			grants = append(grants, roleGrant{Sid: "WriteDestinationObjects", Actions: write, Resources: []string{destination + "/*"}})
+		}
+	}
+	if args.ManifestGenerator {
+		grants = append(grants, roleGrant{Sid: "ListSourceBucket", Actions: []string{"s3:ListBucket", "s3:ListBucketVersions"},
+			Resources: []string{source}})
+	}
+	manifests := []string{s3Arn(fmt.Sprintf("%s/%s/*", scratchBucket, args.SourceBucket))}
+	if args.ManifestArn != "" {
+		manifests = append(manifests, args.ManifestArn)
+	}
+	grants = append(grants,
+		roleGrant{Sid: "ReadManifests", Actions: []string{"s3:GetObject", "s3:GetObjectVersion"}, Resources: manifests},
+		roleGrant{Sid: "WriteReports", Actions: []string{"s3:PutObject"}, Resources: manifests[:1]},
+		roleGrant{Sid: "LocateReportBucket", Actions: []string{"s3:GetBucketLocation"}, Resources: []string{s3Arn(scratchBucket)}},
+	)
+	if args.KmsID != "" && args.KmsID != KmsSSES3 {
+		grants = append(grants, roleGrant{Sid: "UseKMSKey", Actions: []string{"kms:Decrypt", "kms:GenerateDataKey"},
+			Resources: []string{kmsKeyArn(args.KmsID, args.SourceRegion, args.AccountID)}})
+	}
+	return grants
+}
+
+// A KMS key ID as an ARN in the run's region, and its partition, and account
+func kmsKeyArn(id, region, accountID string) string {
+	if strings.HasPrefix(id, "arn:") {
+		return id
+	}
+	if !strings.HasPrefix(id, "alias/") {
+		id = "key/" + id
+	}
+	return fmt.Sprintf("arn:%s:kms:%s:%s:%s", util.Partition(region), region, accountID, id)
+}
+
+// The batch role's policy document granting grants
+func batchRolePolicy(grants []roleGrant) (string, error) {
+	statements := []map[string]any{}
+	for _, g := range grants {
+		statements = append(statements, map[string]any{
+			"Sid":      g.Sid,
+			"Effect":   "Allow",
+			"Action":   g.Actions,
+			"Resource": g.Resources,
+		})
+	}
+	body, err := json.Marshal(map[string]any{"Version": "2012-10-17", "Statement": statements})
+	return string(body), err
+}
+
+// Create the role S3 Batch Operations assumes to run the jobs, or reset the trust policy and permissions
+// of an existing role of that name, returning its ARN
+func (s3obj *s3migration) ensureBatchRole(ctx context.Context, client iamRoleAPI, name string, args MigrationArgs) (string, error) {
+	policy, err := batchRolePolicy(batchRoleGrants(args, s3obj.scratchBucket(args.SourceBucket)))
+	if err != nil {
+		return "", err
+	}
+	var (
+		arn     string
+		created bool
+		missing *iamtypes.NoSuchEntityException
+	)
+	out, err := client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+	switch {
+	case errors.As(err, &missing):
+		cout, cerr := client.CreateRole(ctx, &iam.CreateRoleInput{
+			RoleName:                 aws.String(name),
+			AssumeRolePolicyDocument: aws.String(batchRoleTrustPolicy),
+			Description:              aws.String(fmt.Sprintf("S3 Batch Operations migration of %s to %s", args.SourceBucket, args.DestinationBucket)),
+		})
+		if cerr != nil {
+			return "", cerr
+		}
+		arn, created = aws.ToString(cout.Role.Arn), true
+	case err != nil:
+		return "", err
+	default:
+		arn = aws.ToString(out.Role.Arn)
+		if _, err := client.UpdateAssumeRolePolicy(ctx, &iam.UpdateAssumeRolePolicyInput{
+			RoleName:       aws.String(name),
+			PolicyDocument: aws.String(batchRoleTrustPolicy),
+		}); err != nil {
+			return "", err
+		}
+	}
+	if _, err := client.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       aws.String(name),
+		PolicyName:     aws.String(batchRolePolicyName),
+		PolicyDocument: aws.String(policy),
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Batch operations role is ready",
+		zap.String("role", arn),
+		zap.Bool("created", created),
+		zap.String("policy", batchRolePolicyName),
+	)
+	if created {
+		time.Sleep(roleSettleDelay)
+	}
+	return arn, nil
+}
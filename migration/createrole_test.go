@@ -0,0 +1,125 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type iamMock struct {
+	roles  map[string]string // Trust policy by role name
+	policy string            // Last inline policy put
+	calls  []string
+}
+
+func (m *iamMock) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	m.calls = append(m.calls, "GetRole")
+	if _, ok := m.roles[*params.RoleName]; !ok {
+		return nil, &iamtypes.NoSuchEntityException{}
+	}
+	return &iam.GetRoleOutput{Role: &iamtypes.Role{Arn: aws.String("arn:aws:iam::111122223333:role/" + *params.RoleName)}}, nil
+}
+
+func (m *iamMock) CreateRole(ctx context.Context, params *iam.CreateRoleInput, optFns ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	m.calls = append(m.calls, "CreateRole")
+	m.roles[*params.RoleName] = *params.AssumeRolePolicyDocument
+	return &iam.CreateRoleOutput{Role: &iamtypes.Role{Arn: aws.String("arn:aws:iam::111122223333:role/" + *params.RoleName)}}, nil
+}
+
+func (m *iamMock) UpdateAssumeRolePolicy(ctx context.Context, params *iam.UpdateAssumeRolePolicyInput, optFns ...func(*iam.Options)) (*iam.UpdateAssumeRolePolicyOutput, error) {
+	m.calls = append(m.calls, "UpdateAssumeRolePolicy")
+	m.roles[*params.RoleName] = *params.PolicyDocument
+	return &iam.UpdateAssumeRolePolicyOutput{}, nil
+}
+
+func (m *iamMock) PutRolePolicy(ctx context.Context, params *iam.PutRolePolicyInput, optFns ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	m.calls = append(m.calls, "PutRolePolicy")
+	m.policy = *params.PolicyDocument
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+// Actions and resources of each statement of a batch role policy, by Sid
+func policyGrants(t *testing.T, document string) map[string][]string {
+	var policy struct {
+		Statement []struct {
+			Sid      string
+			Action   []string
+			Resource []string
+		}
+	}
+	assert.NoError(t, json.Unmarshal([]byte(document), &policy))
+	grants := map[string][]string{}
+	for _, st := range policy.Statement {
+		grants[st.Sid] = append(st.Action, st.Resource...)
+	}
+	return grants
+}
+
+func TestEnsureBatchRole(t *testing.T) {
+	delay := roleSettleDelay
+	roleSettleDelay = 0
+	t.Cleanup(func() { roleSettleDelay = delay })
+	m := &iamMock{roles: map[string]string{}}
+	s3mig := &s3migration{}
+	args := MigrationArgs{SourceBucket: "src", DestinationBucket: "dst", SourceRegion: "us-east-1", AccountID: "111122223333",
+		CannedACL: CannedACLNone, KmsID: "1234abcd-12ab-34cd-56ef-1234567890ab"}
+
+	arn, err := s3mig.ensureBatchRole(context.TODO(), m, "migration", args)
+	assert.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::111122223333:role/migration", arn)
+	assert.Equal(t, []string{"GetRole", "CreateRole", "PutRolePolicy"}, m.calls)
+	assert.Equal(t, batchRoleTrustPolicy, m.roles["migration"])
+
+	statements := policyGrants(t, m.policy)
+	assert.Equal(t, []string{"s3:GetObject", "s3:GetObjectVersion", "s3:GetObjectTagging", "s3:GetObjectVersionTagging", "arn:aws:s3:::src/*"},
+		statements["ReadSourceObjects"])
+	// No canned ACL is set, so no ACL permission is needed
+	assert.Equal(t, []string{"s3:PutObject", "s3:PutObjectTagging", "arn:aws:s3:::dst/*"}, statements["WriteDestinationObjects"])
+	assert.Equal(t, []string{"s3:PutObject", "arn:aws:s3:::src/src/*"}, statements["WriteReports"])
+	assert.Equal(t, []string{"kms:Decrypt", "kms:GenerateDataKey", "arn:aws:kms:us-east-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab"},
+		statements["UseKMSKey"])
+
+	// An existing role gets its trust policy reset and its permissions replaced
+	m.calls, m.roles["migration"] = nil, "{}"
+	args.Mode, args.FunctionArn, args.KmsID = ModeLambda, "arn:aws:lambda:us-east-1:111122223333:function:tag", KmsSSES3
+	_, err = s3mig.ensureBatchRole(context.TODO(), m, "migration", args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GetRole", "UpdateAssumeRolePolicy", "PutRolePolicy"}, m.calls)
+	assert.Equal(t, batchRoleTrustPolicy, m.roles["migration"])
+	statements = policyGrants(t, m.policy)
+	assert.Equal(t, []string{"lambda:InvokeFunction", "arn:aws:lambda:us-east-1:111122223333:function:tag"}, statements["InvokeFunction"])
+	assert.NotContains(t, statements, "ReadSourceObjects")
+	assert.NotContains(t, statements, "UseKMSKey")
+}
+
+func TestBatchRoleGrants(t *testing.T) {
+	args := MigrationArgs{SourceBucket: "src", DestinationBucket: "dst", SourceRegion: "us-east-1", AccountID: "111122223333", CannedACL: CannedACLNone}
+	grants := map[string]roleGrant{}
+	for _, g := range batchRoleGrants(args, "src") {
+		grants[g.Sid] = g
+	}
+	assert.NotContains(t, grants, "ListSourceBucket")
+
+	// A generated manifest lists the source bucket
+	args.ManifestGenerator = true
+	grants = map[string]roleGrant{}
+	for _, g := range batchRoleGrants(args, "src") {
+		grants[g.Sid] = g
+	}
+	assert.Equal(t, roleGrant{Sid: "ListSourceBucket", Actions: []string{"s3:ListBucket", "s3:ListBucketVersions"},
+		Resources: []string{"arn:aws:s3:::src"}}, grants["ListSourceBucket"])
+
+	// ARNs are in the partition of the region
+	args.SourceRegion, args.KmsID = "cn-north-1", "alias/migration"
+	for _, g := range batchRoleGrants(args, "src") {
+		for _, resource := range g.Resources {
+			assert.Regexp(t, `^arn:aws-cn:`, resource)
+		}
+	}
+	assert.Equal(t, "arn:aws-us-gov:kms:us-gov-west-1:111122223333:key/id", kmsKeyArn("id", "us-gov-west-1", "111122223333"))
+}
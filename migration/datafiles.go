@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+)
+
+// Default number of inventory data files filtered at once, see filterDataFiles
+const defaultSelectConcurrency = 4
+
+// Filter the inventory data files with the S3 Select expression, running up to selectConcurrency requests
+// at once and merging their results into a single CSV stream.  Results are merged as whole lines, so lines
+// of different files are interleaved while those of each file keep their order.  Inventory keys are URL
+// encoded, so a row is never split over several lines.  A failed file ends the stream with its error.
+func (s3obj *s3migration) filterDataFiles(ctx context.Context, bucket string, keys []string, expression string) io.Reader {
+	if len(keys) == 1 {
+		return s3obj.filterGzippedCsv(ctx, bucket, keys[0], expression)
+	}
+	concurrency := s3obj.selectConcurrency
+	if concurrency < 1 {
+		concurrency = defaultSelectConcurrency
+	}
+
+	pr, pw := io.Pipe()
+	work := make(chan string)
+	stop := make(chan struct{})
+	var (
+		mu       sync.Mutex // Serializes writes so lines aren't interleaved
+		wg       sync.WaitGroup
+		stopOnce sync.Once
+	)
+	fail := func(err error) {
+		stopOnce.Do(func() {
+			pw.CloseWithError(err)
+			close(stop)
+		})
+	}
+	for i := 0; i < min(concurrency, len(keys)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				if err := s3obj.copyLines(pw, &mu, s3obj.filterGzippedCsv(ctx, bucket, key, expression)); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	go func() {
+		defer func() {
+			close(work)
+			wg.Wait()
+			pw.Close()
+		}()
+		for _, key := range keys {
+			select {
+			case work <- key:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				fail(ctx.Err())
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// Copy r to w line by line, holding mu for each line
+func (s3obj *s3migration) copyLines(w io.Writer, mu *sync.Mutex, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			mu.Lock()
+			_, werr := w.Write(line)
+			mu.Unlock()
+			if werr != nil {
+				return werr
+			}
+			s3obj.heartbeat.Beat()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterDataFiles(t *testing.T) {
+	m := &mock{objects: map[string]string{}}
+	keys := []string{}
+	expected := []string{}
+	for i := 0; i < 6; i++ {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		for j := 0; j < 100; j++ {
+			parity := "odd"
+			if j%2 == 0 {
+				parity = "even"
+			}
+			fmt.Fprintf(w, "src,file%d/%d.txt,%s\n", i, j, parity)
+			if parity == "even" {
+				expected = append(expected, fmt.Sprintf("src,file%d/%d.txt", i, j))
+			}
+		}
+		w.Close()
+		key := fmt.Sprintf("src/data/%d.csv.gz", i)
+		m.objects[key] = b.String()
+		keys = append(keys, key)
+	}
+	s3mig := &s3migration{s3Client: m, localFilter: true, selectConcurrency: 3}
+
+	out, err := io.ReadAll(s3mig.filterDataFiles(context.TODO(), "src", keys, "SELECT s._1, s._2 FROM s3object s WHERE s._3 = 'even'"))
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	slices.Sort(lines)
+	slices.Sort(expected)
+	assert.Equal(t, expected, lines)
+
+	// A file that can't be filtered ends the stream with its error
+	m.objects[keys[4]] = "not gzipped"
+	_, err = io.ReadAll(s3mig.filterDataFiles(context.TODO(), "src", keys, "SELECT s._2 FROM s3object s"))
+	assert.Error(t, err)
+}
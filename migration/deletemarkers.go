@@ -0,0 +1,169 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"os"
+	"s3migration/util"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+// Delete markers in the source bucket's version stacks.  Delete markers are never copied.
+type DeleteMarkerSummary struct {
+	Versions      int `json:"versions"`      // Versions and delete markers
+	Markers       int `json:"markers"`       // Delete markers, current and non-current
+	Latest        int `json:"latest"`        // Keys whose latest version is a delete marker
+	PurgeEligible int `json:"purgeEligible"` // Latest delete markers with no other version of the key, ie. expired
+}
+
+// A row of a version stack listing, from the inventory or ListObjectVersions
+type versionRow struct {
+	Key          string
+	VersionID    string
+	IsLatest     bool
+	DeleteMarker bool
+}
+
+// Calls fn for each version and delete marker in the source bucket
+type versionScanner func(fn func(versionRow) error) error
+
+// Count delete markers and find the purge-eligible ones.  Rows for a key aren't guaranteed to be
+// adjacent, so the versions are scanned twice: once for the latest delete markers, then to find the
+// keys with other versions.  Only the latest delete markers are held in memory.
+func analyzeDeleteMarkers(scan versionScanner) (*DeleteMarkerSummary, [][]string, error) {
+	latest := map[string]string{}
+	eligible := map[string]bool{}
+	err := scan(func(row versionRow) error {
+		if row.IsLatest && row.DeleteMarker {
+			latest[row.Key] = row.VersionID
+			eligible[row.Key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := &DeleteMarkerSummary{Latest: len(latest)}
+	err = scan(func(row versionRow) error {
+		summary.Versions++
+		if row.DeleteMarker {
+			summary.Markers++
+		}
+		if id, ok := latest[row.Key]; ok && id != row.VersionID {
+			delete(eligible, row.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([][]string, 0, len(eligible))
+	for key := range eligible {
+		rows = append(rows, []string{key, latest[key]})
+	}
+	slices.SortFunc(rows, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+	summary.PurgeEligible = len(rows)
+	return summary, rows, nil
+}
+
+// Scan the version stacks recorded in the inventory's data files
+func (s3obj *s3migration) inventoryVersions(ctx context.Context, inventory inventoryReport) (versionScanner, error) {
+	manifestJson, err := s3obj.readInventoryManifest(ctx, inventory.Bucket, inventory.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	expression, err := util.GetVersionStackQueryExpression(manifestJson.FileSchema)
+	if err != nil {
+		return nil, err
+	}
+	return func(fn func(versionRow) error) error {
+		r := csv.NewReader(s3obj.filterDataFiles(ctx, inventory.Bucket, manifestJson.dataFileKeys(), expression))
+		for {
+			rec, rerr := r.Read()
+			if rerr == io.EOF {
+				return nil
+			}
+			if rerr != nil {
+				return rerr
+			}
+			key, kerr := util.DecodeManifestKey(rec[0])
+			if kerr != nil {
+				return kerr
+			}
+			s3obj.heartbeat.Beat()
+			if err := fn(versionRow{Key: key, VersionID: rec[1], IsLatest: rec[2] == "true", DeleteMarker: rec[3] == "true"}); err != nil {
+				return err
+			}
+		}
+	}, nil
+}
+
+// Scan the version stacks by listing the source bucket
+func (s3obj *s3migration) listedVersions(ctx context.Context, bucket string) versionScanner {
+	return func(fn func(versionRow) error) error {
+		paginator := s3.NewListObjectVersionsPaginator(s3obj.s3Client, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)})
+		for paginator.HasMorePages() {
+			s3obj.heartbeat.Beat()
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+			for _, v := range page.Versions {
+				if err := fn(versionRow{Key: *v.Key, VersionID: aws.ToString(v.VersionId), IsLatest: aws.ToBool(v.IsLatest)}); err != nil {
+					return err
+				}
+			}
+			for _, m := range page.DeleteMarkers {
+				if err := fn(versionRow{Key: *m.Key, VersionID: aws.ToString(m.VersionId), IsLatest: aws.ToBool(m.IsLatest), DeleteMarker: true}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Analyze the source bucket's delete markers, from the inventory when there is one or by listing otherwise,
+// logging the counts and writing the purge-eligible markers as key,versionId to purgeFile when given
+func (s3obj *s3migration) deleteMarkerAnalysis(ctx context.Context, bucket string, inventory *inventoryReport, purgeFile string) (*DeleteMarkerSummary, error) {
+	scan := s3obj.listedVersions(ctx, bucket)
+	if inventory != nil {
+		var err error
+		if scan, err = s3obj.inventoryVersions(ctx, *inventory); err != nil {
+			return nil, err
+		}
+	}
+	summary, eligible, err := analyzeDeleteMarkers(scan)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Info("Analyzed source delete markers, which are not copied",
+		zap.String("bucket", bucket),
+		zap.Int("versions", summary.Versions),
+		zap.Int("markers", summary.Markers),
+		zap.Int("latest", summary.Latest),
+		zap.Int("purgeEligible", summary.PurgeEligible),
+	)
+	if purgeFile == "" {
+		return summary, nil
+	}
+	f, err := os.Create(purgeFile)
+	if err != nil {
+		return summary, err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(eligible); err != nil {
+		return summary, err
+	}
+	zap.L().Info("Wrote purge-eligible delete markers", zap.String("file", purgeFile), zap.Int("count", len(eligible)))
+	return summary, nil
+}
@@ -0,0 +1,38 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteMarkerAnalysis(t *testing.T) {
+	now := time.Now()
+	m := &mock{listObjectVersionsOutput: &s3.ListObjectVersionsOutput{
+		Versions: []s3types.ObjectVersion{
+			{Key: aws.String("live"), VersionId: aws.String("v1"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+			{Key: aws.String("deleted"), VersionId: aws.String("v2"), IsLatest: aws.Bool(false), LastModified: aws.Time(now)},
+		},
+		DeleteMarkers: []s3types.DeleteMarkerEntry{
+			{Key: aws.String("deleted"), VersionId: aws.String("m1"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+			{Key: aws.String("expired"), VersionId: aws.String("m2"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+			{Key: aws.String("live"), VersionId: aws.String("m3"), IsLatest: aws.Bool(false), LastModified: aws.Time(now)},
+		},
+	}}
+	s3mig := &s3migration{s3Client: m}
+	purgeFile := filepath.Join(t.TempDir(), "purge.csv")
+
+	summary, err := s3mig.deleteMarkerAnalysis(context.TODO(), "src", nil, purgeFile)
+	assert.NoError(t, err)
+	assert.Equal(t, &DeleteMarkerSummary{Versions: 5, Markers: 3, Latest: 2, PurgeEligible: 1}, summary)
+	body, err := os.ReadFile(purgeFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "expired,m2\n", string(body))
+}
@@ -0,0 +1,179 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"s3migration/util"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Delete markers to replay in the destination once the copy completes.  Keys are written to the source
+// bucket's scratch location in the --keys-file format so the plan stays small and can be resumed.
+type deleteReplay struct {
+	Key      string `json:"key"`
+	Count    int    `json:"count"`
+	Replayed bool   `json:"replayed,omitempty"`
+}
+
+// Find the keys whose latest source version is a delete marker, from the inventory when there is one or
+// by listing the source bucket otherwise, and record them for replayDeleteMarkers
+func (s3obj *s3migration) collectDeleteMarkers(ctx context.Context, bucket string, inventory *inventoryReport, filters userFilters) (*deleteReplay, error) {
+	replay := &deleteReplay{Key: fmt.Sprintf("%s/%s/deletes/%s.csv", bucket, inventoryConfigName, time.Now().UTC().Format("2006-01-02T15-04-05Z"))}
+	pr, pw := io.Pipe()
+	go func() {
+		w := csv.NewWriter(pw)
+		write := func(key string) error {
+			replay.Count++
+			return w.Write([]string{key})
+		}
+		var err error
+		if inventory != nil {
+			err = s3obj.inventoryDeleteMarkers(ctx, *inventory, filters, write)
+		} else {
+			err = s3obj.listDeleteMarkers(ctx, bucket, filters, write)
+		}
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+		pw.CloseWithError(err)
+	}()
+	if _, err := s3obj.uploadS3File(ctx, s3obj.scratchBucket(bucket), replay.Key, pr); err != nil {
+		return nil, err
+	}
+	zap.L().Info("Found delete markers to replay in the destination",
+		zap.String("file", replay.Key),
+		zap.Int("count", replay.Count),
+	)
+	return replay, nil
+}
+
+func (s3obj *s3migration) inventoryDeleteMarkers(ctx context.Context, inventory inventoryReport, filters userFilters, fn func(key string) error) error {
+	manifestJson, err := s3obj.readInventoryManifest(ctx, inventory.Bucket, inventory.Manifest)
+	if err != nil {
+		return err
+	}
+	expression, err := util.GetDeleteMarkerQueryExpression(manifestJson.FileSchema, filters.StartDate, filters.EndDate)
+	if err == nil {
+		expression, err = util.AddModifiedFilter(expression, manifestJson.FileSchema, filters.Modified)
+	}
+	if err != nil {
+		return err
+	}
+	r := csv.NewReader(s3obj.filterDataFiles(ctx, inventory.Bucket, manifestJson.dataFileKeys(), expression))
+	for {
+		rec, rerr := r.Read()
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+		key, kerr := util.DecodeManifestKey(rec[0])
+		if kerr != nil {
+			return kerr
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+}
+
+func (s3obj *s3migration) listDeleteMarkers(ctx context.Context, bucket string, filters userFilters, fn func(key string) error) error {
+	paginator := s3.NewListObjectVersionsPaginator(s3obj.s3Client, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		s3obj.heartbeat.Beat()
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, marker := range page.DeleteMarkers {
+			if !aws.ToBool(marker.IsLatest) || !filters.matchesDate(*marker.LastModified) {
+				continue
+			}
+			if err := fn(*marker.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Delete each recorded key in the destination, creating a delete marker on top of the copied versions so
+// the destination version stack mirrors the source.  Returns the number of delete markers created.
+func (s3obj *s3migration) replayDeletes(ctx context.Context, sourceBucket, destinationBucket string, replay *deleteReplay) (int, error) {
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s3obj.scratchBucket(sourceBucket)), Key: aws.String(replay.Key)})
+	if err != nil {
+		return 0, err
+	}
+	defer out.Body.Close()
+
+	replayed := 0
+	batch := []s3types.ObjectIdentifier{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		s3obj.heartbeat.Beat()
+		res, derr := s3obj.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(destinationBucket),
+			Delete: &s3types.Delete{Objects: batch, Quiet: aws.Bool(true)},
+		})
+		if derr != nil {
+			return derr
+		}
+		replayed += len(batch) - len(res.Errors)
+		for _, e := range res.Errors {
+			zap.L().Warn("Unable to replay delete in destination",
+				zap.String("key", aws.ToString(e.Key)),
+				zap.String("code", aws.ToString(e.Code)),
+				zap.String("message", aws.ToString(e.Message)),
+			)
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err = scanKeys(out.Body, replay.Key, func(key, _ string) error {
+		batch = append(batch, s3types.ObjectIdentifier{Key: aws.String(key)})
+		if len(batch) < deleteObjectsMaxKeys {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	return replayed, err
+}
+
+// Replay the recorded deletes once, after the copy jobs met the success threshold.  The state is saved
+// afterwards so that a resumed run doesn't stack a second delete marker on each key.
+func (s3obj *s3migration) replayDeleteMarkers(ctx context.Context, st *runState) {
+	if st.Deletes == nil || st.Deletes.Replayed {
+		return
+	}
+	replayStart := time.Now()
+	replayed, err := s3obj.replayDeletes(ctx, st.Args.SourceBucket, st.Args.DestinationBucket, st.Deletes)
+	s3obj.timePhase(PhaseDeleteReplay, replayStart)
+	if s3obj.report != nil {
+		s3obj.report.DeletesReplayed = replayed
+	}
+	if err != nil {
+		zap.L().Error("Failed to replay deletes in the destination", zap.Int("replayed", replayed), zap.Error(err))
+		return
+	}
+	st.Deletes.Replayed = true
+	st.mustSave()
+	zap.L().Info("Replayed deletes in the destination",
+		zap.String("bucket", st.Args.DestinationBucket),
+		zap.Int("count", st.Deletes.Count),
+		zap.Int("replayed", replayed),
+	)
+}
@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayDeletes(t *testing.T) {
+	now := time.Now()
+	m := &mock{
+		objects: map[string]string{},
+		listObjectVersionsOutput: &s3.ListObjectVersionsOutput{
+			DeleteMarkers: []s3types.DeleteMarkerEntry{
+				{Key: aws.String("gone, with comma"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+				{Key: aws.String("restored"), IsLatest: aws.Bool(false), LastModified: aws.Time(now)},
+			},
+		},
+	}
+	s3mig := &s3migration{s3Client: m, report: newReport(MigrationArgs{})}
+
+	replay, err := s3mig.collectDeleteMarkers(context.TODO(), "src", nil, userFilters{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, replay.Count)
+	assert.Contains(t, replay.Key, "src/"+inventoryConfigName+"/deletes/")
+	assert.Equal(t, "\"gone, with comma\"\n", m.objects[replay.Key])
+
+	st := &runState{Args: MigrationArgs{SourceBucket: "src", DestinationBucket: "dst"}, Deletes: replay}
+	s3mig.replayDeleteMarkers(context.TODO(), st)
+	assert.Equal(t, []string{"gone, with comma"}, m.deleted)
+	assert.True(t, st.Deletes.Replayed)
+	assert.Equal(t, 1, s3mig.report.DeletesReplayed)
+
+	// A resumed run must not stack a second delete marker
+	s3mig.replayDeleteMarkers(context.TODO(), st)
+	assert.Len(t, m.deleted, 1)
+}
@@ -0,0 +1,252 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"s3migration/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Reasons an object is reported by Diff
+const (
+	DiffMissing  = "missing"  // Not in the destination
+	DiffSize     = "size"     // In the destination with a different size
+	DiffETag     = "etag"     // In the destination with the same size and a different ETag
+	DiffChecksum = "checksum" // In the destination without the expected additional checksum, see Verify
+)
+
+// Header of the CSV written by Diff
+var diffHeader = []string{"Key", "Reason", "SourceSize", "DestinationSize", "SourceETag", "DestinationETag"}
+
+type DiffArgs struct {
+	SourceRegion      string
+	SourceBucket      string
+	DestinationBucket string
+	ConfigName        string // Inventory configuration read on both buckets unless ListMode
+	InventoryBucket   string // Bucket the source bucket's inventory is delivered to, see --inventory-dest-bucket
+	ListMode          bool   // List both buckets rather than reading their latest inventory reports
+	CompareETag       bool   // Also report objects of the same size whose single part ETags differ
+	ChecksumAlgorithm string // Also report destination objects without this additional checksum, eg. SHA256
+}
+
+// Outcome of a Diff
+type DiffSummary struct {
+	Source      int `json:"source"`      // Objects in the source bucket
+	Destination int `json:"destination"` // Objects in the destination bucket
+	Missing     int `json:"missing"`
+	Different   int `json:"different"` // Different size, or ETag when compared
+}
+
+// Size and ETag, without quotes, of the latest version of an object
+type objectInfo struct {
+	size     int64
+	etag     string
+	checksum string // Additional checksum algorithm, empty when it has none or it isn't known
+}
+
+// Reports whether two objects' ETags can tell whether their content differs: both must be known and neither
+// from a multipart upload, whose ETag, suffixed with -<parts>, depends on the part size.  SSE-KMS objects'
+// ETags aren't the MD5 of their content either, but can't be told apart from the ETag alone.
+func comparableETags(a, b string) bool {
+	return a != "" && b != "" && !strings.Contains(a, "-") && !strings.Contains(b, "-")
+}
+
+// Calls fn for the latest version of each object in a bucket, delete markers excluded
+type objectScanner func(fn func(key string, info objectInfo) error) error
+
+// Compare the latest versions of the source bucket's objects with the destination's and write those missing
+// in the destination or differing from it to w as CSV, without creating any job.  Each bucket is read from its
+// latest inventory report, or listed when it has none or with ListMode.  The destination's objects are held in
+// memory while the source is read.
+func Diff(args DiffArgs, w io.Writer) (*DiffSummary, error) {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", args.SourceRegion),
+			zap.Error(err),
+		)
+	}
+	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg), inventoryBucket: args.InventoryBucket}
+	summary, err := s3mig.diff(ctx, args, w)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Info("Compared source and destination",
+		zap.String("source", args.SourceBucket),
+		zap.String("destination", args.DestinationBucket),
+		zap.Int("sourceObjects", summary.Source),
+		zap.Int("destinationObjects", summary.Destination),
+		zap.Int("missing", summary.Missing),
+		zap.Int("different", summary.Different),
+	)
+	return summary, nil
+}
+
+func (s3obj *s3migration) diff(ctx context.Context, args DiffArgs, w io.Writer) (*DiffSummary, error) {
+	source := s3obj.bucketObjects(ctx, args.SourceBucket, args.ConfigName, args.ListMode)
+	destination := s3obj.bucketObjects(ctx, args.DestinationBucket, args.ConfigName, args.ListMode)
+	return s3obj.compareObjects(source, destination, args, w)
+}
+
+// Write the source objects missing in the destination or differing from it to w as CSV
+func (s3obj *s3migration) compareObjects(sourceObjects, destinationObjects objectScanner, args DiffArgs, w io.Writer) (*DiffSummary, error) {
+	summary := &DiffSummary{}
+	destination := map[string]objectInfo{}
+	err := destinationObjects(func(key string, info objectInfo) error {
+		destination[key] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	summary.Destination = len(destination)
+
+	out := csv.NewWriter(w)
+	if err := out.Write(diffHeader); err != nil {
+		return nil, err
+	}
+	err = sourceObjects(func(key string, info objectInfo) error {
+		summary.Source++
+		s3obj.heartbeat.Beat()
+		dest, ok := destination[key]
+		reason := ""
+		switch {
+		case !ok:
+			reason = DiffMissing
+			summary.Missing++
+		case dest.size != info.size:
+			reason = DiffSize
+			summary.Different++
+		case args.CompareETag && comparableETags(info.etag, dest.etag) && dest.etag != info.etag:
+			reason = DiffETag
+			summary.Different++
+		case args.ChecksumAlgorithm != "" && dest.checksum != args.ChecksumAlgorithm:
+			reason = DiffChecksum
+			summary.Different++
+		default:
+			return nil
+		}
+		destSize := ""
+		if ok {
+			destSize = strconv.FormatInt(dest.size, 10)
+		}
+		return out.Write([]string{key, reason, strconv.FormatInt(info.size, 10), destSize, info.etag, dest.etag})
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Flush()
+	return summary, out.Error()
+}
+
+// Scan a bucket's latest inventory report, found with its existing configuration, or list it when it
+// has none or listMode is set
+func (s3obj *s3migration) bucketObjects(ctx context.Context, bucket, configName string, listMode bool) objectScanner {
+	if !listMode {
+		finder, err := s3obj.ensureS3InventoryConfig(ctx, bucket, configName, false, "")
+		if err == nil {
+			manifest, merr := s3obj.getLatestManifest(ctx, finder)
+			if merr == nil && manifest != nil && manifest.Key != nil {
+				zap.L().Info("Reading objects from inventory",
+					zap.String("bucket", bucket),
+					zap.String("manifest", *manifest.Key),
+				)
+				return s3obj.inventoryObjects(ctx, finder.BucketName, *manifest)
+			}
+		}
+		zap.L().Info("No inventory report found, listing bucket", zap.String("bucket", bucket))
+	}
+	return s3obj.listedObjects(ctx, bucket)
+}
+
+func (s3obj *s3migration) listedObjects(ctx context.Context, bucket string) objectScanner {
+	return func(fn func(key string, info objectInfo) error) error {
+		paginator := s3.NewListObjectsV2Paginator(s3obj.s3Client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+		for paginator.HasMorePages() {
+			s3obj.heartbeat.Beat()
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return err
+			}
+			for _, obj := range page.Contents {
+				info := objectInfo{size: aws.ToInt64(obj.Size), etag: strings.Trim(aws.ToString(obj.ETag), `"`)}
+				if len(obj.ChecksumAlgorithm) > 0 {
+					info.checksum = string(obj.ChecksumAlgorithm[0])
+				}
+				if err := fn(*obj.Key, info); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Scan the latest versions recorded in an inventory report.  Inventories without an ETag field report
+// empty ETags, so only sizes are compared, and those without a ChecksumAlgorithm field no checksums.
+func (s3obj *s3migration) inventoryObjects(ctx context.Context, bucket string, manifest s3types.Object) objectScanner {
+	return func(fn func(key string, info objectInfo) error) error {
+		manifestJson, err := s3obj.readInventoryManifest(ctx, bucket, manifest)
+		if err != nil {
+			return err
+		}
+		fields := []string{"Key", SizeColumn}
+		etagCol, checksumCol := -1, -1
+		latestOnly := ""
+		for _, col := range strings.Split(manifestJson.FileSchema, ",") {
+			switch strings.TrimSpace(col) {
+			case "ETag":
+				etagCol = len(fields)
+				fields = append(fields, "ETag")
+			case checksumColumn:
+				checksumCol = len(fields)
+				fields = append(fields, checksumColumn)
+			case util.IsLatestColumn:
+				latestOnly = util.IsLatestYes
+			}
+		}
+		expression, err := util.GetBatchQueryExpression(manifestJson.FileSchema, fields, time.Time{}, time.Time{}, latestOnly)
+		if err != nil {
+			return err
+		}
+		r := csv.NewReader(s3obj.filterDataFiles(ctx, bucket, manifestJson.dataFileKeys(), expression))
+		r.FieldsPerRecord = -1
+		for {
+			rec, rerr := r.Read()
+			if rerr == io.EOF {
+				return nil
+			}
+			if rerr != nil {
+				return rerr
+			}
+			key, kerr := util.DecodeManifestKey(rec[0])
+			if kerr != nil {
+				return kerr
+			}
+			info := objectInfo{}
+			info.size, _ = strconv.ParseInt(rec[1], 10, 64)
+			if etagCol > 0 && len(rec) > etagCol {
+				info.etag = rec[etagCol]
+			}
+			if checksumCol > 0 && len(rec) > checksumCol {
+				info.checksum = rec[checksumCol]
+			}
+			if err := fn(key, info); err != nil {
+				return err
+			}
+		}
+	}
+}
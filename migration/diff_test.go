@@ -0,0 +1,60 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Lists different objects for each bucket
+type bucketListMock struct {
+	*mock
+	listings map[string][]s3types.Object
+}
+
+func (m *bucketListMock) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return &s3.ListObjectsV2Output{Contents: m.listings[*params.Bucket]}, nil
+}
+
+func TestDiff(t *testing.T) {
+	obj := func(key string, size int64, etag string) s3types.Object {
+		return s3types.Object{Key: aws.String(key), Size: aws.Int64(size), ETag: aws.String(`"` + etag + `"`)}
+	}
+	m := &bucketListMock{mock: &mock{}, listings: map[string][]s3types.Object{
+		"src": {obj("same.txt", 10, "a"), obj("missing, comma.txt", 5, "b"), obj("resized.txt", 20, "c"), obj("changed.txt", 30, "d")},
+		"dst": {obj("same.txt", 10, "a"), obj("resized.txt", 21, "c"), obj("changed.txt", 30, "e"), obj("extra.txt", 1, "f")},
+	}}
+	s3mig := &s3migration{s3Client: m}
+	args := DiffArgs{SourceBucket: "src", DestinationBucket: "dst", ListMode: true}
+
+	var out bytes.Buffer
+	summary, err := s3mig.diff(context.TODO(), args, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiffSummary{Source: 4, Destination: 4, Missing: 1, Different: 1}, summary)
+	assert.Equal(t, "Key,Reason,SourceSize,DestinationSize,SourceETag,DestinationETag\n"+
+		"\"missing, comma.txt\",missing,5,,b,\n"+
+		"resized.txt,size,20,21,c,c\n", out.String())
+
+	// ETags are only compared when asked, as copies can have different ones
+	out.Reset()
+	args.CompareETag = true
+	summary, err = s3mig.diff(context.TODO(), args, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Different)
+	assert.Contains(t, out.String(), "changed.txt,etag,30,30,d,e\n")
+
+	// Multipart ETags depend on the part size, so they aren't compared
+	m.listings["src"] = append(m.listings["src"], obj("multipart.bin", 40, "f-2"), obj("single.bin", 50, "g"))
+	m.listings["dst"] = append(m.listings["dst"], obj("multipart.bin", 40, "h-3"), obj("single.bin", 50, "i-1"))
+	out.Reset()
+	summary, err = s3mig.diff(context.TODO(), args, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Different)
+	assert.NotContains(t, out.String(), "multipart.bin")
+	assert.NotContains(t, out.String(), "single.bin")
+}
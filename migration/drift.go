@@ -0,0 +1,112 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"math/rand"
+	"os"
+	"s3migration/util"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"go.uber.org/zap"
+)
+
+const maxReportedDriftKeys = 1000
+
+// Objects modified or deleted on the source after their copy job was created, found by sampling the manifests
+type DriftSummary struct {
+	Rows             int      `json:"rows"`             // Objects in all manifests
+	Sampled          int      `json:"sampled"`          // Objects checked with HeadObject
+	Modified         int      `json:"modified"`         // Sampled objects modified after their job was created
+	Deleted          int      `json:"deleted"`          // Sampled objects no longer on the source
+	EstimatedChanged int      `json:"estimatedChanged"` // Modified and deleted, scaled up to all manifest rows
+	Keys             []string `json:"keys,omitempty"`   // Modified keys, capped at maxReportedDriftKeys
+}
+
+// Sample up to sample rows of each job's manifest and HEAD them on the source, reporting objects modified
+// (or deleted) after the job was created.  These need an incremental pass, eg. with --keys-file.
+func (s3obj *s3migration) checkDrift(ctx context.Context, steps []*jobStep, results []*s3control.DescribeJobOutput, sample int) (*DriftSummary, []string, error) {
+	summary := &DriftSummary{}
+	modified := []string{}
+	seen := map[string]bool{}
+	for i, step := range steps {
+		if results[i] == nil || results[i].Job.CreationTime == nil || step.Input.Manifest == nil {
+			continue
+		}
+		created := *results[i].Job.CreationTime
+		rows, err := s3obj.readManifestRows(ctx, step.Input)
+		if err != nil {
+			return nil, nil, err
+		}
+		summary.Rows += len(rows)
+		for _, r := range rand.Perm(len(rows))[:min(sample, len(rows))] {
+			row := rows[r]
+			if len(row) < 2 {
+				continue
+			}
+			key, kerr := util.DecodeManifestKey(row[1])
+			if kerr != nil {
+				return nil, nil, kerr
+			}
+			// The latest version is checked, so a key in several jobs only needs checking once
+			if seen[row[0]+"/"+key] {
+				continue
+			}
+			seen[row[0]+"/"+key] = true
+			summary.Sampled++
+			s3obj.heartbeat.Beat()
+
+			head, herr := s3obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(row[0]), Key: aws.String(key)})
+			var notFound *s3types.NotFound
+			switch {
+			case errors.As(herr, &notFound):
+				summary.Deleted++
+			case herr != nil:
+				return nil, nil, herr
+			case head.LastModified != nil && head.LastModified.After(created):
+				summary.Modified++
+				modified = append(modified, key)
+			}
+		}
+	}
+	if summary.Sampled > 0 {
+		summary.EstimatedChanged = (summary.Modified + summary.Deleted) * summary.Rows / summary.Sampled
+	}
+	slices.Sort(modified)
+	summary.Keys = modified[:min(len(modified), maxReportedDriftKeys)]
+
+	logger := zap.L().Info
+	if summary.Modified+summary.Deleted > 0 {
+		logger = zap.L().Warn
+	}
+	logger("Source objects changed during the migration window",
+		zap.Int("rows", summary.Rows),
+		zap.Int("sampled", summary.Sampled),
+		zap.Int("modified", summary.Modified),
+		zap.Int("deleted", summary.Deleted),
+		zap.Int("estimatedChanged", summary.EstimatedChanged),
+	)
+	return summary, modified, nil
+}
+
+// Write modified keys in the --keys-file format
+func writeDriftKeys(path string, keys []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	for _, key := range keys {
+		if err := w.Write([]string{key}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
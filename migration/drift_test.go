@@ -0,0 +1,50 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDrift(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	m := &mock{
+		objects: map[string]string{"manifest.csv": "src,unchanged\nsrc,changed%20key\nsrc,deleted\n"},
+		heads: map[string]*s3.HeadObjectOutput{
+			"unchanged":   {LastModified: aws.Time(created.Add(-time.Hour))},
+			"changed key": {LastModified: aws.Time(created.Add(time.Minute))},
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName: aws.String("dst"),
+		ManifestArn:      aws.String("arn:aws:s3:::src/manifest.csv"),
+	})
+	steps := []*jobStep{{Kind: jobKindNonVersion, Input: input}, {Kind: jobKindVersion, Input: input}}
+	results := []*s3control.DescribeJobOutput{
+		{Job: &s3controltypes.JobDescriptor{CreationTime: aws.Time(created)}},
+		{Job: &s3controltypes.JobDescriptor{CreationTime: aws.Time(created)}},
+	}
+
+	drift, keys, err := s3mig.checkDrift(context.TODO(), steps, results, 10)
+	assert.NoError(t, err)
+	// Keys in both manifests are only checked once
+	assert.Equal(t, &DriftSummary{Rows: 6, Sampled: 3, Modified: 1, Deleted: 1, EstimatedChanged: 4, Keys: []string{"changed key"}}, drift)
+
+	file := filepath.Join(t.TempDir(), "changed.txt")
+	assert.NoError(t, writeDriftKeys(file, keys))
+	fields, count, err := keysFileManifestFields(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bucket", "Key"}, fields)
+	assert.Equal(t, 1, count)
+	body, _ := os.ReadFile(file)
+	assert.Equal(t, "changed key\n", string(body))
+}
@@ -0,0 +1,124 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"go.uber.org/zap"
+)
+
+// Source and detail types of the migration lifecycle events sent to EventBridge
+const (
+	EventSource = "s3migration"
+
+	EventMigrationStarted   = "MigrationStarted"
+	EventJobCreated         = "JobCreated"
+	EventJobCompleted       = "JobCompleted"
+	EventThresholdFailed    = "ThresholdFailed"
+	EventMigrationCompleted = "MigrationCompleted"
+)
+
+// An event for the EventBridge PutEvents API
+type EventEntry struct {
+	Source       string `json:"Source"`
+	DetailType   string `json:"DetailType"`
+	Detail       string `json:"Detail"`
+	EventBusName string `json:"EventBusName"`
+}
+
+type eventsAPI interface {
+	PutEvents(ctx context.Context, entries []EventEntry) error
+}
+
+// EventBridge client
+type eventBridge struct {
+	client *eventbridge.Client
+}
+
+func newEventBridge(cfg aws.Config) *eventBridge {
+	return &eventBridge{client: eventbridge.NewFromConfig(cfg)}
+}
+
+func (e *eventBridge) PutEvents(ctx context.Context, entries []EventEntry) error {
+	in := &eventbridge.PutEventsInput{}
+	for _, entry := range entries {
+		in.Entries = append(in.Entries, eventbridgetypes.PutEventsRequestEntry{
+			Source:       aws.String(entry.Source),
+			DetailType:   aws.String(entry.DetailType),
+			Detail:       aws.String(entry.Detail),
+			EventBusName: aws.String(entry.EventBusName),
+		})
+	}
+	out, err := e.client.PutEvents(ctx, in)
+	if err != nil {
+		return err
+	}
+	for _, entry := range out.Entries {
+		if entry.ErrorCode != nil {
+			return fmt.Errorf("event rejected: %s: %s", aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+		}
+	}
+	return nil
+}
+
+// Sends the lifecycle events of a run to an event bus.  Each event's detail carries the run's buckets,
+// account and state file, so rules can match a single migration.
+type lifecycleEvents struct {
+	api    eventsAPI
+	bus    string
+	common map[string]any
+}
+
+// Lifecycle events of the run, nil when no event bus is set
+func newLifecycleEvents(cfg aws.Config, args MigrationArgs) *lifecycleEvents {
+	if args.EventBus == "" {
+		return nil
+	}
+	return &lifecycleEvents{
+		api: newEventBridge(cfg),
+		bus: args.EventBus,
+		common: map[string]any{
+			"sourceBucket":      args.SourceBucket,
+			"destinationBucket": args.DestinationBucket,
+			"accountId":         args.AccountID,
+			"stateFile":         args.StateFile,
+		},
+	}
+}
+
+// Send an event.  Failures are logged rather than failing the migration.  A nil lifecycle does nothing.
+func (e *lifecycleEvents) publish(ctx context.Context, detailType string, detail map[string]any) {
+	if e == nil {
+		return
+	}
+	body := map[string]any{}
+	for k, v := range e.common {
+		body[k] = v
+	}
+	for k, v := range detail {
+		body[k] = v
+	}
+	encoded, _ := json.Marshal(body)
+	entry := EventEntry{Source: EventSource, DetailType: detailType, Detail: string(encoded), EventBusName: e.bus}
+	if err := e.api.PutEvents(ctx, []EventEntry{entry}); err != nil {
+		zap.L().Error("Failed to send migration event", zap.String("detailType", detailType), zap.String("eventBus", e.bus), zap.Error(err))
+	}
+}
+
+func (e *lifecycleEvents) jobCompleted(ctx context.Context, kind string, job *s3control.DescribeJobOutput) {
+	if e == nil || job == nil || job.Job == nil {
+		return
+	}
+	detail := map[string]any{"jobId": aws.ToString(job.Job.JobId), "kind": kind, "status": string(job.Job.Status)}
+	if ps := job.Job.ProgressSummary; ps != nil {
+		detail["total"] = aws.ToInt64(ps.TotalNumberOfTasks)
+		detail["succeeded"] = aws.ToInt64(ps.NumberOfTasksSucceeded)
+		detail["failed"] = aws.ToInt64(ps.NumberOfTasksFailed)
+	}
+	e.publish(ctx, EventJobCompleted, detail)
+}
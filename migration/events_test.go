@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type eventsMock struct {
+	entries []EventEntry
+	err     error
+}
+
+func (e *eventsMock) PutEvents(ctx context.Context, entries []EventEntry) error {
+	e.entries = append(e.entries, entries...)
+	return e.err
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	assert.Nil(t, newLifecycleEvents(aws.Config{}, MigrationArgs{}))
+	var none *lifecycleEvents
+	none.publish(context.TODO(), EventMigrationStarted, nil)
+
+	api := &eventsMock{}
+	e := newLifecycleEvents(aws.Config{}, MigrationArgs{EventBus: "default", SourceBucket: "src", DestinationBucket: "dst"})
+	e.api = api
+	e.jobCompleted(context.TODO(), jobKindNonVersion, &s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:  aws.String("job"),
+		Status: s3controltypes.JobStatusComplete,
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(10),
+			NumberOfTasksSucceeded: aws.Int64(9),
+			NumberOfTasksFailed:    aws.Int64(1),
+		},
+	}})
+	assert.Len(t, api.entries, 1)
+	entry := api.entries[0]
+	assert.Equal(t, EventSource, entry.Source)
+	assert.Equal(t, EventJobCompleted, entry.DetailType)
+	assert.Equal(t, "default", entry.EventBusName)
+	var detail map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(entry.Detail), &detail))
+	assert.Equal(t, "src", detail["sourceBucket"])
+	assert.Equal(t, "job", detail["jobId"])
+	assert.Equal(t, 9.0, detail["succeeded"])
+
+	// A failure to send doesn't stop the migration
+	api.err = errors.New("throttled")
+	e.publish(context.TODO(), EventThresholdFailed, map[string]any{"achieved": 0.5})
+	assert.Len(t, api.entries, 2)
+}
+
+func TestEventBridgePutEvents(t *testing.T) {
+	var target string
+	var body map[string][]EventEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		b, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(b, &body)
+		if body["Entries"][0].DetailType == "Rejected" {
+			_, _ = w.Write([]byte(`{"FailedEntryCount": 1, "Entries": [{"ErrorCode": "InternalFailure", "ErrorMessage": "try again"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"FailedEntryCount": 0, "Entries": [{"EventId": "id"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", BaseEndpoint: aws.String(server.URL), Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})}
+	e := newEventBridge(cfg)
+	assert.NoError(t, e.PutEvents(context.TODO(), []EventEntry{{Source: EventSource, DetailType: EventMigrationStarted, Detail: "{}"}}))
+	assert.Equal(t, "AWSEvents.PutEvents", target)
+	assert.Equal(t, EventMigrationStarted, body["Entries"][0].DetailType)
+
+	assert.ErrorContains(t, e.PutEvents(context.TODO(), []EventEntry{{Source: EventSource, DetailType: "Rejected", Detail: "{}"}}), "InternalFailure")
+}
@@ -0,0 +1,124 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Types of the events in the NDJSON event stream
+const (
+	StreamPhase        = "phase"        // A migration phase completed, with its duration
+	StreamJobStatus    = "jobStatus"    // A batch job status poll
+	StreamError        = "error"        // An error was logged
+	StreamRunCompleted = "runCompleted" // Every job is terminal and the success threshold was evaluated
+)
+
+// Writes the progress of a run as newline delimited JSON events, one object per line with its time and
+// type, for log pipelines (eg. the CloudWatch agent or Splunk) to ingest without parsing the log
+type eventStream struct {
+	out    io.WriteCloser
+	common map[string]any
+	mu     sync.Mutex
+}
+
+// Event stream of the run, written to the file or the "fd:N" file descriptor of args.EventStream.  Nil
+// when none is set, or it can't be opened.
+func newEventStream(args MigrationArgs) *eventStream {
+	if args.EventStream == "" {
+		return nil
+	}
+	out, err := openEventStream(args.EventStream)
+	if err != nil {
+		zap.L().Error("Unable to open event stream, continuing without it", zap.String("eventStream", args.EventStream), zap.Error(err))
+		return nil
+	}
+	return &eventStream{out: out, common: map[string]any{"sourceBucket": args.SourceBucket, "destinationBucket": args.DestinationBucket}}
+}
+
+func openEventStream(target string) (io.WriteCloser, error) {
+	fd, ok := strings.CutPrefix(target, "fd:")
+	if !ok {
+		return os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	}
+	n, err := strconv.Atoi(fd)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid file descriptor %q", fd)
+	}
+	return os.NewFile(uintptr(n), target), nil
+}
+
+// Write one event.  Failures are logged rather than failing the migration.  A nil stream does nothing.
+func (s *eventStream) emit(eventType string, fields map[string]any) {
+	if s == nil {
+		return
+	}
+	event := map[string]any{"time": time.Now().UTC().Format(time.RFC3339Nano), "type": eventType}
+	for k, v := range s.common {
+		event[k] = v
+	}
+	for k, v := range fields {
+		event[k] = v
+	}
+	line, _ := json.Marshal(event)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.out.Write(append(line, '\n')); err != nil {
+		// Not logged at error level, which would be streamed in turn
+		zap.L().Warn("Unable to write to event stream", zap.Error(err))
+	}
+}
+
+func (s *eventStream) phase(name string, d time.Duration) {
+	s.emit(StreamPhase, map[string]any{"phase": name, "seconds": d.Seconds()})
+}
+
+func (s *eventStream) jobStatus(job *s3control.DescribeJobOutput) {
+	if job == nil || job.Job == nil {
+		return
+	}
+	fields := map[string]any{"jobId": aws.ToString(job.Job.JobId), "status": string(job.Job.Status)}
+	if ps := job.Job.ProgressSummary; ps != nil {
+		fields["total"] = aws.ToInt64(ps.TotalNumberOfTasks)
+		fields["succeeded"] = aws.ToInt64(ps.NumberOfTasksSucceeded)
+		fields["failed"] = aws.ToInt64(ps.NumberOfTasksFailed)
+	}
+	s.emit(StreamJobStatus, fields)
+}
+
+func (s *eventStream) runCompleted(r *Report) {
+	if s == nil || r == nil {
+		return
+	}
+	s.emit(StreamRunCompleted, map[string]any{"successRatio": r.SuccessRatio, "requiredRatio": r.RequiredRatio, "thresholdMet": r.ThresholdMet})
+}
+
+// Stream an event for every entry logged at error level or above, by hooking the global logger
+func (s *eventStream) captureErrors() {
+	if s == nil {
+		return
+	}
+	zap.ReplaceGlobals(zap.L().WithOptions(zap.Hooks(func(entry zapcore.Entry) error {
+		if entry.Level >= zapcore.ErrorLevel {
+			s.emit(StreamError, map[string]any{"level": entry.Level.String(), "message": entry.Message})
+		}
+		return nil
+	})))
+}
+
+// Record the time elapsed since start against a phase in the report and the event stream
+func (s3obj *s3migration) timePhase(name string, start time.Time) {
+	s3obj.report.timePhase(name, start)
+	s3obj.stream.phase(name, time.Since(start))
+}
@@ -0,0 +1,68 @@
+package migration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestEventStream(t *testing.T) {
+	assert.Nil(t, newEventStream(MigrationArgs{}))
+	assert.Nil(t, newEventStream(MigrationArgs{EventStream: "fd:x"}))
+	var none *eventStream
+	none.phase(PhaseFilter, time.Second)
+	none.captureErrors()
+
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	s := newEventStream(MigrationArgs{EventStream: path, SourceBucket: "src", DestinationBucket: "dst"})
+	// The default global logger is disabled, so hooks would never run
+	core, _ := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	s.captureErrors()
+
+	s3mig := &s3migration{report: newReport(MigrationArgs{}), stream: s}
+	s3mig.timePhase(PhaseFilter, time.Now().Add(-time.Minute))
+	s.jobStatus(&s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:  aws.String("job"),
+		Status: s3controltypes.JobStatusActive,
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(10),
+			NumberOfTasksSucceeded: aws.Int64(4),
+			NumberOfTasksFailed:    aws.Int64(1),
+		},
+	}})
+	zap.L().Info("Not streamed")
+	zap.L().Error("Failed to get job status")
+	s.runCompleted(&Report{SuccessRatio: 0.9, RequiredRatio: 0.8, ThresholdMet: true})
+
+	body, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	assert.Len(t, lines, 4)
+	events := make([]map[string]any, len(lines))
+	for i, line := range lines {
+		assert.NoError(t, json.Unmarshal([]byte(line), &events[i]))
+		assert.Equal(t, "src", events[i]["sourceBucket"])
+		assert.NotEmpty(t, events[i]["time"])
+	}
+	assert.Equal(t, StreamPhase, events[0]["type"])
+	assert.Equal(t, PhaseFilter, events[0]["phase"])
+	assert.InDelta(t, 60.0, events[0]["seconds"], 1)
+	assert.Equal(t, StreamJobStatus, events[1]["type"])
+	assert.Equal(t, 4.0, events[1]["succeeded"])
+	assert.Equal(t, StreamError, events[2]["type"])
+	assert.Equal(t, "Failed to get job status", events[2]["message"])
+	assert.Equal(t, StreamRunCompleted, events[3]["type"])
+	assert.Equal(t, true, events[3]["thresholdMet"])
+}
@@ -0,0 +1,109 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Split an S3 object ARN, eg. arn:aws:s3:::bucket/manifest.csv, into its bucket and key
+func ParseObjectArn(objectArn string) (bucket, key string, err error) {
+	a, err := arn.Parse(objectArn)
+	if err != nil || a.Service != "s3" || a.Region != "" || a.AccountID != "" {
+		return "", "", fmt.Errorf("%s is not an S3 object ARN", objectArn)
+	}
+	bucket, key, found := strings.Cut(a.Resource, "/")
+	if !found || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("%s is not an S3 object ARN", objectArn)
+	}
+	return bucket, key, nil
+}
+
+// ARN of the object key in bucket, in the partition of another S3 ARN, eg. of the manifest it was split from
+func objectArnLike(like, bucket, key string) *string {
+	a, _ := arn.Parse(like)
+	return aws.String(arn.ARN{Partition: a.Partition, Service: "s3", Resource: bucket + "/" + key}.String())
+}
+
+// Whether an existing manifest is an inventory manifest.json rather than an S3 Batch Operations CSV
+func isInventoryManifest(key string) bool {
+	return strings.HasSuffix(key, ".json")
+}
+
+// Manifest fields of an existing S3 Batch Operations CSV, decided by the columns of its first line
+func (s3obj *s3migration) existingManifestFields(ctx context.Context, bucket, key string) ([]string, error) {
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String("bytes=0-65535"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	cr := csv.NewReader(out.Body)
+	cr.FieldsPerRecord = -1
+	rec, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("manifest s3://%s/%s lists no objects", bucket, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("manifest s3://%s/%s: %w", bucket, key, err)
+	}
+	switch len(rec) {
+	case 2:
+		return keysManifestFields(false), nil
+	case 3:
+		return keysManifestFields(true), nil
+	}
+	return nil, fmt.Errorf("manifest s3://%s/%s: expected bucket,key or bucket,key,versionId lines", bucket, key)
+}
+
+// Plan a single batch job over an existing manifest, eg. one kept from an earlier run or written by other tooling,
+// skipping inventory and filtering
+func (s3obj *s3migration) planExistingManifestJob(ctx context.Context, args MigrationArgs, jobArgs *batchJobArgs) *runState {
+	bucket, key, err := ParseObjectArn(args.ManifestArn)
+	if err != nil {
+		zap.L().Fatal("Invalid manifest ARN", zap.Error(err))
+	}
+	etag := args.ManifestETag
+	if etag == "" {
+		head, herr := s3obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if herr != nil {
+			zap.L().Fatal("Failed to read existing manifest", zap.String("manifest", args.ManifestArn), zap.Error(herr))
+		}
+		etag = aws.ToString(head.ETag)
+	}
+	if !isInventoryManifest(key) {
+		if jobArgs.ManifestFields, err = s3obj.existingManifestFields(ctx, bucket, key); err != nil {
+			zap.L().Fatal("Failed to read existing manifest", zap.String("manifest", args.ManifestArn), zap.Error(err))
+		}
+	}
+	zap.L().Info("Using existing manifest, skipping inventory",
+		zap.String("manifest", args.ManifestArn),
+		zap.String("etag", etag),
+		zap.Strings("fields", jobArgs.ManifestFields),
+	)
+	jobArgs.ManifestArn = aws.String(args.ManifestArn)
+	jobArgs.ManifestETag = aws.String(etag)
+	jobArgs.SingleManifest = true
+
+	input := NewCreateJobInput(jobArgs)
+	if isInventoryManifest(key) {
+		// NewCreateJobInput assumes a CSV for unversioned buckets
+		input.Manifest.Spec = &s3controltypes.JobManifestSpec{Format: s3controltypes.JobManifestFormatS3InventoryReportCsv20161130}
+	}
+	s3obj.setJobOperation(ctx, jobArgs, input)
+	if args.FailureReport {
+		s3obj.enableFailureReport(input, args.SourceBucket)
+	}
+	return newRunState(args.StateFile, args, &jobInputParams{nonVersionJobParam: input})
+}
@@ -0,0 +1,50 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseObjectArn(t *testing.T) {
+	bucket, key, err := ParseObjectArn("arn:aws-us-gov:s3:::manifests/run-1/manifest.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "manifests", bucket)
+	assert.Equal(t, "run-1/manifest.csv", key)
+
+	for _, arn := range []string{"manifests/manifest.csv", "arn:aws:s3:::manifests", "arn:aws:s3:::manifests/", "arn:aws:sqs:us-east-1:111122223333:q/x"} {
+		_, _, err = ParseObjectArn(arn)
+		assert.Error(t, err, arn)
+	}
+
+	assert.Equal(t, "arn:aws-us-gov:s3:::manifests/run-1/manifest-chunk-001-of-002.csv",
+		*objectArnLike("arn:aws-us-gov:s3:::manifests/run-1/manifest.csv", "manifests", "run-1/manifest-chunk-001-of-002.csv"))
+}
+
+func TestPlanExistingManifestJob(t *testing.T) {
+	m := &mock{objects: map[string]string{"run-1/manifest.csv": "src,a.txt,v1\nsrc,b.txt,v2\n"}}
+	s3mig := &s3migration{s3Client: m}
+	args := MigrationArgs{SourceBucket: "src", DestinationBucket: "dst", AccountID: "111122223333",
+		ManifestArn: "arn:aws:s3:::manifests/run-1/manifest.csv", StateFile: t.TempDir() + "/state.json"}
+
+	// The CSV's columns decide the fields, and the ETag is read from the object
+	st := s3mig.planJobs(context.TODO(), args)
+	assert.Len(t, st.Steps, 1)
+	manifest := st.Steps[0].Input.Manifest
+	assert.Equal(t, args.ManifestArn, aws.ToString(manifest.Location.ObjectArn))
+	assert.Equal(t, "test-etag", aws.ToString(manifest.Location.ETag))
+	assert.Equal(t, s3controltypes.JobManifestFormatS3BatchOperationsCsv20180820, manifest.Spec.Format)
+	assert.Equal(t, []s3controltypes.JobManifestFieldName{"Bucket", "Key", "VersionId"}, manifest.Spec.Fields)
+
+	// An inventory manifest.json is passed to S3 Batch Operations as an inventory report
+	args.ManifestArn = "arn:aws:s3:::inventory/src/bulk-copy-inventory/2024-01-01T01-00Z/manifest.json"
+	args.ManifestETag = "abc123"
+	st = s3mig.planJobs(context.TODO(), args)
+	manifest = st.Steps[0].Input.Manifest
+	assert.Equal(t, "abc123", aws.ToString(manifest.Location.ETag))
+	assert.Equal(t, s3controltypes.JobManifestFormatS3InventoryReportCsv20161130, manifest.Spec.Format)
+	assert.Empty(t, manifest.Spec.Fields)
+}
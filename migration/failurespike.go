@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"s3migration/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Returned when a batch job was cancelled because too many of its completed tasks failed
+var ErrFailureSpike = errors.New("batch job cancelled after a failure spike")
+
+// Default number of tasks a job completes before its failure ratio is checked, see --cancel-min-tasks
+const DefaultCancelMinTasks = 10000
+
+// Cancel a running job whose completed tasks fail more often than the cancel ratio, once at least
+// cancelMinTasks of them completed, rather than spending hours and request charges on a misconfigured job,
+// eg. one whose role can't write to the destination.  Returns ErrFailureSpike once the job is cancelled.
+func (s3obj *s3migration) cancelOnFailureSpike(ctx context.Context, accountID string, job *s3control.DescribeJobOutput) error {
+	if s3obj.cancelRatio <= 0 || job.Job.ProgressSummary == nil || util.IsTerminal(job.Job.Status) {
+		return nil
+	}
+	failed := aws.ToInt64(job.Job.ProgressSummary.NumberOfTasksFailed)
+	completed := failed + aws.ToInt64(job.Job.ProgressSummary.NumberOfTasksSucceeded)
+	if completed == 0 || completed < s3obj.cancelMinTasks {
+		return nil
+	}
+	ratio := float64(failed) / float64(completed)
+	if ratio <= s3obj.cancelRatio {
+		return nil
+	}
+
+	jobID := aws.ToString(job.Job.JobId)
+	zap.L().Error("Failure spike, cancelling batch job",
+		zap.String("jobId", jobID),
+		zap.Int64("failed", failed),
+		zap.Int64("completed", completed),
+		zap.Int64("total", aws.ToInt64(job.Job.ProgressSummary.TotalNumberOfTasks)),
+		zap.Float64("failureRatio", ratio),
+		zap.Float64("cancelRatio", s3obj.cancelRatio),
+	)
+	if _, err := s3obj.s3CtrClient.UpdateJobStatus(ctx, &s3control.UpdateJobStatusInput{
+		AccountId:          aws.String(accountID),
+		JobId:              job.Job.JobId,
+		RequestedJobStatus: s3controltypes.RequestedJobStatusCancelled,
+		StatusUpdateReason: aws.String(fmt.Sprintf("%.0f%% of %d completed tasks failed", ratio*100, completed)),
+	}); err != nil {
+		return fmt.Errorf("unable to cancel job %s after %d of %d completed tasks failed: %w", jobID, failed, completed, err)
+	}
+	return fmt.Errorf("%w: job %s failed %d of %d completed tasks, more than %v", ErrFailureSpike, jobID, failed, completed, s3obj.cancelRatio)
+}
@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelOnFailureSpike(t *testing.T) {
+	job := func(status s3controltypes.JobStatus, succeeded, failed int64) *s3control.DescribeJobOutput {
+		return &s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+			JobId:  aws.String("job"),
+			Status: status,
+			ProgressSummary: &s3controltypes.JobProgressSummary{
+				TotalNumberOfTasks:     aws.Int64(1000000),
+				NumberOfTasksSucceeded: aws.Int64(succeeded),
+				NumberOfTasksFailed:    aws.Int64(failed),
+			},
+		}}
+	}
+	ctr := &ctrMock{}
+	s3mig := &s3migration{s3CtrClient: ctr, cancelRatio: 0.5, cancelMinTasks: 10000}
+
+	// Too few completed tasks for the ratio to mean anything
+	assert.NoError(t, s3mig.cancelOnFailureSpike(context.TODO(), "111122223333", job(s3controltypes.JobStatusActive, 10, 90)))
+	assert.NoError(t, s3mig.cancelOnFailureSpike(context.TODO(), "111122223333", job(s3controltypes.JobStatusActive, 6000, 5000)))
+	assert.NoError(t, s3mig.cancelOnFailureSpike(context.TODO(), "111122223333", job(s3controltypes.JobStatusComplete, 1000, 9000)))
+	assert.Empty(t, ctr.requestedStatus)
+
+	err := s3mig.cancelOnFailureSpike(context.TODO(), "111122223333", job(s3controltypes.JobStatusActive, 1000, 9000))
+	assert.ErrorIs(t, err, ErrFailureSpike)
+	assert.Equal(t, s3controltypes.RequestedJobStatusCancelled, ctr.requestedStatus)
+
+	// Disabled by default
+	ctr.requestedStatus = ""
+	assert.NoError(t, (&s3migration{s3CtrClient: ctr}).cancelOnFailureSpike(context.TODO(), "111122223333", job(s3controltypes.JobStatusActive, 0, 20000)))
+	assert.Empty(t, ctr.requestedStatus)
+}
@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"s3migration/util"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Build the job input for a job whose manifest is generated by S3 Batch Operations from the source bucket,
+// removing the inventory dependency entirely.  Date filters keep the semantics of the inventory filters.
+func (s3obj *s3migration) generatorJobInput(ctx context.Context, jobArgs *batchJobArgs, filters userFilters,
+	replicationStatuses []string) (*s3control.CreateJobInput, *s3controltypes.S3JobManifestGenerator) {
+	filter := &s3controltypes.JobManifestGeneratorFilter{}
+	switch {
+	case !filters.StartDate.IsZero() && !filters.EndDate.IsZero():
+		filter.CreatedAfter = aws.Time(filters.StartDate)
+		filter.CreatedBefore = aws.Time(filters.EndDate)
+	case !filters.StartDate.IsZero():
+		filter.CreatedBefore = aws.Time(filters.StartDate)
+	case !filters.EndDate.IsZero():
+		filter.CreatedAfter = aws.Time(filters.EndDate)
+	}
+	if !filters.Modified.After.IsZero() {
+		filter.CreatedAfter = aws.Time(filters.Modified.After)
+	}
+	if !filters.Modified.Before.IsZero() {
+		filter.CreatedBefore = aws.Time(filters.Modified.Before)
+	}
+	if jobArgs.Replicate {
+		filter.EligibleForReplication = aws.Bool(true)
+	}
+	if filters.SkipReplicated && len(replicationStatuses) == 0 {
+		for _, status := range s3controltypes.ReplicationStatus("").Values() {
+			replicationStatuses = append(replicationStatuses, string(status))
+		}
+	}
+	for _, status := range replicationStatuses {
+		if filters.SkipReplicated && status == string(s3controltypes.ReplicationStatusCompleted) {
+			continue
+		}
+		filter.ObjectReplicationStatuses = append(filter.ObjectReplicationStatuses, s3controltypes.ReplicationStatus(status))
+	}
+
+	bucket := *jobArgs.SourceBucketName
+	generator := &s3controltypes.S3JobManifestGenerator{
+		SourceBucket:         util.GetArn(s3obj.cfg.Region, bucket),
+		ExpectedBucketOwner:  jobArgs.AccountId,
+		EnableManifestOutput: true,
+		Filter:               filter,
+		ManifestOutputLocation: &s3controltypes.S3ManifestOutputLocation{
+			Bucket:         util.GetArn(s3obj.cfg.Region, s3obj.scratchBucket(bucket)),
+			ManifestFormat: s3controltypes.GeneratedManifestFormatS3InventoryReportCsv20211130,
+			ManifestPrefix: aws.String(fmt.Sprintf("%s/%s/generated/%s", bucket, inventoryConfigName, time.Now().UTC().Format("2006-01-02T15-04-05Z"))),
+			ManifestEncryption: &s3controltypes.GeneratedManifestEncryption{
+				SSES3: &s3controltypes.SSES3Encryption{},
+			},
+		},
+	}
+
+	input := NewCreateJobInput(jobArgs)
+	input.Manifest = nil
+	s3obj.setJobOperation(ctx, jobArgs, input)
+	zap.L().Info("Using S3 Batch Operations manifest generator, skipping inventory",
+		zap.Any("filter", filter),
+		zap.String("generatedManifestPrefix", *generator.ManifestOutputLocation.ManifestPrefix),
+	)
+	return input, generator
+}
@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeneratorJobInput(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock)}
+	jobArgs := &batchJobArgs{
+		AccountId:          aws.String("111122223333"),
+		RoleArn:            aws.String("arn:aws:iam::111122223333:role/somedummyrole"),
+		SourceBucketName:   aws.String("src"),
+		TargetBucketName:   aws.String("dst"),
+		VersioningDisabled: true,
+		CannedACL:          CannedACLNone,
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	input, generator := s3mig.generatorJobInput(context.Background(), jobArgs, userFilters{StartDate: start, EndDate: end}, []string{"FAILED"})
+
+	assert.Nil(t, input.Manifest)
+	assert.Equal(t, "arn:aws:s3:::src", *generator.SourceBucket)
+	assert.Equal(t, start, *generator.Filter.CreatedAfter)
+	assert.Equal(t, end, *generator.Filter.CreatedBefore)
+	assert.Equal(t, []s3controltypes.ReplicationStatus{s3controltypes.ReplicationStatusFailed}, generator.Filter.ObjectReplicationStatuses)
+	assert.True(t, strings.HasPrefix(*generator.ManifestOutputLocation.ManifestPrefix, "src/"+inventoryConfigName+"/generated/"))
+
+	// Start only copies objects from before it, like the inventory filter
+	_, generator = s3mig.generatorJobInput(context.Background(), jobArgs, userFilters{StartDate: start}, nil)
+	assert.Nil(t, generator.Filter.CreatedAfter)
+	assert.Equal(t, start, *generator.Filter.CreatedBefore)
+
+	// Skipping replicated objects lists every other replication status
+	_, generator = s3mig.generatorJobInput(context.Background(), jobArgs, userFilters{SkipReplicated: true}, nil)
+	assert.NotContains(t, generator.Filter.ObjectReplicationStatuses, s3controltypes.ReplicationStatusCompleted)
+	assert.Contains(t, generator.Filter.ObjectReplicationStatuses, s3controltypes.ReplicationStatusNone)
+	_, generator = s3mig.generatorJobInput(context.Background(), jobArgs, userFilters{SkipReplicated: true}, []string{"FAILED", "COMPLETED"})
+	assert.Equal(t, []s3controltypes.ReplicationStatus{s3controltypes.ReplicationStatusFailed}, generator.Filter.ObjectReplicationStatuses)
+
+	// The generator survives the state file and is passed to CreateJob as the union member
+	path := filepath.Join(t.TempDir(), "state.json")
+	args := MigrationArgs{SourceRegion: "us-east-1", AccountID: "111122223333", SourceBucket: "src"}
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: input})
+	st.Steps[0].Generator = generator
+	assert.NoError(t, st.save())
+	loaded, err := loadRunState(path)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded.Steps[0].Input.ManifestGenerator)
+	member, ok := loaded.Steps[0].jobInput().ManifestGenerator.(*s3controltypes.JobManifestGeneratorMemberS3JobManifestGenerator)
+	assert.True(t, ok)
+	assert.Equal(t, "arn:aws:s3:::src", *member.Value.SourceBucket)
+	assert.Nil(t, loaded.Steps[0].Input.ManifestGenerator)
+
+	var out bytes.Buffer
+	assert.NoError(t, ExportPlan(path, PlanFormatAWSCLI, &out))
+	script := out.String()
+	assert.NotContains(t, script, "head-object")
+	assert.Contains(t, script, `"ManifestGenerator":{"S3JobManifestGenerator":{`)
+	assert.NotContains(t, script, `"Value"`)
+}
@@ -0,0 +1,172 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"s3migration/util"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+)
+
+const inventoryPolicySid = "S3MigrationInventoryDelivery"
+
+// Returned when the inventory destination bucket's policy doesn't let S3 deliver the source bucket's inventory
+var ErrInventoryPolicyMissing = errors.New("inventory destination bucket policy does not allow inventory delivery")
+
+// Bucket policy statement letting S3 deliver the source bucket's inventory reports under prefix, with the
+// ARNs in the partition of the region
+func inventoryDeliveryStatement(region, source, destination, prefix string) map[string]any {
+	return map[string]any{
+		"Sid":       inventoryPolicySid,
+		"Effect":    "Allow",
+		"Principal": map[string]any{"Service": "s3.amazonaws.com"},
+		"Action":    "s3:PutObject",
+		"Resource":  *util.GetArn(region, fmt.Sprintf("%s/%s*", destination, prefix)),
+		"Condition": map[string]any{
+			"ArnLike": map[string]any{"aws:SourceArn": *util.GetArn(region, source)},
+		},
+	}
+}
+
+// A policy element that may be a single string or a list of them
+func policyStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		s := []string{}
+		for _, e := range v {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// Reports whether value matches an IAM policy pattern, where * matches any characters and ? any one
+func matchesPolicyPattern(pattern, value string) bool {
+	expr := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern))
+	matched, _ := regexp.MatchString("(?i)^"+expr+"$", value)
+	return matched
+}
+
+func anyMatch(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if matchesPolicyPattern(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Statements of a policy document, whose Statement may be a single statement or a list of them
+func policyStatements(policy map[string]any) []map[string]any {
+	switch s := policy["Statement"].(type) {
+	case map[string]any:
+		return []map[string]any{s}
+	case []any:
+		statements := []map[string]any{}
+		for _, e := range s {
+			if st, ok := e.(map[string]any); ok {
+				statements = append(statements, st)
+			}
+		}
+		return statements
+	}
+	return nil
+}
+
+// Reports whether the policy has a statement allowing S3 to put the source bucket's inventory under prefix.
+// Conditions other than the source bucket ARN are assumed to be met.
+func allowsInventoryDelivery(policy map[string]any, region, source, destination, prefix string) bool {
+	object := *util.GetArn(region, fmt.Sprintf("%s/%sdata/report.csv.gz", destination, prefix))
+	for _, st := range policyStatements(policy) {
+		if st["Effect"] != "Allow" {
+			continue
+		}
+		principal, _ := st["Principal"].(map[string]any)
+		if !anyMatch(policyStrings(principal["Service"]), "s3.amazonaws.com") {
+			continue
+		}
+		if !anyMatch(policyStrings(st["Action"]), "s3:PutObject") || !anyMatch(policyStrings(st["Resource"]), object) {
+			continue
+		}
+		condition, _ := st["Condition"].(map[string]any)
+		sourceArns := []string{}
+		for _, op := range []string{"ArnLike", "ArnEquals", "StringLike", "StringEquals"} {
+			if c, ok := condition[op].(map[string]any); ok {
+				sourceArns = append(sourceArns, policyStrings(c["aws:SourceArn"])...)
+			}
+		}
+		if len(sourceArns) == 0 || anyMatch(sourceArns, *util.GetArn(region, source)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the inventory destination bucket lets S3 deliver the reports the run waits for, as deliveries
+// otherwise fail silently.  With configure set, a missing statement is added to the bucket policy, otherwise
+// ErrInventoryPolicyMissing is returned with the statement needed.  A policy the credentials can't read is
+// only logged, eg. for a destination bucket owned by another account.
+func (s3obj *s3migration) ensureInventoryDeliveryPolicy(ctx context.Context, source string, finder *inventoryManifestFinderArgs, configure bool) error {
+	destination := finder.BucketName
+	policy := map[string]any{"Version": "2012-10-17"}
+	out, err := s3obj.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(destination)})
+	if err != nil {
+		var ae smithy.APIError
+		if !errors.As(err, &ae) || ae.ErrorCode() != "NoSuchBucketPolicy" {
+			zap.L().Warn("Unable to check the inventory destination bucket policy", zap.String("bucket", destination), zap.Error(err))
+			return nil
+		}
+	} else if err := json.Unmarshal([]byte(aws.ToString(out.Policy)), &policy); err != nil {
+		return fmt.Errorf("bucket policy of %s is malformed: %w", destination, err)
+	}
+	if allowsInventoryDelivery(policy, s3obj.cfg.Region, source, destination, finder.Prefix) {
+		return nil
+	}
+
+	statement := inventoryDeliveryStatement(s3obj.cfg.Region, source, destination, finder.Prefix)
+	if !configure {
+		doc, _ := json.MarshalIndent(statement, "", "  ")
+		return fmt.Errorf("%w: add this statement to the policy of %s, or use --configure-inventory-policy\n%s",
+			ErrInventoryPolicyMissing, destination, doc)
+	}
+	policy["Statement"] = append(policyStatementList(policy), statement)
+	doc, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	if _, err := s3obj.s3Client.PutBucketPolicy(ctx, &s3.PutBucketPolicyInput{
+		Bucket: aws.String(destination),
+		Policy: aws.String(string(doc)),
+	}); err != nil {
+		return fmt.Errorf("unable to add the inventory delivery statement to the policy of %s: %w", destination, err)
+	}
+	zap.L().Info("Added inventory delivery statement to the destination bucket policy",
+		zap.String("bucket", destination),
+		zap.String("sid", inventoryPolicySid),
+	)
+	return nil
+}
+
+// The policy's Statement as a list, keeping any statement not decoded by policyStatements
+func policyStatementList(policy map[string]any) []any {
+	switch s := policy["Statement"].(type) {
+	case []any:
+		return s
+	case nil:
+		return []any{}
+	default:
+		return []any{s}
+	}
+}
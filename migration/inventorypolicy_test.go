@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowsInventoryDelivery(t *testing.T) {
+	policy := func(doc string) map[string]any {
+		var p map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(doc), &p))
+		return p
+	}
+	readme := policy(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:PutObject"],
+		"Resource":["arn:aws:s3:::src/src/*"],"Principal":{"Service":["s3.amazonaws.com"]},
+		"Condition":{"ArnLike":{"aws:SourceArn":"arn:aws:s3:::src"}}}]}`)
+	assert.True(t, allowsInventoryDelivery(readme, "us-east-1", "src", "src", "src/bulk-copy-inventory/"))
+	assert.False(t, allowsInventoryDelivery(readme, "us-east-1", "other", "src", "other/bulk-copy-inventory/"))
+
+	shared := policy(`{"Statement":{"Effect":"Allow","Action":"s3:*","Resource":"arn:aws:s3:::inventory/*",
+		"Principal":{"Service":"s3.amazonaws.com"},"Condition":{"ArnLike":{"aws:SourceArn":"arn:aws:s3:::team-*"}}}}`)
+	assert.True(t, allowsInventoryDelivery(shared, "us-east-1", "team-logs", "inventory", "team-logs/bulk-copy-inventory/"))
+	assert.False(t, allowsInventoryDelivery(shared, "us-east-1", "logs", "inventory", "logs/bulk-copy-inventory/"))
+
+	denied := policy(`{"Statement":[{"Effect":"Deny","Action":"s3:PutObject","Resource":"arn:aws:s3:::inventory/*",
+		"Principal":{"Service":"s3.amazonaws.com"}}]}`)
+	assert.False(t, allowsInventoryDelivery(denied, "us-east-1", "src", "inventory", "src/bulk-copy-inventory/"))
+
+	// Resources are matched in the partition of the region
+	china := policy(`{"Statement":{"Effect":"Allow","Action":"s3:PutObject","Resource":"arn:aws-cn:s3:::inventory/*",
+		"Principal":{"Service":"s3.amazonaws.com"},"Condition":{"ArnLike":{"aws:SourceArn":"arn:aws-cn:s3:::src"}}}}`)
+	assert.True(t, allowsInventoryDelivery(china, "cn-north-1", "src", "inventory", "src/bulk-copy-inventory/"))
+	assert.False(t, allowsInventoryDelivery(china, "us-east-1", "src", "inventory", "src/bulk-copy-inventory/"))
+}
+
+func TestEnsureInventoryDeliveryPolicy(t *testing.T) {
+	m := &mock{bucketPolicy: `{"Version":"2012-10-17","Statement":[{"Sid":"Other","Effect":"Allow",
+		"Principal":{"AWS":"arn:aws:iam::111122223333:root"},"Action":"s3:GetObject","Resource":"arn:aws:s3:::inventory/*"}]}`}
+	s3mig := &s3migration{s3Client: m}
+	finder := &inventoryManifestFinderArgs{BucketName: "inventory", Prefix: "src/bulk-copy-inventory/"}
+
+	err := s3mig.ensureInventoryDeliveryPolicy(context.TODO(), "src", finder, false)
+	assert.ErrorIs(t, err, ErrInventoryPolicyMissing)
+	assert.Contains(t, err.Error(), `"Resource": "arn:aws:s3:::inventory/src/bulk-copy-inventory/*"`)
+
+	assert.NoError(t, s3mig.ensureInventoryDeliveryPolicy(context.TODO(), "src", finder, true))
+	var policy map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(m.bucketPolicy), &policy))
+	statements := policyStatements(policy)
+	assert.Len(t, statements, 2)
+	assert.Equal(t, "Other", statements[0]["Sid"])
+	assert.Equal(t, inventoryPolicySid, statements[1]["Sid"])
+	assert.True(t, allowsInventoryDelivery(policy, "us-east-1", "src", "inventory", finder.Prefix))
+
+	// Buckets without a policy get one holding just the statement
+	m.bucketPolicy = ""
+	assert.NoError(t, s3mig.ensureInventoryDeliveryPolicy(context.TODO(), "src", finder, true))
+	assert.NoError(t, json.Unmarshal([]byte(m.bucketPolicy), &policy))
+	assert.Len(t, policyStatements(policy), 1)
+
+	// The statement added names the resources in the partition of the region
+	m.bucketPolicy = ""
+	s3mig.cfg = aws.Config{Region: "cn-north-1"}
+	assert.NoError(t, s3mig.ensureInventoryDeliveryPolicy(context.TODO(), "src", finder, true))
+	assert.Contains(t, m.bucketPolicy, `"arn:aws-cn:s3:::inventory/src/bulk-copy-inventory/*"`)
+	assert.Contains(t, m.bucketPolicy, `"arn:aws-cn:s3:::src"`)
+}
@@ -0,0 +1,80 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+)
+
+type ManifestWatchArgs struct {
+	SourceRegion    string
+	SourceBucket    string
+	ConfigName      string
+	InventoryBucket string // Bucket the inventory is delivered to, see --inventory-dest-bucket
+}
+
+// Watches for inventory manifests delivered for a source bucket
+type ManifestWatcher struct {
+	s3obj *s3migration
+	args  ManifestWatchArgs
+}
+
+func NewManifestWatcher(ctx context.Context, args ManifestWatchArgs) (*ManifestWatcher, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestWatcher{
+		s3obj: &s3migration{s3Client: s3.NewFromConfig(cfg), inventoryBucket: args.InventoryBucket},
+		args:  args,
+	}, nil
+}
+
+// Wait for an inventory manifest delivered after since, checking every interval, and return it.  A
+// configuration that doesn't exist yet, eg. before the first run creates it, has no manifest.
+func (w *ManifestWatcher) WaitForNewer(ctx context.Context, since time.Time, interval time.Duration) (*s3types.Object, error) {
+	missingLogged := false
+	for {
+		manifest, err := w.latest(ctx)
+		var ae smithy.APIError
+		switch {
+		case errors.As(err, &ae) && ae.ErrorCode() == "NoSuchConfiguration":
+			if !missingLogged {
+				zap.L().Warn("Inventory configuration does not exist yet, waiting for a run to create it",
+					zap.String("bucket", w.args.SourceBucket),
+					zap.String("configName", w.args.ConfigName),
+				)
+				missingLogged = true
+			}
+		case err != nil:
+			return nil, err
+		case manifest != nil && aws.ToTime(manifest.LastModified).After(since):
+			zap.L().Info("New inventory manifest delivered",
+				zap.String("key", aws.ToString(manifest.Key)),
+				zap.Time("lastModified", aws.ToTime(manifest.LastModified)),
+			)
+			return manifest, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Latest manifest of the configuration, without creating or changing it
+func (w *ManifestWatcher) latest(ctx context.Context) (*s3types.Object, error) {
+	finder, err := w.s3obj.ensureS3InventoryConfig(ctx, w.args.SourceBucket, w.args.ConfigName, false, "")
+	if err != nil {
+		return nil, err
+	}
+	return w.s3obj.getLatestManifest(ctx, finder)
+}
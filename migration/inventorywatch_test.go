@@ -0,0 +1,34 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestWatcherWaitForNewer(t *testing.T) {
+	delivered := time.Now().Add(-time.Hour)
+	key := "src/bulk-copy-inventory/" + delivered.UTC().Format("2006-01-02T15-04Z") + "/manifest.json"
+	m := &mock{
+		objects: map[string]string{key: `{"sourceBucket": "src", "fileSchema": "Bucket, Key", "files": []}`},
+		listObjectsV2Output: &s3.ListObjectsV2Output{Contents: []s3types.Object{
+			{Key: aws.String(key), LastModified: aws.Time(delivered)},
+		}},
+	}
+	w := &ManifestWatcher{s3obj: &s3migration{s3Client: m}, args: ManifestWatchArgs{SourceBucket: "src", ConfigName: inventoryConfigName}}
+
+	manifest, err := w.WaitForNewer(context.TODO(), delivered.Add(-time.Minute), time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, key, *manifest.Key)
+
+	// The manifest has already been used, so keep waiting for the next one
+	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+	defer cancel()
+	_, err = w.WaitForNewer(ctx, delivered, time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
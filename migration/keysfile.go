@@ -0,0 +1,186 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"s3migration/util"
+	"time"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// KeysFile value that reads keys from standard input
+const KeysStdin = "-"
+
+var errMixedVersionIDs = errors.New("keys file must have a version ID on every line or on none")
+
+// Read keys, one object per line as "key" or "key,versionId", calling fn for each object.
+// Lines are parsed as CSV so keys containing commas or quotes must be quoted.  Keys are not URL-encoded.
+func scanKeys(r io.Reader, name string, fn func(key, versionID string) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for {
+		rec, rerr := cr.Read()
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return fmt.Errorf("keys file %s: %w", name, rerr)
+		}
+		line, _ := cr.FieldPos(0)
+		var err error
+		switch {
+		case len(rec) == 1 && rec[0] != "":
+			err = fn(rec[0], "")
+		case len(rec) == 2 && rec[0] != "" && rec[1] != "":
+			err = fn(rec[0], rec[1])
+		default:
+			err = fmt.Errorf("keys file %s line %d: expected key or key,versionId", name, line)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func scanKeysFile(file string, fn func(key, versionID string) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scanKeys(f, file, fn)
+}
+
+func keysManifestFields(versioned bool) []string {
+	if versioned {
+		return []string{"Bucket", "Key", "VersionId"}
+	}
+	return []string{"Bucket", "Key"}
+}
+
+// Check a keys file before any job is built, returning the manifest fields it needs.
+// Either every line or no line may have a version ID.
+func keysFileManifestFields(file string) ([]string, int, error) {
+	count, versioned := 0, 0
+	err := scanKeysFile(file, func(key, versionID string) error {
+		count++
+		if versionID != "" {
+			versioned++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	switch versioned {
+	case 0:
+		if count == 0 {
+			return nil, 0, fmt.Errorf("keys file %s lists no objects", file)
+		}
+		return keysManifestFields(false), count, nil
+	case count:
+		return keysManifestFields(true), count, nil
+	}
+	return nil, 0, errMixedVersionIDs
+}
+
+// Standard input can only be read once, so the manifest fields are decided by the first line
+// and later lines are checked as they are streamed into the manifest
+func keysStreamManifestFields(r *bufio.Reader) ([]string, error) {
+	var line []byte
+	for n := 1; ; n = r.Buffered() + 1 {
+		var err error
+		line, err = r.Peek(n)
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+			break
+		}
+		if err == io.EOF || err == bufio.ErrBufferFull {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var versioned, found bool
+	_ = scanKeys(bytes.NewReader(line), KeysStdin, func(key, versionID string) error {
+		versioned, found = versionID != "", true
+		return nil
+	})
+	if !found {
+		return nil, errors.New("no keys on standard input")
+	}
+	return keysManifestFields(versioned), nil
+}
+
+// Build the batch manifest from keys read from open, eg. objects identified by other tooling for re-migration
+func (s3obj *s3migration) keysBuilder(open func() (io.ReadCloser, error), name string, fields []string) manifestBuilder {
+	versioned := len(fields) == 3
+	return func(ctx context.Context, jobArgs *batchJobArgs, filters userFilters) (*s3types.Object, error) {
+		r, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		bucket := *jobArgs.SourceBucketName
+		pr, pw := io.Pipe()
+		go func() {
+			w := csv.NewWriter(pw)
+			count := 0
+			err := scanKeys(r, name, func(key, versionID string) error {
+				if (versionID != "") != versioned {
+					return errMixedVersionIDs
+				}
+				row := []string{bucket, util.EncodeManifestKey(key)}
+				if versioned {
+					row = append(row, versionID)
+				}
+				count++
+				return w.Write(row)
+			})
+			w.Flush()
+			if err == nil {
+				err = w.Error()
+			}
+			zap.L().Info("Read keys for batch manifest", zap.String("file", name), zap.Int("count", count))
+			pw.CloseWithError(err)
+		}()
+
+		key := fmt.Sprintf("%s/%s/keys/%s.csv", bucket, inventoryConfigName, time.Now().UTC().Format("2006-01-02T15-04-05Z"))
+		return s3obj.uploadS3File(ctx, s3obj.scratchBucket(bucket), key, pr)
+	}
+}
+
+// Build the batch manifest from a local keys file, or standard input when file is KeysStdin,
+// returning the manifest fields it needs
+func (s3obj *s3migration) keysFileBuilder(file string) (manifestBuilder, []string, error) {
+	if file == KeysStdin {
+		r := bufio.NewReaderSize(os.Stdin, 64*1024)
+		fields, err := keysStreamManifestFields(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		zap.L().Info("Building batch manifest from keys on standard input, skipping inventory")
+		stdin := func() (io.ReadCloser, error) { return io.NopCloser(r), nil }
+		return s3obj.keysBuilder(stdin, KeysStdin, fields), fields, nil
+	}
+
+	fields, count, err := keysFileManifestFields(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	zap.L().Info("Building batch manifest from keys file, skipping inventory",
+		zap.String("file", file),
+		zap.Int("count", count),
+	)
+	open := func() (io.ReadCloser, error) { return os.Open(file) }
+	return s3obj.keysBuilder(open, file, fields), fields, nil
+}
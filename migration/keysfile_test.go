@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeysFile(t *testing.T, body string) string {
+	file := filepath.Join(t.TempDir(), "keys.txt")
+	assert.NoError(t, os.WriteFile(file, []byte(body), 0600))
+	return file
+}
+
+func TestKeysFileManifestFields(t *testing.T) {
+	fields, count, err := keysFileManifestFields(writeKeysFile(t, "a.txt\nlogs/b c.txt\n\n\"d,e.txt\"\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bucket", "Key"}, fields)
+	assert.Equal(t, 3, count)
+
+	fields, count, err = keysFileManifestFields(writeKeysFile(t, "a.txt,v1\nb.txt,v2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bucket", "Key", "VersionId"}, fields)
+	assert.Equal(t, 2, count)
+
+	_, _, err = keysFileManifestFields(writeKeysFile(t, "a.txt,v1\nb.txt\n"))
+	assert.Error(t, err)
+	_, _, err = keysFileManifestFields(writeKeysFile(t, "a.txt,v1,extra\n"))
+	assert.Error(t, err)
+	_, _, err = keysFileManifestFields(writeKeysFile(t, ""))
+	assert.Error(t, err)
+}
+
+func TestKeysFileBuilder(t *testing.T) {
+	m := &mock{objects: map[string]string{}}
+	s3mig := &s3migration{s3Client: m}
+	build, fields, err := s3mig.keysFileBuilder(writeKeysFile(t, "logs/a b+c.txt,v1\n\"d,e.txt\",v2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bucket", "Key", "VersionId"}, fields)
+	obj, err := build(context.Background(), &batchJobArgs{SourceBucketName: aws.String("src")}, userFilters{})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(*obj.Key, "src/bulk-copy-inventory/keys/"))
+	assert.Equal(t, "src,logs%2Fa%20b%2Bc.txt,v1\nsrc,d%2Ce.txt,v2\n", m.objects[*obj.Key])
+}
+
+func TestKeysStream(t *testing.T) {
+	fields, err := keysStreamManifestFields(bufio.NewReader(strings.NewReader("a.txt\nb.txt\n")))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bucket", "Key"}, fields)
+	// Last line without a trailing newline
+	fields, err = keysStreamManifestFields(bufio.NewReader(strings.NewReader("a.txt,v1")))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bucket", "Key", "VersionId"}, fields)
+	_, err = keysStreamManifestFields(bufio.NewReader(strings.NewReader("")))
+	assert.Error(t, err)
+
+	m := &mock{objects: map[string]string{}}
+	s3mig := &s3migration{s3Client: m}
+	r := bufio.NewReader(strings.NewReader("a.txt\nb.txt\n"))
+	fields, err = keysStreamManifestFields(r)
+	assert.NoError(t, err)
+	open := func() (io.ReadCloser, error) { return io.NopCloser(r), nil }
+	obj, err := s3mig.keysBuilder(open, KeysStdin, fields)(context.Background(), &batchJobArgs{SourceBucketName: aws.String("src")}, userFilters{})
+	assert.NoError(t, err)
+	assert.Equal(t, "src,a.txt\nsrc,b.txt\n", m.objects[*obj.Key])
+}
@@ -0,0 +1,62 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Time left at the end of an invocation for the report to be written and returned
+const lambdaDeadlineMargin = time.Minute
+
+// Arguments of a run invoked with the given event, ie. the execution input written by run --step-functions-input.
+// The waits are capped to the time left in the invocation, and the state file (the state table's key) and
+// report are kept in the temporary directory, the only one writable.
+func lambdaRunArgs(ctx context.Context, event []byte) (MigrationArgs, error) {
+	var input struct {
+		Args *MigrationArgs `json:"args"`
+	}
+	if err := json.Unmarshal(event, &input); err != nil {
+		return MigrationArgs{}, err
+	}
+	if input.Args == nil {
+		return MigrationArgs{}, errors.New(`event has no "args", see run --step-functions-input`)
+	}
+	args := *input.Args
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := max(time.Until(deadline)-lambdaDeadlineMargin, time.Second)
+		if args.PollTimeout <= 0 || args.PollTimeout > remaining {
+			args.PollTimeout = remaining
+		}
+		if args.MaxWait <= 0 || args.MaxWait > remaining {
+			args.MaxWait = remaining
+		}
+	}
+	args.StateFile = filepath.Join(os.TempDir(), fmt.Sprintf("s3migration-%s.state.json", args.SourceBucket))
+	args.ReportFile = filepath.Join(os.TempDir(), fmt.Sprintf("s3migration-%s.report.json", args.SourceBucket))
+	args.PlanOnly = false
+	args.PlanFile = ""
+	return args, nil
+}
+
+// Lambda handler running a migration with the arguments in the event, returning its report.  The run
+// must complete within the invocation, otherwise it fails once the time left runs out, leaving its jobs
+// running to be watched with watch --resume --state-table.
+func HandleRunInvocation(ctx context.Context, event []byte) ([]byte, error) {
+	args, err := lambdaRunArgs(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(args.ReportFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err := Run(args); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(args.ReportFile)
+}
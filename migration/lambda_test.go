@@ -0,0 +1,30 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLambdaRunArgs(t *testing.T) {
+	input, err := NewExecutionInput(MigrationArgs{SourceBucket: "src", PollTimeout: 72 * time.Hour, StateTable: "state"})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+
+	args, err := lambdaRunArgs(ctx, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "state", args.StateTable)
+	assert.Equal(t, filepath.Join(os.TempDir(), "s3migration-src.state.json"), args.StateFile)
+	assert.NotEmpty(t, args.ReportFile)
+	assert.LessOrEqual(t, args.PollTimeout, 14*time.Minute)
+	assert.Greater(t, args.PollTimeout, 13*time.Minute)
+	assert.Equal(t, args.PollTimeout, args.MaxWait)
+
+	_, err = lambdaRunArgs(context.Background(), []byte(`{"SourceBucket": "src"}`))
+	assert.ErrorContains(t, err, "no \"args\"")
+}
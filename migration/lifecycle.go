@@ -0,0 +1,175 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Lifecycle rules as JSON, in the shape of the AWS CLI's get-bucket-lifecycle-configuration output, so the
+// rules can be reviewed and edited before they are applied.  The SDK's rule filter is a union that doesn't
+// survive JSON, so rules are converted.
+type lifecycleJSON struct {
+	Rules []lifecycleRuleJSON
+}
+
+type lifecycleRuleJSON struct {
+	ID                             *string                                 `json:",omitempty"`
+	Status                         s3types.ExpirationStatus                `json:",omitempty"`
+	Filter                         *lifecycleFilterJSON                    `json:",omitempty"`
+	Prefix                         *string                                 `json:",omitempty"` // Deprecated by Filter
+	Expiration                     *s3types.LifecycleExpiration            `json:",omitempty"`
+	Transitions                    []s3types.Transition                    `json:",omitempty"`
+	NoncurrentVersionExpiration    *s3types.NoncurrentVersionExpiration    `json:",omitempty"`
+	NoncurrentVersionTransitions   []s3types.NoncurrentVersionTransition   `json:",omitempty"`
+	AbortIncompleteMultipartUpload *s3types.AbortIncompleteMultipartUpload `json:",omitempty"`
+}
+
+// One of the fields is set, none for a rule applying to every object
+type lifecycleFilterJSON struct {
+	Prefix                *string                           `json:",omitempty"`
+	Tag                   *s3types.Tag                      `json:",omitempty"`
+	ObjectSizeGreaterThan *int64                            `json:",omitempty"`
+	ObjectSizeLessThan    *int64                            `json:",omitempty"`
+	And                   *s3types.LifecycleRuleAndOperator `json:",omitempty"`
+}
+
+func toLifecycleJSON(rules []s3types.LifecycleRule) lifecycleJSON {
+	out := lifecycleJSON{Rules: []lifecycleRuleJSON{}}
+	for _, rule := range rules {
+		r := lifecycleRuleJSON{
+			ID:                             rule.ID,
+			Status:                         rule.Status,
+			Prefix:                         rule.Prefix,
+			Expiration:                     rule.Expiration,
+			Transitions:                    rule.Transitions,
+			NoncurrentVersionExpiration:    rule.NoncurrentVersionExpiration,
+			NoncurrentVersionTransitions:   rule.NoncurrentVersionTransitions,
+			AbortIncompleteMultipartUpload: rule.AbortIncompleteMultipartUpload,
+		}
+		if rule.Filter != nil {
+			r.Filter = &lifecycleFilterJSON{}
+			switch f := rule.Filter.(type) {
+			case *s3types.LifecycleRuleFilterMemberPrefix:
+				r.Filter.Prefix = aws.String(f.Value)
+			case *s3types.LifecycleRuleFilterMemberTag:
+				r.Filter.Tag = &f.Value
+			case *s3types.LifecycleRuleFilterMemberObjectSizeGreaterThan:
+				r.Filter.ObjectSizeGreaterThan = aws.Int64(f.Value)
+			case *s3types.LifecycleRuleFilterMemberObjectSizeLessThan:
+				r.Filter.ObjectSizeLessThan = aws.Int64(f.Value)
+			case *s3types.LifecycleRuleFilterMemberAnd:
+				r.Filter.And = &f.Value
+			}
+		}
+		out.Rules = append(out.Rules, r)
+	}
+	return out
+}
+
+func (l lifecycleJSON) rules() ([]s3types.LifecycleRule, error) {
+	rules := []s3types.LifecycleRule{}
+	for _, r := range l.Rules {
+		rule := s3types.LifecycleRule{
+			ID:                             r.ID,
+			Status:                         r.Status,
+			Prefix:                         r.Prefix,
+			Expiration:                     r.Expiration,
+			Transitions:                    r.Transitions,
+			NoncurrentVersionExpiration:    r.NoncurrentVersionExpiration,
+			NoncurrentVersionTransitions:   r.NoncurrentVersionTransitions,
+			AbortIncompleteMultipartUpload: r.AbortIncompleteMultipartUpload,
+		}
+		if f := r.Filter; f != nil {
+			set := 0
+			for _, ok := range []bool{f.Prefix != nil, f.Tag != nil, f.ObjectSizeGreaterThan != nil, f.ObjectSizeLessThan != nil, f.And != nil} {
+				if ok {
+					set++
+				}
+			}
+			switch {
+			case set > 1:
+				return nil, fmt.Errorf("lifecycle rule %s filter has more than one condition, combine them with And", aws.ToString(r.ID))
+			case f.Tag != nil:
+				rule.Filter = &s3types.LifecycleRuleFilterMemberTag{Value: *f.Tag}
+			case f.ObjectSizeGreaterThan != nil:
+				rule.Filter = &s3types.LifecycleRuleFilterMemberObjectSizeGreaterThan{Value: *f.ObjectSizeGreaterThan}
+			case f.ObjectSizeLessThan != nil:
+				rule.Filter = &s3types.LifecycleRuleFilterMemberObjectSizeLessThan{Value: *f.ObjectSizeLessThan}
+			case f.And != nil:
+				rule.Filter = &s3types.LifecycleRuleFilterMemberAnd{Value: *f.And}
+			default:
+				// An empty filter applies the rule to every object
+				rule.Filter = &s3types.LifecycleRuleFilterMemberPrefix{Value: aws.ToString(f.Prefix)}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func readLifecycleFile(path string) ([]s3types.LifecycleRule, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l lifecycleJSON
+	if err := json.Unmarshal(body, &l); err != nil {
+		return nil, fmt.Errorf("invalid lifecycle rules file %s: %w", path, err)
+	}
+	return l.rules()
+}
+
+// Copy the source bucket's lifecycle rules, or those of file when set.  With export set the source's rules are
+// written there for review instead, to be applied with file once edited.
+func (s3obj *s3migration) copyLifecycle(ctx context.Context, source, destination, file, export string) (string, error) {
+	var rules []s3types.LifecycleRule
+	if file != "" {
+		var err error
+		if rules, err = readLifecycleFile(file); err != nil {
+			return "", err
+		}
+	} else {
+		out, err := s3obj.s3Client.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(source)})
+		if isAPIErrorCode(err, "NoSuchLifecycleConfiguration") {
+			return settingAbsent, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		rules = out.Rules
+	}
+	if len(rules) == 0 {
+		return settingAbsent, nil
+	}
+
+	if export != "" {
+		body, err := json.MarshalIndent(toLifecycleJSON(rules), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(export, body, 0644); err != nil {
+			return "", err
+		}
+		zap.L().Info("Wrote lifecycle rules for review, apply them with --lifecycle-file once reviewed",
+			zap.String("file", export),
+			zap.Int("rules", len(rules)),
+		)
+		return settingExported, nil
+	}
+
+	if _, err := s3obj.s3Client.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(destination),
+		LifecycleConfiguration: &s3types.BucketLifecycleConfiguration{Rules: rules},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied lifecycle rules to destination bucket", zap.String("bucket", destination), zap.Int("rules", len(rules)))
+	return settingCopied, nil
+}
@@ -0,0 +1,60 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyLifecycle(t *testing.T) {
+	rules := []s3types.LifecycleRule{
+		{
+			ID:         aws.String("logs"),
+			Status:     s3types.ExpirationStatusEnabled,
+			Filter:     &s3types.LifecycleRuleFilterMemberPrefix{Value: "logs/"},
+			Expiration: &s3types.LifecycleExpiration{Days: aws.Int32(30)},
+		},
+		{
+			ID:     aws.String("archive"),
+			Status: s3types.ExpirationStatusEnabled,
+			Filter: &s3types.LifecycleRuleFilterMemberAnd{Value: s3types.LifecycleRuleAndOperator{
+				Prefix: aws.String("data/"), Tags: []s3types.Tag{{Key: aws.String("tier"), Value: aws.String("cold")}},
+			}},
+			Transitions: []s3types.Transition{{Days: aws.Int32(90), StorageClass: s3types.TransitionStorageClassGlacier}},
+		},
+	}
+	m := &mock{lifecycleRules: rules}
+	s3mig := &s3migration{s3Client: m}
+	export := filepath.Join(t.TempDir(), "lifecycle.json")
+
+	// Exported for review, the destination is left alone
+	outcome, err := s3mig.copyLifecycle(context.TODO(), "src", "dst", "", export)
+	assert.NoError(t, err)
+	assert.Equal(t, settingExported, outcome)
+	assert.Empty(t, m.bucketCalls)
+
+	// The reviewed file is applied as it was exported
+	m.lifecycleRules = nil
+	outcome, err = s3mig.copyLifecycle(context.TODO(), "src", "dst", export, "")
+	assert.NoError(t, err)
+	assert.Equal(t, settingCopied, outcome)
+	assert.Equal(t, []string{"PutBucketLifecycleConfiguration dst"}, m.bucketCalls)
+	assert.Equal(t, toLifecycleJSON(rules), toLifecycleJSON(m.lifecycleRules))
+	assert.Equal(t, &s3types.LifecycleRuleFilterMemberPrefix{Value: "logs/"}, m.lifecycleRules[0].Filter)
+
+	// A filter with several conditions is ambiguous
+	assert.NoError(t, os.WriteFile(export, []byte(`{"Rules": [{"ID": "x", "Filter": {"Prefix": "a/", "ObjectSizeLessThan": 10}}]}`), 0644))
+	_, err = s3mig.copyLifecycle(context.TODO(), "src", "dst", export, "")
+	assert.ErrorContains(t, err, "more than one condition")
+
+	// Nothing to copy without rules
+	m.lifecycleRules = nil
+	outcome, err = s3mig.copyLifecycle(context.TODO(), "src", "dst", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, settingAbsent, outcome)
+}
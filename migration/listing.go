@@ -0,0 +1,111 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"s3migration/util"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Fields of the S3 Batch Operations CSV manifests written by list mode or filtered from inventory
+func batchManifestFields(versioningDisabled bool) []string {
+	if versioningDisabled {
+		return []string{"Bucket", "Key"}
+	}
+	return []string{"Bucket", "Key", "VersionId"}
+}
+
+// Build the batch manifest by listing the source bucket rather than reading an inventory report.
+// Intended for small and medium buckets where waiting up to 48 hours for the first inventory
+// is the biggest time sink.  The listing is streamed straight into the manifest upload.
+func (s3obj *s3migration) listManifest(ctx context.Context, jobArgs *batchJobArgs, filters userFilters) (*s3types.Object, error) {
+	bucket := *jobArgs.SourceBucketName
+	pr, pw := io.Pipe()
+	go func() {
+		w := csv.NewWriter(pw)
+		var (
+			count int
+			err   error
+		)
+		if jobArgs.VersioningDisabled {
+			count, err = s3obj.listObjects(ctx, bucket, filters, w)
+		} else {
+			count, err = s3obj.listObjectVersions(ctx, bucket, filters, w)
+		}
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+		zap.L().Info("Listed source bucket objects for batch manifest",
+			zap.String("bucket", bucket),
+			zap.String("latestOnly", filters.LatestOnly),
+			zap.Int("count", count),
+		)
+		pw.CloseWithError(err)
+	}()
+
+	kind := "all"
+	if filters.LatestOnly == util.IsLatestYes {
+		kind = "latest"
+	} else if filters.LatestOnly == util.IsLatestNo {
+		kind = "noncurrent"
+	}
+	key := fmt.Sprintf("%s/%s/list/%s-%s.csv", bucket, inventoryConfigName, time.Now().UTC().Format("2006-01-02T15-04-05Z"), kind)
+	return s3obj.uploadS3File(ctx, s3obj.scratchBucket(bucket), key, pr)
+}
+
+func (s3obj *s3migration) listObjects(ctx context.Context, bucket string, filters userFilters, w *csv.Writer) (int, error) {
+	count := 0
+	paginator := s3.NewListObjectsV2Paginator(s3obj.s3Client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		s3obj.heartbeat.Beat()
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, err
+		}
+		for _, obj := range page.Contents {
+			if !filters.matchesDate(*obj.LastModified) {
+				continue
+			}
+			if err := w.Write([]string{bucket, util.EncodeManifestKey(*obj.Key)}); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Delete markers are never written as they can't be copied
+func (s3obj *s3migration) listObjectVersions(ctx context.Context, bucket string, filters userFilters, w *csv.Writer) (int, error) {
+	count := 0
+	paginator := s3.NewListObjectVersionsPaginator(s3obj.s3Client, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		s3obj.heartbeat.Beat()
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, err
+		}
+		for _, v := range page.Versions {
+			isLatest := aws.ToBool(v.IsLatest)
+			if (filters.LatestOnly == util.IsLatestYes && !isLatest) || (filters.LatestOnly == util.IsLatestNo && isLatest) {
+				continue
+			}
+			if !filters.matchesDate(*v.LastModified) {
+				continue
+			}
+			if err := w.Write([]string{bucket, util.EncodeManifestKey(*v.Key), aws.ToString(v.VersionId)}); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
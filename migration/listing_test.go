@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"s3migration/util"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListObjectVersions(t *testing.T) {
+	now := time.Now()
+	s3mig = &s3migration{s3Client: &mock{listObjectVersionsOutput: &s3.ListObjectVersionsOutput{
+		Versions: []s3types.ObjectVersion{
+			{Key: aws.String("a b.txt"), VersionId: aws.String("v2"), IsLatest: aws.Bool(true), LastModified: aws.Time(now)},
+			{Key: aws.String("a b.txt"), VersionId: aws.String("v1"), IsLatest: aws.Bool(false), LastModified: aws.Time(now.Add(-time.Hour))},
+		},
+		DeleteMarkers: []s3types.DeleteMarkerEntry{
+			{Key: aws.String("deleted.txt"), VersionId: aws.String("dm"), IsLatest: aws.Bool(true)},
+		},
+	}}}
+
+	testCases := []struct {
+		name       string
+		latestOnly string
+		expected   string
+	}{
+		{name: "All", latestOnly: "", expected: "src,a%20b.txt,v2\nsrc,a%20b.txt,v1\n"},
+		{name: "Latest", latestOnly: util.IsLatestYes, expected: "src,a%20b.txt,v2\n"},
+		{name: "Noncurrent", latestOnly: util.IsLatestNo, expected: "src,a%20b.txt,v1\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := csv.NewWriter(&buf)
+			_, err := s3mig.listObjectVersions(context.TODO(), "src", userFilters{LatestOnly: tc.latestOnly}, w)
+			w.Flush()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package migration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"s3migration/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+// Schemas of the inventory reports built by listing the source bucket, see --list-inventory
+const (
+	listedVersionsSchema = "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate, ETag, StorageClass"
+	listedObjectsSchema  = "Bucket, Key, Size, LastModifiedDate, ETag, StorageClass"
+)
+
+// Build an inventory report by listing the source bucket, for buckets without an inventory where waiting
+// up to 48 hours for the first report is the biggest time sink.  Unlike the --list-mode manifests, the
+// report of a versioned bucket keeps each version's IsLatest flag and the delete markers, so it is filtered,
+// and read by the version stack features, exactly like a report delivered by S3.
+func (s3obj *s3migration) listInventory(ctx context.Context, bucket string, versioningDisabled bool) (*inventoryReport, error) {
+	prefix := fmt.Sprintf("%s/%s/listed/%s", bucket, inventoryConfigName, time.Now().UTC().Format("2006-01-02T15-04-05Z"))
+	dataKey := prefix + "/data/listing.csv.gz"
+	schema := listedVersionsSchema
+	if versioningDisabled {
+		schema = listedObjectsSchema
+	}
+
+	var (
+		size  int64
+		count int
+	)
+	sum := md5.New()
+	pr, pw := io.Pipe()
+	go func() {
+		counter := &countingWriter{w: io.MultiWriter(pw, sum)}
+		gz := gzip.NewWriter(counter)
+		w := csv.NewWriter(gz)
+		var err error
+		if versioningDisabled {
+			count, err = s3obj.listObjectRows(ctx, bucket, w)
+		} else {
+			count, err = s3obj.listVersionRows(ctx, bucket, w)
+		}
+		w.Flush()
+		if err == nil {
+			err = w.Error()
+		}
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+		size = counter.n
+		zap.L().Info("Listed source bucket into inventory report",
+			zap.String("bucket", bucket),
+			zap.Bool("versioningDisabled", versioningDisabled),
+			zap.Int("rows", count),
+		)
+		pw.CloseWithError(err)
+	}()
+	if _, err := s3obj.uploadS3File(ctx, s3obj.scratchBucket(bucket), dataKey, pr); err != nil {
+		return nil, err
+	}
+
+	type dataFile struct {
+		Key         string `json:"key"`
+		Size        int64  `json:"size"`
+		MD5checksum string `json:"MD5checksum"`
+	}
+	body, err := json.Marshal(struct {
+		SourceBucket      string     `json:"sourceBucket"`
+		DestinationBucket string     `json:"destinationBucket"`
+		Version           string     `json:"version"`
+		CreationTimestamp string     `json:"creationTimestamp"`
+		FileFormat        string     `json:"fileFormat"`
+		FileSchema        string     `json:"fileSchema"`
+		Files             []dataFile `json:"files"`
+	}{
+		SourceBucket:      bucket,
+		DestinationBucket: *util.GetArn(s3obj.cfg.Region, s3obj.scratchBucket(bucket)),
+		Version:           "2016-11-30",
+		CreationTimestamp: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		FileFormat:        "CSV",
+		FileSchema:        schema,
+		Files:             []dataFile{{Key: dataKey, Size: size, MD5checksum: hex.EncodeToString(sum.Sum(nil))}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := s3obj.uploadS3File(ctx, s3obj.scratchBucket(bucket), prefix+"/manifest.json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return &inventoryReport{Bucket: s3obj.scratchBucket(bucket), Manifest: *manifest}, nil
+}
+
+// Write a listedVersionsSchema row for every version and delete marker of the bucket
+func (s3obj *s3migration) listVersionRows(ctx context.Context, bucket string, w *csv.Writer) (int, error) {
+	count := 0
+	paginator := s3.NewListObjectVersionsPaginator(s3obj.s3Client, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		s3obj.heartbeat.Beat()
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, err
+		}
+		for _, v := range page.Versions {
+			if err := w.Write([]string{bucket, util.EncodeManifestKey(*v.Key), aws.ToString(v.VersionId),
+				strconv.FormatBool(aws.ToBool(v.IsLatest)), "false", strconv.FormatInt(aws.ToInt64(v.Size), 10),
+				inventoryTime(v.LastModified), strings.Trim(aws.ToString(v.ETag), `"`), string(v.StorageClass)}); err != nil {
+				return count, err
+			}
+			count++
+		}
+		for _, m := range page.DeleteMarkers {
+			if err := w.Write([]string{bucket, util.EncodeManifestKey(*m.Key), aws.ToString(m.VersionId),
+				strconv.FormatBool(aws.ToBool(m.IsLatest)), "true", "", inventoryTime(m.LastModified), "", ""}); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Write a listedObjectsSchema row for every object of the bucket
+func (s3obj *s3migration) listObjectRows(ctx context.Context, bucket string, w *csv.Writer) (int, error) {
+	count := 0
+	paginator := s3.NewListObjectsV2Paginator(s3obj.s3Client, &s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+	for paginator.HasMorePages() {
+		s3obj.heartbeat.Beat()
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return count, err
+		}
+		for _, obj := range page.Contents {
+			if err := w.Write([]string{bucket, util.EncodeManifestKey(*obj.Key), strconv.FormatInt(aws.ToInt64(obj.Size), 10),
+				inventoryTime(obj.LastModified), strings.Trim(aws.ToString(obj.ETag), `"`), string(obj.StorageClass)}); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// LastModifiedDate as written by S3 inventory, eg. 2024-01-31T23:59:59.000Z
+func inventoryTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+// Counts the bytes written through it, ie. the size of the gzipped data file
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
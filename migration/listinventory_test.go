@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListInventory(t *testing.T) {
+	modified := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+	m := &mock{objects: map[string]string{}, listObjectVersionsOutput: &s3.ListObjectVersionsOutput{
+		Versions: []s3types.ObjectVersion{
+			{Key: aws.String("a b.txt"), VersionId: aws.String("v2"), IsLatest: aws.Bool(false), Size: aws.Int64(5),
+				LastModified: &modified, ETag: aws.String(`"abc"`), StorageClass: s3types.ObjectVersionStorageClassStandard},
+		},
+		DeleteMarkers: []s3types.DeleteMarkerEntry{
+			{Key: aws.String("a b.txt"), VersionId: aws.String("v3"), IsLatest: aws.Bool(true), LastModified: &modified},
+		},
+	}}
+	s3mig := &s3migration{s3Client: m}
+
+	inventory, err := s3mig.listInventory(context.TODO(), "src", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "src", inventory.Bucket)
+	manifest, err := s3mig.readInventoryManifest(context.TODO(), inventory.Bucket, inventory.Manifest)
+	assert.NoError(t, err)
+	assert.Equal(t, listedVersionsSchema, manifest.FileSchema)
+	assert.Len(t, manifest.Files, 1)
+	assert.True(t, strings.HasPrefix(aws.ToString(inventory.Manifest.Key), "src/bulk-copy-inventory/listed/"))
+
+	// Rows are written like S3 inventory's, with URL-encoded keys and the delete markers
+	gz, err := gzip.NewReader(strings.NewReader(m.objects[manifest.Files[0].Key]))
+	assert.NoError(t, err)
+	rows, err := csv.NewReader(gz).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"src", "a%20b.txt", "v2", "false", "false", "5", "2024-01-31T23:59:59.000Z", "abc", "STANDARD"},
+		{"src", "a%20b.txt", "v3", "true", "true", "", "2024-01-31T23:59:59.000Z", "", ""},
+	}, rows)
+}
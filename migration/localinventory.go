@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Upload an inventory manifest.json, and the data files it lists, from the local file system to the
+// source bucket so the run can filter it exactly like an inventory report delivered by S3.  Data files
+// are expected next to manifest.json, as they are after downloading an inventory report directory.
+func (s3obj *s3migration) uploadLocalInventory(ctx context.Context, bucket, manifestPath string) (*s3types.Object, error) {
+	body, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	// Decode generically so the fields this tool doesn't use are uploaded unchanged
+	var manifest map[string]any
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("local inventory manifest %s is corrupt or malformed: %w", manifestPath, err)
+	}
+	files, _ := manifest["files"].([]any)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("local inventory manifest %s lists no data files", manifestPath)
+	}
+
+	prefix := fmt.Sprintf("%s/%s/local/%s", bucket, inventoryConfigName, time.Now().UTC().Format("2006-01-02T15-04-05Z"))
+	dir := filepath.Dir(manifestPath)
+	for _, entry := range files {
+		file, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("local inventory manifest %s has a malformed files entry", manifestPath)
+		}
+		key, _ := file["key"].(string)
+		name := path.Base(key)
+		if key == "" || name == "." || name == "/" {
+			return nil, fmt.Errorf("local inventory manifest %s has a files entry without a key", manifestPath)
+		}
+		if err := s3obj.uploadLocalFile(ctx, s3obj.scratchBucket(bucket), prefix+"/data/"+name, filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+		file["key"] = prefix + "/data/" + name
+	}
+
+	body, err = json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Info("Uploading local inventory manifest",
+		zap.String("file", manifestPath),
+		zap.Int("dataFiles", len(files)),
+	)
+	return s3obj.uploadS3File(ctx, s3obj.scratchBucket(bucket), prefix+"/manifest.json", bytes.NewReader(body))
+}
+
+func (s3obj *s3migration) uploadLocalFile(ctx context.Context, bucket, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("local inventory data file: %w", err)
+	}
+	defer f.Close()
+	_, err = s3obj.uploadS3File(ctx, bucket, key, f)
+	return err
+}
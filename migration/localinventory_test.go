@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadLocalInventory(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{
+		"sourceBucket": "src",
+		"destinationBucket": "arn:aws:s3:::inventory",
+		"fileFormat": "CSV",
+		"fileSchema": "Bucket, Key, IsLatest",
+		"files": [{"key": "src/config/data/abc.csv.gz", "size": 4, "MD5checksum": "x"}]
+	}`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "abc.csv.gz"), []byte("data"), 0600))
+
+	m := &mock{objects: map[string]string{}}
+	s3mig := &s3migration{s3Client: m}
+	obj, err := s3mig.uploadLocalInventory(context.Background(), "src", filepath.Join(dir, "manifest.json"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(*obj.Key, "src/bulk-copy-inventory/local/"))
+	assert.True(t, strings.HasSuffix(*obj.Key, "/manifest.json"))
+	assert.Equal(t, "test-etag", *obj.ETag)
+
+	var uploaded manifestJson
+	assert.NoError(t, json.Unmarshal([]byte(m.objects[*obj.Key]), &uploaded))
+	assert.Equal(t, "Bucket, Key, IsLatest", uploaded.FileSchema)
+	assert.Len(t, uploaded.Files, 1)
+	dataKey := strings.TrimSuffix(*obj.Key, "manifest.json") + "data/abc.csv.gz"
+	assert.Equal(t, dataKey, uploaded.Files[0].Key)
+	assert.Equal(t, "data", m.objects[dataKey])
+
+	// Data files must be next to manifest.json
+	assert.NoError(t, os.Remove(filepath.Join(dir, "abc.csv.gz")))
+	_, err = s3mig.uploadLocalInventory(context.Background(), "src", filepath.Join(dir, "manifest.json"))
+	assert.Error(t, err)
+}
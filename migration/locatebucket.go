@@ -0,0 +1,61 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Where a bucket is, as found by LocateBucket
+type BucketLocation struct {
+	Exists   bool
+	Region   string // Empty when S3 didn't say, eg. when a mock or proxy doesn't return it
+	Readable bool   // False when HeadBucket was denied, eg. for a bucket of another account
+}
+
+// Check the bucket exists, and find its region, with the default credentials, eg. to validate the answers to init.
+// The region the credentials are configured for, or us-east-1, is only used to send the request.
+func LocateBucket(bucket string) (*BucketLocation, error) {
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg)}
+	return s3mig.locateBucket(ctx, bucket)
+}
+
+// S3 answers HeadBucket with the bucket's region, even when redirecting a request sent to another region
+// or denying it, so only a bucket that doesn't exist, or an error before S3 answered, leaves it unknown
+func (s3obj *s3migration) locateBucket(ctx context.Context, bucket string) (*BucketLocation, error) {
+	out, err := s3obj.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err == nil {
+		return &BucketLocation{Exists: true, Region: aws.ToString(out.BucketRegion), Readable: true}, nil
+	}
+	var (
+		notFound *s3types.NotFound
+		re       *awshttp.ResponseError
+	)
+	switch {
+	case errors.As(err, &notFound):
+		return &BucketLocation{}, nil
+	case errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotFound:
+		return &BucketLocation{}, nil
+	case errors.As(err, &re) && re.Response.Header.Get("X-Amz-Bucket-Region") != "":
+		return &BucketLocation{
+			Exists:   true,
+			Region:   re.Response.Header.Get("X-Amz-Bucket-Region"),
+			Readable: re.HTTPStatusCode() != http.StatusForbidden,
+		}, nil
+	}
+	return nil, err
+}
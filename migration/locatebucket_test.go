@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+// Answers HeadBucket like S3 does for a bucket in another region, or of another account
+type remoteBucketMock struct {
+	*mock
+	status int
+}
+
+func (m *remoteBucketMock) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if m.status == http.StatusOK {
+		return &s3.HeadBucketOutput{BucketRegion: aws.String("eu-west-1")}, nil
+	}
+	header := http.Header{}
+	header.Set("X-Amz-Bucket-Region", "eu-west-1")
+	return nil, &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: m.status, Header: header}},
+		Err:      errors.New("head bucket"),
+	}}
+}
+
+func TestLocateBucket(t *testing.T) {
+	s3mig := &s3migration{s3Client: &mock{missingBuckets: []string{"missing"}}}
+	location, err := s3mig.locateBucket(context.TODO(), "missing")
+	assert.NoError(t, err)
+	assert.False(t, location.Exists)
+
+	m := &remoteBucketMock{mock: &mock{}}
+	s3mig.s3Client = m
+	for status, readable := range map[int]bool{http.StatusOK: true, http.StatusMovedPermanently: true, http.StatusForbidden: false} {
+		m.status = status
+		location, err = s3mig.locateBucket(context.TODO(), "remote")
+		assert.NoError(t, err)
+		assert.Equal(t, &BucketLocation{Exists: true, Region: "eu-west-1", Readable: readable}, location, status)
+	}
+}
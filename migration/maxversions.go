@@ -0,0 +1,120 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"s3migration/util"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.uber.org/zap"
+)
+
+// A non-current version read from the inventory, its key and version ID as they appear in the manifests
+type inventoryVersion struct {
+	versionID string
+	modified  string // ISO 8601, so versions sort by their text
+}
+
+// Drop all but the newest maxVersions-1 non-current versions of each key from the non-version jobs, so
+// with the current version no more than maxVersions versions of a key are copied.  The inventory's last
+// modified dates order the versions, jobs left with no rows are dropped.
+func (s3obj *s3migration) limitVersionDepth(ctx context.Context, steps []*jobStep, inventory inventoryReport, maxVersions int) ([]*jobStep, error) {
+	keep, err := s3obj.newestVersions(ctx, inventory, maxVersions-1)
+	if err != nil {
+		return nil, err
+	}
+	limited := []*jobStep{}
+	for _, step := range steps {
+		if step.Kind != jobKindNonVersion {
+			limited = append(limited, step)
+			continue
+		}
+		rows, err := s3obj.readManifestRows(ctx, step.Input)
+		if err != nil {
+			return nil, err
+		}
+		kept := [][]string{}
+		for _, row := range rows {
+			if len(row) < 3 {
+				return nil, fmt.Errorf("invalid manifest row %v, expected bucket, key and version ID", row)
+			}
+			if keep[row[1]][row[2]] {
+				kept = append(kept, row)
+			}
+		}
+		zap.L().Info("Limited non-current versions per key",
+			zap.Int("maxVersions", maxVersions),
+			zap.Int("rows", len(rows)),
+			zap.Int("kept", len(kept)),
+		)
+		if len(kept) == 0 {
+			continue
+		}
+		if len(kept) == len(rows) {
+			limited = append(limited, step)
+			continue
+		}
+
+		manifestArn := *step.Input.Manifest.Location.ObjectArn
+		bucket, manifestKey, err := ParseObjectArn(manifestArn)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s-max-versions.csv", strings.TrimSuffix(manifestKey, ".csv"))
+		obj, err := s3obj.uploadRows(ctx, bucket, key, kept)
+		if err != nil {
+			return nil, err
+		}
+		step.Input.Manifest.Location.ObjectArn = objectArnLike(manifestArn, bucket, key)
+		step.Input.Manifest.Location.ETag = obj.ETag
+		limited = append(limited, step)
+	}
+	return limited, nil
+}
+
+// The newest n non-current versions of each key in the inventory, by key and version ID
+func (s3obj *s3migration) newestVersions(ctx context.Context, inventory inventoryReport, n int) (map[string]map[string]bool, error) {
+	manifestJson, err := s3obj.readInventoryManifest(ctx, inventory.Bucket, inventory.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	fields := []string{"Key", "VersionId", util.LastModifiedColumn}
+	expression, err := util.GetBatchQueryExpression(manifestJson.FileSchema, fields, time.Time{}, time.Time{}, util.IsLatestNo)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string][]inventoryVersion{}
+	r := csv.NewReader(s3obj.filterDataFiles(ctx, inventory.Bucket, manifestJson.dataFileKeys(), expression))
+	for {
+		rec, rerr := r.Read()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+		versions[rec[0]] = append(versions[rec[0]], inventoryVersion{versionID: rec[1], modified: rec[2]})
+	}
+
+	keep := map[string]map[string]bool{}
+	for key, stack := range versions {
+		slices.SortStableFunc(stack, func(a, b inventoryVersion) int {
+			return cmp.Compare(b.modified, a.modified)
+		})
+		keep[key] = map[string]bool{}
+		for _, v := range stack[:min(n, len(stack))] {
+			keep[key][v.versionID] = true
+		}
+	}
+	zap.L().Info("Read non-current versions from inventory",
+		zap.Int("keys", len(versions)),
+		zap.String("inventory", aws.ToString(inventory.Manifest.Key)),
+	)
+	return keep, nil
+}
@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitVersionDepth(t *testing.T) {
+	var data bytes.Buffer
+	w := gzip.NewWriter(&data)
+	w.Write([]byte(`src,a,a4,true,false,2024-01-04T00:00:00.000Z
+src,a,a3,false,false,2024-01-03T00:00:00.000Z
+src,a,a1,false,false,2024-01-01T00:00:00.000Z
+src,a,a2,false,false,2024-01-02T00:00:00.000Z
+src,a,m1,false,true,2024-01-05T00:00:00.000Z
+src,b,b2,true,false,2024-01-02T00:00:00.000Z
+src,b,b1,false,false,2024-01-01T00:00:00.000Z
+src,c,c1,false,false,2024-01-01T00:00:00.000Z
+`))
+	w.Close()
+	m := &mock{objects: map[string]string{
+		"inv/manifest.json": `{"fileSchema": "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, LastModifiedDate",
+			"files": [{"key": "inv/data.csv.gz"}]}`,
+		"inv/data.csv.gz": data.String(),
+		"noncurrent.csv":  "src,a,a3\nsrc,a,a1\nsrc,b,b1\nsrc,a,a2\n",
+		"old.csv":         "src,a,a1\n",
+	}}
+	s3mig := &s3migration{s3Client: m, localFilter: true}
+	inventory := inventoryReport{Bucket: "src", Manifest: s3types.Object{Key: aws.String("inv/manifest.json")}}
+	step := func(kind, manifest string) *jobStep {
+		return &jobStep{Kind: kind, Input: NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/" + manifest)})}
+	}
+	steps := []*jobStep{step(jobKindNonVersion, "noncurrent.csv"), step(jobKindNonVersion, "old.csv"), step(jobKindVersion, "latest.csv")}
+
+	// The current version and the newest non-current version, delete markers aren't versions to copy
+	limited, err := s3mig.limitVersionDepth(context.TODO(), steps, inventory, 2)
+	assert.NoError(t, err)
+	assert.Len(t, limited, 2)
+	assert.Equal(t, "arn:aws:s3:::src/noncurrent-max-versions.csv", *limited[0].Input.Manifest.Location.ObjectArn)
+	assert.Equal(t, "src,a,a3\nsrc,b,b1\n", m.objects["noncurrent-max-versions.csv"])
+	assert.Same(t, steps[2], limited[1])
+}
@@ -0,0 +1,321 @@
+package migration
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"s3migration/util"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+const defaultHeadConcurrency = 16
+
+// Predicates on object headers, evaluated with HeadObject.  Patterns use path.Match syntax, eg. image/*
+type MetadataFilter struct {
+	ContentTypes []string          // Object must match one of these Content-Type patterns, if any are given
+	Metadata     map[string]string // Object must have every user metadata key, with a value matching its pattern
+	Concurrency  int               // Number of concurrent HeadObject calls
+	Checkpoint   string            // Local file recording evaluated objects so an interrupted pass can resume
+}
+
+func (f *MetadataFilter) enabled() bool {
+	return f != nil && (len(f.ContentTypes) > 0 || len(f.Metadata) > 0)
+}
+
+func (f *MetadataFilter) matches(head *s3.HeadObjectOutput) bool {
+	if len(f.ContentTypes) > 0 {
+		matched := false
+		for _, pattern := range f.ContentTypes {
+			if ok, _ := path.Match(pattern, aws.ToString(head.ContentType)); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for key, pattern := range f.Metadata {
+		value, found := head.Metadata[strings.ToLower(key)]
+		if !found {
+			return false
+		}
+		if ok, _ := path.Match(pattern, value); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Wrap a manifest builder with a HeadObject pass that keeps only rows matching the metadata filter
+func (s3obj *s3migration) metadataFilteredBuilder(build manifestBuilder, filter *MetadataFilter) manifestBuilder {
+	return func(ctx context.Context, jobArgs *batchJobArgs, filters userFilters) (*s3types.Object, error) {
+		manifest, err := build(ctx, jobArgs, filters)
+		if err != nil {
+			return nil, err
+		}
+		return s3obj.filterManifestByMetadata(ctx, s3obj.scratchBucket(*jobArgs.SourceBucketName), manifest, filter)
+	}
+}
+
+type headResult struct {
+	row     []string
+	match   bool
+	missing bool // The object no longer exists, eg. it was deleted since the inventory
+}
+
+// Hash of the filter's predicates, so a checkpoint recorded with other predicates isn't reused
+func (f *MetadataFilter) fingerprint() string {
+	h := sha256.New()
+	contentTypes := slices.Clone(f.ContentTypes)
+	slices.Sort(contentTypes)
+	for _, pattern := range contentTypes {
+		fmt.Fprintf(h, "content-type\x00%s\x00", pattern)
+	}
+	keys := make([]string, 0, len(f.Metadata))
+	for key := range f.Metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "metadata\x00%s\x00%s\x00", strings.ToLower(key), f.Metadata[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// HEAD every object listed in the manifest and upload a manifest with only the matching rows.  The manifest
+// is streamed, once to evaluate its rows and once to write the matching rows in their original order.
+// Objects that no longer exist don't match.
+func (s3obj *s3migration) filterManifestByMetadata(ctx context.Context, bucket string, manifest *s3types.Object, filter *MetadataFilter) (*s3types.Object, error) {
+	// Read by the goroutine sending the rows to evaluate, while the results are recorded in evaluated
+	previous, err := loadHeadCheckpoint(filter.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	evaluated := map[string]bool{}
+	var checkpoint *csv.Writer
+	if filter.Checkpoint != "" {
+		f, ferr := os.OpenFile(filter.Checkpoint, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if ferr != nil {
+			return nil, ferr
+		}
+		defer f.Close()
+		checkpoint = csv.NewWriter(f)
+		defer checkpoint.Flush()
+	}
+	predicates := filter.fingerprint()
+	zap.L().Info("Filtering manifest by object metadata",
+		zap.String("manifest", *manifest.Key),
+		zap.Int("alreadyEvaluated", len(previous)),
+		zap.Strings("contentTypes", filter.ContentTypes),
+		zap.Any("metadata", filter.Metadata),
+	)
+
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    manifest.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	concurrency := filter.Concurrency
+	if concurrency < 1 {
+		concurrency = defaultHeadConcurrency
+	}
+	work := make(chan []string)
+	results := make(chan headResult)
+	errs := make(chan error, concurrency+1)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range work {
+				match, herr := s3obj.headMatches(ctx, row, filter)
+				var notFound *s3types.NotFound
+				missing := errors.As(herr, &notFound)
+				if herr != nil && !missing {
+					errs <- herr
+					cancel()
+					return
+				}
+				results <- headResult{row: row, match: match, missing: missing}
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		r := csv.NewReader(out.Body)
+		for {
+			row, rerr := r.Read()
+			if rerr == io.EOF {
+				return
+			}
+			if rerr != nil {
+				errs <- fmt.Errorf("unable to read manifest %s: %w", *manifest.Key, rerr)
+				cancel()
+				return
+			}
+			if _, done := previous[checkpointKey(predicates, row)]; done {
+				continue
+			}
+			select {
+			case work <- row:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	missing := 0
+	for res := range results {
+		key := checkpointKey(predicates, res.row)
+		evaluated[key] = res.match
+		if res.missing {
+			missing++
+		}
+		if checkpoint != nil {
+			_ = checkpoint.Write([]string{key, fmt.Sprint(res.match)})
+		}
+		s3obj.heartbeat.Beat()
+	}
+	select {
+	case herr := <-errs:
+		return nil, fmt.Errorf("metadata filter interrupted, rerun to resume: %w", herr)
+	default:
+	}
+
+	// Keep the original manifest order
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	rows, matched := 0, 0
+	go func() {
+		in, gerr := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: manifest.Key})
+		if gerr != nil {
+			pw.CloseWithError(gerr)
+			return
+		}
+		defer in.Body.Close()
+		r, w := csv.NewReader(in.Body), csv.NewWriter(pw)
+		for {
+			row, rerr := r.Read()
+			if rerr == io.EOF {
+				break
+			}
+			if rerr != nil {
+				pw.CloseWithError(fmt.Errorf("unable to read manifest %s: %w", *manifest.Key, rerr))
+				return
+			}
+			rows++
+			key := checkpointKey(predicates, row)
+			match, ok := evaluated[key]
+			if !ok {
+				match = previous[key]
+			}
+			if !match {
+				continue
+			}
+			matched++
+			if werr := w.Write(row); werr != nil {
+				pw.CloseWithError(werr)
+				return
+			}
+		}
+		w.Flush()
+		pw.CloseWithError(w.Error())
+	}()
+	key := strings.TrimSuffix(*manifest.Key, ".csv") + "-metadata.csv"
+	filtered, err := s3obj.uploadS3File(ctx, bucket, key, pr)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Info("Metadata filter complete",
+		zap.Int("rows", rows),
+		zap.Int("matched", matched),
+		zap.Int("notFound", missing),
+	)
+	if filter.Checkpoint != "" {
+		checkpoint.Flush()
+		os.Remove(filter.Checkpoint)
+	}
+	return filtered, nil
+}
+
+// HEAD the object referenced by a manifest row (Bucket, Key[, VersionId]).  Returns the NotFound error of
+// an object that no longer exists.
+func (s3obj *s3migration) headMatches(ctx context.Context, row []string, filter *MetadataFilter) (bool, error) {
+	if len(row) < 2 {
+		return false, fmt.Errorf("invalid manifest row %v", row)
+	}
+	key, err := util.DecodeManifestKey(row[1])
+	if err != nil {
+		return false, err
+	}
+	input := &s3.HeadObjectInput{Bucket: aws.String(row[0]), Key: aws.String(key)}
+	if len(row) > 2 && row[2] != "" {
+		input.VersionId = aws.String(row[2])
+	}
+	head, err := s3obj.s3Client.HeadObject(ctx, input)
+	if err != nil {
+		return false, err
+	}
+	return filter.matches(head), nil
+}
+
+// Checkpoint record key of a manifest row evaluated with the predicates of a filter, see fingerprint
+func checkpointKey(predicates string, row []string) string {
+	return predicates + "\x00" + strings.Join(row, "\x00")
+}
+
+// Read previously evaluated rows from the checkpoint file, if any
+func loadHeadCheckpoint(file string) (map[string]bool, error) {
+	evaluated := map[string]bool{}
+	if file == "" {
+		return evaluated, nil
+	}
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return evaluated, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = 2
+	for {
+		rec, rerr := r.Read()
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			// A partially written final record is expected after a crash
+			zap.L().Warn("Ignoring malformed metadata filter checkpoint record", zap.Error(rerr))
+			continue
+		}
+		evaluated[rec[0]] = rec[1] == "true"
+	}
+	return evaluated, nil
+}
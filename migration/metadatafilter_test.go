@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataFilterMatches(t *testing.T) {
+	head := &s3.HeadObjectOutput{
+		ContentType: aws.String("image/png"),
+		Metadata:    map[string]string{"project": "alpha-1"},
+	}
+
+	assert.False(t, (*MetadataFilter)(nil).enabled())
+	assert.False(t, (&MetadataFilter{Concurrency: 4}).enabled())
+	assert.True(t, (&MetadataFilter{ContentTypes: []string{"image/*"}}).enabled())
+
+	assert.True(t, (&MetadataFilter{ContentTypes: []string{"text/*", "image/*"}}).matches(head))
+	assert.False(t, (&MetadataFilter{ContentTypes: []string{"text/*"}}).matches(head))
+	assert.True(t, (&MetadataFilter{Metadata: map[string]string{"Project": "alpha*"}}).matches(head))
+	assert.False(t, (&MetadataFilter{Metadata: map[string]string{"project": "beta*"}}).matches(head))
+	assert.False(t, (&MetadataFilter{Metadata: map[string]string{"owner": "*"}}).matches(head))
+	assert.False(t, (&MetadataFilter{
+		ContentTypes: []string{"image/*"},
+		Metadata:     map[string]string{"project": "beta*"},
+	}).matches(head))
+}
+
+func TestLoadHeadCheckpoint(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "checkpoint.csv")
+
+	evaluated, err := loadHeadCheckpoint(file)
+	assert.NoError(t, err)
+	assert.Empty(t, evaluated)
+
+	row := checkpointKey("predicates", []string{"bucket", "a.png"})
+	other := checkpointKey("predicates", []string{"bucket", "b.txt"})
+	// Final record truncated by a crash
+	body := "\"" + row + "\",true\n\"" + other + "\",false\n\"bucket"
+	assert.NoError(t, os.WriteFile(file, []byte(body), 0600))
+
+	evaluated, err = loadHeadCheckpoint(file)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{row: true, other: false}, evaluated)
+}
+
+func TestFilterManifestByMetadata(t *testing.T) {
+	m := &mock{
+		objects: map[string]string{"manifest.csv": "src,b.png\nsrc,gone.png\nsrc,c.txt\nsrc,a.png\n"},
+		heads: map[string]*s3.HeadObjectOutput{
+			"a.png": {ContentType: aws.String("image/png")},
+			"b.png": {ContentType: aws.String("image/png")},
+			"c.txt": {ContentType: aws.String("text/plain")},
+			// The filtered manifest's ETag is read once it's uploaded
+			"manifest-metadata.csv": {ETag: aws.String("etag")},
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.csv")
+	filter := &MetadataFilter{ContentTypes: []string{"image/*"}, Concurrency: 2, Checkpoint: checkpoint}
+
+	// An object deleted since the inventory doesn't match, rather than failing the pass
+	filtered, err := s3mig.filterManifestByMetadata(context.TODO(), "src", &s3types.Object{Key: aws.String("manifest.csv")}, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, "manifest-metadata.csv", *filtered.Key)
+	assert.Equal(t, "src,b.png\nsrc,a.png\n", m.objects["manifest-metadata.csv"])
+	assert.NoFileExists(t, checkpoint)
+
+	// A checkpoint recorded with other predicates isn't reused
+	other := &MetadataFilter{ContentTypes: []string{"text/*"}}
+	assert.NotEqual(t, filter.fingerprint(), other.fingerprint())
+	assert.Equal(t, filter.fingerprint(), (&MetadataFilter{ContentTypes: []string{"image/*"}, Concurrency: 8}).fingerprint())
+	body := "\"" + checkpointKey(other.fingerprint(), []string{"src", "c.txt"}) + "\",true\n"
+	assert.NoError(t, os.WriteFile(checkpoint, []byte(body), 0600))
+	_, err = s3mig.filterManifestByMetadata(context.TODO(), "src", &s3types.Object{Key: aws.String("manifest.csv")}, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, "src,b.png\nsrc,a.png\n", m.objects["manifest-metadata.csv"])
+}
@@ -0,0 +1,159 @@
+package migration
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"go.uber.org/zap"
+)
+
+// CloudWatch metric units used by the migration metrics
+const (
+	unitCount   = "Count"
+	unitBytes   = "Bytes"
+	unitSeconds = "Seconds"
+	unitNone    = "None"
+)
+
+// A metric value in a CloudWatch Embedded Metric Format record
+type emfMetric struct {
+	Name  string
+	Unit  string
+	Value float64
+}
+
+// Publishes migration metrics as CloudWatch Embedded Metric Format records, one JSON line each, which
+// CloudWatch Logs extracts into custom metrics when the lines reach it (eg. through the CloudWatch agent,
+// the awslogs log driver or Lambda).  See
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+type metricsEmitter struct {
+	namespace  string
+	dimensions map[string]string
+	path       string // File the records are appended to, stdout when empty
+	out        io.Writer
+	mu         sync.Mutex
+}
+
+// Metrics emitter for the run, nil when no namespace is set
+func newMetricsEmitter(args MigrationArgs) *metricsEmitter {
+	if args.MetricsNamespace == "" {
+		return nil
+	}
+	return &metricsEmitter{
+		namespace:  args.MetricsNamespace,
+		dimensions: map[string]string{"SourceBucket": args.SourceBucket, "DestinationBucket": args.DestinationBucket},
+		path:       args.MetricsFile,
+		out:        os.Stdout,
+	}
+}
+
+// Write one record of the metrics, with the properties as extra fields.  A nil emitter does nothing.
+func (m *metricsEmitter) emit(now time.Time, properties map[string]any, metrics ...emfMetric) {
+	if m == nil || len(metrics) == 0 {
+		return
+	}
+	record := map[string]any{}
+	for k, v := range properties {
+		record[k] = v
+	}
+	dimensions := []string{}
+	for k, v := range m.dimensions {
+		record[k] = v
+		dimensions = append(dimensions, k)
+	}
+	slices.Sort(dimensions)
+	definitions := make([]map[string]string, len(metrics))
+	for i, metric := range metrics {
+		record[metric.Name] = metric.Value
+		definitions[i] = map[string]string{"Name": metric.Name, "Unit": metric.Unit}
+	}
+	record["_aws"] = map[string]any{
+		"Timestamp": now.UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{{
+			"Namespace":  m.namespace,
+			"Dimensions": [][]string{dimensions},
+			"Metrics":    definitions,
+		}},
+	}
+	line, _ := json.Marshal(record)
+	line = append(line, '\n')
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.write(line); err != nil {
+		zap.L().Error("Unable to write metrics", zap.String("file", m.path), zap.Error(err))
+	}
+}
+
+func (m *metricsEmitter) write(line []byte) error {
+	if m.path == "" {
+		_, err := m.out.Write(line)
+		return err
+	}
+	f, err := os.OpenFile(m.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Publish the outcome of a completed batch job.  bytes is the job's estimated size, zero when unknown.
+func (m *metricsEmitter) jobCompleted(job *s3control.DescribeJobOutput, bytes int64) {
+	if m == nil || job == nil || job.Job == nil || job.Job.ProgressSummary == nil {
+		return
+	}
+	ps := job.Job.ProgressSummary
+	total, succeeded, failed := *ps.TotalNumberOfTasks, *ps.NumberOfTasksSucceeded, *ps.NumberOfTasksFailed
+	metrics := []emfMetric{
+		{Name: "ObjectsCopied", Unit: unitCount, Value: float64(succeeded)},
+		{Name: "ObjectsFailed", Unit: unitCount, Value: float64(failed)},
+	}
+	if bytes > 0 && total > 0 {
+		metrics = append(metrics, emfMetric{Name: "BytesCopied", Unit: unitBytes, Value: float64(bytes) * float64(succeeded) / float64(total)})
+	}
+	if job.Job.CreationTime != nil && job.Job.TerminationDate != nil {
+		metrics = append(metrics, emfMetric{Name: "JobDuration", Unit: unitSeconds, Value: job.Job.TerminationDate.Sub(*job.Job.CreationTime).Seconds()})
+	}
+	m.emit(time.Now(), map[string]any{"JobId": *job.Job.JobId, "JobStatus": string(job.Job.Status)}, metrics...)
+}
+
+// Publish the outcome of the run from its report
+func (m *metricsEmitter) runCompleted(r *Report) {
+	if m == nil || r == nil {
+		return
+	}
+	var succeeded, failed int64
+	var bytes float64
+	for _, job := range r.Jobs {
+		succeeded += job.Succeeded
+		failed += job.Failed
+		if job.Total > 0 {
+			bytes += float64(job.Bytes) * float64(job.Succeeded) / float64(job.Total)
+		}
+	}
+	thresholdMet := 0.0
+	if r.ThresholdMet {
+		thresholdMet = 1
+	}
+	now := time.Now()
+	metrics := []emfMetric{
+		{Name: "RunObjectsCopied", Unit: unitCount, Value: float64(succeeded)},
+		{Name: "RunObjectsFailed", Unit: unitCount, Value: float64(failed)},
+		{Name: "RunDuration", Unit: unitSeconds, Value: now.Sub(r.StartedAt).Seconds()},
+		{Name: "SuccessRatio", Unit: unitNone, Value: float64(r.SuccessRatio)},
+		{Name: "ThresholdMet", Unit: unitNone, Value: thresholdMet},
+	}
+	if bytes > 0 {
+		metrics = append(metrics, emfMetric{Name: "RunBytesCopied", Unit: unitBytes, Value: bytes})
+	}
+	m.emit(now, map[string]any{"Jobs": len(r.Jobs)}, metrics...)
+}
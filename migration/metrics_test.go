@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsEmitter(t *testing.T) {
+	assert.Nil(t, newMetricsEmitter(MigrationArgs{}))
+	var none *metricsEmitter
+	none.runCompleted(&Report{})
+
+	var out bytes.Buffer
+	m := newMetricsEmitter(MigrationArgs{MetricsNamespace: "S3Migration", SourceBucket: "src", DestinationBucket: "dst"})
+	m.out = &out
+	created := time.Now().Add(-time.Hour)
+	m.jobCompleted(&s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:           aws.String("job"),
+		Status:          s3controltypes.JobStatusComplete,
+		CreationTime:    aws.Time(created),
+		TerminationDate: aws.Time(created.Add(10 * time.Minute)),
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(10),
+			NumberOfTasksSucceeded: aws.Int64(9),
+			NumberOfTasksFailed:    aws.Int64(1),
+		},
+	}}, 1000)
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &record))
+	assert.Equal(t, "src", record["SourceBucket"])
+	assert.Equal(t, "job", record["JobId"])
+	assert.Equal(t, 9.0, record["ObjectsCopied"])
+	assert.Equal(t, 1.0, record["ObjectsFailed"])
+	assert.Equal(t, 900.0, record["BytesCopied"])
+	assert.Equal(t, 600.0, record["JobDuration"])
+	directive := record["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)[0].(map[string]any)
+	assert.Equal(t, "S3Migration", directive["Namespace"])
+	assert.Equal(t, []any{[]any{"DestinationBucket", "SourceBucket"}}, directive["Dimensions"])
+	assert.Len(t, directive["Metrics"], 4)
+	assert.Contains(t, directive["Metrics"], map[string]any{"Name": "BytesCopied", "Unit": "Bytes"})
+}
+
+func TestMetricsEmitterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.log")
+	m := newMetricsEmitter(MigrationArgs{MetricsNamespace: "S3Migration", MetricsFile: path})
+	r := &Report{StartedAt: time.Now(), SuccessRatio: 0.5, Jobs: []JobSummary{{Total: 2, Succeeded: 1, Failed: 1}}}
+	m.runCompleted(r)
+	r.ThresholdMet = true
+	m.runCompleted(r)
+
+	body, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	assert.Len(t, lines, 2)
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, 1.0, record["RunObjectsCopied"])
+	assert.Equal(t, 0.5, record["SuccessRatio"])
+	assert.Equal(t, 1.0, record["ThresholdMet"])
+	// Job bytes aren't known, so no bytes metric is published
+	assert.NotContains(t, record, "RunBytesCopied")
+}
@@ -0,0 +1,304 @@
+package migration
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"s3migration/util"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+)
+
+// Source objects deleted after a verified copy, see --move
+type MoveSummary struct {
+	Deleted  int `json:"deleted"`  // Source objects deleted
+	Kept     int `json:"kept"`     // Source objects kept as their copy task failed or their job didn't complete
+	Modified int `json:"modified"` // Unversioned source objects kept as they were written, or deleted, after their job was created
+	Errors   int `json:"errors"`   // Source objects that could not be deleted
+}
+
+// Completion report of a batch job, see https://docs.aws.amazon.com/AmazonS3/latest/userguide/batch-ops-job-status.html
+type completionReport struct {
+	Format  s3controltypes.JobReportFormat
+	Results []struct {
+		Key string // Result file listing the tasks
+	}
+}
+
+func completionReportPrefix(bucket string) string {
+	return fmt.Sprintf("%s/%s/reports", bucket, inventoryConfigName)
+}
+
+// Report failed tasks to the source bucket's scratch location, so a move only deletes objects that were copied
+func (s3obj *s3migration) enableFailureReport(input *s3control.CreateJobInput, bucket string) {
+	input.Report = &s3controltypes.JobReport{
+		Enabled:     true,
+		Bucket:      util.GetArn(s3obj.cfg.Region, s3obj.scratchBucket(bucket)),
+		Format:      s3controltypes.JobReportFormatReportCsv20180820,
+		Prefix:      aws.String(completionReportPrefix(bucket)),
+		ReportScope: s3controltypes.JobReportScopeFailedTasksOnly,
+	}
+}
+
+func objectID(key, versionID string) string {
+	return key + "\x00" + versionID
+}
+
+// Read the rows of a job's completion report, ie. its failed tasks:
+// Bucket, Key, VersionId, TaskStatus, HTTPStatusCode, ErrorCode, ResultMessage
+func (s3obj *s3migration) completionReportRows(ctx context.Context, bucket, jobID string) ([][]string, error) {
+	key := fmt.Sprintf("%s/job-%s/manifest.json", completionReportPrefix(bucket), jobID)
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s3obj.scratchBucket(bucket)), Key: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read completion report %s: %w", key, err)
+	}
+	var report completionReport
+	err = json.NewDecoder(out.Body).Decode(&report)
+	out.Body.Close()
+	if err == nil && report.Format != s3controltypes.JobReportFormatReportCsv20180820 {
+		err = fmt.Errorf("unexpected format '%s'", report.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("completion report %s is corrupt or malformed: %w", key, err)
+	}
+
+	var rows [][]string
+	for _, result := range report.Results {
+		res, rerr := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s3obj.scratchBucket(bucket)), Key: aws.String(result.Key)})
+		if rerr != nil {
+			return nil, rerr
+		}
+		r := csv.NewReader(res.Body)
+		r.FieldsPerRecord = -1
+		resultRows, rerr := r.ReadAll()
+		res.Body.Close()
+		if rerr != nil {
+			return nil, rerr
+		}
+		rows = append(rows, resultRows...)
+	}
+	return rows, nil
+}
+
+// Read the failed tasks from a job's completion report
+func (s3obj *s3migration) failedTasks(ctx context.Context, bucket, jobID string) (map[string]bool, error) {
+	rows, err := s3obj.completionReportRows(ctx, bucket, jobID)
+	if err != nil {
+		return nil, err
+	}
+	failed := map[string]bool{}
+	for _, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		k, kerr := util.DecodeManifestKey(row[1])
+		if kerr != nil {
+			return nil, kerr
+		}
+		failed[objectID(k, row[2])] = true
+	}
+	return failed, nil
+}
+
+// Outcome of each object of an unversioned source that changed since its job was created, eg. "modified", or "" for
+// an object that is still the one the job copied.  DeleteObjects deletes the current object of a key, so an object
+// overwritten after its copy would be lost.  LastModified has a one second resolution, so objects written in the
+// second the job was created count as modified.  Objects given with a version ID aren't checked.
+func (s3obj *s3migration) changedSources(ctx context.Context, bucket string, objs []s3types.ObjectIdentifier, created time.Time) []string {
+	outcomes := make([]string, len(objs))
+	since := created.Truncate(time.Second)
+	sem := make(chan struct{}, defaultHeadConcurrency)
+	var wg sync.WaitGroup
+	for i, obj := range objs {
+		if obj.VersionId != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			head, err := s3obj.s3Client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: obj.Key})
+			var (
+				notFound *s3types.NotFound
+				ae       smithy.APIError
+			)
+			switch {
+			case errors.As(err, &notFound):
+				outcomes[i] = "modified"
+			case errors.As(err, &ae):
+				outcomes[i] = ae.ErrorCode()
+			case err != nil:
+				outcomes[i] = err.Error()
+			case head.LastModified == nil || !head.LastModified.Before(since):
+				outcomes[i] = "modified"
+			}
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// Delete the objects of each completed job's manifest from the source, except those whose copy task failed,
+// writing one line per object (key, version ID, outcome) to reportPath.  Nothing is deleted unless every
+// job's completion report can be read.  Objects of an unversioned source are only deleted when they weren't
+// written after their job was created, see changedSources.
+func (s3obj *s3migration) moveSources(ctx context.Context, steps []*jobStep, results []*s3control.DescribeJobOutput, bucket, reportPath string) (*MoveSummary, error) {
+	summary := &MoveSummary{}
+	type stepObjects struct {
+		rows    [][]string
+		failed  map[string]bool
+		created time.Time // When the job was created, the objects written since weren't necessarily copied
+	}
+	plan := []stepObjects{}
+	for i, step := range steps {
+		rows, err := s3obj.readManifestRows(ctx, step.Input)
+		if err != nil {
+			return nil, err
+		}
+		if results[i] == nil || results[i].Job.Status != s3controltypes.JobStatusComplete {
+			zap.L().Warn("Keeping source objects of a batch job that did not complete", zap.String("jobId", step.JobID))
+			summary.Kept += len(rows)
+			continue
+		}
+		failed, err := s3obj.failedTasks(ctx, bucket, step.JobID)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, stepObjects{rows: rows, failed: failed, created: aws.ToTime(results[i].Job.CreationTime)})
+	}
+
+	f, err := os.Create(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	report := csv.NewWriter(f)
+	defer report.Flush()
+
+	batch := []s3types.ObjectIdentifier{}
+	flush := func(created time.Time) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		s3obj.heartbeat.Beat()
+		unchanged := []s3types.ObjectIdentifier{}
+		for i, outcome := range s3obj.changedSources(ctx, bucket, batch, created) {
+			switch outcome {
+			case "":
+				unchanged = append(unchanged, batch[i])
+				continue
+			case "modified":
+				summary.Modified++
+			default:
+				summary.Errors++
+			}
+			if werr := report.Write([]string{*batch[i].Key, "", outcome}); werr != nil {
+				return werr
+			}
+		}
+		if batch = unchanged; len(batch) == 0 {
+			return nil
+		}
+		out, derr := s3obj.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3types.Delete{Objects: batch, Quiet: aws.Bool(true)},
+		})
+		if derr != nil {
+			return derr
+		}
+		errs := map[string]string{}
+		for _, e := range out.Errors {
+			errs[objectID(aws.ToString(e.Key), aws.ToString(e.VersionId))] = aws.ToString(e.Code)
+		}
+		for _, obj := range batch {
+			outcome := "deleted"
+			if code, ok := errs[objectID(*obj.Key, aws.ToString(obj.VersionId))]; ok {
+				outcome = code
+				summary.Errors++
+			} else {
+				summary.Deleted++
+			}
+			if werr := report.Write([]string{*obj.Key, aws.ToString(obj.VersionId), outcome}); werr != nil {
+				return werr
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	for _, p := range plan {
+		for _, row := range p.rows {
+			if len(row) < 2 {
+				continue
+			}
+			key, kerr := util.DecodeManifestKey(row[1])
+			if kerr != nil {
+				return summary, kerr
+			}
+			obj := s3types.ObjectIdentifier{Key: aws.String(key)}
+			versionID := ""
+			if len(row) > 2 && row[2] != "" {
+				versionID = row[2]
+				obj.VersionId = aws.String(versionID)
+			}
+			if p.failed[objectID(key, versionID)] {
+				summary.Kept++
+				if werr := report.Write([]string{key, versionID, "kept"}); werr != nil {
+					return summary, werr
+				}
+				continue
+			}
+			batch = append(batch, obj)
+			if len(batch) == deleteObjectsMaxKeys {
+				if err := flush(p.created); err != nil {
+					return summary, err
+				}
+			}
+		}
+		if err := flush(p.created); err != nil {
+			return summary, err
+		}
+	}
+	report.Flush()
+	return summary, report.Error()
+}
+
+// Move the copied objects once, after the copy jobs met the success threshold
+func (s3obj *s3migration) moveCopiedObjects(ctx context.Context, st *runState, results []*s3control.DescribeJobOutput) {
+	if !st.Args.Move || st.Moved {
+		return
+	}
+	moveStart := time.Now()
+	summary, err := s3obj.moveSources(ctx, st.Steps, results, st.Args.SourceBucket, st.Args.MoveReportFile)
+	s3obj.timePhase(PhaseMove, moveStart)
+	if s3obj.report != nil {
+		s3obj.report.Move = summary
+	}
+	if err != nil {
+		zap.L().Error("Failed to delete copied objects from the source", zap.Error(err))
+		return
+	}
+	st.Moved = true
+	st.mustSave()
+	zap.L().Info("Deleted copied objects from the source",
+		zap.String("bucket", st.Args.SourceBucket),
+		zap.Int("deleted", summary.Deleted),
+		zap.Int("kept", summary.Kept),
+		zap.Int("modified", summary.Modified),
+		zap.Int("errors", summary.Errors),
+		zap.String("report", st.Args.MoveReportFile),
+	)
+}
@@ -0,0 +1,99 @@
+package migration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveSources(t *testing.T) {
+	reports := completionReportPrefix("src")
+	m := &mock{objects: map[string]string{
+		"done.csv":    "src,copied,v1\nsrc,failed%20key,v2\n",
+		"stopped.csv": "src,pending,v3\n",
+		reports + "/job-done/manifest.json": `{"Format":"Report_CSV_20180820","Results":[{"TaskExecutionStatus":"failed","Bucket":"src","Key":"` +
+			reports + `/job-done/results/1.csv"}]}`,
+		reports + "/job-done/results/1.csv": "src,failed%20key,v2,failed,403,AccessDenied,Access Denied\n",
+	}}
+	s3mig := &s3migration{s3Client: m, report: newReport(MigrationArgs{})}
+	step := func(manifest, jobID string) *jobStep {
+		input := NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/" + manifest)})
+		s3mig.enableFailureReport(input, "src")
+		return &jobStep{Kind: jobKindNonVersion, Input: input, JobID: jobID}
+	}
+	reportPath := filepath.Join(t.TempDir(), "deletions.csv")
+	st := &runState{
+		Args:  MigrationArgs{SourceBucket: "src", Move: true, MoveReportFile: reportPath},
+		Steps: []*jobStep{step("done.csv", "done"), step("stopped.csv", "stopped")},
+	}
+	results := []*s3control.DescribeJobOutput{
+		{Job: &s3controltypes.JobDescriptor{Status: s3controltypes.JobStatusComplete}},
+		{Job: &s3controltypes.JobDescriptor{Status: s3controltypes.JobStatusFailed}},
+	}
+	assert.Equal(t, "src/bulk-copy-inventory/reports", *st.Steps[0].Input.Report.Prefix)
+
+	s3mig.moveCopiedObjects(context.TODO(), st, results)
+	assert.Equal(t, []string{"copied"}, m.deleted)
+	assert.Equal(t, &MoveSummary{Deleted: 1, Kept: 2}, s3mig.report.Move)
+	assert.True(t, st.Moved)
+	body, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "failed key,v2,kept\ncopied,v1,deleted\n", string(body))
+
+	// Nothing is deleted twice on resume
+	s3mig.moveCopiedObjects(context.TODO(), st, results)
+	assert.Len(t, m.deleted, 1)
+}
+
+func TestMoveSourcesWithoutCompletionReport(t *testing.T) {
+	m := &mock{objects: map[string]string{"done.csv": "src,copied\n"}}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/done.csv")})
+	results := []*s3control.DescribeJobOutput{{Job: &s3controltypes.JobDescriptor{Status: s3controltypes.JobStatusComplete}}}
+
+	_, err := s3mig.moveSources(context.TODO(), []*jobStep{{Input: input, JobID: "done"}}, results, "src", filepath.Join(t.TempDir(), "d.csv"))
+	assert.Error(t, err)
+	assert.Empty(t, m.deleted)
+}
+
+func TestMoveSourcesUnversioned(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	m := &mock{
+		objects: map[string]string{
+			"done.csv": "src,copied\nsrc,overwritten\nsrc,gone\n",
+			completionReportPrefix("src") + "/job-done/manifest.json": `{"Format":"Report_CSV_20180820","Results":[]}`,
+		},
+		heads: map[string]*s3.HeadObjectOutput{
+			"copied":      {LastModified: aws.Time(created.Add(-time.Hour))},
+			"overwritten": {LastModified: aws.Time(created.Add(time.Minute))},
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/done.csv")})
+	results := []*s3control.DescribeJobOutput{{Job: &s3controltypes.JobDescriptor{Status: s3controltypes.JobStatusComplete, CreationTime: aws.Time(created)}}}
+	reportPath := filepath.Join(t.TempDir(), "deletions.csv")
+
+	// An object overwritten, or deleted, after the job was created may not be the one copied, so it's kept
+	summary, err := s3mig.moveSources(context.TODO(), []*jobStep{{Input: input, JobID: "done"}}, results, "src", reportPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"copied"}, m.deleted)
+	assert.Equal(t, &MoveSummary{Deleted: 1, Modified: 2}, summary)
+	body, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "overwritten,,modified\ngone,,modified\ncopied,,deleted\n", string(body))
+}
+
+func TestEnableFailureReportPartition(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock), cfg: aws.Config{Region: "cn-north-1"}}
+	input := NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws-cn:s3:::src/manifest.csv")})
+	s3mig.enableFailureReport(input, "src")
+	assert.Equal(t, "arn:aws-cn:s3:::src", aws.ToString(input.Report.Bucket))
+}
@@ -0,0 +1,214 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"s3migration/util"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"go.uber.org/zap"
+)
+
+// Returned by copyNotifications when targets of the source's event notifications can't receive the destination's
+var errNotificationTargets = errors.New("event notification targets can't be used by the destination bucket")
+
+type notificationTargetsAPI interface {
+	// Resource policy of an SNS topic, SQS queue or Lambda function, empty when it has none.  Fails when the
+	// target doesn't exist.
+	ResourcePolicy(ctx context.Context, arn string) (string, error)
+}
+
+// SNS, SQS and Lambda clients reading the resource policies of notification targets, in each target's region
+type notificationTargets struct {
+	cfg aws.Config
+}
+
+func newNotificationTargets(cfg aws.Config) *notificationTargets {
+	return &notificationTargets{cfg: cfg}
+}
+
+func (n *notificationTargets) ResourcePolicy(ctx context.Context, arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 7)
+	if len(parts) < 6 {
+		return "", fmt.Errorf("invalid ARN %s", arn)
+	}
+	service, region, account, resource := parts[2], parts[3], parts[4], strings.Join(parts[5:], ":")
+	switch service {
+	case "sns":
+		client := sns.NewFromConfig(n.cfg, func(o *sns.Options) { o.Region = region })
+		out, err := client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(arn)})
+		if err != nil {
+			return "", err
+		}
+		return out.Attributes["Policy"], nil
+	case "sqs":
+		cfg := n.cfg.Copy()
+		cfg.Region = region
+		c := util.NewAWSJSONClient(cfg, service, service)
+		c.Headers["Content-Type"] = "application/x-amz-json-1.0"
+		var queue struct {
+			QueueUrl string `json:"QueueUrl"`
+		}
+		err := c.Do(ctx, http.MethodPost, "/", map[string]string{"X-Amz-Target": "AmazonSQS.GetQueueUrl"},
+			map[string]string{"QueueName": resource, "QueueOwnerAWSAccountId": account}, &queue)
+		if err != nil {
+			return "", err
+		}
+		var out struct {
+			Attributes map[string]string `json:"Attributes"`
+		}
+		err = c.Do(ctx, http.MethodPost, "/", map[string]string{"X-Amz-Target": "AmazonSQS.GetQueueAttributes"},
+			map[string]any{"QueueUrl": queue.QueueUrl, "AttributeNames": []string{"Policy"}}, &out)
+		if err != nil {
+			return "", err
+		}
+		return out.Attributes["Policy"], nil
+	case "lambda":
+		client := lambda.NewFromConfig(n.cfg, func(o *lambda.Options) { o.Region = region })
+		out, err := client.GetPolicy(ctx, &lambda.GetPolicyInput{FunctionName: aws.String(arn)})
+		if err != nil {
+			return "", err
+		}
+		return aws.ToString(out.Policy), nil
+	}
+	return "", fmt.Errorf("unsupported notification target %s", arn)
+}
+
+// Action S3 needs on a notification target of the service to deliver events to it
+func notificationAction(service string) string {
+	switch service {
+	case "sns":
+		return "sns:Publish"
+	case "sqs":
+		return "sqs:SendMessage"
+	}
+	return "lambda:InvokeFunction"
+}
+
+// Reports whether a target's resource policy lets S3 deliver the events of the bucket with the ARN.  Source
+// account conditions are only checked when the account is known, other conditions are assumed to be met.
+func allowsNotification(policy map[string]any, action, bucketArn, account string) bool {
+	for _, st := range policyStatements(policy) {
+		if st["Effect"] != "Allow" {
+			continue
+		}
+		principal, _ := st["Principal"].(map[string]any)
+		if st["Principal"] != "*" && !anyMatch(policyStrings(principal["Service"]), "s3.amazonaws.com") {
+			continue
+		}
+		if !anyMatch(policyStrings(st["Action"]), action) {
+			continue
+		}
+		condition, _ := st["Condition"].(map[string]any)
+		allowed := true
+		for _, op := range condition {
+			keys, _ := op.(map[string]any)
+			for key, values := range keys {
+				switch {
+				case strings.EqualFold(key, "aws:SourceArn"):
+					allowed = allowed && anyMatch(policyStrings(values), bucketArn)
+				case strings.EqualFold(key, "aws:SourceAccount") && account != "":
+					allowed = allowed && anyMatch(policyStrings(values), account)
+				}
+			}
+		}
+		if allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Reasons the destination bucket can't send events to the targets: S3 only sends them to targets in the
+// bucket's region whose resource policy allows it
+func (s3obj *s3migration) notificationTargetIssues(ctx context.Context, arns []string, destination, region, account string) []string {
+	issues := []string{}
+	partitionRegion := region
+	if partitionRegion == "" {
+		partitionRegion = s3obj.cfg.Region
+	}
+	bucketArn := *util.GetArn(partitionRegion, destination)
+	for _, arn := range arns {
+		parts := strings.Split(arn, ":")
+		if len(parts) < 6 {
+			issues = append(issues, fmt.Sprintf("%s is not a valid ARN", arn))
+			continue
+		}
+		if region != "" && parts[3] != region {
+			issues = append(issues, fmt.Sprintf("%s is in %s, the destination bucket in %s", arn, parts[3], region))
+			continue
+		}
+		body, err := s3obj.targets.ResourcePolicy(ctx, arn)
+		if err != nil {
+			issues = append(issues, fmt.Sprintf("%s doesn't exist or can't be read: %v", arn, err))
+			continue
+		}
+		policy := map[string]any{}
+		if body != "" {
+			if err := json.Unmarshal([]byte(body), &policy); err != nil {
+				issues = append(issues, fmt.Sprintf("%s has a malformed policy: %v", arn, err))
+				continue
+			}
+		}
+		if action := notificationAction(parts[2]); !allowsNotification(policy, action, bucketArn, account) {
+			issues = append(issues, fmt.Sprintf("%s policy doesn't allow s3.amazonaws.com %s from %s", arn, action, bucketArn))
+		}
+	}
+	return issues
+}
+
+// Copy the source bucket's event notifications once every SNS, SQS and Lambda target has been checked to
+// exist in the destination bucket's region and to accept its events, as S3 otherwise rejects the whole
+// configuration.  EventBridge delivery needs no target.
+func (s3obj *s3migration) copyNotifications(ctx context.Context, source, destination, account string) (string, error) {
+	out, err := s3obj.s3Client.GetBucketNotificationConfiguration(ctx, &s3.GetBucketNotificationConfigurationInput{Bucket: aws.String(source)})
+	if err != nil {
+		return "", err
+	}
+	arns := []string{}
+	for _, c := range out.TopicConfigurations {
+		arns = append(arns, aws.ToString(c.TopicArn))
+	}
+	for _, c := range out.QueueConfigurations {
+		arns = append(arns, aws.ToString(c.QueueArn))
+	}
+	for _, c := range out.LambdaFunctionConfigurations {
+		arns = append(arns, aws.ToString(c.LambdaFunctionArn))
+	}
+	if len(arns) == 0 && out.EventBridgeConfiguration == nil {
+		return settingAbsent, nil
+	}
+
+	region := ""
+	if head, err := s3obj.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(destination)}); err == nil {
+		region = aws.ToString(head.BucketRegion)
+	}
+	if issues := s3obj.notificationTargetIssues(ctx, arns, destination, region, account); len(issues) > 0 {
+		for _, issue := range issues {
+			zap.L().Warn("Event notification target can't be used by the destination bucket", zap.String("issue", issue))
+		}
+		return "", fmt.Errorf("%w: %s", errNotificationTargets, strings.Join(issues, "; "))
+	}
+
+	if _, err := s3obj.s3Client.PutBucketNotificationConfiguration(ctx, &s3.PutBucketNotificationConfigurationInput{
+		Bucket: aws.String(destination),
+		NotificationConfiguration: &s3types.NotificationConfiguration{
+			TopicConfigurations:          out.TopicConfigurations,
+			QueueConfigurations:          out.QueueConfigurations,
+			LambdaFunctionConfigurations: out.LambdaFunctionConfigurations,
+			EventBridgeConfiguration:     out.EventBridgeConfiguration,
+		},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied event notifications to destination bucket", zap.String("bucket", destination), zap.Int("targets", len(arns)))
+	return settingCopied, nil
+}
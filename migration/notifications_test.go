@@ -0,0 +1,97 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type targetsMock struct {
+	policies map[string]string // By ARN, missing targets don't exist
+}
+
+func (t *targetsMock) ResourcePolicy(ctx context.Context, arn string) (string, error) {
+	policy, ok := t.policies[arn]
+	if !ok {
+		return "", errors.New("NotFound")
+	}
+	return policy, nil
+}
+
+func TestCopyNotifications(t *testing.T) {
+	topic := "arn:aws:sns:us-east-1:111122223333:uploads"
+	queue := "arn:aws:sqs:us-east-1:111122223333:uploads"
+	m := &mock{notifications: &s3types.NotificationConfiguration{
+		TopicConfigurations: []s3types.TopicConfiguration{{TopicArn: aws.String(topic), Events: []s3types.Event{s3types.EventS3ObjectCreated}}},
+		QueueConfigurations: []s3types.QueueConfiguration{{QueueArn: aws.String(queue), Events: []s3types.Event{s3types.EventS3ObjectRemoved}}},
+	}}
+	targets := &targetsMock{policies: map[string]string{
+		// Still only allowing the source bucket
+		topic: `{"Statement": [{"Effect": "Allow", "Principal": {"Service": "s3.amazonaws.com"}, "Action": "SNS:Publish", "Resource": "*",
+		  "Condition": {"ArnLike": {"aws:SourceArn": "arn:aws:s3:::src"}}}]}`,
+		queue: `{"Statement": {"Effect": "Allow", "Principal": {"Service": ["s3.amazonaws.com"]}, "Action": "sqs:*", "Resource": "*",
+		  "Condition": {"StringEquals": {"aws:SourceAccount": "444455556666"}}}}`,
+	}}
+	s3mig := &s3migration{s3Client: m, targets: targets}
+
+	// Nothing is put while a target doesn't accept the destination's events
+	_, err := s3mig.copyNotifications(context.TODO(), "src", "dst", "444455556666")
+	assert.ErrorIs(t, err, errNotificationTargets)
+	assert.ErrorContains(t, err, topic+" policy doesn't allow s3.amazonaws.com sns:Publish from arn:aws:s3:::dst")
+	assert.NotContains(t, err.Error(), queue)
+	assert.Empty(t, m.bucketCalls)
+
+	targets.policies[topic] = `{"Statement": [{"Effect": "Allow", "Principal": {"Service": "s3.amazonaws.com"}, "Action": "SNS:Publish",
+	  "Condition": {"ArnLike": {"aws:SourceArn": ["arn:aws:s3:::src", "arn:aws:s3:::dst"]}}}]}`
+	outcome, err := s3mig.copyNotifications(context.TODO(), "src", "dst", "444455556666")
+	assert.NoError(t, err)
+	assert.Equal(t, settingCopied, outcome)
+	assert.Equal(t, []string{"PutBucketNotificationConfiguration dst"}, m.bucketCalls)
+
+	// The source account condition is checked against the account running the migration
+	issues := s3mig.notificationTargetIssues(context.TODO(), []string{queue}, "dst", "us-east-1", "777788889999")
+	assert.Len(t, issues, 1)
+	// Targets must be in the destination bucket's region and exist
+	issues = s3mig.notificationTargetIssues(context.TODO(), []string{topic, "arn:aws:lambda:eu-west-1:111122223333:function:gone"}, "dst", "eu-west-1", "")
+	assert.Equal(t, []string{
+		topic + " is in us-east-1, the destination bucket in eu-west-1",
+		"arn:aws:lambda:eu-west-1:111122223333:function:gone doesn't exist or can't be read: NotFound",
+	}, issues)
+
+	// Nothing to copy without notifications
+	m.notifications = nil
+	outcome, err = s3mig.copyNotifications(context.TODO(), "src", "dst", "")
+	assert.NoError(t, err)
+	assert.Equal(t, settingAbsent, outcome)
+}
+
+func TestNotificationTargetsTopicPolicy(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(b))
+		_, _ = w.Write([]byte(`<GetTopicAttributesResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/"><GetTopicAttributesResult><Attributes>
+		  <entry><key>Owner</key><value>111122223333</value></entry>
+		  <entry><key>Policy</key><value>{"Statement": []}</value></entry>
+		</Attributes></GetTopicAttributesResult></GetTopicAttributesResponse>`))
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", BaseEndpoint: aws.String(server.URL), Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})}
+	n := newNotificationTargets(cfg)
+	policy, err := n.ResourcePolicy(context.TODO(), "arn:aws:sns:us-west-2:111122223333:uploads")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"Statement": []}`, policy)
+	assert.Equal(t, "GetTopicAttributes", form.Get("Action"))
+	assert.Equal(t, "arn:aws:sns:us-west-2:111122223333:uploads", form.Get("TopicArn"))
+}
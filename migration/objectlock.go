@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
+)
+
+// Object Lock retention and legal hold of a source object.  A batch copy applies the same settings to
+// every object, so objects are grouped by their settings into one job each.
+type lockSettings struct {
+	Mode        s3types.ObjectLockMode
+	RetainUntil time.Time
+	LegalHold   bool
+}
+
+// Unlocked objects have the empty key, the others sort by mode, retain until date and legal hold
+func (l lockSettings) key() string {
+	if l.Mode == "" && !l.LegalHold {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %t", l.Mode, l.RetainUntil.Format(time.RFC3339), l.LegalHold)
+}
+
+// Read the lock settings from an object's headers.  Retention that has already expired isn't copied, as
+// a retain until date in the past is rejected.
+func lockOf(head *s3.HeadObjectOutput, now time.Time) lockSettings {
+	l := lockSettings{LegalHold: head.ObjectLockLegalHoldStatus == s3types.ObjectLockLegalHoldStatusOn}
+	if head.ObjectLockMode != "" && head.ObjectLockRetainUntilDate != nil && head.ObjectLockRetainUntilDate.After(now) {
+		l.Mode = head.ObjectLockMode
+		l.RetainUntil = head.ObjectLockRetainUntilDate.UTC()
+	}
+	return l
+}
+
+// Apply the lock settings to a copy operation
+func (l lockSettings) apply(op *s3controltypes.S3CopyObjectOperation) {
+	if l.Mode != "" {
+		op.ObjectLockMode = s3controltypes.S3ObjectLockMode(l.Mode)
+		op.ObjectLockRetainUntilDate = aws.Time(l.RetainUntil)
+	}
+	if l.LegalHold {
+		op.ObjectLockLegalHoldStatus = s3controltypes.S3ObjectLockLegalHoldStatusOn
+	}
+}
+
+// Object Lock can only be applied to copies in a bucket with Object Lock enabled
+func (s3obj *s3migration) checkObjectLockEnabled(ctx context.Context, bucket string) error {
+	out, err := s3obj.s3Client.GetObjectLockConfiguration(ctx, &s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		var ae smithy.APIError
+		if errors.As(err, &ae) && ae.ErrorCode() == "ObjectLockConfigurationNotFoundError" {
+			return fmt.Errorf("bucket %s does not have Object Lock enabled", bucket)
+		}
+		return err
+	}
+	if out.ObjectLockConfiguration == nil || out.ObjectLockConfiguration.ObjectLockEnabled != s3types.ObjectLockEnabledEnabled {
+		return fmt.Errorf("bucket %s does not have Object Lock enabled", bucket)
+	}
+	return nil
+}
+
+// HEAD an object for its lock settings
+func (s3obj *s3migration) headLock(now time.Time) settingReader {
+	return func(ctx context.Context, bucket, key, versionID string) (copySetting, error) {
+		input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+		if versionID != "" {
+			input.VersionId = aws.String(versionID)
+		}
+		head, err := s3obj.s3Client.HeadObject(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read Object Lock settings: %w", err)
+		}
+		return lockOf(head, now), nil
+	}
+}
+
+// Split each job by the Object Lock settings of its objects, so each copy job applies the retention and
+// legal hold of the objects it copies.  Jobs whose objects aren't locked are kept as they are.
+func (s3obj *s3migration) splitStepsByObjectLock(ctx context.Context, steps []*jobStep, concurrency int) ([]*jobStep, error) {
+	return s3obj.splitStepsBySetting(ctx, steps, concurrency, "lock", s3obj.headLock(time.Now()))
+}
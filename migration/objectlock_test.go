@@ -0,0 +1,106 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockOf(t *testing.T) {
+	now := time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC)
+	until := now.Add(24 * time.Hour)
+	assert.Equal(t, lockSettings{}, lockOf(&s3.HeadObjectOutput{}, now))
+	assert.Equal(t, lockSettings{Mode: s3types.ObjectLockModeCompliance, RetainUntil: until}, lockOf(&s3.HeadObjectOutput{
+		ObjectLockMode:            s3types.ObjectLockModeCompliance,
+		ObjectLockRetainUntilDate: aws.Time(until),
+	}, now))
+	// Expired retention isn't copied, a legal hold is
+	assert.Equal(t, lockSettings{LegalHold: true}, lockOf(&s3.HeadObjectOutput{
+		ObjectLockMode:            s3types.ObjectLockModeGovernance,
+		ObjectLockRetainUntilDate: aws.Time(now.Add(-time.Hour)),
+		ObjectLockLegalHoldStatus: s3types.ObjectLockLegalHoldStatusOn,
+	}, now))
+}
+
+func TestCheckObjectLockEnabled(t *testing.T) {
+	s3mig := &s3migration{s3Client: &mock{}}
+	assert.Error(t, s3mig.checkObjectLockEnabled(context.TODO(), "dst"))
+	s3mig = &s3migration{s3Client: &mock{objectLock: &s3types.ObjectLockConfiguration{ObjectLockEnabled: s3types.ObjectLockEnabledEnabled}}}
+	assert.NoError(t, s3mig.checkObjectLockEnabled(context.TODO(), "dst"))
+}
+
+func TestSplitStepsByObjectLock(t *testing.T) {
+	until := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	m := &mock{
+		objects: map[string]string{
+			"manifest.csv": "src,a\nsrc,b\nsrc,c\nsrc,d\n",
+			"plain.csv":    "src,a\n",
+		},
+		heads: map[string]*s3.HeadObjectOutput{
+			"a": {},
+			"b": {ObjectLockMode: s3types.ObjectLockModeCompliance, ObjectLockRetainUntilDate: aws.Time(until)},
+			"c": {ObjectLockLegalHoldStatus: s3types.ObjectLockLegalHoldStatusOn},
+			"d": {ObjectLockMode: s3types.ObjectLockModeCompliance, ObjectLockRetainUntilDate: aws.Time(until)},
+			// Uploaded manifests
+			"manifest-lock-001.csv": {ETag: aws.String("etag-1")},
+			"manifest-lock-002.csv": {ETag: aws.String("etag-2")},
+			"manifest-lock-003.csv": {ETag: aws.String("etag-3")},
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName:   aws.String("dst"),
+		ManifestArn:        aws.String("arn:aws:s3:::src/manifest.csv"),
+		VersioningDisabled: true,
+	})
+	plain := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName:   aws.String("dst"),
+		ManifestArn:        aws.String("arn:aws:s3:::src/plain.csv"),
+		VersioningDisabled: true,
+	})
+	steps := []*jobStep{{Kind: jobKindNonVersion, Input: input}, {Kind: jobKindNonVersion, Input: plain}}
+
+	split, err := s3mig.splitStepsByObjectLock(context.TODO(), steps, 2)
+	assert.NoError(t, err)
+	assert.Len(t, split, 4)
+
+	// Unlocked objects first, without lock settings
+	assert.Equal(t, "arn:aws:s3:::src/manifest-lock-001.csv", *split[0].Input.Manifest.Location.ObjectArn)
+	assert.Equal(t, "src,a\n", m.objects["manifest-lock-001.csv"])
+	assert.Empty(t, split[0].Input.Operation.S3PutObjectCopy.ObjectLockMode)
+	assert.Empty(t, split[0].Input.Operation.S3PutObjectCopy.ObjectLockLegalHoldStatus)
+	assert.Equal(t, "etag-1", *split[0].Input.Manifest.Location.ETag)
+
+	assert.Equal(t, "src,c\n", m.objects["manifest-lock-002.csv"])
+	assert.Equal(t, s3controltypes.S3ObjectLockLegalHoldStatusOn, split[1].Input.Operation.S3PutObjectCopy.ObjectLockLegalHoldStatus)
+
+	assert.Equal(t, "src,b\nsrc,d\n", m.objects["manifest-lock-003.csv"])
+	op := split[2].Input.Operation.S3PutObjectCopy
+	assert.Equal(t, s3controltypes.S3ObjectLockModeCompliance, op.ObjectLockMode)
+	assert.Equal(t, until, *op.ObjectLockRetainUntilDate)
+	assert.Empty(t, op.ObjectLockLegalHoldStatus)
+
+	// The original input is unchanged, and jobs without locked objects are kept as is
+	assert.Empty(t, input.Operation.S3PutObjectCopy.ObjectLockMode)
+	assert.Same(t, steps[1], split[3])
+}
+
+func TestSplitStepsByObjectLockHeadError(t *testing.T) {
+	m := &mock{
+		objects: map[string]string{"manifest.csv": "src,a\nsrc,missing\n"},
+		heads:   map[string]*s3.HeadObjectOutput{"a": {}},
+	}
+	s3mig := &s3migration{s3Client: m}
+	input := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName: aws.String("dst"),
+		ManifestArn:      aws.String("arn:aws:s3:::src/manifest.csv"),
+	})
+	_, err := s3mig.splitStepsByObjectLock(context.TODO(), []*jobStep{{Kind: jobKindVersion, Input: input}}, 1)
+	assert.Error(t, err)
+}
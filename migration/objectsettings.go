@@ -0,0 +1,145 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"s3migration/util"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Per-object settings, such as Object Lock or an ACL, that a batch copy can only apply to every object of
+// a job.  Objects with the same key share their settings, the empty key being the copy's defaults.
+type copySetting interface {
+	key() string
+	apply(op *s3controltypes.S3CopyObjectOperation)
+}
+
+// Reads the setting of the object referenced by a manifest row
+type settingReader func(ctx context.Context, bucket, key, versionID string) (copySetting, error)
+
+// Read the setting of every row with up to concurrency requests in flight
+func (s3obj *s3migration) readSettings(ctx context.Context, rows [][]string, concurrency int, read settingReader) ([]copySetting, error) {
+	if concurrency < 1 {
+		concurrency = defaultHeadConcurrency
+	}
+	settings := make([]copySetting, len(rows))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	work := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				setting, err := s3obj.readRowSetting(ctx, rows[i], read)
+				if err != nil {
+					once.Do(func() { firstErr = err; cancel() })
+					return
+				}
+				settings[i] = setting
+				s3obj.heartbeat.Beat()
+			}
+		}()
+	}
+	for i := range rows {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+	return settings, firstErr
+}
+
+// Read the setting of the object referenced by a manifest row (Bucket, Key[, VersionId])
+func (s3obj *s3migration) readRowSetting(ctx context.Context, row []string, read settingReader) (copySetting, error) {
+	if len(row) < 2 {
+		return nil, fmt.Errorf("invalid manifest row %v", row)
+	}
+	key, err := util.DecodeManifestKey(row[1])
+	if err != nil {
+		return nil, err
+	}
+	versionID := ""
+	if len(row) > 2 {
+		versionID = row[2]
+	}
+	return read(ctx, row[0], key, versionID)
+}
+
+// Split each job by the settings of its objects, so each copy job applies the settings of the objects it
+// copies.  The manifests are named after the job's with the suffix and a number.  Jobs whose objects all
+// have the default settings are kept as they are.
+func (s3obj *s3migration) splitStepsBySetting(ctx context.Context, steps []*jobStep, concurrency int, suffix string, read settingReader) ([]*jobStep, error) {
+	split := []*jobStep{}
+	for _, step := range steps {
+		rows, err := s3obj.readManifestRows(ctx, step.Input)
+		if err != nil {
+			return nil, err
+		}
+		settings, err := s3obj.readSettings(ctx, rows, concurrency, read)
+		if err != nil {
+			return nil, err
+		}
+		groups := map[string][][]string{}
+		bySetting := map[string]copySetting{}
+		for i, row := range rows {
+			k := settings[i].key()
+			groups[k] = append(groups[k], row)
+			bySetting[k] = settings[i]
+		}
+		if len(groups[""]) == len(rows) {
+			split = append(split, step)
+			continue
+		}
+
+		// Default settings first, then in key order so the plan is stable
+		keys := make([]string, 0, len(groups))
+		for k := range groups {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		manifestArn := *step.Input.Manifest.Location.ObjectArn
+		bucket, manifestKey, err := ParseObjectArn(manifestArn)
+		if err != nil {
+			return nil, err
+		}
+		for i, k := range keys {
+			key := fmt.Sprintf("%s-%s-%03d.csv", strings.TrimSuffix(manifestKey, ".csv"), suffix, i+1)
+			obj, uerr := s3obj.uploadRows(ctx, bucket, key, groups[k])
+			if uerr != nil {
+				return nil, uerr
+			}
+			input, cerr := cloneJobInput(step.Input)
+			if cerr != nil {
+				return nil, cerr
+			}
+			input.ClientRequestToken = aws.String(uuid.NewString())
+			input.Manifest.Location.ObjectArn = objectArnLike(manifestArn, bucket, key)
+			input.Manifest.Location.ETag = obj.ETag
+			bySetting[k].apply(input.Operation.S3PutObjectCopy)
+			split = append(split, &jobStep{Kind: step.Kind, Input: input})
+			zap.L().Info("Planned copy job for objects sharing settings",
+				zap.String("kind", step.Kind),
+				zap.String("manifest", key),
+				zap.Int("rows", len(groups[k])),
+				zap.String("settings", k),
+			)
+		}
+	}
+	return split, nil
+}
@@ -0,0 +1,144 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Plan export formats
+const (
+	PlanFormatAWSCLI = "awscli"
+	PlanFormatJSON   = "json" // PlanDocument
+)
+
+var PlanFormats = []string{PlanFormatAWSCLI, PlanFormatJSON}
+
+// Write the job plan recorded in a state file in the given format
+func ExportPlan(statePath, format string, w io.Writer) error {
+	st, err := loadRunState(statePath)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case PlanFormatAWSCLI:
+		return st.writeAWSCLIScript(w)
+	case PlanFormatJSON:
+		return st.writePlanJSON(w)
+	}
+	return fmt.Errorf("unsupported plan format '%s'", format)
+}
+
+// Write a shell script running the equivalent AWS CLI commands: verifying each manifest is the
+// one the plan was built from, then creating each job that has not been created yet, in order
+func (st *runState) writeAWSCLIScript(w io.Writer) error {
+	args := st.Args
+	fmt.Fprintf(w, "#!/bin/sh\n")
+	fmt.Fprintf(w, "# S3 migration plan exported from %s at %s\n", st.path, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "# Source bucket: %s, destination bucket: %s, jobs: %d\n", args.SourceBucket, args.DestinationBucket, len(st.Steps))
+	if len(st.Steps) > 1 {
+		fmt.Fprintf(w, "# Wait for each job to complete, and check its success ratio, before creating the next\n")
+	}
+	if r := st.Recommendation; r != nil {
+		fmt.Fprintf(w, "# Recommended engine: %s", r.Engine)
+		if r.Estimated > 0 {
+			fmt.Fprintf(w, ", estimated to take %s", r.Estimated)
+		}
+		fmt.Fprintf(w, "\n")
+		for _, reason := range r.Reasons {
+			fmt.Fprintf(w, "#   - %s\n", reason)
+		}
+	}
+	fmt.Fprintf(w, "set -eu\n")
+
+	for i, step := range st.Steps {
+		fmt.Fprintf(w, "\n# Job %d of %d: %s objects\n", i+1, len(st.Steps), step.Kind)
+		if step.Pass > 0 {
+			fmt.Fprintf(w, "# Version ordering pass %d, create once the previous pass completes\n", step.Pass)
+		}
+		if step.JobID != "" {
+			fmt.Fprintf(w, "# Already created as job %s\n", step.JobID)
+			fmt.Fprintf(w, "aws s3control describe-job --region %s --account-id %s --job-id %s\n",
+				shellQuote(args.SourceRegion), shellQuote(args.AccountID), shellQuote(step.JobID))
+			continue
+		}
+		if step.Input.Manifest == nil {
+			fmt.Fprintf(w, "# Manifest generated by S3 Batch Operations when the job is created\n")
+		} else if loc := step.Input.Manifest.Location; loc != nil && loc.ObjectArn != nil {
+			bucket, key, err := ParseObjectArn(*loc.ObjectArn)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "aws s3api head-object --region %s --bucket %s --key %s",
+				shellQuote(args.SourceRegion), shellQuote(bucket), shellQuote(key))
+			if loc.ETag != nil {
+				fmt.Fprintf(w, " --if-match %s", shellQuote(*loc.ETag))
+			}
+			fmt.Fprintf(w, " > /dev/null\n")
+		}
+		input, err := step.cliInput()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "aws s3control create-job --region %s --cli-input-json %s\n", shellQuote(args.SourceRegion), shellQuote(input))
+	}
+	if st.Deletes != nil && !st.Deletes.Replayed {
+		bucket := args.SourceBucket
+		if args.InventoryBucket != "" {
+			bucket = args.InventoryBucket
+		}
+		fmt.Fprintf(w, "\n# Once the jobs complete, replay the %d deletes listed in s3://%s/%s\n", st.Deletes.Count, bucket, st.Deletes.Key)
+		fmt.Fprintf(w, "# by deleting each key in %s, eg. with aws s3api delete-objects\n", args.DestinationBucket)
+	}
+	return nil
+}
+
+// The SDK input structs share member names with the API, so they only need unset members
+// removed to be accepted by --cli-input-json
+func cliInputJSON(in any) (string, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", err
+	}
+	body, err = json.Marshal(pruneUnset(doc))
+	return string(body), err
+}
+
+func pruneUnset(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			if e = pruneUnset(e); e == nil {
+				delete(t, k)
+			} else {
+				t[k] = e
+			}
+		}
+		if len(t) == 0 {
+			return nil
+		}
+	case []any:
+		if len(t) == 0 {
+			return nil
+		}
+		for i := range t {
+			t[i] = pruneUnset(t[i])
+		}
+	case string:
+		if t == "" {
+			return nil
+		}
+	}
+	return v
+}
+
+// Quote a value for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportPlanAWSCLI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	// The manifest's partition doesn't change how it is located
+	args := MigrationArgs{SourceRegion: "cn-north-1", AccountID: "111122223333", SourceBucket: "src", DestinationBucket: "dst"}
+	input := NewCreateJobInput(&batchJobArgs{
+		AccountId:        aws.String(args.AccountID),
+		RoleArn:          aws.String("arn:aws:iam::111122223333:role/somedummyrole"),
+		TargetBucketName: aws.String("dst"),
+		ManifestETag:     aws.String("etag"),
+		ManifestArn:      aws.String("arn:aws-cn:s3:::src/it's/manifest.csv"),
+	})
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: input, versionJobParam: input})
+	st.Steps[0].JobID = "created-job"
+	assert.NoError(t, st.save())
+
+	var out bytes.Buffer
+	assert.NoError(t, ExportPlan(path, PlanFormatAWSCLI, &out))
+	script := out.String()
+	assert.True(t, strings.HasPrefix(script, "#!/bin/sh\n"))
+	assert.Contains(t, script, "aws s3control describe-job --region 'cn-north-1' --account-id '111122223333' --job-id 'created-job'\n")
+	assert.Contains(t, script, `aws s3api head-object --region 'cn-north-1' --bucket 'src' --key 'it'\''s/manifest.csv' --if-match 'etag' > /dev/null`)
+	assert.Equal(t, 1, strings.Count(script, "aws s3control create-job"))
+	assert.Contains(t, script, `"ClientRequestToken":"`+*input.ClientRequestToken+`"`)
+	// Unset members must not be passed to the CLI
+	assert.NotContains(t, script, ":null")
+	assert.NotContains(t, script, `""`)
+
+	assert.Error(t, ExportPlan(path, "terraform", &out))
+}
+
+func TestExportPlanJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	args := MigrationArgs{SourceRegion: "us-gov-west-1", AccountID: "111122223333", SourceBucket: "src", DestinationBucket: "dst",
+		RoleArn: "arn:aws-us-gov:iam::111122223333:role/somedummyrole"}
+	input := NewCreateJobInput(&batchJobArgs{
+		AccountId:        aws.String(args.AccountID),
+		RoleArn:          aws.String(args.RoleArn),
+		TargetBucketName: aws.String("dst"),
+		ManifestETag:     aws.String("etag"),
+		ManifestArn:      aws.String("arn:aws-us-gov:s3:::src/manifests/manifest.csv"),
+	})
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: input})
+	st.Inventory = "s3://src/src/bulk-copy-inventory/manifest.json"
+	st.Expressions = []string{"SELECT s._1, s._2 FROM s3object s"}
+	st.Preflight = &PreflightResults{PermissionsChecked: true, Checks: []string{"ACLs are enabled on the destination bucket"}}
+	assert.NoError(t, st.save())
+
+	var out bytes.Buffer
+	assert.NoError(t, ExportPlan(path, PlanFormatJSON, &out))
+	var doc PlanDocument
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &doc))
+	assert.Equal(t, "src", doc.SourceBucket)
+	assert.Equal(t, st.Inventory, doc.Inventory)
+	assert.Equal(t, st.Expressions, doc.SelectExpressions)
+	assert.Equal(t, *st.Preflight, doc.Preflight)
+	assert.Len(t, doc.Jobs, 1)
+	assert.Equal(t, "s3://src/manifests/manifest.csv", doc.Jobs[0].Manifest)
+	assert.Equal(t, "etag", doc.Jobs[0].ManifestETag)
+
+	// The input is exactly what the AWS CLI export would create the job with
+	cliInput, err := st.Steps[0].cliInput()
+	assert.NoError(t, err)
+	assert.JSONEq(t, cliInput, string(doc.Jobs[0].CreateJobInput))
+}
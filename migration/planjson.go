@@ -0,0 +1,128 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+)
+
+// Results of the checks made before any job is created.  A failed check stops the run, except
+// for the role's permissions, so only the checks that passed are listed.
+type PreflightResults struct {
+	VersioningDisabled bool               `json:"versioningDisabled"`
+	RoleTrusted        *bool              `json:"roleTrusted,omitempty"` // Only checked by dry-run and run --plan
+	PermissionsChecked bool               `json:"permissionsChecked"`    // The role's permissions were simulated, see checkRolePermissions
+	DeniedPermissions  []DeniedPermission `json:"deniedPermissions,omitempty"`
+	Checks             []string           `json:"checks,omitempty"`
+	Cost               *CostEstimate      `json:"cost,omitempty"`
+}
+
+func (p *PreflightResults) passed(check string) {
+	p.Checks = append(p.Checks, check)
+}
+
+// A batch job of the plan, with the CreateJob input as accepted by aws s3control create-job --cli-input-json
+type PlannedJob struct {
+	Kind           string          `json:"kind"`
+	Pass           int             `json:"pass,omitempty"`
+	JobID          string          `json:"jobId,omitempty"`    // Already created
+	Manifest       string          `json:"manifest,omitempty"` // s3:// URI, empty when generated by S3 Batch Operations
+	ManifestETag   string          `json:"manifestETag,omitempty"`
+	CreateJobInput json.RawMessage `json:"createJobInput"`
+}
+
+// The fully resolved plan of a run, for reviewers to approve exactly what will execute
+type PlanDocument struct {
+	SourceBucket      string           `json:"sourceBucket"`
+	DestinationBucket string           `json:"destinationBucket,omitempty"`
+	RoleArn           string           `json:"roleArn"`
+	Inventory         string           `json:"inventory,omitempty"`         // s3:// URI of the inventory manifest the job manifests are filtered from
+	SelectExpressions []string         `json:"selectExpressions,omitempty"` // S3 Select expressions the job manifests are filtered with
+	Jobs              []PlannedJob     `json:"jobs"`
+	Preflight         PreflightResults `json:"preflight"`
+	Recommendation    *Recommendation  `json:"recommendation,omitempty"`
+}
+
+// The plan recorded in the state
+func (st *runState) planDocument() (*PlanDocument, error) {
+	doc := &PlanDocument{
+		SourceBucket:      st.Args.SourceBucket,
+		DestinationBucket: st.Args.DestinationBucket,
+		RoleArn:           st.Args.RoleArn,
+		Inventory:         st.Inventory,
+		SelectExpressions: st.Expressions,
+		Jobs:              []PlannedJob{},
+		Recommendation:    st.Recommendation,
+	}
+	if st.Preflight != nil {
+		doc.Preflight = *st.Preflight
+	}
+	for _, step := range st.Steps {
+		input, err := step.cliInput()
+		if err != nil {
+			return nil, err
+		}
+		job := PlannedJob{Kind: step.Kind, Pass: step.Pass, JobID: step.JobID, CreateJobInput: json.RawMessage(input)}
+		if step.Input.Manifest != nil && step.Input.Manifest.Location != nil {
+			loc := step.Input.Manifest.Location
+			if loc.ObjectArn != nil {
+				bucket, key, err := ParseObjectArn(*loc.ObjectArn)
+				if err != nil {
+					return nil, err
+				}
+				job.Manifest = fmt.Sprintf("s3://%s/%s", bucket, key)
+			}
+			if loc.ETag != nil {
+				job.ManifestETag = *loc.ETag
+			}
+		}
+		doc.Jobs = append(doc.Jobs, job)
+	}
+	return doc, nil
+}
+
+// The step's CreateJob input as --cli-input-json
+func (step *jobStep) cliInput() (string, error) {
+	var in any = step.Input
+	if step.Generator != nil {
+		// The CLI names the union member, where the SDK's union type marshals as "Value"
+		in = struct {
+			*s3control.CreateJobInput
+			ManifestGenerator map[string]any
+		}{step.Input, map[string]any{"S3JobManifestGenerator": step.Generator}}
+	}
+	return cliInputJSON(in)
+}
+
+func (st *runState) writePlanJSON(w io.Writer) error {
+	doc, err := st.planDocument()
+	if err != nil {
+		return err
+	}
+	return writePlanDocument(w, doc)
+}
+
+func writePlanDocument(w io.Writer, doc *PlanDocument) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Write the plan document to path, or stdout for "-", see --plan
+func writePlanFile(path string, doc *PlanDocument) error {
+	if path == "-" {
+		return writePlanDocument(os.Stdout, doc)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writePlanDocument(f, doc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
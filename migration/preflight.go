@@ -27,6 +27,9 @@ import (
 
 const (
 	s3BatchPrincipalSearch = "Statement.#(Principal.Service==\"batchoperations.s3.amazonaws.com\").Effect"
+
+	// Storage class of directory buckets, missing from the S3 Control SDK's enum
+	s3ExpressOneZone s3controltypes.S3StorageClass = "EXPRESS_ONEZONE"
 )
 
 // Use S3 Select to get just the bucket and key from a gzipped CSV generated by the inventory process
@@ -46,6 +49,7 @@ func (s3obj *s3migration) checkFilteredManifest(ctx context.Context, bucket stri
 	if err != nil {
 		return err
 	}
+	s3obj.expressions = append(s3obj.expressions, bucketAndKeyExpression)
 	rdr := s3obj.filterGzippedCsv(ctx, bucket, csvFile, bucketAndKeyExpression)
 	if len(localFile) > 0 {
 		f, ferr := os.OpenFile(localFile, os.O_RDWR|os.O_CREATE, 0600)
@@ -69,19 +73,11 @@ func (s3obj *s3migration) checkFilteredManifest(ctx context.Context, bucket stri
 	return nil
 }
 
-func checkRoleTrust(ctx context.Context, roleArn string) error {
+// Check the role's trust policy lets S3 Batch Operations assume it
+func checkRoleTrust(ctx context.Context, client iamRoleAPI, roleArn string) error {
 	// IAM API needs the bare role name, not the ARN
 	roleName := roleArn[strings.LastIndex(roleArn, "/")+1:]
 
-	// IAM is a global service hosted out of us-east-1.  Create a new config specific to said region
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion("us-east-1"))
-	if err != nil {
-		zap.L().Fatal(
-			"Failed to load AWS client config",
-			zap.Error(err),
-		)
-	}
-	client := iam.NewFromConfig(cfg)
 	out, ierr := client.GetRole(ctx, &iam.GetRoleInput{
 		RoleName: &roleName,
 	})
@@ -111,10 +107,26 @@ func checkRoleTrust(ctx context.Context, roleArn string) error {
 	return nil
 }
 
-// Check that roleArn exists and has trust relationship
-func DryRun(sourceRegion, accountID, sourceBucket, roleArn, configName, localFile string) error {
+// Arguments of a dry run
+type DryRunArgs struct {
+	SourceRegion      string
+	AccountID         string
+	SourceBucket      string
+	DestinationBucket string // Optional, used for the cost estimate and the role's destination permissions
+	RoleArn           string
+	ConfigName        string
+	LocalFile         string // File the filtered inventory is written to, instead of counting its lines
+	InventoryBucket   string
+	KmsID             string
+	PlanFile          string // File the resolved plan is written to as JSON, "-" for stdout, see PlanDocument
+}
+
+// Check that the role exists, has a trust relationship and the permissions the jobs need, and estimate the
+// cost of migrating the latest inventory.  Permissions the role is denied are logged as warnings and recorded in the plan.
+func DryRun(args DryRunArgs) error {
 	defer util.ZapLogSync()
 	ctx := context.Background()
+	sourceRegion, sourceBucket, configName := args.SourceRegion, args.SourceBucket, args.ConfigName
 
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(sourceRegion))
 	if err != nil {
@@ -125,12 +137,22 @@ func DryRun(sourceRegion, accountID, sourceBucket, roleArn, configName, localFil
 		)
 	}
 
-	err = checkRoleTrust(ctx, roleArn)
+	// IAM is global, the SDK resolves the endpoint of the region's partition, eg. iam.amazonaws.com
+	iamClient := iam.NewFromConfig(cfg)
+	err = checkRoleTrust(ctx, iamClient, args.RoleArn)
 	if err != nil {
 		zap.L().Fatal("Failed to check role trust", zap.Error(err))
 	}
 
-	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg)}
+	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg), inventoryBucket: args.InventoryBucket}
+	trusted := true
+	s3mig.preflight.RoleTrusted = &trusted
+	// The permissions of a copy run with the default arguments
+	if perr := s3mig.checkRolePermissions(ctx, iamClient, MigrationArgs{SourceRegion: sourceRegion, AccountID: args.AccountID,
+		SourceBucket: sourceBucket, DestinationBucket: args.DestinationBucket, RoleArn: args.RoleArn, KmsID: args.KmsID,
+		CannedACL: CannedACLAuto}); perr != nil {
+		zap.L().Warn("Batch jobs are likely to fail", zap.Error(perr))
+	}
 	versioningDisabled, verr := s3mig.isVersioningDisabled(ctx, sourceBucket)
 	if verr != nil {
 		zap.L().Fatal("Failed to get versioning status", zap.Error(verr))
@@ -139,8 +161,9 @@ func DryRun(sourceRegion, accountID, sourceBucket, roleArn, configName, localFil
 		zap.String("bucket", sourceBucket),
 		zap.Bool("disabled", versioningDisabled),
 	)
+	s3mig.preflight.VersioningDisabled = versioningDisabled
 
-	manifestArgs, invErr := s3mig.ensureS3InventoryConfig(ctx, sourceBucket, configName, false)
+	manifestArgs, invErr := s3mig.ensureS3InventoryConfig(ctx, sourceBucket, configName, false, "")
 	if invErr != nil {
 		zap.L().Fatal("Failed to get inventory config", zap.Error(invErr))
 	}
@@ -165,16 +188,38 @@ func DryRun(sourceRegion, accountID, sourceBucket, roleArn, configName, localFil
 		zap.L().Debug("Found inventory manifest, continuing with dry-run",
 			zap.Any("Manifest", manifestFile),
 		)
+		// Versioned buckets are copied by a job for non-current versions and one for latest versions
+		jobs := 2
+		if versioningDisabled {
+			jobs = 1
+		}
+		costArgs := MigrationArgs{SourceRegion: sourceRegion, AccountID: args.AccountID, DestinationBucket: args.DestinationBucket}
+		cost, cerr := s3mig.estimateInventoryCost(ctx, costArgs, manifestArgs.BucketName, *manifestFile, jobs)
+		if cerr != nil {
+			zap.L().Error("Unable to estimate the migration cost", zap.Error(cerr))
+		}
+		s3mig.preflight.Cost = cost
 	}
 
 	if versioningDisabled {
 		zap.L().Info("Inventory manifest versioning is disabled, filtering manifest file")
-		if err := s3mig.checkFilteredManifest(ctx, sourceBucket, *manifestFile, localFile); err != nil {
+		if err := s3mig.checkFilteredManifest(ctx, manifestArgs.BucketName, *manifestFile, args.LocalFile); err != nil {
 			zap.L().Error("Recoverable error during retrieval of latest inventory manifest",
 				zap.Error(err))
 		}
 	}
 
+	if args.PlanFile != "" {
+		// No job is planned, the plan holds what the checks resolved
+		doc := &PlanDocument{SourceBucket: sourceBucket, DestinationBucket: args.DestinationBucket, RoleArn: args.RoleArn,
+			SelectExpressions: s3mig.expressions, Jobs: []PlannedJob{}, Preflight: s3mig.preflight}
+		if manifestFile != nil && manifestFile.Key != nil {
+			doc.Inventory = fmt.Sprintf("s3://%s/%s", manifestArgs.BucketName, *manifestFile.Key)
+		}
+		if werr := writePlanFile(args.PlanFile, doc); werr != nil {
+			zap.L().Fatal("Failed to write the plan", zap.String("file", args.PlanFile), zap.Error(werr))
+		}
+	}
 	return nil
 
 }
@@ -220,6 +265,13 @@ func NewCreateJobInput(jobArgs *batchJobArgs) *s3control.CreateJobInput {
 		spec.Format = s3controltypes.JobManifestFormatS3BatchOperationsCsv20180820
 		spec.Fields = []s3controltypes.JobManifestFieldName{"Bucket", "Key"}
 	}
+	if len(jobArgs.ManifestFields) > 0 {
+		spec.Format = s3controltypes.JobManifestFormatS3BatchOperationsCsv20180820
+		spec.Fields = nil
+		for _, field := range jobArgs.ManifestFields {
+			spec.Fields = append(spec.Fields, s3controltypes.JobManifestFieldName(field))
+		}
+	}
 
 	input := &s3control.CreateJobInput{
 		AccountId: jobArgs.AccountId,
@@ -228,7 +280,7 @@ func NewCreateJobInput(jobArgs *batchJobArgs) *s3control.CreateJobInput {
 				BucketKeyEnabled:  true,
 				MetadataDirective: s3controltypes.S3MetadataDirectiveCopy,
 				StorageClass:      s3controltypes.S3StorageClassStandard,
-				TargetResource:    util.GetArn(*jobArgs.TargetBucketName),
+				TargetResource:    util.GetTargetArn(*jobArgs.TargetBucketName, jobArgs.TargetRegion, aws.ToString(jobArgs.AccountId)),
 			},
 		},
 		Manifest: &s3controltypes.JobManifest{
@@ -247,5 +299,9 @@ func NewCreateJobInput(jobArgs *batchJobArgs) *s3control.CreateJobInput {
 		ConfirmationRequired: aws.Bool(false),
 	}
 
+	// Directory buckets only have the S3 Express One Zone storage class
+	if util.IsDirectoryBucket(*jobArgs.TargetBucketName) {
+		input.Operation.S3PutObjectCopy.StorageClass = s3ExpressOneZone
+	}
 	return input
 }
@@ -0,0 +1,235 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Run statuses shown on the program dashboard
+const (
+	RunStatusPlanned        = "Planned"
+	RunStatusInProgress     = "In progress"
+	RunStatusComplete       = "Complete"
+	RunStatusBelowThreshold = "Below threshold"
+)
+
+// One run in a workspace, from its state file and, once it has completed, its report
+type ProgramRun struct {
+	StateFile         string
+	SourceBucket      string
+	DestinationBucket string
+	Status            string
+	JobsCreated       int
+	JobsPlanned       int
+	Total             int64
+	Succeeded         int64
+	Failed            int64
+	Bytes             int64
+	SuccessRatio      float32
+	RequiredRatio     float32
+	OutstandingRetry  int64 // Failed tasks plus objects estimated to have changed during the run
+	UpdatedAt         time.Time
+}
+
+// Totals across every run in a workspace
+type ProgramSummary struct {
+	GeneratedAt      time.Time
+	Runs             []ProgramRun
+	Statuses         map[string]int
+	Total            int64
+	Succeeded        int64
+	Failed           int64
+	Bytes            int64
+	OutstandingRetry int64
+}
+
+// Load every run recorded in dir, ie. the *.state.json files written by run, with the
+// report each run wrote to --report-file when it's still present.  Relative report paths
+// are resolved against dir, where the runs are expected to have been started from.
+func loadProgram(dir string) (*ProgramSummary, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.state.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	summary := &ProgramSummary{GeneratedAt: time.Now(), Statuses: map[string]int{}}
+	for _, path := range paths {
+		st, serr := loadRunState(path)
+		if serr != nil {
+			zap.L().Warn("Skipping unreadable state file", zap.String("file", path), zap.Error(serr))
+			continue
+		}
+		run := ProgramRun{
+			StateFile:         filepath.Base(path),
+			SourceBucket:      st.Args.SourceBucket,
+			DestinationBucket: st.Args.DestinationBucket,
+			Status:            RunStatusPlanned,
+			JobsPlanned:       len(st.Steps),
+			RequiredRatio:     st.Args.ReqSuccessThreshold,
+			UpdatedAt:         st.UpdatedAt,
+		}
+		for _, step := range st.Steps {
+			if step.JobID != "" {
+				run.JobsCreated++
+				run.Status = RunStatusInProgress
+			}
+		}
+
+		report, rerr := loadReport(dir, st.Args.ReportFile)
+		if rerr != nil {
+			zap.L().Warn("Skipping unreadable report", zap.String("file", st.Args.ReportFile), zap.Error(rerr))
+		}
+		if report != nil {
+			run.Status = RunStatusBelowThreshold
+			if report.ThresholdMet {
+				run.Status = RunStatusComplete
+			}
+			for _, job := range report.Jobs {
+				run.Total += job.Total
+				run.Succeeded += job.Succeeded
+				run.Failed += job.Failed
+			}
+			run.Bytes = report.Bytes
+			run.SuccessRatio = report.SuccessRatio
+			run.OutstandingRetry = run.Failed
+			if report.Drift != nil {
+				run.OutstandingRetry += int64(report.Drift.EstimatedChanged)
+			}
+			run.UpdatedAt = report.CompletedAt
+		}
+
+		summary.Runs = append(summary.Runs, run)
+		summary.Statuses[run.Status]++
+		summary.Total += run.Total
+		summary.Succeeded += run.Succeeded
+		summary.Failed += run.Failed
+		summary.Bytes += run.Bytes
+		summary.OutstandingRetry += run.OutstandingRetry
+	}
+	return summary, nil
+}
+
+// Read a run's report, returning nil when the run has no report file or it hasn't been written yet
+func loadReport(dir, path string) (*Report, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	return report, json.Unmarshal(body, report)
+}
+
+// Format a byte count with a binary unit, eg. 1.5 GiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Formatting shared by the HTML pages
+var templateFuncs = template.FuncMap{
+	"bytes": func(n int64) string {
+		if n == 0 {
+			return "-"
+		}
+		return formatBytes(n)
+	},
+	"percent": func(r float32) string { return fmt.Sprintf("%.1f%%", r*100) },
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02 15:04 UTC")
+	},
+}
+
+var programTemplate = template.Must(template.New("program").Funcs(templateFuncs).Funcs(template.FuncMap{
+	"statuses": func() []string {
+		return []string{RunStatusComplete, RunStatusInProgress, RunStatusPlanned, RunStatusBelowThreshold}
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>S3 migration program</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em 0.6em; text-align: left; }
+td.n { text-align: right; }
+.tiles { display: flex; gap: 1em; margin-bottom: 2em; }
+.tile { border: 1px solid #ddd; border-radius: 4px; padding: 0.8em 1.2em; }
+.tile b { display: block; font-size: 1.6em; }
+.Complete { color: #1a7f37; }
+.Below.threshold { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>S3 migration program</h1>
+<p>{{len .Runs}} runs, generated {{time .GeneratedAt}}</p>
+<div class="tiles">
+{{- range statuses}}
+<div class="tile"><b>{{index $.Statuses .}}</b>{{.}}</div>
+{{- end}}
+<div class="tile"><b>{{.Succeeded}} / {{.Total}}</b>objects copied</div>
+<div class="tile"><b>{{bytes .Bytes}}</b>inventory bytes</div>
+<div class="tile"><b>{{.OutstandingRetry}}</b>outstanding retries</div>
+</div>
+<table>
+<tr><th>Source</th><th>Destination</th><th>Status</th><th>Jobs</th><th>Succeeded</th><th>Failed</th><th>Bytes</th><th>Success ratio</th><th>Required</th><th>Outstanding retries</th><th>Updated</th><th>State file</th></tr>
+{{- range .Runs}}
+<tr>
+<td>{{.SourceBucket}}</td>
+<td>{{.DestinationBucket}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td class="n">{{.JobsCreated}} / {{.JobsPlanned}}</td>
+<td class="n">{{.Succeeded}} / {{.Total}}</td>
+<td class="n">{{.Failed}}</td>
+<td class="n">{{bytes .Bytes}}</td>
+<td class="n">{{if .Total}}{{percent .SuccessRatio}}{{else}}-{{end}}</td>
+<td class="n">{{percent .RequiredRatio}}</td>
+<td class="n">{{.OutstandingRetry}}</td>
+<td>{{time .UpdatedAt}}</td>
+<td>{{.StateFile}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// Write a single page HTML dashboard summarizing every run recorded in the workspace dir
+func WriteProgramDashboard(dir string, w io.Writer) error {
+	summary, err := loadProgram(dir)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Summarized migration program", zap.String("dir", dir), zap.Int("runs", len(summary.Runs)))
+	return programTemplate.Execute(w, summary)
+}
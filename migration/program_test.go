@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgramDashboard(t *testing.T) {
+	dir := t.TempDir()
+	newState := func(src string, args MigrationArgs, jobIDs ...string) {
+		args.SourceBucket, args.DestinationBucket, args.ReqSuccessThreshold = src, "dst", 0.8
+		st := newRunState(filepath.Join(dir, "s3migration-"+src+".state.json"), args,
+			&jobInputParams{nonVersionJobParam: &s3control.CreateJobInput{}, versionJobParam: &s3control.CreateJobInput{}})
+		for i, id := range jobIDs {
+			st.Steps[i].JobID = id
+		}
+		assert.NoError(t, st.save())
+	}
+	newState("planned", MigrationArgs{})
+	newState("running", MigrationArgs{ReportFile: "running.report.json"}, "job-1")
+	newState("done", MigrationArgs{ReportFile: "done.report.json"}, "job-2", "job-3")
+	report, _ := json.Marshal(&Report{
+		Jobs:         []JobSummary{{Total: 10, Succeeded: 9, Failed: 1}, {Total: 5, Succeeded: 5}},
+		SuccessRatio: 0.9,
+		ThresholdMet: true,
+		Bytes:        3 << 30,
+		Drift:        &DriftSummary{EstimatedChanged: 2},
+	})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "done.report.json"), report, 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.state.json"), []byte("{"), 0600))
+
+	summary, err := loadProgram(dir)
+	assert.NoError(t, err)
+	assert.Len(t, summary.Runs, 3)
+	statuses := map[string]string{}
+	for _, run := range summary.Runs {
+		statuses[run.SourceBucket] = run.Status
+	}
+	assert.Equal(t, map[string]string{"planned": RunStatusPlanned, "running": RunStatusInProgress, "done": RunStatusComplete}, statuses)
+	assert.Equal(t, int64(15), summary.Total)
+	assert.Equal(t, int64(3), summary.OutstandingRetry)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteProgramDashboard(dir, &out))
+	page := out.String()
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.Contains(t, page, "<td>done</td>")
+	assert.Contains(t, page, "3.0 GiB")
+	assert.Contains(t, page, "14 / 15")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 TiB", formatBytes(2<<40))
+}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"s3migration/util"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+)
+
+// Operations retried while polling, see progressMetrics.retry
+const (
+	retryDescribeJob       = "describe-job"
+	retryInventoryManifest = "inventory-manifest"
+)
+
+// Prometheus metric names and help
+const (
+	metricJobTasks          = "s3migration_job_tasks"
+	metricJobsCreated       = "s3migration_jobs_created_total"
+	metricJobsCompleted     = "s3migration_jobs_completed_total"
+	metricRetries           = "s3migration_retries_total"
+	metricBytesCopied       = "s3migration_bytes_copied_total"
+	metricSuccessRatio      = "s3migration_success_ratio"
+	metricJobTasksHelp      = "Tasks of a batch job by result: total, succeeded or failed"
+	metricJobsCreatedHelp   = "Batch jobs created"
+	metricJobsCompletedHelp = "Batch jobs that reached a terminal status, by status"
+	metricRetriesHelp       = "Retries of throttled job status checks and of waits for an inventory manifest, by operation"
+	metricBytesCopiedHelp   = "Bytes copied by completed jobs, estimated from the inventory when split into chunks"
+	metricSuccessRatioHelp  = "Success ratio of the completed run"
+)
+
+// Job progress, retries and bytes copied of a run, served on /metrics by the health endpoint.  Every
+// series is labelled with the run's buckets, so several runs can be scraped into one fleet-wide view.
+// A nil progressMetrics does nothing.
+type progressMetrics struct {
+	registry *util.Metrics
+	buckets  util.Labels
+}
+
+func newProgressMetrics(args MigrationArgs) *progressMetrics {
+	return &progressMetrics{
+		registry: util.DefaultMetrics,
+		buckets:  util.Labels{"source_bucket": args.SourceBucket, "destination_bucket": args.DestinationBucket},
+	}
+}
+
+// The run's bucket labels plus the given ones
+func (p *progressMetrics) labels(extra util.Labels) util.Labels {
+	labels := util.Labels{}
+	for k, v := range p.buckets {
+		labels[k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (p *progressMetrics) jobCreated() {
+	if p == nil {
+		return
+	}
+	p.registry.Add(metricJobsCreated, metricJobsCreatedHelp, p.labels(nil), 1)
+}
+
+// Record a job's task counts from its status
+func (p *progressMetrics) jobProgress(job *s3control.DescribeJobOutput) {
+	if p == nil || job == nil || job.Job == nil || job.Job.ProgressSummary == nil {
+		return
+	}
+	ps := job.Job.ProgressSummary
+	for result, value := range map[string]*int64{
+		"total":     ps.TotalNumberOfTasks,
+		"succeeded": ps.NumberOfTasksSucceeded,
+		"failed":    ps.NumberOfTasksFailed,
+	} {
+		labels := p.labels(util.Labels{"job_id": aws.ToString(job.Job.JobId), "result": result})
+		p.registry.Set(metricJobTasks, metricJobTasksHelp, labels, float64(aws.ToInt64(value)))
+	}
+}
+
+// Record a job reaching a terminal status.  bytes is the job's estimated size, zero when unknown.
+func (p *progressMetrics) jobCompleted(job *s3control.DescribeJobOutput, bytes int64) {
+	if p == nil || job == nil || job.Job == nil {
+		return
+	}
+	p.jobProgress(job)
+	p.registry.Add(metricJobsCompleted, metricJobsCompletedHelp, p.labels(util.Labels{"status": string(job.Job.Status)}), 1)
+	if ps := job.Job.ProgressSummary; ps != nil && bytes > 0 && aws.ToInt64(ps.TotalNumberOfTasks) > 0 {
+		copied := float64(bytes) * float64(aws.ToInt64(ps.NumberOfTasksSucceeded)) / float64(aws.ToInt64(ps.TotalNumberOfTasks))
+		p.registry.Add(metricBytesCopied, metricBytesCopiedHelp, p.labels(nil), copied)
+	}
+}
+
+func (p *progressMetrics) retry(operation string) {
+	if p == nil {
+		return
+	}
+	p.registry.Add(metricRetries, metricRetriesHelp, p.labels(util.Labels{"operation": operation}), 1)
+}
+
+func (p *progressMetrics) runCompleted(successRatio float32) {
+	if p == nil {
+		return
+	}
+	// Round trip through the shortest float32 text, so 0.9 isn't served as 0.8999999761581421
+	ratio, _ := strconv.ParseFloat(strconv.FormatFloat(float64(successRatio), 'g', -1, 32), 64)
+	p.registry.Set(metricSuccessRatio, metricSuccessRatioHelp, p.labels(nil), ratio)
+}
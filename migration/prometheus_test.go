@@ -0,0 +1,45 @@
+package migration
+
+import (
+	"net/http/httptest"
+	"s3migration/util"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressMetrics(t *testing.T) {
+	var none *progressMetrics
+	none.jobCreated()
+	none.retry(retryDescribeJob)
+
+	p := newProgressMetrics(MigrationArgs{SourceBucket: "src", DestinationBucket: "dst"})
+	p.registry = util.NewMetrics()
+	p.jobCreated()
+	p.retry(retryDescribeJob)
+	p.retry(retryDescribeJob)
+	p.jobCompleted(&s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:  aws.String("job"),
+		Status: s3controltypes.JobStatusComplete,
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(10),
+			NumberOfTasksSucceeded: aws.Int64(9),
+			NumberOfTasksFailed:    aws.Int64(1),
+		},
+	}}, 1000)
+	p.runCompleted(0.9)
+
+	rec := httptest.NewRecorder()
+	p.registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	buckets := `destination_bucket="dst",`
+	assert.Contains(t, body, `s3migration_jobs_created_total{`+buckets+`source_bucket="src"} 1`)
+	assert.Contains(t, body, `s3migration_retries_total{`+buckets+`operation="describe-job",source_bucket="src"} 2`)
+	assert.Contains(t, body, `s3migration_job_tasks{`+buckets+`job_id="job",result="failed",source_bucket="src"} 1`)
+	assert.Contains(t, body, `s3migration_jobs_completed_total{`+buckets+`source_bucket="src",status="Complete"} 1`)
+	assert.Contains(t, body, `s3migration_bytes_copied_total{`+buckets+`source_bucket="src"} 900`)
+	assert.Contains(t, body, `s3migration_success_ratio{`+buckets+`source_bucket="src"} 0.9`)
+}
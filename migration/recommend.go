@@ -0,0 +1,200 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+// Engines a migration can be run with
+const (
+	EngineBatchCopy         = "batch-copy"               // S3 Batch Operations copy from a filtered manifest, this tool's default
+	EngineManifestGenerator = "batch-manifest-generator" // S3 Batch Operations copy with a generated manifest, see --manifest-generator
+	EngineClient            = "client"                   // Copy from a single host, eg. aws s3 sync
+	EngineDataSync          = "datasync"                 // AWS DataSync task between the buckets
+)
+
+// Rough planning throughputs for each engine, per second.  They only need to rank the engines and give
+// the order of magnitude of a migration's duration.
+var engineThroughput = map[string]struct {
+	Objects     float64
+	Bytes       float64
+	CrossRegion float64 // Factor applied to Bytes when the buckets are in different regions
+}{
+	EngineBatchCopy:         {Objects: 1000, Bytes: 2 << 30, CrossRegion: 0.5},
+	EngineManifestGenerator: {Objects: 1000, Bytes: 2 << 30, CrossRegion: 0.5},
+	EngineClient:            {Objects: 100, Bytes: 250 << 20, CrossRegion: 0.5},
+	EngineDataSync:          {Objects: 300, Bytes: 1250 << 20, CrossRegion: 1},
+}
+
+// Thresholds steering the recommendation
+const (
+	batchCopyMaxObjectSize = 5 << 30   // CopyObject, and so a batch copy, is limited to 5 GB objects
+	clientMaxObjects       = 10000     // Up to this many objects, and clientMaxBytes, a batch job's setup isn't worth it
+	clientMaxBytes         = 10 << 30  // See clientMaxObjects
+	dataSyncMinAvgSize     = 256 << 20 // Cross-region objects this large on average are bandwidth bound
+	listingMaxObjects      = 10000000  // Beyond this, listing the source takes hours
+)
+
+// What is known about the migration when it is planned
+type planProfile struct {
+	Objects      int64 // Objects to copy, 0 when unknown
+	Bytes        int64 // Bytes to copy, 0 when unknown
+	CrossRegion  bool
+	CrossAccount bool
+	Listed       bool          // Manifests were built by listing the source bucket
+	Timeline     time.Duration // Time the migration must complete in, 0 when there is no deadline
+}
+
+// Engine suggested for a migration, recorded in the plan
+type Recommendation struct {
+	Engine    string        `json:"engine"`
+	Estimated time.Duration `json:"estimated,omitempty"` // Estimated duration with the engine, 0 when the size is unknown
+	Reasons   []string      `json:"reasons"`
+}
+
+// Estimated time for an engine to copy the profiled objects
+func (p planProfile) estimate(engine string) time.Duration {
+	rate := engineThroughput[engine]
+	bytes := rate.Bytes
+	if p.CrossRegion {
+		bytes *= rate.CrossRegion
+	}
+	seconds := float64(p.Objects)/rate.Objects + float64(p.Bytes)/bytes
+	return max(time.Duration(seconds*float64(time.Second)).Round(time.Minute), time.Minute)
+}
+
+// Suggest the engine best suited to the profiled migration, with the reasons for the choice
+func recommendEngine(p planProfile) *Recommendation {
+	var avg int64
+	if p.Objects > 0 {
+		avg = p.Bytes / p.Objects
+	}
+	r := &Recommendation{Engine: EngineBatchCopy}
+	switch {
+	case avg > batchCopyMaxObjectSize:
+		r.Engine = EngineDataSync
+		r.Reasons = append(r.Reasons, fmt.Sprintf("the average object size, %s, is over the 5 GB limit of a batch copy", formatBytes(avg)))
+	case p.Objects > 0 && p.Objects <= clientMaxObjects && p.Bytes <= clientMaxBytes && !p.CrossAccount:
+		r.Engine = EngineClient
+		r.Reasons = append(r.Reasons, fmt.Sprintf("%d objects are copied from a single host in minutes, without the setup and per-job fee of S3 Batch Operations", p.Objects))
+	case p.CrossRegion && avg >= dataSyncMinAvgSize:
+		r.Engine = EngineDataSync
+		r.Reasons = append(r.Reasons, fmt.Sprintf("cross-region copies of large objects, %s on average, are bound by bandwidth which DataSync manages", formatBytes(avg)))
+	case p.Listed && p.Objects > listingMaxObjects:
+		r.Engine = EngineManifestGenerator
+		r.Reasons = append(r.Reasons, fmt.Sprintf("listing %d objects takes hours, S3 Batch Operations can generate the manifest instead", p.Objects))
+	default:
+		if p.Objects == 0 {
+			r.Reasons = append(r.Reasons, "the number of objects is unknown, and S3 Batch Operations scales to any number")
+		} else {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("S3 Batch Operations copies %d objects in parallel without a host to run", p.Objects))
+		}
+	}
+	if p.CrossAccount && r.Engine != EngineClient {
+		r.Reasons = append(r.Reasons, "the destination is in another account, so the copy runs with a role rather than credentials for both accounts")
+	}
+	if p.Objects == 0 {
+		return r
+	}
+
+	r.Estimated = p.estimate(r.Engine)
+	if p.Timeline > 0 && r.Estimated > p.Timeline {
+		// Fall back to the fastest engine able to copy the objects
+		engines := []string{EngineBatchCopy, EngineManifestGenerator, EngineClient, EngineDataSync}
+		if avg > batchCopyMaxObjectSize {
+			engines = []string{EngineClient, EngineDataSync}
+		}
+		fastest := slices.MinFunc(engines, func(a, b string) int { return int(p.estimate(a) - p.estimate(b)) })
+		if fastest != r.Engine {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("%s would take about %s, longer than the %s timeline", r.Engine, r.Estimated, p.Timeline))
+			r.Engine = fastest
+			r.Estimated = p.estimate(fastest)
+		}
+		if r.Estimated > p.Timeline {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("no engine is expected to meet the %s timeline, consider splitting the migration", p.Timeline))
+		}
+	}
+	return r
+}
+
+// Find whether the destination bucket is in another region, and whether it's owned by another account
+func (s3obj *s3migration) destinationTopology(ctx context.Context, args MigrationArgs) (crossRegion, crossAccount bool, err error) {
+	region, err := manager.GetBucketRegion(ctx, s3obj.s3Client, args.DestinationBucket)
+	if err != nil {
+		return false, false, err
+	}
+	_, err = s3obj.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket:              aws.String(args.DestinationBucket),
+		ExpectedBucketOwner: aws.String(args.AccountID),
+	})
+	// The region is unknown when the tool runs with the default region
+	crossRegion = args.SourceRegion != "" && region != "" && region != args.SourceRegion
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) && re.HTTPStatusCode() == http.StatusForbidden {
+		return crossRegion, true, nil
+	}
+	return crossRegion, false, err
+}
+
+// Profile the planned migration and recommend an engine for it.  Bytes are only known when the
+// manifests were filtered from inventory, and are the size of the objects the filters selected.
+func (s3obj *s3migration) recommend(ctx context.Context, args MigrationArgs, st *runState) *Recommendation {
+	p := planProfile{Listed: args.ListMode, Timeline: args.Timeline}
+	if s3obj.report != nil {
+		p.Bytes = s3obj.report.Bytes
+	}
+	for _, step := range st.Steps {
+		if step.Input.Manifest == nil {
+			// Generated manifests are only known once the job runs
+			p.Objects, p.Bytes = 0, 0
+			break
+		}
+		rows, err := s3obj.countManifestRows(ctx, step)
+		if err != nil {
+			zap.L().Warn("Unable to count manifest objects for the engine recommendation", zap.Error(err))
+			p.Objects, p.Bytes = 0, 0
+			break
+		}
+		p.Objects += rows
+	}
+	var err error
+	if p.CrossRegion, p.CrossAccount, err = s3obj.destinationTopology(ctx, args); err != nil {
+		zap.L().Warn("Unable to find the destination bucket's region and owner for the engine recommendation", zap.Error(err))
+	}
+
+	r := recommendEngine(p)
+	zap.L().Info("Recommended migration engine",
+		zap.String("engine", r.Engine),
+		zap.Duration("estimated", r.Estimated),
+		zap.Strings("reasons", r.Reasons),
+		zap.Int64("objects", p.Objects),
+		zap.Int64("bytes", p.Bytes),
+		zap.Bool("crossRegion", p.CrossRegion),
+		zap.Bool("crossAccount", p.CrossAccount),
+	)
+	return r
+}
+
+func (s3obj *s3migration) countManifestRows(ctx context.Context, step *jobStep) (int64, error) {
+	bucket, key, err := ParseObjectArn(*step.Input.Manifest.Location.ObjectArn)
+	if err != nil {
+		return 0, err
+	}
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return 0, err
+	}
+	defer out.Body.Close()
+	count, err := LineCounter(out.Body)
+	return int64(count), err
+}
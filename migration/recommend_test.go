@@ -0,0 +1,97 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile planProfile
+		want    string
+	}{
+		{"unknown size", planProfile{}, EngineBatchCopy},
+		{"small", planProfile{Objects: 500, Bytes: 1 << 30}, EngineClient},
+		{"small cross-account", planProfile{Objects: 500, Bytes: 1 << 30, CrossAccount: true}, EngineBatchCopy},
+		{"many objects", planProfile{Objects: 5000000, Bytes: 5 << 40}, EngineBatchCopy},
+		{"over the copy limit", planProfile{Objects: 100, Bytes: 100 * (6 << 30)}, EngineDataSync},
+		{"large objects cross-region", planProfile{Objects: 100000, Bytes: 100000 * (512 << 20), CrossRegion: true}, EngineDataSync},
+		{"large objects same region", planProfile{Objects: 100000, Bytes: 100000 * (512 << 20)}, EngineBatchCopy},
+		{"large listing", planProfile{Objects: 50000000, Bytes: 50 << 40, Listed: true}, EngineManifestGenerator},
+	}
+	for _, tt := range tests {
+		r := recommendEngine(tt.profile)
+		assert.Equal(t, tt.want, r.Engine, tt.name)
+		assert.NotEmpty(t, r.Reasons, tt.name)
+		assert.Equal(t, tt.profile.Objects == 0, r.Estimated == 0, tt.name)
+	}
+}
+
+func TestRecommendEngineTimeline(t *testing.T) {
+	// 200 TiB of large objects in the same region is bandwidth bound, where a batch copy is fastest
+	p := planProfile{Objects: 1000000, Bytes: 200 << 40}
+	r := recommendEngine(p)
+	assert.Equal(t, EngineBatchCopy, r.Engine)
+
+	p.Timeline = r.Estimated / 2
+	r = recommendEngine(p)
+	assert.Equal(t, EngineBatchCopy, r.Engine)
+	assert.Contains(t, r.Reasons[len(r.Reasons)-1], "no engine is expected to meet")
+
+	// Too slow from a single host, so the faster batch copy is suggested instead
+	p = planProfile{Objects: 10000, Bytes: 10 << 30, Timeline: 90 * time.Second}
+	assert.Greater(t, p.estimate(EngineClient), p.Timeline)
+	r = recommendEngine(p)
+	assert.Equal(t, EngineBatchCopy, r.Engine)
+	assert.Contains(t, r.Reasons[1], "client would take about 2m0s")
+	assert.Len(t, r.Reasons, 2)
+}
+
+func TestDestinationTopology(t *testing.T) {
+	args := MigrationArgs{SourceRegion: "us-east-1", AccountID: "111122223333", DestinationBucket: "dst"}
+	s3mig := &s3migration{s3Client: &mock{}}
+	crossRegion, crossAccount, err := s3mig.destinationTopology(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.False(t, crossRegion)
+	assert.False(t, crossAccount)
+
+	// A bucket owned by another account fails the expected bucket owner check
+	forbidden := &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusForbidden}},
+	}}
+	s3mig = &s3migration{s3Client: &mock{headBucketErr: forbidden}}
+	_, crossAccount, err = s3mig.destinationTopology(context.TODO(), args)
+	assert.NoError(t, err)
+	assert.True(t, crossAccount)
+}
+
+func TestRecommendInPlanExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	args := MigrationArgs{SourceRegion: "us-east-1", AccountID: "111122223333", SourceBucket: "src", DestinationBucket: "dst", PlanOnly: true}
+	input := NewCreateJobInput(&batchJobArgs{
+		TargetBucketName: aws.String("dst"),
+		ManifestArn:      aws.String("arn:aws:s3:::src/manifest.csv"),
+	})
+	s3mig := &s3migration{
+		s3Client: &mock{objects: map[string]string{"manifest.csv": "src,a\nsrc,b\nsrc,c\n"}},
+		report:   &Report{Bytes: 3 << 20},
+	}
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: input})
+	st.Recommendation = s3mig.recommend(context.TODO(), args, st)
+	assert.Equal(t, EngineClient, st.Recommendation.Engine)
+	assert.NoError(t, st.save())
+
+	var out bytes.Buffer
+	assert.NoError(t, ExportPlan(path, PlanFormatAWSCLI, &out))
+	assert.Contains(t, out.String(), "# Recommended engine: client, estimated to take 1m0s\n#   - 3 objects are copied")
+}
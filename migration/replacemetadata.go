@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+// Prefix of user metadata in --replace-metadata, as in HTTP headers
+const userMetadataPrefix = "x-amz-meta-"
+
+// Parse the metadata copies get instead of their source object's, from header names to values, eg.
+// Content-Type=text/html or x-amz-meta-project=alpha.  Expires is an HTTP date or RFC 3339 time.
+func ParseObjectMetadata(fields map[string]string) (*s3controltypes.S3ObjectMetadata, error) {
+	metadata := &s3controltypes.S3ObjectMetadata{}
+	for name, value := range fields {
+		switch header := strings.ToLower(strings.TrimSpace(name)); {
+		case header == "content-type":
+			metadata.ContentType = aws.String(value)
+		case header == "cache-control":
+			metadata.CacheControl = aws.String(value)
+		case header == "content-disposition":
+			metadata.ContentDisposition = aws.String(value)
+		case header == "content-encoding":
+			metadata.ContentEncoding = aws.String(value)
+		case header == "content-language":
+			metadata.ContentLanguage = aws.String(value)
+		case header == "expires":
+			expires, err := http.ParseTime(value)
+			if err != nil {
+				if expires, err = time.Parse(time.RFC3339, value); err != nil {
+					return nil, fmt.Errorf("value '%s' of Expires is not an HTTP date or RFC 3339 time", value)
+				}
+			}
+			metadata.HttpExpiresDate = aws.Time(expires)
+		case strings.HasPrefix(header, userMetadataPrefix) && len(header) > len(userMetadataPrefix):
+			if metadata.UserMetadata == nil {
+				metadata.UserMetadata = map[string]string{}
+			}
+			metadata.UserMetadata[strings.TrimPrefix(header, userMetadataPrefix)] = value
+		default:
+			return nil, fmt.Errorf("metadata '%s' can't be replaced, valid names are Content-Type, Cache-Control, Content-Disposition, "+
+				"Content-Encoding, Content-Language, Expires and %s<name>", name, userMetadataPrefix)
+		}
+	}
+	return metadata, nil
+}
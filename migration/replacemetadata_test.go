@@ -0,0 +1,53 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseObjectMetadata(t *testing.T) {
+	metadata, err := ParseObjectMetadata(map[string]string{
+		"Content-Type":       "text/html",
+		"cache-control":      "public, max-age=3600",
+		"Expires":            "Wed, 21 Oct 2026 07:28:00 GMT",
+		"x-amz-meta-Project": "alpha",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "text/html", aws.ToString(metadata.ContentType))
+	assert.Equal(t, "public, max-age=3600", aws.ToString(metadata.CacheControl))
+	assert.Equal(t, time.Date(2026, 10, 21, 7, 28, 0, 0, time.UTC), aws.ToTime(metadata.HttpExpiresDate))
+	assert.Equal(t, map[string]string{"project": "alpha"}, metadata.UserMetadata)
+
+	metadata, err = ParseObjectMetadata(map[string]string{"Expires": "2026-10-21T07:28:00Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 21, 7, 28, 0, 0, time.UTC), aws.ToTime(metadata.HttpExpiresDate))
+
+	for _, bad := range []map[string]string{{"Content-Length": "10"}, {"x-amz-meta-": "x"}, {"Expires": "tomorrow"}} {
+		_, err = ParseObjectMetadata(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSetJobOperationMetadata(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock)}
+	jobArgs := &batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/manifest.csv")}
+	input := NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Equal(t, s3controltypes.S3MetadataDirectiveCopy, input.Operation.S3PutObjectCopy.MetadataDirective)
+	assert.Nil(t, input.Operation.S3PutObjectCopy.NewObjectMetadata)
+
+	jobArgs.NewMetadata = &s3controltypes.S3ObjectMetadata{ContentType: aws.String("text/css"), UserMetadata: map[string]string{"fixed": "yes"}}
+	input = NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Equal(t, s3controltypes.S3MetadataDirectiveReplace, input.Operation.S3PutObjectCopy.MetadataDirective)
+
+	// The new metadata survives the state file and chunking
+	clone, err := cloneJobInput(input)
+	assert.NoError(t, err)
+	assert.Equal(t, jobArgs.NewMetadata, clone.Operation.S3PutObjectCopy.NewObjectMetadata)
+}
@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"s3migration/util"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Batch job operations, see --mode
+const (
+	ModeCopy      = "copy"
+	ModeReplicate = "replicate"
+	ModeLambda    = "lambda" // Invoke a Lambda function per object, see MigrationArgs.FunctionArn
+)
+
+var Modes = []string{ModeCopy, ModeReplicate, ModeLambda}
+
+// Event schema of the Lambda invocations, whose tasks carry the object's bucket ARN, key and version ID
+const lambdaInvocationSchemaVersion = "2.0"
+
+// Check the source bucket has an enabled replication rule to the destination bucket.  Batch Replication
+// replicates objects using the bucket's own replication configuration, so the job can't target any other bucket.
+func (s3obj *s3migration) checkReplicationConfigured(ctx context.Context, source, destination string) error {
+	out, err := s3obj.s3Client.GetBucketReplication(ctx, &s3.GetBucketReplicationInput{Bucket: aws.String(source)})
+	if err != nil {
+		return fmt.Errorf("unable to get replication configuration of bucket %s: %w", source, err)
+	}
+	destinationArn := *util.GetArn(s3obj.cfg.Region, destination)
+	for _, rule := range out.ReplicationConfiguration.Rules {
+		if rule.Status == s3types.ReplicationRuleStatusEnabled && rule.Destination != nil && aws.ToString(rule.Destination.Bucket) == destinationArn {
+			zap.L().Info("Found replication rule to the destination bucket",
+				zap.String("rule", aws.ToString(rule.ID)),
+				zap.String("destination", destinationArn),
+			)
+			return nil
+		}
+	}
+	return fmt.Errorf("bucket %s has no enabled replication rule to %s", source, destination)
+}
+
+// Set the job's operation: a copy, with the canned ACL chosen for the destination and any replaced metadata,
+// a replication or a Lambda invocation
+func (s3obj *s3migration) setJobOperation(ctx context.Context, jobArgs *batchJobArgs, input *s3control.CreateJobInput) {
+	if jobArgs.Replicate {
+		input.Operation = &s3controltypes.JobOperation{S3ReplicateObject: &s3controltypes.S3ReplicateObjectOperation{}}
+		return
+	}
+	if jobArgs.FunctionArn != "" {
+		input.Operation = &s3controltypes.JobOperation{LambdaInvoke: &s3controltypes.LambdaInvokeOperation{
+			FunctionArn:             aws.String(jobArgs.FunctionArn),
+			InvocationSchemaVersion: aws.String(lambdaInvocationSchemaVersion),
+		}}
+		return
+	}
+	// Grants and a canned ACL can't be used together
+	switch {
+	case len(jobArgs.Grants) > 0:
+		input.Operation.S3PutObjectCopy.AccessControlGrants = jobArgs.Grants
+	case jobArgs.PreserveACL:
+	default:
+		input.Operation.S3PutObjectCopy.CannedAccessControlList = s3obj.selectCannedACL(ctx, jobArgs)
+	}
+	input.Operation.S3PutObjectCopy.ChecksumAlgorithm = s3controltypes.S3ChecksumAlgorithm(jobArgs.ChecksumAlgorithm)
+	// Every piece of metadata is replaced, so fields left unset are dropped from the copies
+	if jobArgs.NewMetadata != nil {
+		input.Operation.S3PutObjectCopy.MetadataDirective = s3controltypes.S3MetadataDirectiveReplace
+		input.Operation.S3PutObjectCopy.NewObjectMetadata = jobArgs.NewMetadata
+	}
+}
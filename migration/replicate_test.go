@@ -0,0 +1,69 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReplicationConfigured(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock)}
+	assert.Error(t, s3mig.checkReplicationConfigured(context.TODO(), "src", "dst"))
+
+	s3mig = &s3migration{s3Client: &mock{replication: &s3types.ReplicationConfiguration{Rules: []s3types.ReplicationRule{
+		{ID: aws.String("disabled"), Status: s3types.ReplicationRuleStatusDisabled, Destination: &s3types.Destination{Bucket: aws.String("arn:aws:s3:::dst")}},
+		{ID: aws.String("other"), Status: s3types.ReplicationRuleStatusEnabled, Destination: &s3types.Destination{Bucket: aws.String("arn:aws:s3:::other")}},
+	}}}}
+	assert.Error(t, s3mig.checkReplicationConfigured(context.TODO(), "src", "dst"))
+
+	s3mig = &s3migration{s3Client: &mock{replication: &s3types.ReplicationConfiguration{Rules: []s3types.ReplicationRule{
+		{ID: aws.String("dst"), Status: s3types.ReplicationRuleStatusEnabled, Destination: &s3types.Destination{Bucket: aws.String("arn:aws:s3:::dst")}},
+	}}}}
+	assert.NoError(t, s3mig.checkReplicationConfigured(context.TODO(), "src", "dst"))
+}
+
+func TestSetJobOperation(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock)}
+	jobArgs := &batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/manifest.csv"), Replicate: true}
+	input := NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Nil(t, input.Operation.S3PutObjectCopy)
+	assert.NotNil(t, input.Operation.S3ReplicateObject)
+
+	// Replicate operations survive the state file and chunking
+	clone, err := cloneJobInput(input)
+	assert.NoError(t, err)
+	assert.NotNil(t, clone.Operation.S3ReplicateObject)
+}
+
+func TestSetJobOperationChecksum(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock)}
+	jobArgs := &batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/manifest.csv"), ChecksumAlgorithm: "SHA256"}
+	input := NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Equal(t, s3controltypes.S3ChecksumAlgorithmSha256, input.Operation.S3PutObjectCopy.ChecksumAlgorithm)
+
+	// The algorithm is recorded for verifying the copies
+	r := newReport(MigrationArgs{ChecksumAlgorithm: "SHA256"})
+	assert.Equal(t, "SHA256", r.ChecksumAlgorithm)
+}
+
+func TestSetJobOperationLambda(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock)}
+	jobArgs := &batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/manifest.csv"),
+		FunctionArn: "arn:aws:lambda:us-east-1:111122223333:function:transcode"}
+	input := NewCreateJobInput(jobArgs)
+	s3mig.setJobOperation(context.TODO(), jobArgs, input)
+	assert.Nil(t, input.Operation.S3PutObjectCopy)
+	assert.Equal(t, "arn:aws:lambda:us-east-1:111122223333:function:transcode", aws.ToString(input.Operation.LambdaInvoke.FunctionArn))
+	assert.Equal(t, "2.0", aws.ToString(input.Operation.LambdaInvoke.InvocationSchemaVersion))
+
+	// Lambda operations survive the state file and chunking
+	clone, err := cloneJobInput(input)
+	assert.NoError(t, err)
+	assert.Equal(t, input.Operation.LambdaInvoke, clone.Operation.LambdaInvoke)
+}
@@ -0,0 +1,134 @@
+package migration
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"go.uber.org/zap"
+)
+
+// Migration phases timed for the final report
+const (
+	PhaseInventoryWait = "inventory-wait"
+	PhaseFilter        = "filter"
+	PhaseUpload        = "upload"
+	PhaseJobQueue      = "job-queue"
+	PhaseJobExecution  = "job-execution"
+	PhaseVerification  = "verification"
+	PhaseDeleteReplay  = "delete-replay"
+	PhaseMove          = "move"
+)
+
+// Wall-clock time spent in a single migration phase
+type PhaseTiming struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Outcome of a single batch job
+type JobSummary struct {
+	JobID     string `json:"jobId"`
+	Status    string `json:"status"`
+	Total     int64  `json:"total"`
+	Succeeded int64  `json:"succeeded"`
+	Failed    int64  `json:"failed"`
+	Bytes     int64  `json:"bytes,omitempty"` // Estimated size of the job's objects, when known
+}
+
+// Summary of a migration run, logged on completion and optionally written to a JSON file
+type Report struct {
+	SourceBucket      string               `json:"sourceBucket"`
+	DestinationBucket string               `json:"destinationBucket"`
+	StartedAt         time.Time            `json:"startedAt"`
+	CompletedAt       time.Time            `json:"completedAt"`
+	Phases            []PhaseTiming        `json:"phases"`
+	Jobs              []JobSummary         `json:"jobs"`
+	SuccessRatio      float32              `json:"successRatio"`
+	RequiredRatio     float32              `json:"requiredRatio"`
+	ThresholdMet      bool                 `json:"thresholdMet"`
+	AccessFindings    []AccessFinding      `json:"accessFindings,omitempty"`
+	Drift             *DriftSummary        `json:"drift,omitempty"`
+	Bytes             int64                `json:"bytes,omitempty"` // Size of the inventory objects the filters selected, when the inventory has sizes
+	DeletesReplayed   int                  `json:"deletesReplayed,omitempty"`
+	DeleteMarkers     *DeleteMarkerSummary `json:"deleteMarkers,omitempty"`
+	Move              *MoveSummary         `json:"move,omitempty"`
+	ChecksumAlgorithm string               `json:"checksumAlgorithm,omitempty"` // Additional checksum of the copies, for verifying them
+	Failures          []FailureCount       `json:"failures,omitempty"`          // Failed tasks by error code, from the completion reports
+}
+
+func newReport(args MigrationArgs) *Report {
+	return &Report{
+		SourceBucket:      args.SourceBucket,
+		DestinationBucket: args.DestinationBucket,
+		StartedAt:         time.Now(),
+		RequiredRatio:     args.ReqSuccessThreshold,
+		ChecksumAlgorithm: args.ChecksumAlgorithm,
+	}
+}
+
+// Add the given duration to a phase.  Phases that run more than once (eg. filtering for
+// both the latest and non-latest version jobs) accumulate.  A nil report does nothing.
+func (r *Report) addPhase(name string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	for i := range r.Phases {
+		if r.Phases[i].Name == name {
+			r.Phases[i].Seconds += d.Seconds()
+			return
+		}
+	}
+	r.Phases = append(r.Phases, PhaseTiming{Name: name, Seconds: d.Seconds()})
+}
+
+// Record the time elapsed since start against a phase
+func (r *Report) timePhase(name string, start time.Time) {
+	r.addPhase(name, time.Since(start))
+}
+
+// Record a completed job, splitting its lifetime into queued and active time
+func (r *Report) addJob(job *s3control.DescribeJobOutput, bytes int64) {
+	if r == nil || job == nil || job.Job == nil {
+		return
+	}
+	summary := JobSummary{JobID: *job.Job.JobId, Status: string(job.Job.Status), Bytes: bytes}
+	if ps := job.Job.ProgressSummary; ps != nil {
+		summary.Total = *ps.TotalNumberOfTasks
+		summary.Succeeded = *ps.NumberOfTasksSucceeded
+		summary.Failed = *ps.NumberOfTasksFailed
+		if ps.Timers != nil && ps.Timers.ElapsedTimeInActiveSeconds != nil && job.Job.CreationTime != nil {
+			active := time.Duration(*ps.Timers.ElapsedTimeInActiveSeconds) * time.Second
+			end := time.Now()
+			if job.Job.TerminationDate != nil {
+				end = *job.Job.TerminationDate
+			}
+			r.addPhase(PhaseJobExecution, active)
+			r.addPhase(PhaseJobQueue, max(end.Sub(*job.Job.CreationTime)-active, 0))
+		}
+	}
+	r.Jobs = append(r.Jobs, summary)
+}
+
+// Log the report and write it to path, if given
+func (r *Report) finish(path string) {
+	r.CompletedAt = time.Now()
+	zap.L().Info("Migration report",
+		zap.Any("phases", r.Phases),
+		zap.Any("jobs", r.Jobs),
+		zap.Float32("successRatio", r.SuccessRatio),
+		zap.Bool("thresholdMet", r.ThresholdMet),
+		zap.Int("accessFindings", len(r.AccessFindings)),
+		zap.Duration("elapsed", r.CompletedAt.Sub(r.StartedAt)),
+	)
+	if path == "" {
+		return
+	}
+	body, _ := json.MarshalIndent(r, "", "  ")
+	if err := os.WriteFile(path, body, 0600); err != nil {
+		zap.L().Error("Unable to write migration report", zap.String("file", path), zap.Error(err))
+		return
+	}
+	zap.L().Info("Wrote migration report", zap.String("file", path))
+}
@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportPhases(t *testing.T) {
+	r := newReport(MigrationArgs{SourceBucket: "src", DestinationBucket: "dst"})
+	r.addPhase(PhaseFilter, time.Second)
+	r.addPhase(PhaseFilter, 2*time.Second)
+
+	created := time.Now().Add(-time.Hour)
+	r.addJob(&s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:           aws.String("job"),
+		Status:          s3controltypes.JobStatusComplete,
+		CreationTime:    aws.Time(created),
+		TerminationDate: aws.Time(created.Add(10 * time.Minute)),
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(10),
+			NumberOfTasksSucceeded: aws.Int64(9),
+			NumberOfTasksFailed:    aws.Int64(1),
+			Timers:                 &s3controltypes.JobTimers{ElapsedTimeInActiveSeconds: aws.Int64(240)},
+		},
+	}}, 1<<20)
+
+	assert.Equal(t, []PhaseTiming{
+		{Name: PhaseFilter, Seconds: 3},
+		{Name: PhaseJobExecution, Seconds: 240},
+		{Name: PhaseJobQueue, Seconds: 360},
+	}, r.Phases)
+	assert.Equal(t, []JobSummary{{JobID: "job", Status: "Complete", Total: 10, Succeeded: 9, Failed: 1, Bytes: 1 << 20}}, r.Jobs)
+
+	// A nil report must be safe to use
+	var none *Report
+	none.addPhase(PhaseUpload, time.Second)
+}
@@ -0,0 +1,57 @@
+package migration
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3 client whose reads acknowledge that the requester pays for them, so inventories and manifests in
+// Requester Pays buckets can be read.  Buckets that aren't Requester Pays ignore the acknowledgement.
+type requesterPaysClient struct {
+	s3API
+}
+
+func (c *requesterPaysClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	input := *params
+	input.RequestPayer = s3types.RequestPayerRequester
+	return c.s3API.GetObject(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	input := *params
+	input.RequestPayer = s3types.RequestPayerRequester
+	return c.s3API.HeadObject(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	input := *params
+	input.RequestPayer = s3types.RequestPayerRequester
+	return c.s3API.ListObjectsV2(ctx, &input, optFns...)
+}
+
+func (c *requesterPaysClient) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	input := *params
+	input.RequestPayer = s3types.RequestPayerRequester
+	return c.s3API.ListObjectVersions(ctx, &input, optFns...)
+}
+
+// The SelectObjectContent input has no RequestPayer, so the request header is set directly
+func (c *requesterPaysClient) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error) {
+	return c.s3API.SelectObjectContent(ctx, params, append(optFns, withRequesterPaysHeader)...)
+}
+
+func withRequesterPaysHeader(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc("RequesterPays",
+			func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+				if req, ok := in.Request.(*smithyhttp.Request); ok {
+					req.Header.Set("x-amz-request-payer", string(s3types.RequestPayerRequester))
+				}
+				return next.HandleBuild(ctx, in)
+			}), middleware.After)
+	})
+}
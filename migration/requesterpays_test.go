@@ -0,0 +1,52 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records the request payer of the reads it serves
+type requestPayerMock struct {
+	*mock
+	payers     []s3types.RequestPayer
+	selectOpts int
+}
+
+func (m *requestPayerMock) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.payers = append(m.payers, params.RequestPayer)
+	return m.mock.GetObject(ctx, params, optFns...)
+}
+
+func (m *requestPayerMock) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.payers = append(m.payers, params.RequestPayer)
+	return &s3.ListObjectsV2Output{}, nil
+}
+
+func (m *requestPayerMock) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error) {
+	m.selectOpts = len(optFns)
+	return nil, nil
+}
+
+func TestRequesterPaysClient(t *testing.T) {
+	m := &requestPayerMock{mock: &mock{}}
+	client := &requesterPaysClient{s3API: m}
+
+	params := &s3.GetObjectInput{Bucket: aws.String("src"), Key: aws.String("manifest.json")}
+	_, err := client.GetObject(context.TODO(), params)
+	assert.NoError(t, err)
+	_, err = client.ListObjectsV2(context.TODO(), &s3.ListObjectsV2Input{Bucket: aws.String("src")})
+	assert.NoError(t, err)
+	assert.Equal(t, []s3types.RequestPayer{s3types.RequestPayerRequester, s3types.RequestPayerRequester}, m.payers)
+	assert.Empty(t, params.RequestPayer, "the caller's input is left unchanged")
+
+	_, _ = client.SelectObjectContent(context.TODO(), &s3.SelectObjectContentInput{})
+	assert.Equal(t, 1, m.selectOpts)
+	options := s3.Options{}
+	withRequesterPaysHeader(&options)
+	assert.Len(t, options.APIOptions, 1)
+}
@@ -2,19 +2,22 @@ package migration
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"s3migration/util"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3control"
@@ -23,24 +26,79 @@ import (
 	"go.uber.org/zap"
 )
 
-func init() {
-	logger := zap.Must(zap.NewProduction())
-	if os.Getenv("LOG_LEVEL") == "DEBUG" {
-		logger = zap.Must(zap.NewDevelopment())
-	}
-	zap.ReplaceGlobals(logger)
-}
-
 const (
 	inventoryConfigName = "bulk-copy-inventory"
+	initialPollDelay    = 15 * time.Second
+	defaultPollInterval = 60 * time.Second
+
+	// Number of retry intervals to wait for an inventory manifest when no maximum wait is given
+	defaultManifestRetries = 24
+
+	// DescribeJob throttling retry policy
+	describeJobMaxRetries  = 10
+	describeJobBackoffBase = time.Second
+	describeJobBackoffMax  = 2 * time.Minute
 )
 
+// Returned when a batch job does not reach a terminal state within the poll timeout
+var ErrJobPollTimeout = errors.New("timed out waiting for batch job to complete")
+
+// S3 Select error codes where the region, partition or an SCP doesn't allow it, see filterGzippedCsv
+var selectUnavailableCodes = []string{"AccessDenied", "MethodNotAllowed", "NotImplemented", "UnsupportedOperation"}
+
 type s3migration struct {
+	cfg         aws.Config // Config the clients are built from, with the run's retry and request rate settings
 	s3Client    s3API
 	s3CtrClient s3ControlAPI
+	quiet       bool            // Only log state transitions while polling
+	heartbeat   *util.Heartbeat // Liveness signal for container schedulers, may be nil
+
+	pollInterval time.Duration // Interval between job status checks
+	pollTimeout  time.Duration // Maximum time to wait for a job, zero waits forever
+
+	cancelRatio    float64 // Failure ratio of completed tasks a running job is cancelled above, zero never cancels
+	cancelMinTasks int64   // Tasks a job completes before its failure ratio is checked
+
+	report   *Report                // Phase timings and job outcomes, may be nil
+	analyzer accessAnalyzerAPI      // IAM Access Analyzer, only set when the exposure check is requested
+	targets  notificationTargetsAPI // Resource policies of event notification targets, only set when bucket configuration is copied
+	metrics  *metricsEmitter        // CloudWatch metrics, may be nil
+	events   *lifecycleEvents       // EventBridge lifecycle events, may be nil
+	progress *progressMetrics       // Prometheus metrics served on /metrics, may be nil
+	stream   *eventStream           // NDJSON progress events, may be nil
+
+	inventoryBucket string   // Bucket inventory is delivered to and manifests are written to, the source bucket when empty
+	localFilter     bool     // Filter inventory data files locally rather than with S3 Select
+	kmsKey          string   // KMS key manifests and other uploads are encrypted with, SSE-S3 when empty
+	inventoryFields []string // Optional fields of the inventory configurations created, DefaultInventoryFields when empty
+
+	selectConcurrency int // Inventory data files filtered at once, see filterDataFiles
+
+	expressions []string         // S3 Select expressions the manifests were filtered with, for the plan
+	preflight   PreflightResults // Checks made while planning, for the plan
+}
+
+// Bucket the source bucket's inventory is delivered to, and the manifests and reports of its migration are
+// written to.  Keys in it still start with the source bucket's name, see filteredManifestKey.
+func (s3obj *s3migration) scratchBucket(bucket string) string {
+	if s3obj.inventoryBucket != "" {
+		return s3obj.inventoryBucket
+	}
+	return bucket
+}
+
+// Number of 48 hour periods back to search for a manifest, covering at least one delivery at the given frequency
+func inventoryDateWindow(frequency s3types.InventoryFrequency) int {
+	if frequency == s3types.InventoryFrequencyWeekly {
+		return -8
+	}
+	return -1
 }
 
-func (s3obj *s3migration) ensureS3InventoryConfig(ctx context.Context, bucket string, configName string, shouldUpdate bool) (*inventoryManifestFinderArgs, error) {
+// Find where the inventory configuration delivers its reports, creating or enabling the default configuration
+// when shouldUpdate is set.  frequency is only used when the configuration is created, defaulting to daily.
+func (s3obj *s3migration) ensureS3InventoryConfig(ctx context.Context, bucket string, configName string, shouldUpdate bool,
+	frequency s3types.InventoryFrequency) (*inventoryManifestFinderArgs, error) {
 	out, err := s3obj.s3Client.GetBucketInventoryConfiguration(ctx, &s3.GetBucketInventoryConfigurationInput{
 		Bucket: aws.String(bucket),
 		Id:     aws.String(configName),
@@ -76,23 +134,40 @@ func (s3obj *s3migration) ensureS3InventoryConfig(ctx context.Context, bucket st
 	prefix := fmt.Sprintf("%s/%s/", bucket, configName)
 	// If configuration exists and is enabled, no further work required
 	if out != nil && *out.InventoryConfiguration.IsEnabled {
-		dateWindow := -1
-		if out.InventoryConfiguration.Schedule.Frequency == s3types.InventoryFrequencyWeekly {
-			dateWindow = -8
+		existing := out.InventoryConfiguration.Schedule.Frequency
+		if frequency != "" && frequency != existing {
+			zap.L().Warn("Using existing inventory configuration, which has a different frequency to the one requested",
+				zap.String("configName", configName),
+				zap.String("frequency", string(existing)),
+				zap.String("requested", string(frequency)),
+			)
 		}
 		destinationArn := *out.InventoryConfiguration.Destination.S3BucketDestination.Bucket
+		if destination := destinationArn[strings.LastIndex(destinationArn, ":")+1:]; destination != s3obj.scratchBucket(bucket) {
+			zap.L().Warn("Using existing inventory configuration, which delivers to a different bucket to the one requested",
+				zap.String("configName", configName),
+				zap.String("bucket", destination),
+				zap.String("requested", s3obj.scratchBucket(bucket)),
+			)
+		}
 		if out.InventoryConfiguration.Destination.S3BucketDestination.Prefix != nil {
 			prefix = fmt.Sprintf("%s/%s", *out.InventoryConfiguration.Destination.S3BucketDestination.Prefix, prefix)
 		}
 		return &inventoryManifestFinderArgs{
-			BucketName: destinationArn[strings.LastIndex(destinationArn, ":")+1:],
-			Prefix:     prefix,
-			DateWindow: dateWindow,
+			BucketName:   destinationArn[strings.LastIndex(destinationArn, ":")+1:],
+			Prefix:       prefix,
+			Frequency:    existing,
+			DateWindow:   inventoryDateWindow(existing),
+			SourceBucket: bucket,
 		}, nil
 	}
+	if frequency == "" {
+		frequency = s3types.InventoryFrequencyDaily
+	}
 	zap.L().Info("Inventory configuration does not exist or is disabled.  Creating/enabling",
 		zap.String("bucket", bucket),
 		zap.String("configName", configName),
+		zap.String("frequency", string(frequency)),
 	)
 
 	// Create/Update configuration
@@ -102,7 +177,7 @@ func (s3obj *s3migration) ensureS3InventoryConfig(ctx context.Context, bucket st
 		InventoryConfiguration: &s3types.InventoryConfiguration{
 			Destination: &s3types.InventoryDestination{
 				S3BucketDestination: &s3types.InventoryS3BucketDestination{
-					Bucket: util.GetArn(bucket),
+					Bucket: util.GetArn(s3obj.cfg.Region, s3obj.scratchBucket(bucket)),
 					Encryption: &s3types.InventoryEncryption{
 						SSES3: &s3types.SSES3{},
 					},
@@ -113,24 +188,36 @@ func (s3obj *s3migration) ensureS3InventoryConfig(ctx context.Context, bucket st
 			IncludedObjectVersions: s3types.InventoryIncludedObjectVersionsAll,
 			IsEnabled:              aws.Bool(true),
 			Schedule: &s3types.InventorySchedule{
-				Frequency: s3types.InventoryFrequencyDaily,
-			},
-			OptionalFields: []s3types.InventoryOptionalField{
-				s3types.InventoryOptionalFieldLastModifiedDate,
-				s3types.InventoryOptionalFieldReplicationStatus,
-				s3types.InventoryOptionalFieldSize, // Batch operations has a 5GB limit, can use this to filter those out
+				Frequency: frequency,
 			},
+			OptionalFields: s3obj.inventoryOptionalFields(),
 		},
 	})
 
 	// These are the same values set above
 	return &inventoryManifestFinderArgs{
-		BucketName: bucket,
-		Prefix:     prefix,
-		DateWindow: -1,
+		BucketName:   s3obj.scratchBucket(bucket),
+		Prefix:       prefix,
+		Frequency:    frequency,
+		DateWindow:   inventoryDateWindow(frequency),
+		SourceBucket: bucket,
+		Created:      err == nil,
 	}, err
 }
 
+// Optional fields of the inventory configurations the tool creates
+func (s3obj *s3migration) inventoryOptionalFields() []s3types.InventoryOptionalField {
+	names := s3obj.inventoryFields
+	if len(names) == 0 {
+		names = DefaultInventoryFields
+	}
+	fields := make([]s3types.InventoryOptionalField, len(names))
+	for i, name := range names {
+		fields[i] = s3types.InventoryOptionalField(name)
+	}
+	return fields
+}
+
 func (s3obj *s3migration) getLatestManifest(ctx context.Context, finderArgs *inventoryManifestFinderArgs) (*s3types.Object, error) {
 	windowStart := time.Now().Add(time.Duration(finderArgs.DateWindow) * time.Hour * 48)
 	// expected prefix for inventory manifests
@@ -158,21 +245,46 @@ func (s3obj *s3migration) getLatestManifest(ctx context.Context, finderArgs *inv
 	manifests := []s3types.Object{}
 	for _, obj := range out.Contents {
 		// Check if the object is a manifest and is within our time frame window
-		if strings.HasSuffix(*obj.Key, "manifest.json") && obj.LastModified.After(windowStart) {
+		if isInventoryManifestKey(finderArgs.Prefix, *obj.Key) && obj.LastModified.After(windowStart) {
 			manifests = append(manifests, obj)
 		}
 	}
+	slices.SortFunc(manifests, objectDateDescending)
 
-	if len(manifests) == 0 {
-		zap.L().Info("No manifest file available",
-			zap.String("prefix", finderArgs.Prefix),
-			zap.String("date", dateString),
+	// A destination shared by several source buckets holds everyone's reports, so only use a manifest
+	// that lists our source bucket
+	for _, manifest := range manifests {
+		if finderArgs.SourceBucket == "" {
+			return &manifest, nil
+		}
+		content, err := s3obj.readInventoryManifest(ctx, finderArgs.BucketName, manifest)
+		if err != nil {
+			return nil, err
+		}
+		if content.SourceBucket == finderArgs.SourceBucket {
+			return &manifest, nil
+		}
+		zap.L().Warn("Skipping inventory manifest of another source bucket",
+			zap.String("key", *manifest.Key),
+			zap.String("sourceBucket", content.SourceBucket),
 		)
-		return nil, nil
 	}
-	slices.SortFunc(manifests, objectDateDescending)
+	s3obj.pollLogger(false).Info("No manifest file available",
+		zap.String("prefix", finderArgs.Prefix),
+		zap.String("date", dateString),
+	)
+	return nil, nil
+}
 
-	return &manifests[0], nil
+// Reports whether key is a manifest delivered directly under prefix, ie. <prefix><date>/manifest.json.
+// Manifests deeper down, such as those of a configuration whose name extends a path, belong to someone else.
+func isInventoryManifestKey(prefix, key string) bool {
+	folder, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return false
+	}
+	folder, ok = strings.CutSuffix(folder, "/manifest.json")
+	return ok && folder != "" && !strings.Contains(folder, "/")
 }
 
 func (s3obj *s3migration) isVersioningDisabled(ctx context.Context, bucket string) (bool, error) {
@@ -210,32 +322,147 @@ func (s3obj *s3migration) readInventoryManifest(ctx context.Context, bucket stri
 
 // Use S3 Select to get just the bucket and key from a gzipped CSV generated by the inventory process
 func (s3obj *s3migration) filterManifestCsv(ctx context.Context, args *batchJobArgs,
-	manifest s3types.Object, filters userFilters) (*s3types.Object, error) {
-	manifestJson, err := s3obj.readInventoryManifest(ctx, *args.SourceBucketName, manifest)
+	inventory inventoryReport, filters userFilters) (*s3types.Object, error) {
+	filterStart := time.Now()
+	manifestJson, err := s3obj.readInventoryManifest(ctx, inventory.Bucket, inventory.Manifest)
 	if err != nil {
 		return &s3types.Object{}, err
 	}
 
 	csvFile := manifestJson.Files[0].Key
+	dataFiles := manifestJson.dataFileKeys()
 	zap.L().Info("Processing existing inventory datafile",
+		zap.String("bucket", inventory.Bucket),
 		zap.String("csvFile", csvFile),
+		zap.Int("dataFiles", len(dataFiles)),
 	)
 
-	bucketAndKeyExpression, err := util.GetQueryExpression(manifestJson.FileSchema, filters.StartDate,
-		filters.EndDate, filters.LatestOnly, args.VersioningDisabled)
+	var bucketAndKeyExpression string
+	if len(args.ManifestFields) > 0 {
+		bucketAndKeyExpression, err = util.GetBatchQueryExpression(manifestJson.FileSchema, args.ManifestFields,
+			filters.StartDate, filters.EndDate, filters.LatestOnly)
+	} else {
+		bucketAndKeyExpression, err = util.GetQueryExpression(manifestJson.FileSchema, filters.StartDate,
+			filters.EndDate, filters.LatestOnly, args.VersioningDisabled)
+	}
+	if err == nil {
+		bucketAndKeyExpression, err = addUserFilters(bucketAndKeyExpression, manifestJson.FileSchema, filters)
+	}
 	if err != nil {
 		return nil, err
 	}
-	rdr := s3obj.filterGzippedCsv(ctx, *args.SourceBucketName, csvFile, bucketAndKeyExpression)
+	// The batch manifest expression applies the filters whether or not the bucket is versioned
+	if serr := s3obj.logScope(ctx, inventory.Bucket, dataFiles, manifestJson.FileSchema, filters,
+		args.VersioningDisabled && len(args.ManifestFields) == 0); serr != nil {
+		zap.L().Warn("Unable to count the objects in scope of the filters", zap.Error(serr))
+	}
+	s3obj.expressions = append(s3obj.expressions, bucketAndKeyExpression)
+	rdr := s3obj.filterDataFiles(ctx, inventory.Bucket, dataFiles, bucketAndKeyExpression)
+	s3obj.timePhase(PhaseFilter, filterStart)
+
+	// S3 Select results are streamed, so the upload phase includes the time spent reading them.  The
+	// manifest is named after the first data file, which identifies the report.
+	key := filteredManifestKey(*args.SourceBucketName, csvFile, bucketAndKeyExpression)
+	uploadStart := time.Now()
+	defer s3obj.timePhase(PhaseUpload, uploadStart)
+	return s3obj.uploadS3File(ctx, s3obj.scratchBucket(*args.SourceBucketName), key, rdr)
+}
 
-	// The filtered data file will have a similar name to the automatically generated data file.
-	// However, as we're expecting a gzipped file and are uploading an uncompressed file, we trim the ".gz" from the key
-	key := strings.TrimSuffix(csvFile, ".gz")
-	return s3obj.uploadS3File(ctx, *args.SourceBucketName, key, rdr)
+// Count the objects of the data files the filters select, and their bytes when the inventory has sizes, so
+// the filters can be checked against expectations before the job is created.  The bytes are added to the report.
+func (s3obj *s3migration) logScope(ctx context.Context, bucket string, dataFiles []string, fileSchema string, filters userFilters, versioningDisabled bool) error {
+	expression, err := util.GetScopeQueryExpression(fileSchema, filters.StartDate, filters.EndDate, filters.LatestOnly, versioningDisabled)
+	if err == nil {
+		expression, err = addUserFilters(expression, fileSchema, filters)
+	}
+	if err != nil {
+		return err
+	}
+	// Each data file returns its own count and sum
+	recs, err := csv.NewReader(s3obj.filterDataFiles(ctx, bucket, dataFiles, expression)).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		return fmt.Errorf("no scope returned for %d data files", len(dataFiles))
+	}
+	var objects, bytes int64
+	for _, rec := range recs {
+		n, b, err := parseScope(rec)
+		if err != nil {
+			return err
+		}
+		objects, bytes = objects+n, bytes+b
+	}
+	fields := []zap.Field{
+		zap.Int64("objects", objects),
+		zap.String("latestOnly", filters.LatestOnly),
+		zap.Time("start", filters.StartDate),
+		zap.Time("end", filters.EndDate),
+		zap.Time("modifiedAfter", filters.Modified.After),
+		zap.Time("modifiedBefore", filters.Modified.Before),
+		zap.Strings("encryption", filters.Encryption),
+		zap.Bool("skipReplicated", filters.SkipReplicated),
+		zap.String("sql", filters.SQL),
+		zap.Int("dataFiles", len(dataFiles)),
+	}
+	if len(recs[0]) > 1 {
+		fields = append(fields, zap.Int64("bytes", bytes), zap.String("size", formatBytes(bytes)))
+		// Each manifest filtered from the inventory, eg. of the latest and non-current versions, adds its scope
+		if s3obj.report != nil {
+			s3obj.report.Bytes += bytes
+		}
+	}
+	zap.L().Info("Objects in scope of the filters", fields...)
+	return nil
+}
+
+// Add the filters not built into the inventory query expressions: the modified range, encryption and
+// replication statuses and SQL clause
+func addUserFilters(expression, fileSchema string, filters userFilters) (string, error) {
+	expression, err := util.AddModifiedFilter(expression, fileSchema, filters.Modified)
+	if err == nil {
+		expression, err = util.AddFieldFilter(expression, fileSchema, util.EncryptionColumn, filters.Encryption, false)
+	}
+	if err == nil && filters.SkipReplicated {
+		expression, err = util.AddFieldFilter(expression, fileSchema, util.ReplicationColumn, []string{string(s3controltypes.ReplicationStatusCompleted)}, true)
+	}
+	if err != nil {
+		return "", err
+	}
+	return util.AddSQLFilter(expression, fileSchema, filters.SQL)
+}
+
+// Parse the count, and sum of sizes if selected, returned by a scope expression.  The sum is empty
+// when no object is in scope.
+func parseScope(rec []string) (objects, bytes int64, err error) {
+	if objects, err = strconv.ParseInt(rec[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("unexpected object count '%s': %w", rec[0], err)
+	}
+	if len(rec) > 1 && rec[1] != "" {
+		if bytes, err = strconv.ParseInt(rec[1], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("unexpected object size sum '%s': %w", rec[1], err)
+		}
+	}
+	return objects, bytes, nil
 }
 
-// Execute the given S3 Select expression against provided bucket and key, returning an io.Reader wrapper
-func (s3obj *s3migration) filterGzippedCsv(ctx context.Context, bucket, key, expression string) *util.S3SelectReader {
+// Key of the manifest filtered from an inventory data file, in the source bucket's scratch location.  The
+// data file's key already holds the source bucket and configuration name, and the expression's hash keeps
+// manifests filtered differently from the same data file, eg. the latest and noncurrent versions, apart.
+// As we're expecting a gzipped file and are uploading an uncompressed file, the ".gz" is trimmed from the key.
+func filteredManifestKey(bucket, dataKey, expression string) string {
+	sum := sha256.Sum256([]byte(expression))
+	return fmt.Sprintf("%s/%s/filtered/%s-%x.csv", bucket, inventoryConfigName,
+		strings.TrimSuffix(dataKey, ".csv.gz"), sum[:4])
+}
+
+// Execute the given S3 Select expression against provided bucket and key, returning an io.Reader wrapper.
+// Where S3 Select is unavailable, or with --local-filter, the file is downloaded and filtered locally instead.
+func (s3obj *s3migration) filterGzippedCsv(ctx context.Context, bucket, key, expression string) io.Reader {
+	if s3obj.localFilter {
+		return s3obj.filterGzippedCsvLocally(ctx, bucket, key, expression)
+	}
 	out, err := s3obj.s3Client.SelectObjectContent(ctx, &s3.SelectObjectContentInput{
 		Bucket:         aws.String(bucket),
 		Key:            aws.String(key),
@@ -253,6 +480,14 @@ func (s3obj *s3migration) filterGzippedCsv(ctx context.Context, bucket, key, exp
 			CSV: &s3types.CSVOutput{},
 		},
 	})
+	var ae smithy.APIError
+	if errors.As(err, &ae) && slices.Contains(selectUnavailableCodes, ae.ErrorCode()) {
+		zap.L().Warn("S3 Select is unavailable, filtering CSV file locally",
+			zap.String("key", key),
+			zap.String("code", ae.ErrorCode()),
+		)
+		return s3obj.filterGzippedCsvLocally(ctx, bucket, key, expression)
+	}
 	if err != nil {
 		zap.L().Fatal("Error filtering CSV file with S3 Select",
 			zap.String("bucket", bucket),
@@ -264,6 +499,24 @@ func (s3obj *s3migration) filterGzippedCsv(ctx context.Context, bucket, key, exp
 	return &util.S3SelectReader{Stream: out.GetStream()}
 }
 
+// Stream the file through a local filter applying the S3 Select expression, see util.LocalSelect
+func (s3obj *s3migration) filterGzippedCsvLocally(ctx context.Context, bucket, key, expression string) io.Reader {
+	out, err := s3obj.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err == nil {
+		var rdr io.Reader
+		if rdr, err = util.NewLocalSelectReader(out.Body, expression); err == nil {
+			return rdr
+		}
+	}
+	zap.L().Fatal("Error filtering CSV file locally",
+		zap.String("bucket", bucket),
+		zap.String("key", key),
+		zap.String("expression", expression),
+		zap.Error(err),
+	)
+	return nil
+}
+
 func (s3obj s3migration) uploadS3File(ctx context.Context, bucket, key string, reader io.Reader) (*s3types.Object, error) {
 	// The s3 manager feature is being used as we don't have a Content-Length value for a direct PutObject.
 	// The files being uploaded should not be very large, so we're configuring the uploader to minimize local resource usage
@@ -273,12 +526,19 @@ func (s3obj s3migration) uploadS3File(ctx context.Context, bucket, key string, r
 		u.PartSize = 64 * 1024 * 1024 // 64MB per part.  Per docs, the minimum this can be is 5MB
 	})
 
-	result, err := uploader.Upload(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket:               aws.String(bucket),
 		Key:                  aws.String(key),
 		Body:                 reader,
 		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
-	})
+	}
+	// Where policy mandates a customer managed key, the batch role must be able to decrypt the manifest with it
+	if s3obj.kmsKey != "" {
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(s3obj.kmsKey)
+		input.BucketKeyEnabled = aws.Bool(true)
+	}
+	result, err := uploader.Upload(ctx, input)
 
 	if err != nil {
 		zap.L().Fatal("failed to upload filtered inventory file",
@@ -327,225 +587,610 @@ func (s3obj *s3migration) isOwnershipEnforced(ctx context.Context, bucket string
 	return false, nil
 }
 
-func Run(args MigrationArgs) error {
-	defer util.ZapLogSync()
-	ctx := context.Background()
-
-	// get aws configuration from loacal aws credentials
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+// Choose the canned ACL for the copy operation.  An explicit choice always wins, "none" never
+// sets one, and "auto" uses bucket-owner-full-control only when destination ownership is enforced.
+func (s3obj *s3migration) selectCannedACL(ctx context.Context, jobArgs *batchJobArgs) s3controltypes.S3CannedAccessControlList {
+	switch jobArgs.CannedACL {
+	case CannedACLNone:
+		return ""
+	case CannedACLAuto, "":
+	default:
+		zap.L().Info("Using requested canned ACL", zap.String("cannedACL", jobArgs.CannedACL))
+		return s3controltypes.S3CannedAccessControlList(jobArgs.CannedACL)
+	}
+	if util.IsMultiRegionAccessPoint(*jobArgs.TargetBucketName) {
+		zap.L().Info("Destination is a Multi-Region Access Point, its buckets' ownership setting isn't checked")
+		return ""
+	}
+	// Directory buckets are always owned by the bucket owner and don't support ACLs
+	if util.IsDirectoryBucket(*jobArgs.TargetBucketName) {
+		return ""
+	}
+	// If the target bucket ACL setting is "BucketOwnerEnforced", then
+	// use a canned ACL to avoid issues of invalid source object ACLs
+	enforced, err := s3obj.isOwnershipEnforced(ctx, *jobArgs.TargetBucketName)
 	if err != nil {
-		zap.L().Fatal(
-			"Failed to load AWS client config",
-			zap.String("region", args.SourceRegion),
-			zap.Error(err),
-		)
+		zap.L().Warn("Failed to get destination bucket ownership setting", zap.Error(err))
 	}
-	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg), s3CtrClient: s3control.NewFromConfig(cfg)}
-	versioningDisabled, verr := s3mig.isVersioningDisabled(ctx, args.SourceBucket)
-	if verr != nil {
-		zap.L().Fatal("Failed to get versioning status", zap.Error(verr))
+	if err == nil && enforced {
+		zap.L().Info("Destination bucket ownership setting is enforced, using canned bucket owner full control ACL")
+		return s3controltypes.S3CannedAccessControlListBucketOwnerFullControl
 	}
-	zap.L().Info("Bucket versioning status",
-		zap.String("bucket", args.SourceBucket),
-		zap.Bool("disabled", versioningDisabled),
-	)
+	return ""
+}
+
+// Ensure the inventory configuration exists and wait for its latest manifest to be delivered
+func (s3obj *s3migration) waitForInventoryManifest(ctx context.Context, args MigrationArgs) *inventoryReport {
 	shouldUpdate := args.ConfigName == inventoryConfigName
-	manifestArgs, invErr := s3mig.ensureS3InventoryConfig(ctx, args.SourceBucket, args.ConfigName, shouldUpdate)
+	manifestArgs, invErr := s3obj.ensureS3InventoryConfig(ctx, args.SourceBucket, args.ConfigName, shouldUpdate,
+		s3types.InventoryFrequency(args.InventoryFrequency))
 	if invErr != nil {
 		zap.L().Fatal("Failed to get inventory config", zap.Error(invErr))
 	}
+	if perr := s3obj.ensureInventoryDeliveryPolicy(ctx, args.SourceBucket, manifestArgs, args.InventoryPolicy); perr != nil {
+		zap.L().Fatal("Inventory reports can't be delivered", zap.Error(perr))
+	}
 	zap.L().Debug("Search criteria for latest inventory manifest",
 		zap.String("bucket", manifestArgs.BucketName),
 		zap.String("prefix", manifestArgs.Prefix),
+		zap.String("frequency", string(manifestArgs.Frequency)),
 		zap.Int("dateWindow", manifestArgs.DateWindow),
 	)
 
-	var (
-		manifestFile *s3types.Object
-		merr         error
-		ctr          int16
-	)
-
 	// Try to get s3 bucket manifest details or wait until inventory file is available.
-	// it is set to wait up to 24 hours for inventoty rto be available.
+	// By default it waits for up to 24 retry intervals for inventory to be available.
 	duration, _ := time.ParseDuration(args.RetryInterval)
+	maxWait := manifestMaxWait(args)
+	waitStart := time.Now()
+	manifestFile := s3obj.pollInventoryManifest(ctx, manifestArgs, duration, maxWait)
+	if manifestFile == nil {
+		zap.L().Fatal("No inventory manifest found within timeout period, exiting copy process.",
+			zap.Duration("maxWait", maxWait),
+			util.ExitCode(util.ExitInventoryTimeout),
+		)
+	}
+	s3obj.timePhase(PhaseInventoryWait, waitStart)
+	return &inventoryReport{Bucket: manifestArgs.BucketName, Manifest: *manifestFile, Created: manifestArgs.Created}
+}
+
+// Check for the latest manifest every interval until one is found, or nil once maxWait has passed.  The
+// sleeps never pass the deadline, so a last check is made when it's reached.
+func (s3obj *s3migration) pollInventoryManifest(ctx context.Context, finder *inventoryManifestFinderArgs, interval, maxWait time.Duration) *s3types.Object {
+	deadline := time.Now().Add(maxWait)
+	var ctr int16
 	for {
-		manifestFile, merr = s3mig.getLatestManifest(ctx, manifestArgs)
-		if merr != nil {
+		s3obj.heartbeat.Beat()
+		manifestFile, err := s3obj.getLatestManifest(ctx, finder)
+		if err != nil {
 			zap.L().Error("Recoverable error during retrieval of latest inventory manifest",
-				zap.Error(merr),
+				zap.Error(err),
 			)
-			continue
-		}
-		if manifestFile != nil && manifestFile.Key != nil {
+		} else if manifestFile != nil && manifestFile.Key != nil {
 			zap.L().Debug("Found inventory manifest, continuing with batch copy",
 				zap.Any("Manifest", manifestFile),
 			)
-			break
+			return manifestFile
 		}
-		if ctr > 23 {
-			zap.L().Fatal("No inventory manifest found within timeout period, exiting copy process.")
+		if !time.Now().Before(deadline) {
+			return nil
 		}
 		ctr++
-		zap.L().Info("No manifest found, sleeping before retry",
+		s3obj.progress.retry(retryInventoryManifest)
+		s3obj.pollLogger(ctr == 1).Info("No manifest found, sleeping before retry",
 			zap.Int16("retryCount", ctr),
-			zap.String("retryInterval", args.RetryInterval),
+			zap.Duration("retryInterval", interval),
+		)
+		time.Sleep(max(min(interval, time.Until(deadline)), 0))
+	}
+}
+
+// Maximum time to wait for an inventory manifest, defaulting to defaultManifestRetries retry intervals
+func manifestMaxWait(args MigrationArgs) time.Duration {
+	if args.MaxWait > 0 {
+		return args.MaxWait
+	}
+	duration, _ := time.ParseDuration(args.RetryInterval)
+	return defaultManifestRetries * duration
+}
+
+func Run(args MigrationArgs) error {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	// get aws configuration from loacal aws credentials
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", args.SourceRegion),
+			zap.Error(err),
 		)
-		time.Sleep(duration)
 	}
+	s3mig := newS3Migration(cfg, args)
+	if args.CreateRole != "" {
+		// IAM is global, the SDK resolves the endpoint of the region's partition, eg. iam.amazonaws.com
+		client := iam.NewFromConfig(s3mig.cfg)
+		if args.RoleArn, err = s3mig.ensureBatchRole(ctx, client, args.CreateRole, args); err != nil {
+			zap.L().Fatal("Failed to create the batch operations role", zap.String("role", args.CreateRole), zap.Error(err))
+		}
+	}
+	if args.PlanFile != "" {
+		// Checked before planning so the denied permissions are logged before any manifest is built
+		client := iam.NewFromConfig(s3mig.cfg)
+		trusted := checkRoleTrust(ctx, client, args.RoleArn) == nil
+		s3mig.preflight.RoleTrusted = &trusted
+		if perr := s3mig.checkRolePermissions(ctx, client, args); perr != nil {
+			zap.L().Warn("Batch jobs are likely to fail", zap.Error(perr))
+		}
+	}
+	st := s3mig.planJobs(ctx, args)
+	if args.PlanOnly {
+		st.Recommendation = s3mig.recommend(ctx, args, st)
+	}
+	st.table = newStateTable(s3mig.cfg, args.StateTable, args.StateFile)
+	st.mustSave()
+	if args.PlanFile != "" {
+		doc, derr := st.planDocument()
+		if derr == nil {
+			derr = writePlanFile(args.PlanFile, doc)
+		}
+		if derr != nil {
+			zap.L().Fatal("Failed to write the plan", zap.String("file", args.PlanFile), zap.Error(derr))
+		}
+	}
+	trackRun(st)
+	if args.StateFile != "" {
+		zap.L().Info("Recording batch jobs in state file", zap.String("file", args.StateFile), zap.String("table", args.StateTable))
+	}
+	if args.PlanOnly {
+		zap.L().Info("Batch job plan recorded, no job created. Use \"plan export\" to review it or \"watch --resume\" to run it",
+			zap.String("file", args.StateFile),
+			zap.Int("jobs", len(st.Steps)),
+		)
+		return nil
+	}
+
+	// Create S3 batch job(s)
+	s3mig.events.publish(ctx, EventMigrationStarted, map[string]any{"jobs": len(st.Steps)})
+	return s3mig.executeJobs(ctx, st)
+}
+
+// Clients of a run with the given arguments
+func newS3Migration(cfg aws.Config, args MigrationArgs) *s3migration {
+	if args.SDKMaxAttempts > 0 {
+		cfg.RetryMaxAttempts = args.SDKMaxAttempts
+	}
+	if args.SDKRetryMode != "" {
+		cfg.RetryMode = aws.RetryMode(args.SDKRetryMode)
+	}
+	if args.MaxAPITPS > 0 {
+		cfg.APIOptions = append(slices.Clip(cfg.APIOptions), util.NewRateLimiter(args.MaxAPITPS).APIOption)
+	}
+	s3mig := &s3migration{cfg: cfg, s3Client: s3.NewFromConfig(cfg), s3CtrClient: s3control.NewFromConfig(cfg), quiet: args.Quiet, heartbeat: args.Heartbeat,
+		pollInterval: args.PollInterval, pollTimeout: args.PollTimeout, cancelRatio: args.CancelFailureRatio, cancelMinTasks: args.CancelMinTasks,
+		report: newReport(args), metrics: newMetricsEmitter(args),
+		progress: newProgressMetrics(args), inventoryBucket: args.InventoryBucket,
+		localFilter: args.LocalFilter, selectConcurrency: args.SelectConcurrency, inventoryFields: args.InventoryFields}
+	if args.KmsID != KmsSSES3 {
+		s3mig.kmsKey = args.KmsID
+	}
+	if args.AccessAnalyzer {
+		s3mig.analyzer = newAccessAnalyzer(cfg)
+	}
+	s3mig.events = newLifecycleEvents(cfg, args)
+	s3mig.stream = newEventStream(args)
+	s3mig.stream.captureErrors()
+	if args.AccessGrants {
+		s3mig.s3Client = newAccessGrantsClient(s3mig.s3Client, s3control.NewFromConfig(cfg), args)
+	}
+	if args.RequestPayer != "" {
+		s3mig.s3Client = &requesterPaysClient{s3API: s3mig.s3Client}
+	}
+	return s3mig
+}
 
+// Directory buckets have no versions, so copying every version of a versioned source would leave whichever
+// version the jobs copied last.  Runs copying the objects named by a keys file or manifest aren't checked.
+func checkDirectoryBucketVersions(args MigrationArgs, versioningDisabled bool) error {
+	if !util.IsDirectoryBucket(args.DestinationBucket) || versioningDisabled || args.LatestOnly == util.IsLatestYes ||
+		args.KeysFile != "" || args.ManifestArn != "" {
+		return nil
+	}
+	return fmt.Errorf("source bucket %s is versioned and directory bucket %s has no versions, use --latest-only Yes to copy the latest versions",
+		args.SourceBucket, args.DestinationBucket)
+}
+
+// Check the buckets are ready for the migration and plan its batch jobs
+func (s3obj *s3migration) planJobs(ctx context.Context, args MigrationArgs) *runState {
+	if args.CreateDestination && !args.PlanOnly {
+		if _, cerr := s3obj.ensureDestinationBucket(ctx, args.SourceBucket, args.DestinationBucket, args.SourceRegion); cerr != nil {
+			zap.L().Fatal("Failed to create destination bucket", zap.Error(cerr))
+		}
+	}
+	versioningDisabled, verr := s3obj.isVersioningDisabled(ctx, args.SourceBucket)
+	if verr != nil {
+		zap.L().Fatal("Failed to get versioning status", zap.Error(verr))
+	}
+	zap.L().Info("Bucket versioning status",
+		zap.String("bucket", args.SourceBucket),
+		zap.Bool("disabled", versioningDisabled),
+	)
+	s3obj.preflight.VersioningDisabled = versioningDisabled
+	if derr := checkDirectoryBucketVersions(args, versioningDisabled); derr != nil {
+		zap.L().Fatal("Copying every version to a directory bucket isn't supported", zap.Error(derr))
+	}
+	if args.ReplayDeletes {
+		// Delete markers only exist, and can only be mirrored, in versioned buckets
+		destDisabled, derr := s3obj.isVersioningDisabled(ctx, args.DestinationBucket)
+		if derr != nil {
+			zap.L().Fatal("Failed to get destination versioning status", zap.Error(derr))
+		}
+		if versioningDisabled || destDisabled {
+			zap.L().Fatal("Replaying deletes requires versioning on both the source and destination buckets",
+				zap.Bool("sourceDisabled", versioningDisabled),
+				zap.Bool("destinationDisabled", destDisabled),
+			)
+		}
+		s3obj.preflight.passed("versioning is enabled on the source and destination buckets")
+	}
+	if args.PreserveObjectLock {
+		if lerr := s3obj.checkObjectLockEnabled(ctx, args.DestinationBucket); lerr != nil {
+			zap.L().Fatal("Preserving Object Lock settings requires Object Lock on the destination bucket", zap.Error(lerr))
+		}
+		s3obj.preflight.passed("Object Lock is enabled on the destination bucket")
+	}
+	if args.AssertOwnership != "" {
+		if oerr := s3obj.assertOwnership(ctx, args.DestinationBucket, args.AssertOwnership); oerr != nil {
+			zap.L().Fatal("Destination bucket object ownership does not match the expected ownership", zap.Error(oerr))
+		}
+		s3obj.preflight.passed("destination bucket object ownership is " + string(args.AssertOwnership))
+	}
+	if args.PreserveACL || len(args.Grants) > 0 {
+		if aerr := s3obj.checkACLsEnabled(ctx, args.DestinationBucket); aerr != nil {
+			zap.L().Fatal("Copying with ACLs requires ACLs on the destination bucket", zap.Error(aerr))
+		}
+		s3obj.preflight.passed("ACLs are enabled on the destination bucket")
+	}
+	if args.CleanupOlderThan > 0 {
+		if _, cerr := s3obj.cleanupManifests(ctx, args.SourceBucket, args.ConfigName, args.CleanupOlderThan, false); cerr != nil {
+			zap.L().Error("Failed to clean up stale manifests", zap.Error(cerr))
+		}
+	}
 	//  Setting up non default parameters.
 	nonDefaultArgs := &batchJobArgs{
 		AccountId:          aws.String(args.AccountID),
 		RoleArn:            aws.String(args.RoleArn),
 		SourceBucketName:   aws.String(args.SourceBucket),
 		TargetBucketName:   aws.String(args.DestinationBucket),
+		TargetRegion:       args.SourceRegion,
 		VersioningDisabled: versioningDisabled,
+		CannedACL:          args.CannedACL,
+		Grants:             args.Grants,
+		PreserveACL:        args.PreserveACL,
+		ChecksumAlgorithm:  args.ChecksumAlgorithm,
+		NewMetadata:        args.NewMetadata,
+	}
+	if args.Mode == ModeLambda {
+		nonDefaultArgs.FunctionArn = args.FunctionArn
+	}
+	if args.Mode == ModeReplicate {
+		if versioningDisabled {
+			zap.L().Fatal("Replication requires versioning on the source bucket", zap.String("bucket", args.SourceBucket))
+		}
+		if rerr := s3obj.checkReplicationConfigured(ctx, args.SourceBucket, args.DestinationBucket); rerr != nil {
+			zap.L().Fatal("Batch Replication requires replication to the destination to be configured", zap.Error(rerr))
+		}
+		s3obj.preflight.passed("replication to the destination bucket is configured")
+		// Replication keeps version IDs, so every version is replicated by one job in any order
+		nonDefaultArgs.Replicate = true
+		nonDefaultArgs.SingleManifest = true
 	}
 
 	// Setting  custom bucket object filters
 	filters := userFilters{
-		StartDate:  args.StartDt,
-		EndDate:    args.EndDt,
-		LatestOnly: args.LatestOnly,
-		kmsID:      args.KmsID,
+		StartDate:      args.StartDt,
+		EndDate:        args.EndDt,
+		Modified:       args.Modified,
+		LatestOnly:     args.LatestOnly,
+		SQL:            args.FilterSQL,
+		Encryption:     args.EncryptionStatuses,
+		SkipReplicated: args.SkipReplicated,
+		kmsID:          args.KmsID,
+	}
+
+	// Persist the job plan so that an interrupted run can be resumed with "watch --resume"
+	var st *runState
+	switch {
+	case args.ManifestArn != "":
+		st = s3obj.planExistingManifestJob(ctx, args, nonDefaultArgs)
+	case args.ManifestGenerator:
+		st = s3obj.planGeneratorJob(ctx, args, nonDefaultArgs, filters)
+	default:
+		st = s3obj.planManifestJobs(ctx, args, nonDefaultArgs, filters)
+	}
+	st.Expressions = s3obj.expressions
+	st.Preflight = &s3obj.preflight
+	return st
+}
+
+// Plan the batch jobs copying the objects listed in manifests built from inventory, a listing or a keys file
+func (s3obj *s3migration) planManifestJobs(ctx context.Context, args MigrationArgs, jobArgs *batchJobArgs, filters userFilters) *runState {
+	// Choose how the batch manifest(s) are produced
+	var (
+		buildManifest manifestBuilder
+		inventory     *inventoryReport // Inventory the manifests are filtered from, if any
+	)
+	if args.ListMode {
+		zap.L().Info("Building batch manifest by listing the source bucket, skipping inventory")
+		jobArgs.ManifestFields = batchManifestFields(jobArgs.VersioningDisabled)
+		buildManifest = s3obj.listManifest
+	} else if args.KeysFile != "" {
+		build, fields, kerr := s3obj.keysFileBuilder(args.KeysFile)
+		if kerr != nil {
+			zap.L().Fatal("Failed to read keys file", zap.Error(kerr))
+		}
+		jobArgs.ManifestFields = fields
+		jobArgs.SingleManifest = true
+		buildManifest = build
+	} else if args.ListInventory {
+		zap.L().Info("Building inventory report by listing the source bucket, skipping inventory setup")
+		listStart := time.Now()
+		listed, lerr := s3obj.listInventory(ctx, args.SourceBucket, jobArgs.VersioningDisabled)
+		if lerr != nil {
+			zap.L().Fatal("Failed to build inventory report from a listing", zap.Error(lerr))
+		}
+		s3obj.timePhase(PhaseUpload, listStart)
+		inventory = listed
+		buildManifest = s3obj.inventoryManifestBuilder(*inventory)
+	} else if args.LocalInventory != "" {
+		zap.L().Info("Using local inventory report, skipping inventory setup", zap.String("file", args.LocalInventory))
+		uploadStart := time.Now()
+		manifestFile, merr := s3obj.uploadLocalInventory(ctx, args.SourceBucket, args.LocalInventory)
+		if merr != nil {
+			zap.L().Fatal("Failed to upload local inventory report", zap.Error(merr))
+		}
+		s3obj.timePhase(PhaseUpload, uploadStart)
+		inventory = &inventoryReport{Bucket: s3obj.scratchBucket(args.SourceBucket), Manifest: *manifestFile}
+		buildManifest = s3obj.inventoryManifestBuilder(*inventory)
+	} else {
+		inventory = s3obj.waitForInventoryManifest(ctx, args)
+		buildManifest = s3obj.inventoryManifestBuilder(*inventory)
+	}
+	// Batch Replication, and a move deleting exactly the versions copied, need the version ID of each object,
+	// which the default inventory manifest leaves out
+	if inventory != nil && (args.ManifestFormat == ManifestFormatBatch || jobArgs.Replicate || args.Move) {
+		zap.L().Info("Filtering inventory into S3 Batch Operations CSV manifests")
+		jobArgs.ManifestFields = batchManifestFields(jobArgs.VersioningDisabled)
+	}
+
+	if args.MetadataFilter.enabled() {
+		buildManifest = s3obj.metadataFilteredBuilder(buildManifest, args.MetadataFilter)
 	}
 
 	// Build jpb input parameters
-	jobParams, err := s3mig.getJobParams(ctx, *manifestFile, nonDefaultArgs, filters)
+	jobParams, err := s3obj.getJobParams(ctx, buildManifest, jobArgs, filters)
 	if err != nil {
 		zap.L().Fatal("Failed to create batch parameters", zap.Error(err))
 	}
 
-	// Create S3 batch job(s)
-	jobOutput := new(jobResults)
-	zap.L().Info("Creating batch job")
-	if jobParams.nonVersionJobParam != nil {
-		jobOutParam, jobErr := s3mig.s3CtrClient.CreateJob(ctx, jobParams.nonVersionJobParam)
-		if jobErr != nil {
-			zap.L().Fatal("Failed to create batch job", zap.Error(jobErr))
-		}
-		jobOutput.nonVersionJobResult, err = s3mig.pollJobResult(ctx, args.AccountID, jobOutParam)
-		if err != nil {
-			zap.L().Fatal("Failed to get job status",
-				zap.String("jobId", *jobOutParam.JobId),
-				zap.Error(err),
-			)
+	st := newRunState(args.StateFile, args, jobParams)
+	if inventory != nil {
+		st.Inventory = fmt.Sprintf("s3://%s/%s", inventory.Bucket, aws.ToString(inventory.Manifest.Key))
+		st.InventoryCreated = inventory.Created
+	}
+	if args.MaxVersions > 0 && !jobArgs.VersioningDisabled {
+		if inventory == nil {
+			zap.L().Fatal("--max-versions needs an inventory to order the versions of each key")
+		}
+		if st.Steps, err = s3obj.limitVersionDepth(ctx, st.Steps, *inventory, args.MaxVersions); err != nil {
+			zap.L().Fatal("Failed to limit the non-current versions copied", zap.Error(err))
 		}
 	}
-
-	if jobParams.versionJobParam != nil {
-		// if there is any prior non versioned job, Check its results before proceeding
-		if jobParams.nonVersionJobParam != nil {
-			if jobOutput.nonVersionJobResult != nil {
-				zap.L().Info("Checking non version object job success threshold.")
-				jobSuccessThreshold := util.GetJobSuccessThreshold(jobOutput.nonVersionJobResult)
-				if jobSuccessThreshold < args.ReqSuccessThreshold {
-					zap.L().Fatal("Job Completed, failled to achieve required success threshold",
-						zap.Float32("Achieved ", jobSuccessThreshold),
-						zap.Float32("Required ", args.ReqSuccessThreshold),
-					)
-				}
-			}
-
+	concurrency := defaultHeadConcurrency
+	if args.MetadataFilter != nil {
+		concurrency = args.MetadataFilter.Concurrency
+	}
+	if args.SkipExisting {
+		allLatest := jobArgs.VersioningDisabled || jobArgs.SingleManifest
+		if st.Steps, err = s3obj.skipExisting(ctx, st.Steps, args, inventory, allLatest, concurrency); err != nil {
+			zap.L().Fatal("Failed to find objects already in the destination", zap.Error(err))
 		}
-		jobOutParam, jobErr := s3mig.s3CtrClient.CreateJob(ctx, jobParams.versionJobParam)
-		if jobErr != nil {
-			zap.L().Fatal("Failed to create batch job", zap.Error(jobErr))
+	}
+	// The inventory's sizes balance the chunks
+	var hist *keyHistogram
+	if inventory != nil && args.Chunks > 1 {
+		if hist, err = s3obj.inventoryHistogram(ctx, inventory.Bucket, inventory.Manifest); err != nil {
+			zap.L().Fatal("Failed to build key space histogram from inventory", zap.Error(err))
 		}
-		jobOutput.versionJobResult, err = s3mig.pollJobResult(ctx, args.AccountID, jobOutParam)
-		if err != nil {
-			zap.L().Fatal("Failed to get job status",
-				zap.String("jobId", *jobOutParam.JobId),
-				zap.Error(err),
-			)
+	}
+	if args.Chunks > 1 {
+		if st.Steps, err = s3obj.splitSteps(ctx, st.Steps, args.Chunks, hist); err != nil {
+			zap.L().Fatal("Failed to split batch manifests into chunks", zap.Error(err))
 		}
 	}
-	// At last, checking overall job completion success threshold
-	jobSuccessThreshold := util.GetJobSuccessThreshold(jobOutput.nonVersionJobResult, jobOutput.versionJobResult)
-	if jobSuccessThreshold < args.ReqSuccessThreshold {
-		zap.L().Fatal("Job Completed, failed to achieve required success threshold",
-			zap.Float32("Achieved ", jobSuccessThreshold),
-			zap.Float32("Required ", args.ReqSuccessThreshold),
-		)
+	if args.PreserveObjectLock {
+		if st.Steps, err = s3obj.splitStepsByObjectLock(ctx, st.Steps, concurrency); err != nil {
+			zap.L().Fatal("Failed to split batch jobs by Object Lock settings", zap.Error(err))
+		}
 	}
-	zap.L().Info("Job Completed, Achieved required success threshold",
-		zap.Float32("Achieved ", jobSuccessThreshold),
-		zap.Float32("Required ", args.ReqSuccessThreshold),
-	)
-	return nil
+	if args.PreserveACL {
+		if st.Steps, err = s3obj.splitStepsByACL(ctx, st.Steps, concurrency); err != nil {
+			zap.L().Fatal("Failed to split batch jobs by ACL", zap.Error(err))
+		}
+	}
+	if args.OrderVersions && !jobArgs.VersioningDisabled {
+		if st.Steps, err = s3obj.splitStepsByVersionOrder(ctx, st.Steps, concurrency); err != nil {
+			zap.L().Fatal("Failed to split non-current versions into ordered passes", zap.Error(err))
+		}
+	}
+	if args.Move || args.FailureReport {
+		for _, step := range st.Steps {
+			s3obj.enableFailureReport(step.Input, args.SourceBucket)
+		}
+	}
+	// Buckets that have never been versioned have no delete markers
+	if args.AnalyzeMarkers && !jobArgs.VersioningDisabled {
+		markers, merr := s3obj.deleteMarkerAnalysis(ctx, args.SourceBucket, inventory, args.PurgeEligibleFile)
+		if merr != nil {
+			zap.L().Error("Failed to analyze source delete markers", zap.Error(merr))
+		}
+		if s3obj.report != nil {
+			s3obj.report.DeleteMarkers = markers
+		}
+	}
+	if args.ReplayDeletes {
+		if st.Deletes, err = s3obj.collectDeleteMarkers(ctx, args.SourceBucket, inventory, filters); err != nil {
+			zap.L().Fatal("Failed to find delete markers to replay", zap.Error(err))
+		}
+	}
+	return st
 }
 
-// Polling job progress details and returns job completion details object
+// Plan a single batch job whose manifest is generated by S3 Batch Operations
+func (s3obj *s3migration) planGeneratorJob(ctx context.Context, args MigrationArgs, jobArgs *batchJobArgs, filters userFilters) *runState {
+	// The generator lists current versions only for copies, so non-current versions can't be copied this way
+	if !jobArgs.VersioningDisabled && filters.LatestOnly != util.IsLatestYes && !jobArgs.Replicate {
+		zap.L().Fatal("The manifest generator only copies current versions of a versioned bucket, use --latest-only Yes or an inventory")
+	}
+	input, generator := s3obj.generatorJobInput(ctx, jobArgs, filters, args.ReplicationStatuses)
+	if args.FailureReport {
+		s3obj.enableFailureReport(input, args.SourceBucket)
+	}
+	st := newRunState(args.StateFile, args, &jobInputParams{nonVersionJobParam: input})
+	st.Steps[0].Generator = generator
+	return st
+}
+
+// Polling job progress details and returns job completion details object.
+// Returns ErrJobPollTimeout if the job has not reached a terminal state within the poll timeout, and
+// ErrFailureSpike if it was cancelled for failing too many tasks.
 func (s3obj *s3migration) pollJobResult(ctx context.Context, accountID string, job *s3control.CreateJobOutput) (*s3control.DescribeJobOutput, error) {
-	// Sleep 15 seconds to allow the job to get some kind of update
-	zap.L().Info("Sleeping 15 seconds before checking initial job status")
-	time.Sleep(15 * time.Second)
+	pollInterval := s3obj.pollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	var deadline time.Time
+	if s3obj.pollTimeout > 0 {
+		deadline = time.Now().Add(s3obj.pollTimeout)
+	}
+	// Never sleep past the deadline, so the last check is made when the timeout is reached
+	untilDeadline := func(d time.Duration) time.Duration {
+		if deadline.IsZero() {
+			return d
+		}
+		return max(min(d, time.Until(deadline)), 0)
+	}
+
+	// Sleep before the first check to allow the job to get some kind of update
+	initialDelay := untilDeadline(min(initialPollDelay, pollInterval))
+	zap.L().Info("Sleeping before checking initial job status", zap.Duration("delay", initialDelay))
+	time.Sleep(initialDelay)
 
-	// Poll forever on the state of the batch job
+	// Poll on the state of the batch job until it is terminal or the timeout is exceeded
+	var lastStatus s3controltypes.JobStatus
 	for {
-		jobStatus, jobStatusErr := s3obj.s3CtrClient.DescribeJob(ctx, &s3control.DescribeJobInput{
-			AccountId: aws.String(accountID),
-			JobId:     job.JobId,
-		})
+		s3obj.heartbeat.Beat()
+		jobStatus, jobStatusErr := s3obj.describeJob(ctx, accountID, *job.JobId)
 		if jobStatusErr != nil {
 			return nil, jobStatusErr
 		}
-		zap.L().Info("Copy job status",
+		s3obj.pollLogger(jobStatus.Job.Status != lastStatus).Info("Copy job status",
 			zap.String("jobId", *job.JobId),
 			zap.Any("status", jobStatus.Job.Status),
 			zap.Int64("failed", *jobStatus.Job.ProgressSummary.NumberOfTasksFailed),
 			zap.Int64("succeeded", *jobStatus.Job.ProgressSummary.NumberOfTasksSucceeded),
 			zap.Int64("total", *jobStatus.Job.ProgressSummary.TotalNumberOfTasks),
 		)
+		lastStatus = jobStatus.Job.Status
+		s3obj.progress.jobProgress(jobStatus)
+		s3obj.stream.jobStatus(jobStatus)
+		if err := s3obj.cancelOnFailureSpike(ctx, accountID, jobStatus); err != nil {
+			return jobStatus, err
+		}
 		if util.IsTerminal(jobStatus.Job.Status) {
 			return jobStatus, nil
 		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return jobStatus, fmt.Errorf("%w: job %s still %s after %s", ErrJobPollTimeout,
+				*job.JobId, jobStatus.Job.Status, s3obj.pollTimeout)
+		}
 		// Unlike manifest polling, we expect S3 Batch operations to complete quickly
-		// Therefore we can use a short, standard 60 second poll
-		zap.L().Info("Batch job not complete, sleeping 60 seconds before checking status")
-		time.Sleep(60 * time.Second)
+		// Therefore we can use a short, standard poll interval
+		sleep := untilDeadline(pollInterval)
+		s3obj.pollLogger(false).Info("Batch job not complete, sleeping before checking status",
+			zap.Duration("pollInterval", sleep),
+		)
+		time.Sleep(sleep)
 	}
 }
 
-func (s3obj *s3migration) getJobParams(ctx context.Context, manifestFile s3types.Object, jobArgs *batchJobArgs, filters userFilters) (*jobInputParams, error) {
+// DescribeJob, retrying throttling and transient 503 responses with exponential backoff and jitter
+func (s3obj *s3migration) describeJob(ctx context.Context, accountID, jobID string) (*s3control.DescribeJobOutput, error) {
+	for attempt := 0; ; attempt++ {
+		out, err := s3obj.s3CtrClient.DescribeJob(ctx, &s3control.DescribeJobInput{
+			AccountId: aws.String(accountID),
+			JobId:     aws.String(jobID),
+		})
+		if err == nil || !util.IsThrottlingError(err) || attempt >= describeJobMaxRetries {
+			return out, err
+		}
+		delay := util.BackoffDelay(attempt, describeJobBackoffBase, describeJobBackoffMax)
+		s3obj.progress.retry(retryDescribeJob)
+		zap.L().Warn("DescribeJob throttled, backing off before retry",
+			zap.String("jobId", jobID),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		time.Sleep(delay)
+	}
+}
 
-	jobParams := new(jobInputParams)
-	createJobInput := func(manifestFile s3types.Object, jobArgs *batchJobArgs, filters userFilters) *s3control.CreateJobInput {
+// In quiet mode, repetitive polling entries below warn level are dropped so that
+// only state transitions are logged
+func (s3obj *s3migration) pollLogger(transition bool) *zap.Logger {
+	if s3obj.quiet && !transition {
+		return zap.L().WithOptions(zap.IncreaseLevel(zap.WarnLevel))
+	}
+	return zap.L()
+}
+
+// Filter the given inventory manifest for each job
+func (s3obj *s3migration) inventoryManifestBuilder(inventory inventoryReport) manifestBuilder {
+	return func(ctx context.Context, jobArgs *batchJobArgs, filters userFilters) (*s3types.Object, error) {
 		zap.L().Info("Inventory manifest versioning is disabled, filtering manifest file")
-		manifest, err := s3obj.filterManifestCsv(ctx, jobArgs, manifestFile, filters)
+		return s3obj.filterManifestCsv(ctx, jobArgs, inventory, filters)
+	}
+}
+
+func (s3obj *s3migration) getJobParams(ctx context.Context, buildManifest manifestBuilder, jobArgs *batchJobArgs, filters userFilters) (*jobInputParams, error) {
+
+	jobParams := new(jobInputParams)
+	createJobInput := func(jobArgs *batchJobArgs, filters userFilters) *s3control.CreateJobInput {
+		manifest, err := buildManifest(ctx, jobArgs, filters)
 		if err != nil {
 			zap.L().Fatal("Failed to create filtered manifest file", zap.Error(err))
 		}
 
-		manifestObjectArn := util.GetArn(fmt.Sprintf("%s/%s", *jobArgs.SourceBucketName, *manifest.Key))
+		manifestObjectArn := util.GetArn(s3obj.cfg.Region, fmt.Sprintf("%s/%s", s3obj.scratchBucket(*jobArgs.SourceBucketName), *manifest.Key))
 		zap.L().Debug("Manifest object ARN", zap.String("ARN", *manifestObjectArn))
 		jobArgs.ManifestETag = manifest.ETag
 		jobArgs.ManifestArn = manifestObjectArn
 
 		jobInputs := NewCreateJobInput(jobArgs)
-		// If the target bucket ACL setting is "BucketOwnerEnforced", then
-		// use a canned ACL to avoid issues of invalid source object ACLs
-		enforced, err := s3obj.isOwnershipEnforced(ctx, *jobArgs.TargetBucketName)
-		if err != nil {
-			zap.L().Warn("Failed to get destination bucket ownership setting", zap.Error(err))
-		}
-		if err == nil && enforced {
-			zap.L().Info("Destination bucket ownership setting is enforced, using canned bucket owner full control ACL")
-			jobInputs.Operation.S3PutObjectCopy.CannedAccessControlList = s3controltypes.S3CannedAccessControlListBucketOwnerFullControl
-		}
+		s3obj.setJobOperation(ctx, jobArgs, jobInputs)
 
 		return jobInputs
 	}
 
 	// For non version bucket create non version job paramters
-	if jobArgs.VersioningDisabled {
-		jobParams.nonVersionJobParam = createJobInput(manifestFile, jobArgs, filters)
+	if jobArgs.VersioningDisabled || jobArgs.SingleManifest {
+		jobParams.nonVersionJobParam = createJobInput(jobArgs, filters)
 		return jobParams, nil
 	}
 	// Incase user has requested for latest objects only from versioned bucket
 	if filters.LatestOnly == "Yes" {
-		jobParams.versionJobParam = createJobInput(manifestFile, jobArgs, filters)
+		jobParams.versionJobParam = createJobInput(jobArgs, filters)
 		return jobParams, nil
 	}
 
@@ -553,10 +1198,10 @@ func (s3obj *s3migration) getJobParams(ctx context.Context, manifestFile s3types
 	// another is for non latest versioned objects. we will be copying non latest version objects first and then latest version,
 	// by doing this, we will be avoiding any overwriting of older version object over newer version
 	filters.LatestOnly = "Yes"
-	jobParams.versionJobParam = createJobInput(manifestFile, jobArgs, filters)
+	jobParams.versionJobParam = createJobInput(jobArgs, filters)
 
 	filters.LatestOnly = "No"
-	jobParams.nonVersionJobParam = createJobInput(manifestFile, jobArgs, filters)
+	jobParams.nonVersionJobParam = createJobInput(jobArgs, filters)
 
 	return jobParams, nil
 }
@@ -1,8 +1,13 @@
 package migration
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"io"
+	"s3migration/util"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -10,11 +15,40 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 )
 
 type mock struct {
 	listObjectsV2Output *s3.ListObjectsV2Output
+	objectOwnership     s3types.ObjectOwnership
+	ownershipErr        error
+	bucketPolicy        string
+
+	listObjectVersionsOutput *s3.ListObjectVersionsOutput
+	objects                  map[string]string // When not nil, PutObject stores bodies by key and GetObject serves them
+	deleted                  []string
+	heads                    map[string]*s3.HeadObjectOutput // When not nil, HeadObject serves these by key, missing keys are NotFound
+	inventoryConfig          *s3types.InventoryConfiguration // Last configuration put
+	replication              *s3types.ReplicationConfiguration
+	objectLock               *s3types.ObjectLockConfiguration
+	headBucketErr            error                             // Returned by HeadBucket calls checking the expected bucket owner
+	acls                     map[string]*s3.GetObjectAclOutput // When not nil, GetObjectAcl serves these by key, missing keys are NoSuchKey
+	encryption               *s3types.ServerSideEncryptionRule
+	deletedConfig            string // Id of the inventory configuration deleted
+	selectErr                error  // Returned by SelectObjectContent
+	lastPut                  *s3.PutObjectInput
+	missingBuckets           []string // HeadBucket returns NotFound for these, until created
+	bucketCalls              []string // Bucket creation and settings calls, as "Operation bucket"
+	publicAccessBlock        *s3types.PublicAccessBlockConfiguration
+	lifecycleRules           []s3types.LifecycleRule            // Source lifecycle rules, the last rules put
+	notifications            *s3types.NotificationConfiguration // Source event notifications, the last configuration put
+	corsRules                []s3types.CORSRule                 // Source CORS rules, the last rules put
+	website                  *s3types.WebsiteConfiguration      // Source website configuration, the last configuration put
+	bucketTags               []s3types.Tag                      // Source bucket tags, the last tags put
+	logging                  *s3types.LoggingEnabled            // Source access logging, the last logging put
 }
 
 func (m *mock) GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
@@ -26,6 +60,9 @@ func (m *mock) GetBucketInventoryConfiguration(ctx context.Context, params *s3.G
 }
 
 func (m *mock) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if body, ok := m.objects[*params.Key]; ok {
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+	}
 	stringReader := strings.NewReader(`{
 		"sourceBucket" : "testsurcebucket",
 		"destinationBucket" : "arn:aws:s3:::inventorybucket-test1",
@@ -49,9 +86,15 @@ func (m *mock) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input,
 }
 
 func (m *mock) PutBucketInventoryConfiguration(ctx context.Context, params *s3.PutBucketInventoryConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketInventoryConfigurationOutput, error) {
+	m.inventoryConfig = params.InventoryConfiguration
 	return &s3.PutBucketInventoryConfigurationOutput{}, nil
 }
 func (m *mock) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.lastPut = params
+	if m.objects != nil {
+		body, _ := io.ReadAll(params.Body)
+		m.objects[*params.Key] = string(body)
+	}
 	return &s3.PutObjectOutput{}, nil
 }
 
@@ -64,6 +107,9 @@ func (m *mock) AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInp
 
 }
 func (m *mock) SelectObjectContent(c context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error) {
+	if m.selectErr != nil {
+		return nil, m.selectErr
+	}
 	return &s3.SelectObjectContentOutput{}, nil
 }
 
@@ -71,8 +117,187 @@ func (m *mock) CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadI
 	return &s3.CreateMultipartUploadOutput{}, nil
 }
 
+func (m *mock) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	for _, obj := range params.Delete.Objects {
+		m.deleted = append(m.deleted, *obj.Key)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (m *mock) GetBucketReplication(ctx context.Context, params *s3.GetBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error) {
+	if m.replication == nil {
+		return nil, &smithy.GenericAPIError{Code: "ReplicationConfigurationNotFoundError"}
+	}
+	return &s3.GetBucketReplicationOutput{ReplicationConfiguration: m.replication}, nil
+}
+
+func (m *mock) GetObjectLockConfiguration(ctx context.Context, params *s3.GetObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	if m.objectLock == nil {
+		return nil, &smithy.GenericAPIError{Code: "ObjectLockConfigurationNotFoundError"}
+	}
+	return &s3.GetObjectLockConfigurationOutput{ObjectLockConfiguration: m.objectLock}, nil
+}
+
+func (m *mock) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	rule := s3types.ServerSideEncryptionRule{ApplyServerSideEncryptionByDefault: &s3types.ServerSideEncryptionByDefault{SSEAlgorithm: s3types.ServerSideEncryptionAes256}}
+	if m.encryption != nil {
+		rule = *m.encryption
+	}
+	return &s3.GetBucketEncryptionOutput{ServerSideEncryptionConfiguration: &s3types.ServerSideEncryptionConfiguration{Rules: []s3types.ServerSideEncryptionRule{rule}}}, nil
+}
+
+func (m *mock) DeleteBucketInventoryConfiguration(ctx context.Context, params *s3.DeleteBucketInventoryConfigurationInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketInventoryConfigurationOutput, error) {
+	m.inventoryConfig = nil
+	m.deletedConfig = *params.Id
+	return &s3.DeleteBucketInventoryConfigurationOutput{}, nil
+}
+
+func (m *mock) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	if params.ExpectedBucketOwner != nil && m.headBucketErr != nil {
+		return nil, m.headBucketErr
+	}
+	if slices.Contains(m.missingBuckets, *params.Bucket) {
+		return nil, &s3types.NotFound{}
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (m *mock) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	m.missingBuckets = slices.DeleteFunc(m.missingBuckets, func(b string) bool { return b == *params.Bucket })
+	m.bucketCalls = append(m.bucketCalls, "CreateBucket "+*params.Bucket)
+	return &s3.CreateBucketOutput{}, nil
+}
+
+func (m *mock) PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketVersioning "+*params.Bucket)
+	return &s3.PutBucketVersioningOutput{}, nil
+}
+
+func (m *mock) PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketEncryption "+*params.Bucket)
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+func (m *mock) PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketOwnershipControls "+*params.Bucket)
+	return &s3.PutBucketOwnershipControlsOutput{}, nil
+}
+
+func (m *mock) GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error) {
+	if m.publicAccessBlock == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchPublicAccessBlockConfiguration"}
+	}
+	return &s3.GetPublicAccessBlockOutput{PublicAccessBlockConfiguration: m.publicAccessBlock}, nil
+}
+
+func (m *mock) PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutPublicAccessBlock "+*params.Bucket)
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+func (m *mock) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	if m.lifecycleRules == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchLifecycleConfiguration"}
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{Rules: m.lifecycleRules}, nil
+}
+
+func (m *mock) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketLifecycleConfiguration "+*params.Bucket)
+	m.lifecycleRules = params.LifecycleConfiguration.Rules
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+func (m *mock) GetBucketNotificationConfiguration(ctx context.Context, params *s3.GetBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketNotificationConfigurationOutput, error) {
+	if m.notifications == nil {
+		return &s3.GetBucketNotificationConfigurationOutput{}, nil
+	}
+	return &s3.GetBucketNotificationConfigurationOutput{
+		TopicConfigurations:          m.notifications.TopicConfigurations,
+		QueueConfigurations:          m.notifications.QueueConfigurations,
+		LambdaFunctionConfigurations: m.notifications.LambdaFunctionConfigurations,
+		EventBridgeConfiguration:     m.notifications.EventBridgeConfiguration,
+	}, nil
+}
+
+func (m *mock) PutBucketNotificationConfiguration(ctx context.Context, params *s3.PutBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketNotificationConfigurationOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketNotificationConfiguration "+*params.Bucket)
+	m.notifications = params.NotificationConfiguration
+	return &s3.PutBucketNotificationConfigurationOutput{}, nil
+}
+
+func (m *mock) GetBucketCors(ctx context.Context, params *s3.GetBucketCorsInput, optFns ...func(*s3.Options)) (*s3.GetBucketCorsOutput, error) {
+	if m.corsRules == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchCORSConfiguration"}
+	}
+	return &s3.GetBucketCorsOutput{CORSRules: m.corsRules}, nil
+}
+
+func (m *mock) PutBucketCors(ctx context.Context, params *s3.PutBucketCorsInput, optFns ...func(*s3.Options)) (*s3.PutBucketCorsOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketCors "+*params.Bucket)
+	m.corsRules = params.CORSConfiguration.CORSRules
+	return &s3.PutBucketCorsOutput{}, nil
+}
+
+func (m *mock) GetBucketWebsite(ctx context.Context, params *s3.GetBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.GetBucketWebsiteOutput, error) {
+	if m.website == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchWebsiteConfiguration"}
+	}
+	return &s3.GetBucketWebsiteOutput{
+		IndexDocument:         m.website.IndexDocument,
+		ErrorDocument:         m.website.ErrorDocument,
+		RedirectAllRequestsTo: m.website.RedirectAllRequestsTo,
+		RoutingRules:          m.website.RoutingRules,
+	}, nil
+}
+
+func (m *mock) PutBucketWebsite(ctx context.Context, params *s3.PutBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.PutBucketWebsiteOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketWebsite "+*params.Bucket)
+	m.website = params.WebsiteConfiguration
+	return &s3.PutBucketWebsiteOutput{}, nil
+}
+
+func (m *mock) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	if m.bucketTags == nil {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchTagSet"}
+	}
+	return &s3.GetBucketTaggingOutput{TagSet: m.bucketTags}, nil
+}
+
+func (m *mock) PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketTagging "+*params.Bucket)
+	m.bucketTags = params.Tagging.TagSet
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+func (m *mock) GetBucketLogging(ctx context.Context, params *s3.GetBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketLoggingOutput, error) {
+	return &s3.GetBucketLoggingOutput{LoggingEnabled: m.logging}, nil
+}
+
+func (m *mock) PutBucketLogging(ctx context.Context, params *s3.PutBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketLoggingOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketLogging "+*params.Bucket)
+	m.logging = params.BucketLoggingStatus.LoggingEnabled
+	return &s3.PutBucketLoggingOutput{}, nil
+}
+
+func (m *mock) GetObjectAcl(ctx context.Context, params *s3.GetObjectAclInput, optFns ...func(*s3.Options)) (*s3.GetObjectAclOutput, error) {
+	if m.acls != nil {
+		if acl, ok := m.acls[*params.Key]; ok {
+			return acl, nil
+		}
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectAclOutput{}, nil
+}
+
 func (m *mock) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
-	return &s3.HeadObjectOutput{}, nil
+	if m.heads != nil {
+		if head, ok := m.heads[*params.Key]; ok {
+			return head, nil
+		}
+		return nil, &s3types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{ETag: aws.String("test-etag")}, nil
 }
 
 func (m *mock) UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
@@ -80,7 +305,29 @@ func (m *mock) UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Opti
 }
 
 func (m *mock) GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
-	return nil, nil
+	if m.ownershipErr != nil {
+		return nil, m.ownershipErr
+	}
+	return &s3.GetBucketOwnershipControlsOutput{OwnershipControls: &s3types.OwnershipControls{
+		Rules: []s3types.OwnershipControlsRule{{ObjectOwnership: m.objectOwnership}},
+	}}, nil
+}
+
+func (m *mock) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	if m.bucketPolicy == "" {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchBucketPolicy"}
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(m.bucketPolicy)}, nil
+}
+
+func (m *mock) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	m.bucketCalls = append(m.bucketCalls, "PutBucketPolicy "+*params.Bucket)
+	m.bucketPolicy = *params.Policy
+	return &s3.PutBucketPolicyOutput{}, nil
+}
+
+func (m *mock) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	return m.listObjectVersionsOutput, nil
 }
 
 var s3mig *s3migration
@@ -95,7 +342,7 @@ func TestIsVersioningDisabled(t *testing.T) {
 
 func TestEnsureS3InventoryConfig(t *testing.T) {
 	s3mig = &s3migration{s3Client: new(mock)}
-	v, er := s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", "testconfig", false)
+	v, er := s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", "testconfig", false, "")
 	if er != nil {
 		t.Errorf("failed %v", er)
 	}
@@ -104,6 +351,89 @@ func TestEnsureS3InventoryConfig(t *testing.T) {
 	}
 }
 
+func TestEnsureS3InventoryConfigFrequency(t *testing.T) {
+	m := new(mock)
+	s3mig = &s3migration{s3Client: m}
+	v, er := s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", inventoryConfigName, true, s3types.InventoryFrequencyWeekly)
+	assert.NoError(t, er)
+	assert.Equal(t, s3types.InventoryFrequencyWeekly, m.inventoryConfig.Schedule.Frequency)
+	assert.Equal(t, s3types.InventoryFrequencyWeekly, v.Frequency)
+	assert.Equal(t, -8, v.DateWindow)
+
+	v, er = s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", inventoryConfigName, true, "")
+	assert.NoError(t, er)
+	assert.Equal(t, s3types.InventoryFrequencyDaily, m.inventoryConfig.Schedule.Frequency)
+	assert.Equal(t, s3types.InventoryFrequencyDaily, v.Frequency)
+	assert.Equal(t, -1, v.DateWindow)
+}
+
+func TestEnsureS3InventoryConfigFields(t *testing.T) {
+	m := new(mock)
+	s3mig = &s3migration{s3Client: m}
+	_, er := s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", inventoryConfigName, true, "")
+	assert.NoError(t, er)
+	assert.Len(t, m.inventoryConfig.OptionalFields, len(DefaultInventoryFields))
+	assert.Contains(t, m.inventoryConfig.OptionalFields, s3types.InventoryOptionalFieldETag)
+
+	s3mig.inventoryFields = []string{"Size", "StorageClass", "ObjectLockMode"}
+	_, er = s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", inventoryConfigName, true, "")
+	assert.NoError(t, er)
+	assert.Equal(t, []s3types.InventoryOptionalField{s3types.InventoryOptionalFieldSize,
+		s3types.InventoryOptionalFieldStorageClass, s3types.InventoryOptionalFieldObjectLockMode}, m.inventoryConfig.OptionalFields)
+}
+
+func TestEnsureS3InventoryConfigDestinationBucket(t *testing.T) {
+	m := new(mock)
+	s3mig = &s3migration{s3Client: m, inventoryBucket: "inventory"}
+	v, er := s3mig.ensureS3InventoryConfig(context.TODO(), "testbucket", inventoryConfigName, true, "")
+	assert.NoError(t, er)
+	assert.Equal(t, "arn:aws:s3:::inventory", *m.inventoryConfig.Destination.S3BucketDestination.Bucket)
+	assert.Equal(t, "inventory", v.BucketName)
+	assert.Equal(t, "testbucket/bulk-copy-inventory/", v.Prefix)
+	assert.Equal(t, "testbucket", v.SourceBucket)
+}
+
+func TestFilterGzippedCsvLocally(t *testing.T) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write([]byte("src,a.txt,v1,true,false\nsrc,a.txt,v0,false,false\nsrc,b.txt,v2,true,true\n"))
+	w.Close()
+	m := &mock{
+		objects:   map[string]string{"src/data/1.csv.gz": b.String()},
+		selectErr: &smithy.GenericAPIError{Code: "MethodNotAllowed"},
+	}
+	s3mig := &s3migration{s3Client: m}
+	expression, err := util.GetQueryExpression("Bucket, Key, VersionId, IsLatest, IsDeleteMarker", time.Time{}, time.Time{}, util.IsLatestYes, false)
+	assert.NoError(t, err)
+
+	out, err := io.ReadAll(s3mig.filterGzippedCsv(context.TODO(), "src", "src/data/1.csv.gz", expression))
+	assert.NoError(t, err)
+	assert.Equal(t, "src,a.txt\n", string(out))
+
+	// Without trying S3 Select
+	m.selectErr = errors.New("unexpected S3 Select call")
+	s3mig.localFilter = true
+	out, err = io.ReadAll(s3mig.filterGzippedCsv(context.TODO(), "src", "src/data/1.csv.gz", expression))
+	assert.NoError(t, err)
+	assert.Equal(t, "src,a.txt\n", string(out))
+}
+
+func TestUploadS3FileEncryption(t *testing.T) {
+	m := &mock{}
+	s3mig := &s3migration{s3Client: m}
+	_, err := s3mig.uploadS3File(context.TODO(), "src", "manifest.csv", strings.NewReader("src,a.txt\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, s3types.ServerSideEncryptionAes256, m.lastPut.ServerSideEncryption)
+	assert.Nil(t, m.lastPut.SSEKMSKeyId)
+
+	s3mig.kmsKey = "arn:aws:kms:us-east-1:111122223333:key/abcd"
+	_, err = s3mig.uploadS3File(context.TODO(), "src", "manifest.csv", strings.NewReader("src,a.txt\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, s3types.ServerSideEncryptionAwsKms, m.lastPut.ServerSideEncryption)
+	assert.Equal(t, s3mig.kmsKey, aws.ToString(m.lastPut.SSEKMSKeyId))
+	assert.True(t, aws.ToBool(m.lastPut.BucketKeyEnabled))
+}
+
 func TestBuildCopyJobArgs(t *testing.T) {
 	s3mig = &s3migration{s3Client: new(mock)}
 	out := NewCreateJobInput(&batchJobArgs{
@@ -124,7 +454,7 @@ func TestGetLatestManifest(t *testing.T) {
 		listObjectsV2Output: &s3.ListObjectsV2Output{
 			CommonPrefixes: []s3types.CommonPrefix{},
 			Contents: []s3types.Object{{ETag: aws.String("/testetag/"),
-				Key: aws.String("/inventorybucket/manifest.json"), LastModified: aws.Time(time.Now().Add(-1))}},
+				Key: aws.String("testsurcebucket/bulk-copy-inventory/2024-04-15T01-00Z/manifest.json"), LastModified: aws.Time(time.Now().Add(-1))}},
 		},
 	}}
 	out, er := s3mig.getLatestManifest(context.TODO(), &inventoryManifestFinderArgs{
@@ -140,6 +470,121 @@ func TestGetLatestManifest(t *testing.T) {
 	}
 }
 
+func TestGetLatestManifestSharedDestination(t *testing.T) {
+	prefix := "inventories/src/bulk-copy-inventory/"
+	manifest := func(sourceBucket string) string {
+		return `{"sourceBucket": "` + sourceBucket + `", "fileSchema": "Bucket, Key", "files": []}`
+	}
+	s3mig = &s3migration{s3Client: &mock{
+		listObjectsV2Output: &s3.ListObjectsV2Output{
+			Contents: []s3types.Object{
+				{Key: aws.String(prefix + "2024-04-14T01-00Z/manifest.json"), LastModified: aws.Time(time.Now().Add(-2 * time.Hour))},
+				// Delivered to our prefix, but lists another source bucket
+				{Key: aws.String(prefix + "2024-04-15T01-00Z/manifest.json"), LastModified: aws.Time(time.Now().Add(-time.Hour))},
+				// Not a dated manifest folder directly under our prefix
+				{Key: aws.String(prefix + "hive/dt=2024-04-15-01-00/manifest.json"), LastModified: aws.Time(time.Now())},
+				{Key: aws.String("inventories/src/bulk-copy-inventory-2/2024-04-15T01-00Z/manifest.json"), LastModified: aws.Time(time.Now())},
+			},
+		},
+		objects: map[string]string{
+			prefix + "2024-04-14T01-00Z/manifest.json": manifest("src"),
+			prefix + "2024-04-15T01-00Z/manifest.json": manifest("other"),
+		},
+	}}
+	out, err := s3mig.getLatestManifest(context.TODO(), &inventoryManifestFinderArgs{
+		BucketName:   "shared-inventories",
+		Prefix:       prefix,
+		DateWindow:   -1,
+		SourceBucket: "src",
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, out) {
+		assert.Equal(t, prefix+"2024-04-14T01-00Z/manifest.json", *out.Key)
+	}
+
+	// Only other buckets' manifests
+	s3mig.s3Client.(*mock).objects[prefix+"2024-04-14T01-00Z/manifest.json"] = manifest("other")
+	out, err = s3mig.getLatestManifest(context.TODO(), &inventoryManifestFinderArgs{
+		BucketName:   "shared-inventories",
+		Prefix:       prefix,
+		DateWindow:   -1,
+		SourceBucket: "src",
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, out)
+}
+
+// Lists the manifests only from the given listing on, as if they were delivered while polling
+type deliveryMock struct {
+	*mock
+	deliveredAt int
+	listings    int
+}
+
+func (m *deliveryMock) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.listings++
+	if m.listings < m.deliveredAt {
+		return &s3.ListObjectsV2Output{}, nil
+	}
+	return m.mock.ListObjectsV2(ctx, params, optFns...)
+}
+
+func TestPollInventoryManifest(t *testing.T) {
+	finder := &inventoryManifestFinderArgs{BucketName: "inventory", Prefix: "src/bulk-copy-inventory/", DateWindow: -1}
+	listing := &s3.ListObjectsV2Output{Contents: []s3types.Object{
+		{Key: aws.String("src/bulk-copy-inventory/2024-04-15T01-00Z/manifest.json"), LastModified: aws.Time(time.Now().Add(-time.Hour))},
+	}}
+
+	// A report delivered when the wait is up is still found, by a last check at the deadline
+	m := &deliveryMock{mock: &mock{listObjectsV2Output: listing}, deliveredAt: 2}
+	s3mig := &s3migration{s3Client: m}
+	manifest := s3mig.pollInventoryManifest(context.TODO(), finder, 20*time.Millisecond, 20*time.Millisecond)
+	if assert.NotNil(t, manifest) {
+		assert.Equal(t, "src/bulk-copy-inventory/2024-04-15T01-00Z/manifest.json", *manifest.Key)
+	}
+	assert.Equal(t, 2, m.listings)
+
+	// Otherwise the wait gives up at the deadline, not an interval early, and never sleeps past it
+	m = &deliveryMock{mock: &mock{listObjectsV2Output: listing}, deliveredAt: 1000}
+	s3mig = &s3migration{s3Client: m}
+	start := time.Now()
+	assert.Nil(t, s3mig.pollInventoryManifest(context.TODO(), finder, 3*time.Millisecond, 10*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, m.listings, 2)
+	assert.LessOrEqual(t, m.listings, 5)
+}
+
+func TestIsInventoryManifestKey(t *testing.T) {
+	prefix := "inventories/src/cfg/"
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{prefix + "2024-04-15T01-00Z/manifest.json", true},
+		{prefix + "manifest.json", false},
+		{prefix + "hive/dt=2024-04-15-01-00/manifest.json", false},
+		{prefix + "2024-04-15T01-00Z/manifest.checksum", false},
+		{"inventories/src/cfg-2/2024-04-15T01-00Z/manifest.json", false},
+		{"inventories/other/cfg/2024-04-15T01-00Z/manifest.json", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isInventoryManifestKey(prefix, tt.key), tt.key)
+	}
+}
+
+func TestFilteredManifestKey(t *testing.T) {
+	data := "inventories/src/cfg/data/573a77fc.csv.gz"
+	latest := filteredManifestKey("src", data, "select latest")
+	noncurrent := filteredManifestKey("src", data, "select noncurrent")
+	assert.True(t, strings.HasPrefix(latest, "src/bulk-copy-inventory/filtered/inventories/src/cfg/data/573a77fc-"))
+	assert.True(t, strings.HasSuffix(latest, ".csv"))
+	assert.NotEqual(t, latest, noncurrent)
+	assert.Equal(t, latest, filteredManifestKey("src", data, "select latest"))
+	// Another source bucket's data file under the same shared destination prefix
+	assert.NotEqual(t, latest, filteredManifestKey("src", "inventories/src2/cfg/data/573a77fc.csv.gz", "select latest"))
+	assert.True(t, isScratchManifest("src/bulk-copy-inventory/", latest))
+}
+
 func TestGetLatestManifest_2(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -198,3 +643,211 @@ func TestGetLatestManifest_2(t *testing.T) {
 		})
 	}
 }
+
+type ctrMock struct {
+	status          s3controltypes.JobStatus
+	requestedStatus s3controltypes.RequestedJobStatus
+	completeAfter   int // DescribeJob calls answered with status before the job completes, 0 never completes
+	describes       int
+	succeeded       map[string]int64 // Tasks succeeded of 10 by job ID, all of them when absent
+}
+
+func (m *ctrMock) CreateJob(ctx context.Context, params *s3control.CreateJobInput, optFns ...func(*s3control.Options)) (*s3control.CreateJobOutput, error) {
+	return &s3control.CreateJobOutput{JobId: aws.String("test-job")}, nil
+}
+
+func (m *ctrMock) DescribeJob(ctx context.Context, params *s3control.DescribeJobInput, optFns ...func(*s3control.Options)) (*s3control.DescribeJobOutput, error) {
+	m.describes++
+	status := m.status
+	if m.completeAfter > 0 && m.describes > m.completeAfter {
+		status = s3controltypes.JobStatusComplete
+	}
+	succeeded, ok := m.succeeded[aws.ToString(params.JobId)]
+	if !ok {
+		succeeded = 10
+	}
+	return &s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:  params.JobId,
+		Status: status,
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			NumberOfTasksFailed:    aws.Int64(10 - succeeded),
+			NumberOfTasksSucceeded: aws.Int64(succeeded),
+			TotalNumberOfTasks:     aws.Int64(10),
+		},
+	}}, nil
+}
+
+func (m *ctrMock) UpdateJobStatus(ctx context.Context, params *s3control.UpdateJobStatusInput, optFns ...func(*s3control.Options)) (*s3control.UpdateJobStatusOutput, error) {
+	m.requestedStatus = params.RequestedJobStatus
+	return &s3control.UpdateJobStatusOutput{}, nil
+}
+
+func TestConfirmJob(t *testing.T) {
+	testCases := []struct {
+		name        string
+		mode        string
+		answer      string
+		expected    s3controltypes.RequestedJobStatus
+		expectedErr bool
+	}{
+		{name: "Approved", mode: ConfirmPrompt, answer: "y\n", expected: s3controltypes.RequestedJobStatusReady},
+		{name: "Rejected", mode: ConfirmPrompt, answer: "n\n", expected: s3controltypes.RequestedJobStatusCancelled, expectedErr: true},
+		{name: "External", mode: ConfirmExternal, answer: "", expected: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctr := &ctrMock{status: s3controltypes.JobStatusSuspended}
+			s3mig = &s3migration{s3Client: new(mock), s3CtrClient: ctr}
+			err := s3mig.confirmJob(context.TODO(), "111122223333", &s3control.CreateJobInput{},
+				&s3control.CreateJobOutput{JobId: aws.String("test-job")}, tc.mode, strings.NewReader(tc.answer))
+			assert.Equal(t, tc.expectedErr, err != nil)
+			assert.Equal(t, tc.expected, ctr.requestedStatus)
+		})
+	}
+}
+
+func TestPollJobResult(t *testing.T) {
+	testCases := []struct {
+		name        string
+		status      s3controltypes.JobStatus
+		expectedErr error
+	}{
+		{name: "Complete", status: s3controltypes.JobStatusComplete, expectedErr: nil},
+		{name: "Timeout", status: s3controltypes.JobStatusActive, expectedErr: ErrJobPollTimeout},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s3mig = &s3migration{
+				s3Client:     new(mock),
+				s3CtrClient:  &ctrMock{status: tc.status},
+				pollInterval: time.Millisecond,
+				pollTimeout:  time.Millisecond,
+			}
+			out, err := s3mig.pollJobResult(context.TODO(), "111122223333", &s3control.CreateJobOutput{JobId: aws.String("test-job")})
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.Equal(t, tc.status, out.Job.Status)
+		})
+	}
+
+	// A job still running when less than a poll interval is left is checked once more when the timeout is reached
+	ctr := &ctrMock{status: s3controltypes.JobStatusActive, completeAfter: 1}
+	s3mig = &s3migration{s3Client: new(mock), s3CtrClient: ctr, pollInterval: 30 * time.Millisecond, pollTimeout: 50 * time.Millisecond}
+	start := time.Now()
+	out, err := s3mig.pollJobResult(context.TODO(), "111122223333", &s3control.CreateJobOutput{JobId: aws.String("test-job")})
+	assert.NoError(t, err)
+	assert.Equal(t, s3controltypes.JobStatusComplete, out.Job.Status)
+	assert.Equal(t, 2, ctr.describes)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestSelectCannedACL(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cannedACL string
+		ownership s3types.ObjectOwnership
+		expected  s3controltypes.S3CannedAccessControlList
+	}{
+		{name: "AutoEnforced", cannedACL: CannedACLAuto, ownership: s3types.ObjectOwnershipBucketOwnerEnforced,
+			expected: s3controltypes.S3CannedAccessControlListBucketOwnerFullControl},
+		{name: "AutoNotEnforced", cannedACL: CannedACLAuto, ownership: s3types.ObjectOwnershipObjectWriter, expected: ""},
+		{name: "NoneEnforced", cannedACL: CannedACLNone, ownership: s3types.ObjectOwnershipBucketOwnerEnforced, expected: ""},
+		{name: "Explicit", cannedACL: "private", ownership: s3types.ObjectOwnershipBucketOwnerEnforced,
+			expected: s3controltypes.S3CannedAccessControlListPrivate},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s3mig = &s3migration{s3Client: &mock{objectOwnership: tc.ownership}}
+			acl := s3mig.selectCannedACL(context.TODO(), &batchJobArgs{
+				TargetBucketName: aws.String("dummybucket"),
+				CannedACL:        tc.cannedACL,
+			})
+			assert.Equal(t, tc.expected, acl)
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	objects, bytes, err := parseScope([]string{"42", "1048576"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), objects)
+	assert.Equal(t, int64(1<<20), bytes)
+
+	// Nothing in scope has no sum, and inventories without sizes have no sum column
+	objects, bytes, err = parseScope([]string{"0", ""})
+	assert.NoError(t, err)
+	assert.Zero(t, objects+bytes)
+	objects, _, err = parseScope([]string{"7"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), objects)
+
+	_, _, err = parseScope([]string{"many"})
+	assert.Error(t, err)
+}
+
+func TestNewS3MigrationRetries(t *testing.T) {
+	cfg := aws.Config{Region: "us-east-1"}
+	s3mig := newS3Migration(cfg, MigrationArgs{SDKMaxAttempts: 10, SDKRetryMode: "adaptive", MaxAPITPS: 5})
+	options := s3mig.s3Client.(*s3.Client).Options()
+	assert.Equal(t, 10, options.RetryMaxAttempts)
+	assert.Equal(t, aws.RetryModeAdaptive, options.RetryMode)
+	assert.Len(t, options.APIOptions, 1)
+	assert.Empty(t, cfg.APIOptions)
+
+	// The SDK defaults are kept otherwise
+	options = newS3Migration(cfg, MigrationArgs{}).s3Client.(*s3.Client).Options()
+	assert.Zero(t, options.RetryMaxAttempts)
+	assert.Empty(t, options.APIOptions)
+}
+
+func TestNewCreateJobInputDestinations(t *testing.T) {
+	input := NewCreateJobInput(&batchJobArgs{AccountId: aws.String("111111111111"), TargetBucketName: aws.String("dest"), TargetRegion: "us-east-1"})
+	assert.Equal(t, "arn:aws:s3:::dest", *input.Operation.S3PutObjectCopy.TargetResource)
+	assert.Equal(t, s3controltypes.S3StorageClassStandard, input.Operation.S3PutObjectCopy.StorageClass)
+
+	input = NewCreateJobInput(&batchJobArgs{AccountId: aws.String("111111111111"), TargetBucketName: aws.String("dest--use1-az4--x-s3"), TargetRegion: "us-east-1"})
+	assert.Equal(t, "arn:aws:s3express:us-east-1:111111111111:bucket/dest--use1-az4--x-s3", *input.Operation.S3PutObjectCopy.TargetResource)
+	assert.Equal(t, s3ExpressOneZone, input.Operation.S3PutObjectCopy.StorageClass)
+
+	// Directory buckets don't support ACLs
+	s3mig := &s3migration{s3Client: &mock{objectOwnership: s3types.ObjectOwnershipBucketOwnerEnforced}}
+	assert.Empty(t, s3mig.selectCannedACL(context.TODO(), &batchJobArgs{TargetBucketName: aws.String("dest--use1-az4--x-s3"), CannedACL: CannedACLAuto}))
+}
+
+func TestFilterManifestCsvBytes(t *testing.T) {
+	var data bytes.Buffer
+	w := gzip.NewWriter(&data)
+	w.Write([]byte("src,a,100\nsrc,b,2000\nsrc,c,30000\n"))
+	w.Close()
+	m := &mock{objects: map[string]string{
+		"inv/manifest.json": `{"fileSchema": "Bucket, Key, Size", "files": [{"key": "inv/data.csv.gz"}]}`,
+		"inv/data.csv.gz":   data.String(),
+	}}
+	s3mig := &s3migration{s3Client: m, localFilter: true, report: &Report{}}
+	inventory := inventoryReport{Bucket: "src", Manifest: s3types.Object{Key: aws.String("inv/manifest.json")}}
+	args := &batchJobArgs{SourceBucketName: aws.String("src"), VersioningDisabled: true}
+
+	// A single manifest, not split into chunks, still sizes the run from the objects the filters select
+	_, err := s3mig.filterManifestCsv(context.TODO(), args, inventory, userFilters{SQL: "Size > 1000"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(32000), s3mig.report.Bytes)
+}
+
+func TestCheckDirectoryBucketVersions(t *testing.T) {
+	directory := MigrationArgs{SourceBucket: "src", DestinationBucket: "dst--use1-az4--x-s3"}
+	testCases := []struct {
+		name               string
+		args               MigrationArgs
+		versioningDisabled bool
+		valid              bool
+	}{
+		{name: "general purpose bucket", args: MigrationArgs{SourceBucket: "src", DestinationBucket: "dst"}, valid: true},
+		{name: "every version", args: directory, valid: false},
+		{name: "unversioned source", args: directory, versioningDisabled: true, valid: true},
+		{name: "latest versions", args: MigrationArgs{SourceBucket: "src", DestinationBucket: directory.DestinationBucket, LatestOnly: util.IsLatestYes}, valid: true},
+		{name: "keys file", args: MigrationArgs{SourceBucket: "src", DestinationBucket: directory.DestinationBucket, KeysFile: "keys.csv"}, valid: true},
+	}
+	for _, tc := range testCases {
+		err := checkDirectoryBucketVersions(tc.args, tc.versioningDisabled)
+		assert.Equal(t, tc.valid, err == nil, "%s: %v", tc.name, err)
+	}
+}
@@ -0,0 +1,83 @@
+package migration
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Scheduled runs are recorded in a directory per run named after the time the run started
+const scheduledRunLayout = "20060102T150405Z"
+
+// Files of a scheduled run in its directory
+const (
+	ScheduledStateFile  = "state.json"
+	ScheduledReportFile = "report.json"
+	ScheduledLogFile    = "run.log"
+)
+
+// Directory recording a scheduled run started at the given time
+func ScheduledRunDir(historyDir string, started time.Time) string {
+	return filepath.Join(historyDir, started.UTC().Format(scheduledRunLayout))
+}
+
+// Directories of the scheduled runs in the history, oldest first
+func scheduledRuns(historyDir string) ([]string, error) {
+	entries, err := os.ReadDir(historyDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	runs := []string{}
+	for _, e := range entries {
+		if _, perr := time.Parse(scheduledRunLayout, e.Name()); e.IsDir() && perr == nil {
+			runs = append(runs, e.Name())
+		}
+	}
+	slices.Sort(runs)
+	return runs, nil
+}
+
+// Start of the latest scheduled run that met its success threshold, from which the next run is
+// incremental.  Runs that failed, or didn't finish, are skipped so their objects are copied again.
+func LastSuccessfulRunStart(historyDir string) (time.Time, bool, error) {
+	runs, err := scheduledRuns(historyDir)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		report, rerr := LoadReport(filepath.Join(historyDir, runs[i], ScheduledReportFile))
+		if errors.Is(rerr, fs.ErrNotExist) {
+			continue
+		}
+		if rerr != nil {
+			return time.Time{}, false, rerr
+		}
+		if report.ThresholdMet {
+			return report.StartedAt, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// Delete all but the latest keep scheduled runs from the history, returning the directories deleted
+func PruneRunHistory(historyDir string, keep int) ([]string, error) {
+	runs, err := scheduledRuns(historyDir)
+	if err != nil || len(runs) <= keep {
+		return nil, err
+	}
+	removed := []string{}
+	for _, run := range runs[:len(runs)-keep] {
+		dir := filepath.Join(historyDir, run)
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeScheduledRun(t *testing.T, historyDir string, started time.Time, report string) {
+	dir := ScheduledRunDir(historyDir, started)
+	assert.NoError(t, os.MkdirAll(dir, 0700))
+	if report != "" {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, ScheduledReportFile), []byte(report), 0600))
+	}
+}
+
+func TestLastSuccessfulRunStart(t *testing.T) {
+	historyDir := t.TempDir()
+	_, ok, err := LastSuccessfulRunStart(filepath.Join(historyDir, "missing"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	day := time.Date(2024, 4, 15, 2, 0, 0, 0, time.UTC)
+	writeScheduledRun(t, historyDir, day, `{"startedAt": "2024-04-15T02:00:00Z", "thresholdMet": true}`)
+	writeScheduledRun(t, historyDir, day.AddDate(0, 0, 1), `{"startedAt": "2024-04-16T02:00:00Z", "thresholdMet": false}`)
+	// Killed before writing its report
+	writeScheduledRun(t, historyDir, day.AddDate(0, 0, 2), "")
+	assert.NoError(t, os.MkdirAll(filepath.Join(historyDir, "not-a-run"), 0700))
+
+	start, ok, err := LastSuccessfulRunStart(historyDir)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, day, start.UTC())
+}
+
+func TestPruneRunHistory(t *testing.T) {
+	historyDir := t.TempDir()
+	day := time.Date(2024, 4, 15, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		writeScheduledRun(t, historyDir, day.AddDate(0, 0, i), "")
+	}
+	removed, err := PruneRunHistory(historyDir, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(historyDir, "20240415T020000Z"), filepath.Join(historyDir, "20240416T020000Z")}, removed)
+	runs, err := scheduledRuns(historyDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20240417T020000Z", "20240418T020000Z"}, runs)
+
+	removed, err = PruneRunHistory(historyDir, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, removed)
+}
@@ -0,0 +1,139 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.uber.org/zap"
+)
+
+// Returned by checkRolePermissions when IAM policy simulation finds actions the batch role isn't allowed
+var ErrRolePermissions = errors.New("batch role is missing permissions the jobs need")
+
+type iamSimulateAPI interface {
+	SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+// An action on a resource the batch role's policies don't allow
+type DeniedPermission struct {
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	Decision string `json:"decision"` // implicitDeny or explicitDeny
+}
+
+// Simulate the role's IAM policies against every action and resource of grants, returning the
+// permutations that aren't allowed.  Resources of a bucket in bucketPolicies, by bucket ARN, are simulated
+// with its policy as the resource policy, so access granted by the bucket policy is allowed.  Key policies
+// and SCPs aren't evaluated.
+func simulateBatchRole(ctx context.Context, client iamSimulateAPI, roleArn string, grants []roleGrant, bucketPolicies map[string]string) ([]DeniedPermission, error) {
+	denied := []DeniedPermission{}
+	for _, g := range grants {
+		// One simulation per bucket, as it takes a single resource policy
+		var buckets []string
+		resources := map[string][]string{}
+		for _, r := range g.Resources {
+			b := bucketArnOf(r)
+			if _, ok := resources[b]; !ok {
+				buckets = append(buckets, b)
+			}
+			resources[b] = append(resources[b], r)
+		}
+		for _, b := range buckets {
+			input := &iam.SimulatePrincipalPolicyInput{
+				PolicySourceArn: aws.String(roleArn),
+				ActionNames:     g.Actions,
+				ResourceArns:    resources[b],
+			}
+			if policy, ok := bucketPolicies[b]; ok {
+				input.ResourcePolicy = aws.String(policy)
+			}
+			paginator := iam.NewSimulatePrincipalPolicyPaginator(client, input)
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					return nil, err
+				}
+				for _, r := range page.EvaluationResults {
+					if r.EvalDecision == iamtypes.PolicyEvaluationDecisionTypeAllowed {
+						continue
+					}
+					denied = append(denied, DeniedPermission{
+						Action:   aws.ToString(r.EvalActionName),
+						Resource: aws.ToString(r.EvalResourceName),
+						Decision: string(r.EvalDecision),
+					})
+				}
+			}
+		}
+	}
+	return denied, nil
+}
+
+// ARN of the bucket an S3 bucket or object ARN is in, eg. arn:aws:s3:::bucket for arn:aws:s3:::bucket/key,
+// or "" for other ARNs, eg. of a KMS key or an access point
+func bucketArnOf(resource string) string {
+	a, err := arn.Parse(resource)
+	if err != nil || a.Service != "s3" || a.Region != "" || a.AccountID != "" {
+		return ""
+	}
+	a.Resource, _, _ = strings.Cut(a.Resource, "/")
+	return a.String()
+}
+
+// Policies of the buckets of grants by bucket ARN.  Buckets without a policy, or whose policy can't be read,
+// are left out.
+func (s3obj *s3migration) bucketPolicies(ctx context.Context, grants []roleGrant) map[string]string {
+	policies := map[string]string{}
+	seen := map[string]bool{}
+	for _, g := range grants {
+		for _, r := range g.Resources {
+			b := bucketArnOf(r)
+			if b == "" || seen[b] {
+				continue
+			}
+			seen[b] = true
+			a, _ := arn.Parse(b)
+			out, err := s3obj.s3Client.GetBucketPolicy(ctx, &s3.GetBucketPolicyInput{Bucket: aws.String(a.Resource)})
+			if err != nil {
+				zap.L().Debug("Simulating without the bucket's policy", zap.String("bucket", a.Resource), zap.Error(err))
+				continue
+			}
+			policies[b] = aws.ToString(out.Policy)
+		}
+	}
+	return policies
+}
+
+// Log the permissions the batch role is missing for a run with args, and record them in the preflight results,
+// returning ErrRolePermissions when any are.  The buckets' policies are part of the simulation, key policies and
+// SCPs aren't, so a denial is a warning.  A failed simulation, eg. without iam:SimulatePrincipalPolicy, is only logged.
+func (s3obj *s3migration) checkRolePermissions(ctx context.Context, client iamSimulateAPI, args MigrationArgs) error {
+	grants := batchRoleGrants(args, s3obj.scratchBucket(args.SourceBucket))
+	denied, err := simulateBatchRole(ctx, client, args.RoleArn, grants, s3obj.bucketPolicies(ctx, grants))
+	if err != nil {
+		zap.L().Warn("Unable to simulate the batch role's permissions", zap.String("role", args.RoleArn), zap.Error(err))
+		return nil
+	}
+	s3obj.preflight.PermissionsChecked = true
+	s3obj.preflight.DeniedPermissions = denied
+	for _, d := range denied {
+		zap.L().Warn("Batch role is not allowed an action the jobs need",
+			zap.String("role", args.RoleArn),
+			zap.String("action", d.Action),
+			zap.String("resource", d.Resource),
+			zap.String("decision", d.Decision),
+		)
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("%w: %d action and resource permutations denied", ErrRolePermissions, len(denied))
+	}
+	zap.L().Info("Batch role is allowed every action the jobs need", zap.String("role", args.RoleArn), zap.Int("grants", len(grants)))
+	return nil
+}
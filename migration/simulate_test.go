@@ -0,0 +1,80 @@
+package migration
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type simulateMock struct {
+	allowed map[string]bool // By "action resource"
+}
+
+// Allowed by the role's policies, or by a resource policy naming the action and resource
+
+func (m *simulateMock) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	out := &iam.SimulatePrincipalPolicyOutput{}
+	for _, action := range params.ActionNames {
+		for _, resource := range params.ResourceArns {
+			decision := iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+			policy := aws.ToString(params.ResourcePolicy)
+			if m.allowed[action+" "+resource] || strings.Contains(policy, `"`+action+`"`) && strings.Contains(policy, `"`+resource+`"`) {
+				decision = iamtypes.PolicyEvaluationDecisionTypeAllowed
+			}
+			out.EvaluationResults = append(out.EvaluationResults, iamtypes.EvaluationResult{
+				EvalActionName: aws.String(action), EvalResourceName: aws.String(resource), EvalDecision: decision,
+			})
+		}
+	}
+	return out, nil
+}
+
+func TestCheckRolePermissions(t *testing.T) {
+	args := MigrationArgs{SourceBucket: "src", DestinationBucket: "dst", RoleArn: "arn:aws:iam::111122223333:role/batch", CannedACL: CannedACLNone}
+	s3m := &mock{}
+	s3mig := &s3migration{s3Client: s3m, inventoryBucket: "reports"}
+	allowed := map[string]bool{}
+	for _, g := range batchRoleGrants(args, "reports") {
+		for _, action := range g.Actions {
+			for _, resource := range g.Resources {
+				allowed[action+" "+resource] = true
+			}
+		}
+	}
+	m := &simulateMock{allowed: allowed}
+	err := s3mig.checkRolePermissions(context.TODO(), m, args)
+	assert.NoError(t, err)
+	assert.True(t, s3mig.preflight.PermissionsChecked)
+	assert.Empty(t, s3mig.preflight.DeniedPermissions)
+
+	// Writing reports to the inventory destination bucket isn't allowed
+	delete(allowed, "s3:PutObject arn:aws:s3:::reports/src/*")
+	err = s3mig.checkRolePermissions(context.TODO(), m, args)
+	assert.ErrorIs(t, err, ErrRolePermissions)
+	assert.Equal(t, []DeniedPermission{{Action: "s3:PutObject", Resource: "arn:aws:s3:::reports/src/*", Decision: "implicitDeny"}},
+		s3mig.preflight.DeniedPermissions)
+
+	// The role isn't allowed the action, the report bucket's policy grants it
+	s3m.bucketPolicy = `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:role/batch"},` +
+		`"Action":["s3:PutObject"],"Resource":["arn:aws:s3:::reports/src/*"]}]}`
+	err = s3mig.checkRolePermissions(context.TODO(), m, args)
+	assert.NoError(t, err)
+	assert.Empty(t, s3mig.preflight.DeniedPermissions)
+}
+
+func TestBucketArnOf(t *testing.T) {
+	for resource, want := range map[string]string{
+		"arn:aws:s3:::src":                                 "arn:aws:s3:::src",
+		"arn:aws-cn:s3:::src/prefix/*":                     "arn:aws-cn:s3:::src",
+		"arn:aws:s3:us-east-1:111122223333:accesspoint/ap": "",
+		"arn:aws:kms:us-east-1:111122223333:key/1234":      "",
+		"src": "",
+	} {
+		assert.Equal(t, want, bucketArnOf(resource), resource)
+	}
+}
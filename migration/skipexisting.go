@@ -0,0 +1,212 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"s3migration/util"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Manifests with at most this many rows are checked with HeadObject rather than by scanning the buckets
+const skipExistingHeadLimit = 1000
+
+// Size and ETag of an object read with HeadObject, like the copy settings.  Missing objects have a negative size.
+type headInfo objectInfo
+
+func (h headInfo) key() string {
+	return fmt.Sprintf("%d/%s", h.size, h.etag)
+}
+
+func (h headInfo) apply(*s3controltypes.S3CopyObjectOperation) {}
+
+func (s3obj *s3migration) headInfo(ctx context.Context, bucket, key, versionID string) (copySetting, error) {
+	input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	head, err := s3obj.s3Client.HeadObject(ctx, input)
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return headInfo{size: -1}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read object size and ETag: %w", err)
+	}
+	return headInfo{size: aws.ToInt64(head.ContentLength), etag: strings.Trim(aws.ToString(head.ETag), `"`)}, nil
+}
+
+// Whether the destination's copy of an object matches the source's.  Sizes must match, and ETags when
+// both are known, as inventories without an ETag field report empty ETags.
+func (info objectInfo) matches(dest objectInfo) bool {
+	if info.size < 0 || info.size != dest.size {
+		return false
+	}
+	return info.etag == "" || dest.etag == "" || info.etag == dest.etag
+}
+
+// Drop the objects whose latest version is already in the destination, with the same size and ETag, from the
+// jobs copying latest versions, so rerunning after a partial failure only copies what's left.  Small manifests
+// are checked with HeadObject on both buckets.  Otherwise the destination is read from its latest inventory
+// report, or listed, and the source from its inventory, or listed.  allLatest is set when every job copies
+// latest versions, eg. for a bucket that was never versioned.  Jobs left with no rows are dropped.
+func (s3obj *s3migration) skipExisting(ctx context.Context, steps []*jobStep, args MigrationArgs, inventory *inventoryReport, allLatest bool, concurrency int) ([]*jobStep, error) {
+	manifests := map[*jobStep][][]string{}
+	total := 0
+	for _, step := range steps {
+		if step.Kind != jobKindVersion && !allLatest {
+			continue
+		}
+		rows, err := s3obj.readManifestRows(ctx, step.Input)
+		if err != nil {
+			return nil, err
+		}
+		manifests[step] = rows
+		total += len(rows)
+	}
+
+	var existing func(step *jobStep) ([]bool, error)
+	if total <= skipExistingHeadLimit {
+		existing = func(step *jobStep) ([]bool, error) {
+			return s3obj.headExisting(ctx, manifests[step], args.DestinationBucket, concurrency)
+		}
+	} else {
+		source, destination, err := s3obj.scanExisting(ctx, manifests, args, inventory)
+		if err != nil {
+			return nil, err
+		}
+		existing = func(step *jobStep) ([]bool, error) {
+			rows := manifests[step]
+			found := make([]bool, len(rows))
+			for i, row := range rows {
+				key, err := util.DecodeManifestKey(row[1])
+				if err != nil {
+					return nil, err
+				}
+				info, ok := source[key]
+				dest, dok := destination[key]
+				found[i] = ok && dok && info.matches(dest)
+			}
+			return found, nil
+		}
+	}
+
+	kept := []*jobStep{}
+	skipped := 0
+	for _, step := range steps {
+		rows, ok := manifests[step]
+		if !ok {
+			kept = append(kept, step)
+			continue
+		}
+		found, err := existing(step)
+		if err != nil {
+			return nil, err
+		}
+		missing := [][]string{}
+		for i, row := range rows {
+			if !found[i] {
+				missing = append(missing, row)
+			}
+		}
+		skipped += len(rows) - len(missing)
+		if len(missing) == 0 {
+			continue
+		}
+		if len(missing) == len(rows) {
+			kept = append(kept, step)
+			continue
+		}
+		manifestArn := *step.Input.Manifest.Location.ObjectArn
+		bucket, manifestKey, err := ParseObjectArn(manifestArn)
+		if err != nil {
+			return nil, err
+		}
+		key := fmt.Sprintf("%s-skip-existing.csv", strings.TrimSuffix(manifestKey, ".csv"))
+		obj, err := s3obj.uploadRows(ctx, bucket, key, missing)
+		if err != nil {
+			return nil, err
+		}
+		step.Input.Manifest.Location.ObjectArn = objectArnLike(manifestArn, bucket, key)
+		step.Input.Manifest.Location.ETag = obj.ETag
+		kept = append(kept, step)
+	}
+	zap.L().Info("Skipping objects already in the destination",
+		zap.String("destination", args.DestinationBucket),
+		zap.Int("objects", total),
+		zap.Int("skipped", skipped),
+	)
+	return kept, nil
+}
+
+// Whether each row's object is in the destination bucket with the same size and ETag, read with HeadObject
+func (s3obj *s3migration) headExisting(ctx context.Context, rows [][]string, destination string, concurrency int) ([]bool, error) {
+	source, err := s3obj.readSettings(ctx, rows, concurrency, s3obj.headInfo)
+	if err != nil {
+		return nil, err
+	}
+	destRows := make([][]string, len(rows))
+	for i, row := range rows {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("invalid manifest row %v", row)
+		}
+		destRows[i] = []string{destination, row[1]}
+	}
+	dest, err := s3obj.readSettings(ctx, destRows, concurrency, s3obj.headInfo)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]bool, len(rows))
+	for i := range rows {
+		found[i] = objectInfo(source[i].(headInfo)).matches(objectInfo(dest[i].(headInfo)))
+	}
+	return found, nil
+}
+
+// The size and ETag of the manifests' objects in the source and destination buckets, by key.  Only the
+// manifests' keys are kept, the buckets' other objects aren't needed.
+func (s3obj *s3migration) scanExisting(ctx context.Context, manifests map[*jobStep][][]string, args MigrationArgs, inventory *inventoryReport) (map[string]objectInfo, map[string]objectInfo, error) {
+	wanted := map[string]bool{}
+	for _, rows := range manifests {
+		for _, row := range rows {
+			if len(row) < 2 {
+				return nil, nil, fmt.Errorf("invalid manifest row %v", row)
+			}
+			key, err := util.DecodeManifestKey(row[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			wanted[key] = true
+		}
+	}
+	collect := func(scan objectScanner) (map[string]objectInfo, error) {
+		objects := map[string]objectInfo{}
+		err := scan(func(key string, info objectInfo) error {
+			if wanted[key] {
+				objects[key] = info
+			}
+			return nil
+		})
+		return objects, err
+	}
+
+	destination, err := collect(s3obj.bucketObjects(ctx, args.DestinationBucket, args.ConfigName, args.ListMode))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read destination objects: %w", err)
+	}
+	scan := s3obj.listedObjects(ctx, args.SourceBucket)
+	if inventory != nil {
+		scan = s3obj.inventoryObjects(ctx, inventory.Bucket, inventory.Manifest)
+	}
+	source, err := collect(scan)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read source objects: %w", err)
+	}
+	return source, destination, nil
+}
@@ -0,0 +1,65 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves heads by bucket and key, missing objects are not found.  Uploaded manifests are served by the mock.
+type bucketHeadMock struct {
+	*mock
+	objects map[string]objectInfo
+}
+
+func (m *bucketHeadMock) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if _, ok := m.mock.objects[*params.Key]; ok {
+		return m.mock.HeadObject(ctx, params, optFns...)
+	}
+	info, ok := m.objects[*params.Bucket+"/"+*params.Key]
+	if !ok {
+		return nil, &s3types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(info.size), ETag: aws.String(`"` + info.etag + `"`)}, nil
+}
+
+func TestSkipExisting(t *testing.T) {
+	m := &bucketHeadMock{
+		mock: &mock{objects: map[string]string{
+			"latest.csv":     "src,same\nsrc,missing\nsrc,resized\nsrc,edited\nsrc,unknown%20etag\n",
+			"copied.csv":     "src,same\n",
+			"noncurrent.csv": "src,same,v1\n",
+		}},
+		objects: map[string]objectInfo{
+			"src/same": {size: 10, etag: "a"}, "dst/same": {size: 10, etag: "a"},
+			"src/missing": {size: 10, etag: "b"},
+			"src/resized": {size: 10, etag: "c"}, "dst/resized": {size: 11, etag: "c"},
+			"src/edited": {size: 10, etag: "d"}, "dst/edited": {size: 10, etag: "e"},
+			"src/unknown etag": {size: 10}, "dst/unknown etag": {size: 10, etag: "f"},
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	step := func(kind, manifest string) *jobStep {
+		return &jobStep{Kind: kind, Input: NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/" + manifest)})}
+	}
+	steps := []*jobStep{step(jobKindNonVersion, "noncurrent.csv"), step(jobKindVersion, "latest.csv"), step(jobKindVersion, "copied.csv")}
+	args := MigrationArgs{SourceBucket: "src", DestinationBucket: "dst"}
+
+	// Non-current versions are kept, and a job whose objects were all copied is dropped
+	kept, err := s3mig.skipExisting(context.TODO(), steps, args, nil, false, 2)
+	assert.NoError(t, err)
+	assert.Len(t, kept, 2)
+	assert.Same(t, steps[0], kept[0])
+	assert.Equal(t, "arn:aws:s3:::src/latest-skip-existing.csv", *kept[1].Input.Manifest.Location.ObjectArn)
+	assert.Equal(t, "src,missing\nsrc,resized\nsrc,edited\n", m.mock.objects["latest-skip-existing.csv"])
+
+	// Without versions every job copies latest versions
+	steps = []*jobStep{step(jobKindNonVersion, "copied.csv")}
+	kept, err = s3mig.skipExisting(context.TODO(), steps, args, nil, true, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, kept)
+}
@@ -0,0 +1,472 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"s3migration/util"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Kinds of batch job created by a run.  Non-latest versions are always copied before latest versions.
+const (
+	jobKindNonVersion = "non-version"
+	jobKindVersion    = "version"
+)
+
+// A batch job in the run's plan.  Input is kept so a job that had not been created yet
+// can be created, with the same client request token, when the run is resumed.
+// The manifest generator is a union that doesn't survive JSON, so it's kept beside the input.
+type jobStep struct {
+	Kind      string                                 `json:"kind"`
+	Input     *s3control.CreateJobInput              `json:"input"`
+	Generator *s3controltypes.S3JobManifestGenerator `json:"generator,omitempty"`
+	JobID     string                                 `json:"jobId,omitempty"`
+	Bytes     int64                                  `json:"bytes,omitempty"` // Estimated from the inventory histogram when split into chunks
+	Pass      int                                    `json:"pass,omitempty"`  // Version ordering pass, see splitStepsByVersionOrder
+}
+
+// Input for CreateJob, with the manifest generator when the step has one
+func (step *jobStep) jobInput() *s3control.CreateJobInput {
+	if step.Generator == nil {
+		return step.Input
+	}
+	input := *step.Input
+	input.ManifestGenerator = &s3controltypes.JobManifestGeneratorMemberS3JobManifestGenerator{Value: *step.Generator}
+	return &input
+}
+
+// Returned when the batch jobs did not achieve the required success threshold
+var ErrThresholdNotMet = errors.New("failed to achieve required success threshold")
+
+// Persisted record of the jobs a run is creating and watching
+type runState struct {
+	Args             MigrationArgs     `json:"args"`
+	Steps            []*jobStep        `json:"steps"`
+	Inventory        string            `json:"inventory,omitempty"`        // s3:// URI of the inventory manifest the job manifests were filtered from
+	InventoryCreated bool              `json:"inventoryCreated,omitempty"` // The run created the inventory configuration, see --cleanup-inventory
+	Deletes          *deleteReplay     `json:"deletes,omitempty"`
+	Moved            bool              `json:"moved,omitempty"`          // Copied objects were deleted from the source, see --move
+	Completed        bool              `json:"completed,omitempty"`      // Every job is terminal and the success threshold was evaluated
+	FailedTasks      int64             `json:"failedTasks,omitempty"`    // Tasks the jobs failed, once completed
+	Recommendation   *Recommendation   `json:"recommendation,omitempty"` // Engine suggested when the plan was built, see recommendEngine
+	Expressions      []string          `json:"expressions,omitempty"`    // S3 Select expressions the manifests were filtered with
+	Preflight        *PreflightResults `json:"preflight,omitempty"`
+	Stopped          *stopRecord       `json:"stopped,omitempty"` // The last stop by a signal, see StopRun
+	UpdatedAt        time.Time         `json:"updatedAt"`
+
+	path  string
+	table *stateTable // DynamoDB checkpoint, may be nil
+	mu    sync.Mutex  // Guards the state written by StopRun from another goroutine
+}
+
+func newRunState(path string, args MigrationArgs, jobParams *jobInputParams) *runState {
+	st := &runState{Args: args, path: path}
+	if jobParams.nonVersionJobParam != nil {
+		st.Steps = append(st.Steps, &jobStep{Kind: jobKindNonVersion, Input: jobParams.nonVersionJobParam})
+	}
+	if jobParams.versionJobParam != nil {
+		st.Steps = append(st.Steps, &jobStep{Kind: jobKindVersion, Input: jobParams.versionJobParam})
+	}
+	return st
+}
+
+func loadRunState(path string) (*runState, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeRunState(path, body)
+}
+
+// Load the state checkpointed to the table, written back to path as well as the table when saved
+func loadTableRunState(ctx context.Context, path string, table *stateTable) (*runState, error) {
+	body, err := table.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st, err := decodeRunState(path, body)
+	if err != nil {
+		return nil, err
+	}
+	st.table = table
+	return st, nil
+}
+
+func decodeRunState(path string, body []byte) (*runState, error) {
+	st := &runState{path: path}
+	if err := json.Unmarshal(body, st); err != nil {
+		return nil, fmt.Errorf("state file %s is corrupt or malformed: %w", path, err)
+	}
+	return st, nil
+}
+
+// Write the state file, and checkpoint it to the state table if any.  Does nothing when
+// neither is configured.  A failed checkpoint doesn't stop the state file being written.
+func (st *runState) save() error {
+	if st.path == "" && st.table == nil {
+		return nil
+	}
+	st.mu.Lock()
+	st.UpdatedAt = time.Now()
+	body, err := json.MarshalIndent(st, "", "  ")
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	var tableErr error
+	if st.table != nil {
+		if err := st.table.save(context.Background(), body, st.UpdatedAt); err != nil {
+			tableErr = fmt.Errorf("unable to checkpoint state to table %s: %w", st.table.name, err)
+		}
+	}
+	if st.path == "" {
+		return tableErr
+	}
+	return errors.Join(tableErr, writeStateFile(st.path, body))
+}
+
+// Write the state file atomically so a crash mid-write never leaves a truncated file behind
+func writeStateFile(path string, body []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Record that the run completed, so it isn't resumed by run --container
+func (st *runState) complete() {
+	st.mu.Lock()
+	st.Completed = true
+	st.mu.Unlock()
+	st.mustSave()
+}
+
+func (st *runState) mustSave() {
+	if err := st.save(); err != nil {
+		zap.L().Error("Unable to write state file", zap.String("file", st.path), zap.Error(err))
+	}
+}
+
+// Create (if not already created) and watch each job in the plan in order, checking the success
+// threshold between jobs and across all jobs once complete.  Used by both run and watch --resume.
+// Consecutive jobs of the same kind, ie. chunks of one manifest, run concurrently.
+func (s3obj *s3migration) executeJobs(ctx context.Context, st *runState) error {
+	args := st.Args
+	var nonVersionResults, versionResults []*s3control.DescribeJobOutput
+	stepResults := make([]*s3control.DescribeJobOutput, len(st.Steps))
+	for start := 0; start < len(st.Steps); {
+		end := start + 1
+		for end < len(st.Steps) && sameWave(st.Steps[end], st.Steps[start]) {
+			end++
+		}
+		wave := st.Steps[start:end]
+
+		// if there is any prior non versioned job, Check its results before proceeding
+		if start > 0 && len(nonVersionResults) > 0 {
+			zap.L().Info("Checking non version object job success threshold.")
+			jobSuccessThreshold := util.GetJobSuccessThreshold(nonVersionResults...)
+			failed := failedTasks(nonVersionResults)
+			if !thresholdMet(args, jobSuccessThreshold, failed) {
+				s3obj.events.publish(ctx, EventThresholdFailed, map[string]any{"achieved": jobSuccessThreshold, "required": args.ReqSuccessThreshold, "failed": failed})
+				s3obj.report.SuccessRatio = jobSuccessThreshold
+				s3obj.recordFailures(ctx, st)
+				s3obj.metrics.runCompleted(s3obj.report)
+				s3obj.stream.runCompleted(s3obj.report)
+				s3obj.progress.runCompleted(jobSuccessThreshold)
+				s3obj.report.finish(args.ReportFile)
+				st.complete()
+				zap.L().Error("Job Completed, failled to achieve required success threshold",
+					zap.Float32("Achieved ", jobSuccessThreshold),
+					zap.Float32("Required ", args.ReqSuccessThreshold),
+					zap.Int64("failed", failed),
+				)
+				return thresholdError(args, jobSuccessThreshold, failed)
+			}
+		}
+
+		for _, step := range wave {
+			if step.JobID == "" {
+				zap.L().Info("Creating batch job", zap.String("kind", step.Kind))
+				jobOutParam, jobErr := s3obj.createJob(ctx, args.AccountID, step.jobInput(), args.ConfirmMode)
+				if jobErr != nil {
+					zap.L().Fatal("Failed to create batch job", zap.Error(jobErr), util.ExitCode(util.ExitJobCreationFailed))
+				}
+				st.mu.Lock()
+				step.JobID = *jobOutParam.JobId
+				st.mu.Unlock()
+				st.mustSave()
+				s3obj.progress.jobCreated()
+				s3obj.events.publish(ctx, EventJobCreated, map[string]any{"jobId": step.JobID, "kind": step.Kind})
+			} else {
+				zap.L().Info("Resuming watch of batch job", zap.String("kind", step.Kind), zap.String("jobId", step.JobID))
+			}
+		}
+		if args.NoWait {
+			if end < len(st.Steps) {
+				zap.L().Info("Remaining batch jobs are created by watch --resume once these complete",
+					zap.Int("remaining", len(st.Steps)-end))
+			}
+			writeDetached(os.Stdout, st, wave)
+			return nil
+		}
+
+		results := make([]*s3control.DescribeJobOutput, len(wave))
+		errs := make([]error, len(wave))
+		var wg sync.WaitGroup
+		for i, step := range wave {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i], errs[i] = s3obj.pollJobResult(ctx, args.AccountID, &s3control.CreateJobOutput{JobId: &step.JobID})
+			}()
+		}
+		wg.Wait()
+
+		for i, step := range wave {
+			if errors.Is(errs[i], ErrFailureSpike) {
+				// The failed tasks of the cancelled job are the diagnostics
+				s3obj.report.addJob(results[i], step.Bytes)
+				s3obj.recordFailures(ctx, st)
+				s3obj.report.finish(args.ReportFile)
+				st.complete()
+				zap.L().Error("Batch job cancelled after a failure spike, check the job's failures before running again",
+					zap.String("jobId", step.JobID),
+					zap.Error(errs[i]),
+				)
+				return errs[i]
+			}
+			if errors.Is(errs[i], ErrJobPollTimeout) {
+				zap.L().Fatal("Batch job did not complete within poll timeout",
+					zap.String("jobId", step.JobID),
+					zap.Error(errs[i]),
+				)
+			}
+			if errs[i] != nil {
+				zap.L().Fatal("Failed to get job status",
+					zap.String("jobId", step.JobID),
+					zap.Error(errs[i]),
+				)
+			}
+			s3obj.report.addJob(results[i], step.Bytes)
+			s3obj.metrics.jobCompleted(results[i], step.Bytes)
+			s3obj.progress.jobCompleted(results[i], step.Bytes)
+			s3obj.events.jobCompleted(ctx, step.Kind, results[i])
+			stepResults[start+i] = results[i]
+			if step.Kind == jobKindNonVersion {
+				nonVersionResults = append(nonVersionResults, results[i])
+			} else {
+				versionResults = append(versionResults, results[i])
+			}
+		}
+		start = end
+	}
+
+	// At last, checking overall job completion success threshold
+	jobSuccessThreshold := util.GetJobSuccessThreshold(append(nonVersionResults, versionResults...)...)
+	// The verification phase is the checks reading the buckets and the completion reports, a run without any has none
+	verifying := s3obj.analyzer != nil || args.DriftSample > 0 || args.Move || args.FailureReport
+	verifyStart := time.Now()
+	if s3obj.analyzer != nil {
+		findings, aerr := s3obj.checkBucketPolicyExposure(ctx, args.DestinationBucket, args.AnalyzerArn)
+		if aerr != nil {
+			zap.L().Error("Failed to check destination bucket policy with Access Analyzer", zap.Error(aerr))
+		}
+		s3obj.report.AccessFindings = findings
+	}
+	if args.DriftSample > 0 {
+		drift, keys, derr := s3obj.checkDrift(ctx, st.Steps, stepResults, args.DriftSample)
+		if derr != nil {
+			zap.L().Error("Failed to check source objects for changes during the migration", zap.Error(derr))
+		} else if s3obj.report != nil {
+			s3obj.report.Drift = drift
+		}
+		if derr == nil && args.DriftKeysFile != "" {
+			if werr := writeDriftKeys(args.DriftKeysFile, keys); werr != nil {
+				zap.L().Error("Unable to write changed keys", zap.String("file", args.DriftKeysFile), zap.Error(werr))
+			}
+		}
+	}
+	failed := failedTasks(stepResults)
+	met := thresholdMet(args, jobSuccessThreshold, failed)
+	s3obj.recordFailures(ctx, st)
+	if verifying {
+		s3obj.timePhase(PhaseVerification, verifyStart)
+	}
+	if met {
+		s3obj.replayDeleteMarkers(ctx, st)
+		s3obj.moveCopiedObjects(ctx, st, stepResults)
+		s3obj.removeCreatedInventory(ctx, st)
+	}
+	s3obj.report.SuccessRatio = jobSuccessThreshold
+	s3obj.report.ThresholdMet = met
+	s3obj.metrics.runCompleted(s3obj.report)
+	s3obj.stream.runCompleted(s3obj.report)
+	s3obj.progress.runCompleted(jobSuccessThreshold)
+	s3obj.report.finish(args.ReportFile)
+	st.mu.Lock()
+	st.FailedTasks = failed
+	st.mu.Unlock()
+	st.complete()
+	if !met {
+		s3obj.events.publish(ctx, EventThresholdFailed, map[string]any{"achieved": jobSuccessThreshold, "required": args.ReqSuccessThreshold, "failed": failed})
+		zap.L().Error("Job Completed, failed to achieve required success threshold",
+			zap.Float32("Achieved ", jobSuccessThreshold),
+			zap.Float32("Required ", args.ReqSuccessThreshold),
+			zap.Int64("failed", failed),
+		)
+		return thresholdError(args, jobSuccessThreshold, failed)
+	}
+	s3obj.events.publish(ctx, EventMigrationCompleted, map[string]any{"achieved": jobSuccessThreshold, "required": args.ReqSuccessThreshold, "failed": failed})
+	zap.L().Info("Job Completed, Achieved required success threshold",
+		zap.Float32("Achieved ", jobSuccessThreshold),
+		zap.Float32("Required ", args.ReqSuccessThreshold),
+	)
+	return nil
+}
+
+// Whether the jobs achieved the required success ratio, with no more failed objects than the limit if any
+func thresholdMet(args MigrationArgs, ratio float32, failed int64) bool {
+	return ratio >= args.ReqSuccessThreshold && (args.MaxFailedObjects == 0 || failed <= args.MaxFailedObjects)
+}
+
+func thresholdError(args MigrationArgs, ratio float32, failed int64) error {
+	if ratio >= args.ReqSuccessThreshold {
+		return fmt.Errorf("%w: %d objects failed, at most %d allowed", ErrThresholdNotMet, failed, args.MaxFailedObjects)
+	}
+	return fmt.Errorf("%w: achieved %v, required %v", ErrThresholdNotMet, ratio, args.ReqSuccessThreshold)
+}
+
+// Total tasks the jobs failed
+func failedTasks(results []*s3control.DescribeJobOutput) int64 {
+	var failed int64
+	for _, result := range results {
+		if result != nil && result.Job != nil && result.Job.ProgressSummary != nil {
+			failed += aws.ToInt64(result.Job.ProgressSummary.NumberOfTasksFailed)
+		}
+	}
+	return failed
+}
+
+// Whether the run in this process completed meeting the success threshold, but with some tasks failed
+func CompletedWithFailures() bool {
+	activeRun.Lock()
+	st := activeRun.st
+	activeRun.Unlock()
+	if st == nil {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.Completed && st.FailedTasks > 0
+}
+
+// Print the jobs a --no-wait run created and the state file to resume them from, as key=value lines,
+// eg. for $GITHUB_OUTPUT
+func writeDetached(w io.Writer, st *runState, created []*jobStep) {
+	ids := make([]string, len(created))
+	for i, step := range created {
+		ids[i] = step.JobID
+	}
+	fmt.Fprintf(w, "jobIds=%s\n", strings.Join(ids, ","))
+	fmt.Fprintf(w, "stateFile=%s\n", st.path)
+}
+
+// Load the state from the table in the given region if any, otherwise from the state file
+func loadStateFrom(ctx context.Context, statePath, stateTableName, region string) (*runState, error) {
+	if stateTableName == "" {
+		return loadRunState(statePath)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return loadTableRunState(ctx, statePath, newStateTable(cfg, stateTableName, statePath))
+}
+
+// Whether the state file, or table, records a run that hasn't completed, eg. one whose container was
+// stopped while it was polling
+func PendingRun(statePath, stateTableName, region string) (bool, error) {
+	st, err := loadStateFrom(context.Background(), statePath, stateTableName, region)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrNoTableState) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !st.Completed, nil
+}
+
+// Reattach to the jobs recorded in a state file, eg. after the machine running the
+// original run rebooted, and continue exactly as the original run would have.  When a state
+// table is given the state is loaded from it rather than the file, in the given region.
+func Resume(statePath, stateTableName, region string, quiet bool, heartbeat *util.Heartbeat) error {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	st, err := loadStateFrom(ctx, statePath, stateTableName, region)
+	if err != nil {
+		return err
+	}
+	args := st.Args
+	args.Quiet = quiet
+	args.Heartbeat = heartbeat
+	zap.L().Info("Resuming migration from state file",
+		zap.String("file", statePath),
+		zap.String("table", stateTableName),
+		zap.String("inventory", st.Inventory),
+		zap.String("sourceBucket", args.SourceBucket),
+		zap.String("destinationBucket", args.DestinationBucket),
+		zap.Int("jobs", len(st.Steps)),
+	)
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", args.SourceRegion),
+			zap.Error(err),
+		)
+	}
+	s3mig := newS3Migration(cfg, args)
+	// A state file recorded by a run checkpointing to a table keeps checkpointing to it
+	if st.table == nil {
+		st.table = newStateTable(s3mig.cfg, args.StateTable, statePath)
+	}
+	if st.Stopped != nil {
+		zap.L().Info("Resuming a run stopped by a signal",
+			zap.String("signal", st.Stopped.Signal),
+			zap.Time("stoppedAt", st.Stopped.At),
+			zap.Strings("jobIds", st.Stopped.JobIDs),
+		)
+		st.Stopped = nil
+	}
+	trackRun(st)
+	return s3mig.executeJobs(ctx, st)
+}
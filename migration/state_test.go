@@ -0,0 +1,138 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStateResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	args := MigrationArgs{
+		AccountID:           "111122223333",
+		SourceBucket:        "src",
+		DestinationBucket:   "dst",
+		ReqSuccessThreshold: 0.8,
+		PollInterval:        time.Millisecond,
+	}
+	input := NewCreateJobInput(&batchJobArgs{
+		AccountId:          aws.String(args.AccountID),
+		RoleArn:            aws.String("arn:aws:iam::111122223333:role/somedummyrole"),
+		TargetBucketName:   aws.String("dst"),
+		ManifestETag:       aws.String("etag"),
+		ManifestArn:        aws.String("arn:aws:s3:::src/manifest.csv"),
+		VersioningDisabled: false,
+	})
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: input, versionJobParam: input})
+	// Simulate a run interrupted while watching the first job
+	st.Steps[0].JobID = "in-flight-job"
+	assert.NoError(t, st.save())
+
+	loaded, err := loadRunState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "in-flight-job", loaded.Steps[0].JobID)
+	assert.Equal(t, *input.ClientRequestToken, *loaded.Steps[1].Input.ClientRequestToken)
+
+	s3mig = &s3migration{
+		s3Client:     new(mock),
+		s3CtrClient:  &ctrMock{status: s3controltypes.JobStatusComplete},
+		pollInterval: args.PollInterval,
+		report:       newReport(loaded.Args),
+	}
+	assert.NoError(t, s3mig.executeJobs(context.TODO(), loaded))
+
+	// The pending job must have been created and recorded
+	resumed, err := loadRunState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-job", resumed.Steps[1].JobID)
+	assert.Len(t, s3mig.report.Jobs, 2)
+}
+
+func TestPendingRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	pending, err := PendingRun(path, "", "")
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+	// Every task succeeds, which is short of an impossible threshold
+	args := MigrationArgs{AccountID: "111122223333", ReqSuccessThreshold: 1.1, PollInterval: time.Millisecond}
+	input := NewCreateJobInput(&batchJobArgs{
+		AccountId:        aws.String(args.AccountID),
+		RoleArn:          aws.String("arn:aws:iam::111122223333:role/somedummyrole"),
+		TargetBucketName: aws.String("dst"),
+		ManifestETag:     aws.String("etag"),
+		ManifestArn:      aws.String("arn:aws:s3:::src/manifest.csv"),
+	})
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: input})
+	assert.NoError(t, st.save())
+	pending, err = PendingRun(path, "", "")
+	assert.NoError(t, err)
+	assert.True(t, pending)
+
+	s3mig := &s3migration{s3Client: new(mock), s3CtrClient: &ctrMock{status: s3controltypes.JobStatusComplete}, pollInterval: args.PollInterval,
+		report: newReport(args)}
+	assert.ErrorIs(t, s3mig.executeJobs(context.TODO(), st), ErrThresholdNotMet)
+	pending, err = PendingRun(path, "", "")
+	assert.NoError(t, err)
+	assert.False(t, pending)
+}
+
+func TestExecuteJobsNoWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	args := MigrationArgs{AccountID: "111122223333", ReqSuccessThreshold: 0.8, NoWait: true}
+	st := newRunState(path, args, &jobInputParams{nonVersionJobParam: testJobInput(), versionJobParam: testJobInput()})
+	s3mig := &s3migration{s3Client: new(mock), s3CtrClient: &ctrMock{status: s3controltypes.JobStatusActive}, report: newReport(args)}
+	assert.NoError(t, s3mig.executeJobs(context.TODO(), st))
+
+	// Only the first job is created, and the run is left for watch --resume
+	loaded, err := loadRunState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-job", loaded.Steps[0].JobID)
+	assert.Empty(t, loaded.Steps[1].JobID)
+	assert.False(t, loaded.Completed)
+	assert.False(t, loaded.Args.NoWait)
+	assert.Empty(t, s3mig.report.Jobs)
+
+	var out bytes.Buffer
+	writeDetached(&out, loaded, loaded.Steps[:1])
+	assert.Equal(t, "jobIds=test-job\nstateFile="+path+"\n", out.String())
+}
+
+func TestCompletedWithFailures(t *testing.T) {
+	defer trackRun(nil)
+	failed := &s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{ProgressSummary: &s3controltypes.JobProgressSummary{
+		NumberOfTasksFailed: aws.Int64(2),
+	}}}
+	st := &runState{FailedTasks: failedTasks([]*s3control.DescribeJobOutput{failed, nil, failed})}
+	assert.Equal(t, int64(4), st.FailedTasks)
+
+	assert.False(t, CompletedWithFailures(), "no run in progress")
+	trackRun(st)
+	assert.False(t, CompletedWithFailures(), "still watching the jobs")
+	st.Completed = true
+	assert.True(t, CompletedWithFailures())
+	st.FailedTasks = 0
+	assert.False(t, CompletedWithFailures())
+}
+
+func TestThresholdMet(t *testing.T) {
+	args := MigrationArgs{ReqSuccessThreshold: 0.99}
+	assert.True(t, thresholdMet(args, 0.999, 1000))
+	assert.False(t, thresholdMet(args, 0.9, 0))
+
+	// A billion objects can meet the ratio with far more failures than acceptable
+	args.MaxFailedObjects = 1000
+	assert.True(t, thresholdMet(args, 0.999, 1000))
+	assert.False(t, thresholdMet(args, 0.999, 1001))
+	err := thresholdError(args, 0.999, 1001)
+	assert.ErrorIs(t, err, ErrThresholdNotMet)
+	assert.ErrorContains(t, err, "1001 objects failed, at most 1000 allowed")
+	assert.ErrorContains(t, thresholdError(args, 0.9, 1001), "achieved 0.9, required 0.99")
+}
@@ -0,0 +1,157 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attributes of a state table item.  The table's partition key is StateKeyAttribute, a string.
+const (
+	StateKeyAttribute  = "StateFile"
+	stateBodyAttribute = "State"
+	stateTimeAttribute = "UpdatedAt"
+)
+
+// DynamoDB's limit on the size of an item, its attribute names and values
+const dynamoItemLimit = 400 << 10
+
+var (
+	// Returned when the state table has no state recorded for a run
+	ErrNoTableState = errors.New("no state recorded in table")
+	// Returned when another run checkpointed the state since this run last loaded or saved it
+	ErrStateConflict = errors.New("state was updated by another run")
+)
+
+type dynamoAPI interface {
+	GetItem(ctx context.Context, table, key string) (map[string]string, error)
+	// Write item, only replacing an item whose attributes have the values of condition when it is set
+	PutItem(ctx context.Context, table string, item, condition map[string]string) error
+}
+
+// DynamoDB client, reading and writing items of string attributes
+type dynamoDB struct {
+	client *dynamodb.Client
+}
+
+func newDynamoDB(cfg aws.Config) *dynamoDB {
+	return &dynamoDB{client: dynamodb.NewFromConfig(cfg)}
+}
+
+func (d *dynamoDB) GetItem(ctx context.Context, table, key string) (map[string]string, error) {
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            map[string]dynamodbtypes.AttributeValue{StateKeyAttribute: &dynamodbtypes.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item == nil {
+		return nil, err
+	}
+	item := map[string]string{}
+	for name, value := range out.Item {
+		if s, ok := value.(*dynamodbtypes.AttributeValueMemberS); ok {
+			item[name] = s.Value
+		}
+	}
+	return item, nil
+}
+
+func (d *dynamoDB) PutItem(ctx context.Context, table string, item, condition map[string]string) error {
+	attrs := map[string]dynamodbtypes.AttributeValue{}
+	for name, value := range item {
+		attrs[name] = &dynamodbtypes.AttributeValueMemberS{Value: value}
+	}
+	input := &dynamodb.PutItemInput{TableName: aws.String(table), Item: attrs}
+	if len(condition) > 0 {
+		names := make([]string, 0, len(condition))
+		for name := range condition {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		clauses := []string{}
+		input.ExpressionAttributeNames = map[string]string{}
+		input.ExpressionAttributeValues = map[string]dynamodbtypes.AttributeValue{}
+		for i, name := range names {
+			input.ExpressionAttributeNames[fmt.Sprintf("#a%d", i)] = name
+			input.ExpressionAttributeValues[fmt.Sprintf(":v%d", i)] = &dynamodbtypes.AttributeValueMemberS{Value: condition[name]}
+			clauses = append(clauses, fmt.Sprintf("#a%d = :v%d", i, i))
+		}
+		input.ConditionExpression = aws.String(strings.Join(clauses, " AND "))
+	}
+	_, err := d.client.PutItem(ctx, input)
+	var ccf *dynamodbtypes.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrStateConflict
+	}
+	return err
+}
+
+// Checkpoints a run's state to a DynamoDB table, keyed by the state file path, so the run can be resumed
+// from another machine when the one running it is lost along with its state file
+type stateTable struct {
+	api     dynamoAPI
+	name    string
+	key     string
+	updated string     // UpdatedAt of the item when this run last loaded or saved it, which the next save expects
+	mu      sync.Mutex // Serializes the saves of concurrent jobs, which would otherwise fail each other's condition
+}
+
+// State table of the run, nil when no table is set
+func newStateTable(cfg aws.Config, name, key string) *stateTable {
+	if name == "" {
+		return nil
+	}
+	return &stateTable{api: newDynamoDB(cfg), name: name, key: key}
+}
+
+func (t *stateTable) load(ctx context.Context) ([]byte, error) {
+	item, err := t.api.GetItem(ctx, t.name, t.key)
+	if err != nil {
+		return nil, err
+	}
+	body, ok := item[stateBodyAttribute]
+	if !ok {
+		return nil, fmt.Errorf("%w %s for %s", ErrNoTableState, t.name, t.key)
+	}
+	t.updated = item[stateTimeAttribute]
+	return []byte(body), nil
+}
+
+// Checkpoint the state, unless another run saved it since this run last loaded or saved it.  The first
+// save of a new run replaces any item left by an earlier run with the same key.
+func (t *stateTable) save(ctx context.Context, body []byte, updated time.Time) error {
+	item := map[string]string{
+		StateKeyAttribute:  t.key,
+		stateBodyAttribute: string(body),
+		stateTimeAttribute: updated.UTC().Format(time.RFC3339Nano),
+	}
+	size := 0
+	for name, value := range item {
+		size += len(name) + len(value)
+	}
+	if size > dynamoItemLimit {
+		return fmt.Errorf("state of %d bytes is over DynamoDB's 400 KB item limit, use fewer jobs, eg. fewer --chunks, or only a state file", size)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var condition map[string]string
+	if t.updated != "" {
+		condition = map[string]string{stateTimeAttribute: t.updated}
+	}
+	if err := t.api.PutItem(ctx, t.name, item, condition); err != nil {
+		if errors.Is(err, ErrStateConflict) {
+			return fmt.Errorf("%w since %s, not overwriting it", err, t.updated)
+		}
+		return err
+	}
+	t.updated = item[stateTimeAttribute]
+	return nil
+}
@@ -0,0 +1,125 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// In memory DynamoDB table keyed by StateKeyAttribute
+type dynamoMock struct {
+	items  map[string]map[string]string
+	putErr error
+}
+
+func (d *dynamoMock) GetItem(ctx context.Context, table, key string) (map[string]string, error) {
+	return d.items[key], nil
+}
+
+func (d *dynamoMock) PutItem(ctx context.Context, table string, item, condition map[string]string) error {
+	if d.putErr != nil {
+		return d.putErr
+	}
+	for name, value := range condition {
+		if d.items[item[StateKeyAttribute]][name] != value {
+			return ErrStateConflict
+		}
+	}
+	d.items[item[StateKeyAttribute]] = item
+	return nil
+}
+
+func TestStateTableCheckpoint(t *testing.T) {
+	assert.Nil(t, newStateTable(aws.Config{}, "", "state.json"))
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	api := &dynamoMock{items: map[string]map[string]string{}}
+	table := &stateTable{api: api, name: "s3migration-state", key: path}
+	_, err := loadTableRunState(context.TODO(), path, table)
+	assert.ErrorIs(t, err, ErrNoTableState)
+
+	st := &runState{Args: MigrationArgs{SourceBucket: "src"}, Steps: []*jobStep{{Kind: jobKindNonVersion, JobID: "job"}},
+		Inventory: "s3://src/inventory/manifest.json", path: path, table: table}
+	assert.NoError(t, st.save())
+	assert.Contains(t, api.items[path], stateTimeAttribute)
+
+	// The machine running the migration is lost along with its state file
+	assert.NoError(t, os.Remove(path))
+	loaded, err := loadTableRunState(context.TODO(), path, table)
+	assert.NoError(t, err)
+	assert.Equal(t, "job", loaded.Steps[0].JobID)
+	assert.Equal(t, "s3://src/inventory/manifest.json", loaded.Inventory)
+
+	// Another run resumed from the table saves first, so this run doesn't overwrite its state
+	other, err := loadTableRunState(context.TODO(), path, &stateTable{api: api, name: "s3migration-state", key: path})
+	assert.NoError(t, err)
+	assert.NoError(t, other.save())
+	assert.NoError(t, other.save())
+	assert.ErrorIs(t, loaded.save(), ErrStateConflict)
+
+	// State over the item size limit isn't written
+	other.Steps = make([]*jobStep, 5000)
+	for i := range other.Steps {
+		other.Steps[i] = &jobStep{Kind: jobKindNonVersion, JobID: "00000000-0000-0000-0000-000000000000"}
+	}
+	assert.ErrorContains(t, other.save(), "400 KB")
+
+	// The state file is still written when the checkpoint fails
+	api.putErr = errors.New("throttled")
+	assert.ErrorContains(t, loaded.save(), "s3migration-state")
+	fromFile, err := loadRunState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "job", fromFile.Steps[0].JobID)
+}
+
+func TestDynamoDBItems(t *testing.T) {
+	var targets []string
+	var put map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.Header.Get("X-Amz-Target")
+		targets = append(targets, target)
+		b, _ := io.ReadAll(r.Body)
+		if target == "DynamoDB_20120810.PutItem" && put != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type": "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException"}`))
+			return
+		}
+		if target == "DynamoDB_20120810.PutItem" {
+			_ = json.Unmarshal(b, &put)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Item": {"StateFile": {"S": "state.json"}, "State": {"S": "{}"}}}`))
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{Region: "us-east-1", BaseEndpoint: aws.String(server.URL), Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})}
+	d := newDynamoDB(cfg)
+	assert.NoError(t, d.PutItem(context.TODO(), "table", map[string]string{StateKeyAttribute: "state.json"},
+		map[string]string{stateTimeAttribute: "2024-01-01T00:00:00Z"}))
+	assert.Equal(t, "table", put["TableName"])
+	assert.Equal(t, map[string]any{StateKeyAttribute: map[string]any{"S": "state.json"}}, put["Item"])
+	assert.Equal(t, "#a0 = :v0", put["ConditionExpression"])
+	assert.Equal(t, map[string]any{"#a0": stateTimeAttribute}, put["ExpressionAttributeNames"])
+	assert.Equal(t, map[string]any{":v0": map[string]any{"S": "2024-01-01T00:00:00Z"}}, put["ExpressionAttributeValues"])
+
+	item, err := d.GetItem(context.TODO(), "table", "state.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", item[stateBodyAttribute])
+
+	// The item changed since
+	err = d.PutItem(context.TODO(), "table", map[string]string{StateKeyAttribute: "state.json"}, nil)
+	assert.ErrorIs(t, err, ErrStateConflict)
+	assert.Equal(t, []string{"DynamoDB_20120810.PutItem", "DynamoDB_20120810.GetItem", "DynamoDB_20120810.PutItem"}, targets)
+}
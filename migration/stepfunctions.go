@@ -0,0 +1,370 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"s3migration/util"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"go.uber.org/zap"
+)
+
+// Steps of the Step Functions integration.  Each step does one unit of work without waiting, and can be
+// repeated with the same input, so the state machine does the waiting and retries failed steps.
+const (
+	StepEnsureInventory = "ensure-inventory"
+	StepFindManifest    = "find-manifest"
+	StepFilter          = "filter"
+	StepCreateJob       = "create-job"
+	StepCheckJob        = "check-job"
+)
+
+var Steps = []string{StepEnsureInventory, StepFindManifest, StepFilter, StepCreateJob, StepCheckJob}
+
+// Returned by find-manifest when no inventory manifest was delivered within the maximum wait
+var ErrManifestWaitTimeout = errors.New("no inventory manifest found within the maximum wait")
+
+// Task counts of a terminal batch job
+type jobCounts struct {
+	JobID     string                   `json:"jobId"`
+	Status    s3controltypes.JobStatus `json:"status"`
+	Total     int64                    `json:"total"`
+	Succeeded int64                    `json:"succeeded"`
+	Failed    int64                    `json:"failed"`
+}
+
+func (c *jobCounts) describeJobOutput() *s3control.DescribeJobOutput {
+	return &s3control.DescribeJobOutput{Job: &s3controltypes.JobDescriptor{
+		JobId:  aws.String(c.JobID),
+		JobArn: aws.String(c.JobID), // Only logged, for jobs without tasks
+		Status: c.Status,
+		ProgressSummary: &s3controltypes.JobProgressSummary{
+			TotalNumberOfTasks:     aws.Int64(c.Total),
+			NumberOfTasksSucceeded: aws.Int64(c.Succeeded),
+			NumberOfTasksFailed:    aws.Int64(c.Failed),
+		},
+	}}
+}
+
+// State of a Step Functions execution, passed from each step to the next.  The Choice and Wait states
+// of the definition read found, done, terminal, thresholdMet and the wait durations.
+type executionState struct {
+	Args      MigrationArgs `json:"args"`
+	StartedAt time.Time     `json:"startedAt"`
+
+	ManifestWaitSeconds int64  `json:"manifestWaitSeconds"`
+	PollSeconds         int64  `json:"pollSeconds"`
+	Found               bool   `json:"found"`               // The manifests can be built, ie. the inventory manifest was delivered
+	Inventory           string `json:"inventory,omitempty"` // s3:// URI of the inventory manifest
+
+	Steps        []*jobStep   `json:"steps,omitempty"`
+	Results      []*jobCounts `json:"results,omitempty"` // Counts of each step's job once terminal
+	Wave         int          `json:"wave"`              // First step of the jobs being created or checked
+	WaveEnd      int          `json:"waveEnd"`
+	Terminal     bool         `json:"terminal"` // Every job of the wave is terminal
+	Done         bool         `json:"done"`
+	ThresholdMet bool         `json:"thresholdMet"`
+	SuccessRatio float32      `json:"successRatio"`
+}
+
+// Input of a state machine execution migrating with the given arguments.  Local files aren't available
+// to the steps, so the state file, report, metrics file, event stream, failed objects file and metadata checkpoint are left out.
+func NewExecutionInput(args MigrationArgs) ([]byte, error) {
+	args.StateFile = ""
+	args.ReportFile = ""
+	args.MetricsFile = ""
+	args.EventStream = ""
+	args.FailedObjectsFile = ""
+	args.Heartbeat = nil
+	args.MetadataFilter = nil
+	args.ConfirmMode = ConfirmNone
+	return json.MarshalIndent(executionState{Args: args}, "", "  ")
+}
+
+// Whether the manifests are filtered from an inventory configured on the source bucket
+func usesInventoryConfig(args MigrationArgs) bool {
+	return !args.ListMode && args.KeysFile == "" && args.LocalInventory == "" && !args.ListInventory && !args.ManifestGenerator && args.ManifestArn == ""
+}
+
+// Run a step with the execution state as input, returning the next state
+func RunStep(ctx context.Context, step string, input []byte) ([]byte, error) {
+	var es executionState
+	if err := json.Unmarshal(input, &es); err != nil {
+		return nil, fmt.Errorf("execution state is corrupt or malformed: %w", err)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(es.Args.SourceRegion))
+	if err != nil {
+		return nil, err
+	}
+	s3mig := newS3Migration(cfg, es.Args)
+	zap.L().Info("Running migration step", zap.String("step", step),
+		zap.String("sourceBucket", es.Args.SourceBucket),
+		zap.String("destinationBucket", es.Args.DestinationBucket),
+	)
+	switch step {
+	case StepEnsureInventory:
+		err = s3mig.ensureInventoryStep(ctx, &es)
+	case StepFindManifest:
+		err = s3mig.findManifestStep(ctx, &es)
+	case StepFilter:
+		s3mig.filterStep(ctx, &es)
+	case StepCreateJob:
+		err = s3mig.createJobStep(ctx, &es)
+	case StepCheckJob:
+		err = s3mig.checkJobStep(ctx, &es)
+	default:
+		return nil, fmt.Errorf("unknown step '%s', valid steps are %v", step, Steps)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(es)
+}
+
+// Lambda handler running the step named in the event, eg. {"step": "find-manifest", "state": {...}}
+func HandleStepInvocation(ctx context.Context, event []byte) ([]byte, error) {
+	var invocation struct {
+		Step  string          `json:"step"`
+		State json.RawMessage `json:"state"`
+	}
+	if err := json.Unmarshal(event, &invocation); err != nil {
+		return nil, err
+	}
+	return RunStep(ctx, invocation.Step, invocation.State)
+}
+
+// Create or enable the inventory configuration, and set the waits of the state machine
+func (s3obj *s3migration) ensureInventoryStep(ctx context.Context, es *executionState) error {
+	if es.StartedAt.IsZero() {
+		es.StartedAt = time.Now().UTC()
+	}
+	retry, _ := time.ParseDuration(es.Args.RetryInterval)
+	es.ManifestWaitSeconds = max(int64(retry.Seconds()), 1)
+	poll := es.Args.PollInterval
+	if poll <= 0 {
+		poll = defaultPollInterval
+	}
+	es.PollSeconds = max(int64(poll.Seconds()), 1)
+	if !usesInventoryConfig(es.Args) {
+		return nil
+	}
+	finderArgs, err := s3obj.ensureS3InventoryConfig(ctx, es.Args.SourceBucket, es.Args.ConfigName, es.Args.ConfigName == inventoryConfigName,
+		s3types.InventoryFrequency(es.Args.InventoryFrequency))
+	if err != nil {
+		return err
+	}
+	return s3obj.ensureInventoryDeliveryPolicy(ctx, es.Args.SourceBucket, finderArgs, es.Args.InventoryPolicy)
+}
+
+// Check once for the latest inventory manifest
+func (s3obj *s3migration) findManifestStep(ctx context.Context, es *executionState) error {
+	if !usesInventoryConfig(es.Args) {
+		es.Found = true
+		return nil
+	}
+	finderArgs, err := s3obj.ensureS3InventoryConfig(ctx, es.Args.SourceBucket, es.Args.ConfigName, false,
+		s3types.InventoryFrequency(es.Args.InventoryFrequency))
+	if err != nil {
+		return err
+	}
+	manifest, err := s3obj.getLatestManifest(ctx, finderArgs)
+	if err != nil {
+		return err
+	}
+	if manifest != nil && manifest.Key != nil {
+		es.Found = true
+		es.Inventory = fmt.Sprintf("s3://%s/%s", finderArgs.BucketName, aws.ToString(manifest.Key))
+		return nil
+	}
+	s3obj.progress.retry(retryInventoryManifest)
+	if time.Since(es.StartedAt) > manifestMaxWait(es.Args) {
+		return fmt.Errorf("%w of %s", ErrManifestWaitTimeout, manifestMaxWait(es.Args))
+	}
+	return nil
+}
+
+// Check the buckets and build the job manifests, planning the jobs.  Repeating the step rebuilds the
+// same manifests.
+func (s3obj *s3migration) filterStep(ctx context.Context, es *executionState) {
+	st := s3obj.planJobs(ctx, es.Args)
+	es.Steps = st.Steps
+	es.Results = make([]*jobCounts, len(st.Steps))
+	if st.Inventory != "" {
+		es.Inventory = st.Inventory
+	}
+	es.Wave, es.WaveEnd = 0, 0
+	zap.L().Info("Batch job plan built", zap.Int("jobs", len(es.Steps)), zap.String("inventory", es.Inventory))
+}
+
+// Create the jobs of the next wave, ie. consecutive jobs of the same kind and pass, that haven't been created.
+// As in a run, non-version jobs must meet the success threshold before version jobs are created.
+func (s3obj *s3migration) createJobStep(ctx context.Context, es *executionState) error {
+	es.Terminal = false
+	if es.Wave >= len(es.Steps) {
+		return s3obj.completeExecution(ctx, es)
+	}
+	if es.WaveEnd <= es.Wave {
+		es.WaveEnd = es.Wave + 1
+		for es.WaveEnd < len(es.Steps) && sameWave(es.Steps[es.WaveEnd], es.Steps[es.Wave]) {
+			es.WaveEnd++
+		}
+	}
+	if es.Wave > 0 {
+		var nonVersionResults []*s3control.DescribeJobOutput
+		for i, step := range es.Steps[:es.Wave] {
+			if step.Kind == jobKindNonVersion && es.Results[i] != nil {
+				nonVersionResults = append(nonVersionResults, es.Results[i].describeJobOutput())
+			}
+		}
+		if len(nonVersionResults) > 0 {
+			es.SuccessRatio = util.GetJobSuccessThreshold(nonVersionResults...)
+			failed := failedTasks(nonVersionResults)
+			if !thresholdMet(es.Args, es.SuccessRatio, failed) {
+				es.Done = true
+				s3obj.events.publish(ctx, EventThresholdFailed, map[string]any{"achieved": es.SuccessRatio, "required": es.Args.ReqSuccessThreshold, "failed": failed})
+				return nil
+			}
+		}
+	}
+	if es.Wave == 0 {
+		s3obj.events.publish(ctx, EventMigrationStarted, map[string]any{"jobs": len(es.Steps)})
+	}
+	for _, step := range es.Steps[es.Wave:es.WaveEnd] {
+		if step.JobID != "" {
+			continue
+		}
+		// The step's client request token makes a repeated create return the job already created
+		job, err := s3obj.createJob(ctx, es.Args.AccountID, step.jobInput(), es.Args.ConfirmMode)
+		if err != nil {
+			return err
+		}
+		step.JobID = aws.ToString(job.JobId)
+		zap.L().Info("Created batch job", zap.String("kind", step.Kind), zap.String("jobId", step.JobID))
+		s3obj.events.publish(ctx, EventJobCreated, map[string]any{"jobId": step.JobID, "kind": step.Kind})
+	}
+	return nil
+}
+
+// Check the status of each job of the wave once, moving to the next wave once all are terminal
+func (s3obj *s3migration) checkJobStep(ctx context.Context, es *executionState) error {
+	es.Terminal = true
+	for i := es.Wave; i < es.WaveEnd; i++ {
+		if es.Results[i] != nil {
+			continue
+		}
+		step := es.Steps[i]
+		out, err := s3obj.describeJob(ctx, es.Args.AccountID, step.JobID)
+		if err != nil {
+			return err
+		}
+		ps := out.Job.ProgressSummary
+		zap.L().Info("Copy job status",
+			zap.String("jobId", step.JobID),
+			zap.Any("status", out.Job.Status),
+			zap.Int64("failed", aws.ToInt64(ps.NumberOfTasksFailed)),
+			zap.Int64("succeeded", aws.ToInt64(ps.NumberOfTasksSucceeded)),
+			zap.Int64("total", aws.ToInt64(ps.TotalNumberOfTasks)),
+		)
+		if !util.IsTerminal(out.Job.Status) {
+			es.Terminal = false
+			continue
+		}
+		es.Results[i] = &jobCounts{JobID: step.JobID, Status: out.Job.Status, Total: aws.ToInt64(ps.TotalNumberOfTasks),
+			Succeeded: aws.ToInt64(ps.NumberOfTasksSucceeded), Failed: aws.ToInt64(ps.NumberOfTasksFailed)}
+		s3obj.metrics.jobCompleted(out, step.Bytes)
+		s3obj.events.jobCompleted(ctx, step.Kind, out)
+	}
+	if !es.Terminal {
+		return nil
+	}
+	es.Wave = es.WaveEnd
+	if es.Wave >= len(es.Steps) {
+		return s3obj.completeExecution(ctx, es)
+	}
+	return nil
+}
+
+// Evaluate the success threshold across every job
+func (s3obj *s3migration) completeExecution(ctx context.Context, es *executionState) error {
+	results := make([]*s3control.DescribeJobOutput, 0, len(es.Results))
+	for _, r := range es.Results {
+		if r != nil {
+			results = append(results, r.describeJobOutput())
+		}
+	}
+	es.Done = true
+	es.SuccessRatio = util.GetJobSuccessThreshold(results...)
+	failed := failedTasks(results)
+	es.ThresholdMet = thresholdMet(es.Args, es.SuccessRatio, failed)
+	detail := map[string]any{"achieved": es.SuccessRatio, "required": es.Args.ReqSuccessThreshold, "failed": failed}
+	if es.ThresholdMet {
+		s3obj.events.publish(ctx, EventMigrationCompleted, detail)
+	} else {
+		s3obj.events.publish(ctx, EventThresholdFailed, detail)
+	}
+	return nil
+}
+
+// Amazon States Language definition of a state machine running the steps with the given Lambda function,
+// whose runtime serves HandleStepInvocation
+func StateMachineDefinition(functionArn string) ([]byte, error) {
+	// The integration is in the function's partition
+	partition := "aws"
+	if a, err := arn.Parse(functionArn); err == nil {
+		partition = a.Partition
+	}
+	task := func(step, next string) map[string]any {
+		return map[string]any{
+			"Type":     "Task",
+			"Resource": fmt.Sprintf("arn:%s:states:::lambda:invoke", partition),
+			"Parameters": map[string]any{
+				"FunctionName": functionArn,
+				"Payload":      map[string]any{"step": step, "state.$": "$"},
+			},
+			"OutputPath": "$.Payload",
+			"Retry": []map[string]any{
+				{
+					"ErrorEquals":     []string{"Lambda.ServiceException", "Lambda.AWSLambdaException", "Lambda.SdkClientException", "Lambda.TooManyRequestsException"},
+					"IntervalSeconds": 2, "MaxAttempts": 6, "BackoffRate": 2,
+				},
+				// Steps are idempotent, so failures such as throttling are retried a few times
+				{"ErrorEquals": []string{"States.TaskFailed"}, "IntervalSeconds": 30, "MaxAttempts": 3, "BackoffRate": 2},
+			},
+			"Next": next,
+		}
+	}
+	choice := func(defaultNext string, choices ...map[string]any) map[string]any {
+		return map[string]any{"Type": "Choice", "Choices": choices, "Default": defaultNext}
+	}
+	when := func(variable, next string) map[string]any {
+		return map[string]any{"Variable": variable, "BooleanEquals": true, "Next": next}
+	}
+	definition := map[string]any{
+		"Comment": "S3 migration with S3 Batch Operations, see s3migration stepfunctions",
+		"StartAt": "EnsureInventory",
+		"States": map[string]any{
+			"EnsureInventory": task(StepEnsureInventory, "FindManifest"),
+			"FindManifest":    task(StepFindManifest, "ManifestFound"),
+			"ManifestFound":   choice("WaitForManifest", when("$.found", "Filter")),
+			"WaitForManifest": map[string]any{"Type": "Wait", "SecondsPath": "$.manifestWaitSeconds", "Next": "FindManifest"},
+			"Filter":          task(StepFilter, "CreateJobs"),
+			"CreateJobs":      task(StepCreateJob, "JobsCreated"),
+			"JobsCreated":     choice("WaitForJobs", when("$.done", "ThresholdMet")),
+			"WaitForJobs":     map[string]any{"Type": "Wait", "SecondsPath": "$.pollSeconds", "Next": "CheckJobs"},
+			"CheckJobs":       task(StepCheckJob, "JobsChecked"),
+			"JobsChecked":     choice("WaitForJobs", when("$.done", "ThresholdMet"), when("$.terminal", "CreateJobs")),
+			"ThresholdMet":    choice("ThresholdFailed", when("$.thresholdMet", "Succeeded")),
+			"Succeeded":       map[string]any{"Type": "Succeed"},
+			"ThresholdFailed": map[string]any{"Type": "Fail", "Error": "ThresholdNotMet", "Cause": "The batch jobs did not achieve the required success threshold"},
+		},
+	}
+	return json.MarshalIndent(definition, "", "  ")
+}
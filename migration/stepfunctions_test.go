@@ -0,0 +1,133 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutionSteps(t *testing.T) {
+	ctr := &ctrMock{status: s3controltypes.JobStatusActive}
+	s3mig := &s3migration{s3Client: new(mock), s3CtrClient: ctr}
+	es := &executionState{
+		Args:    MigrationArgs{AccountID: "111122223333", ReqSuccessThreshold: 0.8, ListMode: true},
+		Steps:   []*jobStep{{Kind: jobKindNonVersion, Input: testJobInput()}, {Kind: jobKindVersion, Input: testJobInput()}},
+		Results: make([]*jobCounts, 2),
+	}
+	assert.NoError(t, s3mig.ensureInventoryStep(context.TODO(), es))
+	assert.Equal(t, int64(defaultPollInterval.Seconds()), es.PollSeconds)
+	assert.NoError(t, s3mig.findManifestStep(context.TODO(), es))
+	assert.True(t, es.Found)
+
+	// Non-version objects are copied first
+	assert.NoError(t, s3mig.createJobStep(context.TODO(), es))
+	assert.Equal(t, "test-job", es.Steps[0].JobID)
+	assert.Empty(t, es.Steps[1].JobID)
+	assert.NoError(t, s3mig.checkJobStep(context.TODO(), es))
+	assert.False(t, es.Terminal)
+	assert.Nil(t, es.Results[0])
+
+	ctr.status = s3controltypes.JobStatusComplete
+	assert.NoError(t, s3mig.checkJobStep(context.TODO(), es))
+	assert.True(t, es.Terminal)
+	assert.False(t, es.Done)
+	assert.Equal(t, 1, es.Wave)
+
+	// Repeating a step doesn't create the job again
+	assert.NoError(t, s3mig.createJobStep(context.TODO(), es))
+	es.Steps[1].JobID = "version-job"
+	assert.NoError(t, s3mig.createJobStep(context.TODO(), es))
+	assert.Equal(t, "version-job", es.Steps[1].JobID)
+
+	assert.NoError(t, s3mig.checkJobStep(context.TODO(), es))
+	assert.True(t, es.Done)
+	assert.True(t, es.ThresholdMet)
+	assert.Equal(t, float32(1), es.SuccessRatio)
+}
+
+func TestExecutionThresholdBetweenWaves(t *testing.T) {
+	s3mig := &s3migration{s3Client: new(mock), s3CtrClient: &ctrMock{}}
+	es := &executionState{
+		Args:  MigrationArgs{ReqSuccessThreshold: 0.8},
+		Steps: []*jobStep{{Kind: jobKindNonVersion, JobID: "a"}, {Kind: jobKindVersion, Input: testJobInput()}},
+		Results: []*jobCounts{
+			{JobID: "a", Status: s3controltypes.JobStatusComplete, Total: 10, Succeeded: 5, Failed: 5}, nil,
+		},
+		Wave: 1,
+	}
+	assert.NoError(t, s3mig.createJobStep(context.TODO(), es))
+	assert.True(t, es.Done)
+	assert.False(t, es.ThresholdMet)
+	assert.Empty(t, es.Steps[1].JobID)
+}
+
+func TestNewExecutionInput(t *testing.T) {
+	input, err := NewExecutionInput(MigrationArgs{SourceBucket: "src", StateFile: "s3migration-src.state.json",
+		ReportFile: "report.json", ConfirmMode: ConfirmExternal, MetadataFilter: &MetadataFilter{Checkpoint: "checkpoint.csv"}})
+	assert.NoError(t, err)
+	var es executionState
+	assert.NoError(t, json.Unmarshal(input, &es))
+	assert.Equal(t, "src", es.Args.SourceBucket)
+	assert.Empty(t, es.Args.StateFile)
+	assert.Empty(t, es.Args.ReportFile)
+	assert.Equal(t, ConfirmNone, es.Args.ConfirmMode)
+	assert.Nil(t, es.Args.MetadataFilter)
+}
+
+func TestStateMachineDefinition(t *testing.T) {
+	body, err := StateMachineDefinition("arn:aws:lambda:us-east-1:111122223333:function:s3migration")
+	assert.NoError(t, err)
+	var definition struct {
+		StartAt string
+		States  map[string]struct {
+			Type       string
+			Next       string
+			Default    string
+			Choices    []struct{ Next string }
+			Parameters struct{ Payload map[string]string }
+		}
+	}
+	assert.NoError(t, json.Unmarshal(body, &definition))
+
+	// Every transition leads to a state, and every step is run by a task
+	assert.Contains(t, definition.States, definition.StartAt)
+	steps := []string{}
+	for _, state := range definition.States {
+		next := []string{state.Next, state.Default}
+		for _, c := range state.Choices {
+			next = append(next, c.Next)
+		}
+		for _, n := range next {
+			if n != "" {
+				assert.Contains(t, definition.States, n)
+			}
+		}
+		if state.Type == "Task" {
+			steps = append(steps, state.Parameters.Payload["step"])
+			assert.Equal(t, "$", state.Parameters.Payload["state.$"])
+		}
+	}
+	assert.ElementsMatch(t, Steps, steps)
+}
+
+func TestStateMachineDefinitionPartition(t *testing.T) {
+	body, err := StateMachineDefinition("arn:aws-cn:lambda:cn-north-1:111122223333:function:s3migration")
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"arn:aws-cn:states:::lambda:invoke"`)
+	assert.NotContains(t, string(body), `"arn:aws:states:::lambda:invoke"`)
+}
+
+func testJobInput() *s3control.CreateJobInput {
+	return NewCreateJobInput(&batchJobArgs{
+		AccountId:        aws.String("111122223333"),
+		RoleArn:          aws.String("arn:aws:iam::111122223333:role/somedummyrole"),
+		TargetBucketName: aws.String("dst"),
+		ManifestETag:     aws.String("etag"),
+		ManifestArn:      aws.String("arn:aws:s3:::src/manifest.csv"),
+	})
+}
@@ -0,0 +1,70 @@
+package migration
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Phases recorded when a run is stopped, see StopRun
+const (
+	StopPhasePlanning = "planning" // Waiting for or filtering the inventory, the run has to be started again
+	StopPhaseJobs     = "jobs"     // Creating or watching the batch jobs, the run can be resumed
+)
+
+// Recorded in the state when the run is stopped by a signal
+type stopRecord struct {
+	Signal string    `json:"signal"`
+	Phase  string    `json:"phase"`
+	JobIDs []string  `json:"jobIds,omitempty"` // Jobs created before the stop, which keep running
+	At     time.Time `json:"at"`
+}
+
+// The run in progress in this process, whose state is recorded when it is stopped
+var activeRun struct {
+	sync.Mutex
+	st *runState
+}
+
+func trackRun(st *runState) {
+	activeRun.Lock()
+	defer activeRun.Unlock()
+	activeRun.st = st
+}
+
+// Record in the state that the run in progress was stopped by the signal, eg. a SIGTERM from Kubernetes or
+// ECS, and return its phase and the state file to resume it from.  The state file is "" when the run hadn't
+// recorded its plan yet, or had completed, so there's nothing to resume.  Batch jobs keep running.
+func StopRun(signal string) (string, string) {
+	activeRun.Lock()
+	st := activeRun.st
+	activeRun.Unlock()
+	if st == nil {
+		return StopPhasePlanning, ""
+	}
+
+	st.mu.Lock()
+	if st.Completed {
+		st.mu.Unlock()
+		return StopPhaseJobs, ""
+	}
+	record := &stopRecord{Signal: signal, Phase: StopPhaseJobs, At: time.Now()}
+	for _, step := range st.Steps {
+		if step.JobID != "" {
+			record.JobIDs = append(record.JobIDs, step.JobID)
+		}
+	}
+	st.Stopped = record
+	st.mu.Unlock()
+	st.mustSave()
+	return record.Phase, st.path
+}
+
+// Command resuming the run recorded in the state file, and table when given
+func ResumeCommand(path, table, region string) string {
+	parts := []string{"s3migration", "watch", "--resume", "--state-file", shellQuote(path)}
+	if table != "" {
+		parts = append(parts, "--state-table", shellQuote(table), "--region", shellQuote(region))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,42 @@
+package migration
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopRun(t *testing.T) {
+	defer trackRun(nil)
+
+	trackRun(nil)
+	phase, path := StopRun("terminated")
+	assert.Equal(t, StopPhasePlanning, phase)
+	assert.Empty(t, path)
+
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	st := &runState{Args: MigrationArgs{SourceBucket: "src"}, path: statePath,
+		Steps: []*jobStep{{Kind: jobKindNonVersion, JobID: "job-1"}, {Kind: jobKindVersion}}}
+	trackRun(st)
+	phase, path = StopRun("terminated")
+	assert.Equal(t, StopPhaseJobs, phase)
+	assert.Equal(t, statePath, path)
+
+	saved, err := loadRunState(statePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "terminated", saved.Stopped.Signal)
+	assert.Equal(t, []string{"job-1"}, saved.Stopped.JobIDs)
+	assert.False(t, saved.Completed)
+
+	// A completed run has nothing to resume
+	st.complete()
+	_, path = StopRun("terminated")
+	assert.Empty(t, path)
+}
+
+func TestResumeCommand(t *testing.T) {
+	assert.Equal(t, "s3migration watch --resume --state-file 'my state.json'", ResumeCommand("my state.json", "", "us-east-1"))
+	assert.Equal(t, "s3migration watch --resume --state-file 's.json' --state-table 'runs' --region 'us-east-1'",
+		ResumeCommand("s.json", "runs", "us-east-1"))
+}
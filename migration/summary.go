@@ -0,0 +1,289 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"s3migration/util"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Formats of a run's summary
+const (
+	SummaryFormatHTML = "html"
+	SummaryFormatCSV  = "csv"
+)
+
+var SummaryFormats = []string{SummaryFormatHTML, SummaryFormatCSV}
+
+// Failed tasks of a batch job sharing an error code, from its completion report, see --failure-report
+type FailureCount struct {
+	JobID     string `json:"jobId"`
+	ErrorCode string `json:"errorCode"`
+	Count     int64  `json:"count"`
+	Example   string `json:"example,omitempty"` // Key of one of the objects that failed
+}
+
+// Count each created job's failed tasks by error code, when the jobs write completion reports, and log the
+// breakdown.  With FailedObjectsFile the failed tasks are also written to it.  A job whose completion report
+// can't be read, eg. one that failed before running its tasks, is left out.
+func (s3obj *s3migration) recordFailures(ctx context.Context, st *runState) {
+	if s3obj.report == nil || !(st.Args.Move || st.Args.FailureReport) {
+		return
+	}
+	var out *csv.Writer
+	if st.Args.FailedObjectsFile != "" {
+		f, err := os.Create(st.Args.FailedObjectsFile)
+		if err != nil {
+			zap.L().Error("Unable to write failed objects", zap.String("file", st.Args.FailedObjectsFile), zap.Error(err))
+		} else {
+			defer f.Close()
+			out = csv.NewWriter(f)
+			defer out.Flush()
+			out.Write([]string{"jobId", "bucket", "key", "versionId", "taskStatus", "httpStatusCode", "errorCode", "resultMessage"})
+		}
+	}
+
+	s3obj.report.Failures = nil
+	for _, step := range st.Steps {
+		if step.JobID == "" {
+			continue
+		}
+		rows, err := s3obj.completionReportRows(ctx, st.Args.SourceBucket, step.JobID)
+		if err != nil {
+			zap.L().Error("Failed to read batch job completion report", zap.String("jobId", step.JobID), zap.Error(err))
+			continue
+		}
+		failures := failureCounts(step.JobID, rows)
+		for _, f := range failures {
+			zap.L().Warn("Failed tasks by error code",
+				zap.String("jobId", f.JobID),
+				zap.String("errorCode", f.ErrorCode),
+				zap.Int64("count", f.Count),
+				zap.String("example", f.Example),
+			)
+		}
+		s3obj.report.Failures = append(s3obj.report.Failures, failures...)
+		if out != nil {
+			writeFailedObjects(out, step.JobID, rows)
+		}
+	}
+}
+
+func failureCounts(jobID string, rows [][]string) []FailureCount {
+	counts := map[string]*FailureCount{}
+	for _, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		code := row[3] // The task status, when the row has no error code
+		if len(row) > 5 && row[5] != "" {
+			code = row[5]
+		}
+		c, ok := counts[code]
+		if !ok {
+			c = &FailureCount{JobID: jobID, ErrorCode: code}
+			c.Example, _ = util.DecodeManifestKey(row[1])
+			counts[code] = c
+		}
+		c.Count++
+	}
+	failures := []FailureCount{}
+	for _, c := range counts {
+		failures = append(failures, *c)
+	}
+	// Most frequent first
+	slices.SortFunc(failures, func(a, b FailureCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), strings.Compare(a.ErrorCode, b.ErrorCode))
+	})
+	return failures
+}
+
+// Write the failed tasks of a job's completion report with their keys decoded
+func writeFailedObjects(out *csv.Writer, jobID string, rows [][]string) {
+	for _, row := range rows {
+		if len(row) < 4 {
+			continue
+		}
+		record := make([]string, 8)
+		record[0] = jobID
+		copy(record[1:], row)
+		if key, err := util.DecodeManifestKey(row[1]); err == nil {
+			record[2] = key
+		}
+		out.Write(record)
+	}
+}
+
+// Objects a run didn't copy, or that still need attention, for the summary
+type skippedCount struct {
+	Reason string
+	Count  int64
+}
+
+func skippedObjects(r *Report) []skippedCount {
+	skipped := []skippedCount{}
+	add := func(reason string, n int64) {
+		if n > 0 {
+			skipped = append(skipped, skippedCount{Reason: reason, Count: n})
+		}
+	}
+	for _, job := range r.Jobs {
+		add("Failed to copy in job "+job.JobID, job.Failed)
+	}
+	if r.DeleteMarkers != nil {
+		add("Delete markers, which can't be copied", int64(r.DeleteMarkers.Markers))
+	}
+	if r.Drift != nil {
+		add("Changed on the source during the migration (estimated)", int64(r.Drift.EstimatedChanged))
+	}
+	if r.Move != nil {
+		add("Kept on the source by the move", int64(r.Move.Kept))
+		add("Kept on the source as they changed after the copy", int64(r.Move.Modified))
+		add("Failed to delete from the source", int64(r.Move.Errors))
+	}
+	return skipped
+}
+
+// Error codes of a job's failed tasks, eg. AccessDenied=3;NoSuchKey=1
+func jobFailures(r *Report, jobID string) string {
+	codes := []string{}
+	for _, f := range r.Failures {
+		if f.JobID == jobID {
+			codes = append(codes, fmt.Sprintf("%s=%d", f.ErrorCode, f.Count))
+		}
+	}
+	return strings.Join(codes, ";")
+}
+
+// A run's report with its totals, as shown in the HTML summary
+type summaryPage struct {
+	*Report
+	GeneratedAt time.Time
+	Total       int64
+	Succeeded   int64
+	Failed      int64
+	Skipped     []skippedCount
+}
+
+func newSummaryPage(r *Report) summaryPage {
+	page := summaryPage{Report: r, GeneratedAt: time.Now(), Skipped: skippedObjects(r)}
+	for _, job := range r.Jobs {
+		page.Total += job.Total
+		page.Succeeded += job.Succeeded
+		page.Failed += job.Failed
+	}
+	return page
+}
+
+var summaryTemplate = template.Must(template.New("summary").Funcs(templateFuncs).Funcs(template.FuncMap{
+	"failures": func(r *Report, jobID string) string { return jobFailures(r, jobID) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>S3 migration of {{.SourceBucket}} to {{.DestinationBucket}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em 0.6em; text-align: left; }
+td.n { text-align: right; }
+.met { color: #1a7f37; }
+.missed { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>S3 migration of {{.SourceBucket}} to {{.DestinationBucket}}</h1>
+<p>Started {{time .StartedAt}}, completed {{time .CompletedAt}}, summary generated {{time .GeneratedAt}}</p>
+<h2>Outcome</h2>
+<table>
+<tr><th>Success threshold</th><td class="{{if .ThresholdMet}}met">Met{{else}}missed">Not met{{end}}</td></tr>
+<tr><th>Success ratio</th><td class="n">{{percent .SuccessRatio}}</td></tr>
+<tr><th>Required</th><td class="n">{{percent .RequiredRatio}}</td></tr>
+<tr><th>Objects copied</th><td class="n">{{.Succeeded}} / {{.Total}}</td></tr>
+<tr><th>Objects failed</th><td class="n">{{.Failed}}</td></tr>
+<tr><th>Inventory bytes</th><td class="n">{{bytes .Bytes}}</td></tr>
+{{- if .ChecksumAlgorithm}}
+<tr><th>Checksum</th><td>{{.ChecksumAlgorithm}}</td></tr>
+{{- end}}
+</table>
+<h2>Jobs</h2>
+<table>
+<tr><th>Job</th><th>Status</th><th>Tasks</th><th>Succeeded</th><th>Failed</th><th>Bytes</th><th>Errors</th></tr>
+{{- range .Jobs}}
+<tr>
+<td>{{.JobID}}</td>
+<td>{{.Status}}</td>
+<td class="n">{{.Total}}</td>
+<td class="n">{{.Succeeded}}</td>
+<td class="n">{{.Failed}}</td>
+<td class="n">{{bytes .Bytes}}</td>
+<td>{{failures $.Report .JobID}}</td>
+</tr>
+{{- end}}
+</table>
+{{- if .Failures}}
+<h2>Failures</h2>
+<table>
+<tr><th>Job</th><th>Error code</th><th>Tasks</th><th>Example key</th></tr>
+{{- range .Failures}}
+<tr><td>{{.JobID}}</td><td>{{.ErrorCode}}</td><td class="n">{{.Count}}</td><td>{{.Example}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Skipped}}
+<h2>Objects not copied</h2>
+<table>
+{{- range .Skipped}}
+<tr><th>{{.Reason}}</th><td class="n">{{.Count}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Phases</h2>
+<table>
+{{- range .Phases}}
+<tr><th>{{.Name}}</th><td class="n">{{printf "%.0f" .Seconds}} s</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// Write a run's report as a summary for people, eg. to attach to a change ticket: an HTML page, or a CSV
+// file of the jobs with a final row of the totals and threshold outcome
+func WriteReportSummary(r *Report, format string, w io.Writer) error {
+	switch format {
+	case SummaryFormatHTML:
+		return summaryTemplate.Execute(w, newSummaryPage(r))
+	case SummaryFormatCSV:
+		return writeSummaryCSV(r, w)
+	}
+	return fmt.Errorf("unknown summary format '%s'", format)
+}
+
+func writeSummaryCSV(r *Report, w io.Writer) error {
+	page := newSummaryPage(r)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"jobId", "status", "total", "succeeded", "failed", "bytes", "errors"})
+	for _, job := range r.Jobs {
+		_ = cw.Write([]string{job.JobID, job.Status, strconv.FormatInt(job.Total, 10), strconv.FormatInt(job.Succeeded, 10),
+			strconv.FormatInt(job.Failed, 10), strconv.FormatInt(job.Bytes, 10), jobFailures(r, job.JobID)})
+	}
+	outcome := "threshold not met"
+	if r.ThresholdMet {
+		outcome = "threshold met"
+	}
+	_ = cw.Write([]string{"total", outcome, strconv.FormatInt(page.Total, 10), strconv.FormatInt(page.Succeeded, 10),
+		strconv.FormatInt(page.Failed, 10), strconv.FormatInt(r.Bytes, 10), ""})
+	cw.Flush()
+	return cw.Error()
+}
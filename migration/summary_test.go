@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordFailures(t *testing.T) {
+	reports := completionReportPrefix("src")
+	m := &mock{objects: map[string]string{
+		reports + "/job-a/manifest.json": `{"Format":"Report_CSV_20180820","Results":[{"Key":"` + reports + `/job-a/results/1.csv"}]}`,
+		reports + "/job-a/results/1.csv": "src,one,,failed,403,AccessDenied,Access Denied\n" +
+			"src,two%20keys,,failed,404,NoSuchKey,Not Found\n" +
+			"src,three,,failed,403,AccessDenied,Access Denied\n",
+	}}
+	s3mig := &s3migration{s3Client: m, report: newReport(MigrationArgs{})}
+	st := &runState{
+		Args:  MigrationArgs{SourceBucket: "src", FailureReport: true, FailedObjectsFile: filepath.Join(t.TempDir(), "failed.csv")},
+		Steps: []*jobStep{{JobID: "a"}, {JobID: "unreadable"}, {}},
+	}
+	s3mig.recordFailures(context.TODO(), st)
+	assert.Equal(t, []FailureCount{
+		{JobID: "a", ErrorCode: "AccessDenied", Count: 2, Example: "one"},
+		{JobID: "a", ErrorCode: "NoSuchKey", Count: 1, Example: "two keys"},
+	}, s3mig.report.Failures)
+	assert.Equal(t, "AccessDenied=2;NoSuchKey=1", jobFailures(s3mig.report, "a"))
+
+	body, err := os.ReadFile(st.Args.FailedObjectsFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "jobId,bucket,key,versionId,taskStatus,httpStatusCode,errorCode,resultMessage\n"+
+		"a,src,one,,failed,403,AccessDenied,Access Denied\n"+
+		"a,src,two keys,,failed,404,NoSuchKey,Not Found\n"+
+		"a,src,three,,failed,403,AccessDenied,Access Denied\n", string(body))
+}
+
+func TestWriteReportSummary(t *testing.T) {
+	r := &Report{
+		SourceBucket:      "src",
+		DestinationBucket: "dst",
+		Jobs: []JobSummary{
+			{JobID: "a", Status: "Complete", Total: 10, Succeeded: 7, Failed: 3, Bytes: 100},
+			{JobID: "b", Status: "Complete", Total: 5, Succeeded: 5},
+		},
+		SuccessRatio:  0.8,
+		RequiredRatio: 0.8,
+		ThresholdMet:  true,
+		Bytes:         100,
+		Failures:      []FailureCount{{JobID: "a", ErrorCode: "AccessDenied", Count: 3, Example: "<one>"}},
+		Move:          &MoveSummary{Deleted: 12, Kept: 3},
+	}
+	var csvOut bytes.Buffer
+	assert.NoError(t, WriteReportSummary(r, SummaryFormatCSV, &csvOut))
+	assert.Equal(t, "jobId,status,total,succeeded,failed,bytes,errors\n"+
+		"a,Complete,10,7,3,100,AccessDenied=3\n"+
+		"b,Complete,5,5,0,0,\n"+
+		"total,threshold met,15,12,3,100,\n", csvOut.String())
+
+	var htmlOut bytes.Buffer
+	assert.NoError(t, WriteReportSummary(r, SummaryFormatHTML, &htmlOut))
+	page := htmlOut.String()
+	assert.Contains(t, page, `<td class="met">Met</td>`)
+	assert.Contains(t, page, "<td>a</td><td>AccessDenied</td><td class=\"n\">3</td><td>&lt;one&gt;</td>")
+	assert.Contains(t, page, "<tr><th>Kept on the source by the move</th><td class=\"n\">3</td></tr>")
+	assert.Contains(t, page, "<tr><th>Failed to copy in job a</th><td class=\"n\">3</td></tr>")
+
+	assert.ErrorContains(t, WriteReportSummary(r, "pdf", &htmlOut), "unknown summary format")
+}
@@ -0,0 +1,122 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// What the success ratio of a threshold policy counts
+const (
+	ThresholdBasisObjects = "objects"
+	ThresholdBasisBytes   = "bytes"
+)
+
+// How a threshold policy combines jobs: every job must meet the threshold, or the jobs' totals must
+const (
+	ThresholdModePerJob    = "per-job"
+	ThresholdModeAggregate = "aggregate"
+)
+
+var DefaultSimulatedThresholds = []float32{0.8, 0.9, 0.95, 0.99, 1}
+
+// Success ratio a completed run achieved under one threshold policy.  Unavailable when the report doesn't
+// have what the policy counts, ie. job bytes.
+type ThresholdPolicy struct {
+	Basis     string  `json:"basis"`
+	Mode      string  `json:"mode"`
+	Available bool    `json:"available"`
+	Achieved  float32 `json:"achieved"`
+}
+
+// Whether the run would have met the threshold under this policy
+func (p ThresholdPolicy) Met(threshold float32) bool {
+	return p.Available && p.Achieved >= threshold
+}
+
+// Success ratio of each threshold policy over the jobs of a run report.  Jobs without tasks are skipped,
+// as they are by the run.  Bytes are only known per job, from the inventory when the run was chunked, so
+// failed tasks count as objects of the job's average size: per-job bytes ratios are the per-job object
+// ratios, while the aggregate weighs each job by its bytes.
+func SimulateThresholds(report *Report) []ThresholdPolicy {
+	objects := ThresholdPolicy{Basis: ThresholdBasisObjects, Mode: ThresholdModeAggregate, Available: true}
+	perJob := ThresholdPolicy{Basis: ThresholdBasisObjects, Mode: ThresholdModePerJob, Available: true, Achieved: 1}
+	bytes := ThresholdPolicy{Basis: ThresholdBasisBytes, Mode: ThresholdModeAggregate, Available: true}
+	var total, succeeded int64
+	var totalBytes, succeededBytes float64
+	for _, job := range report.Jobs {
+		if job.Total < 1 {
+			continue
+		}
+		ratio := float64(job.Succeeded) / float64(job.Total)
+		total += job.Total
+		succeeded += job.Succeeded
+		perJob.Achieved = min(perJob.Achieved, float32(ratio))
+		if job.Bytes <= 0 {
+			bytes.Available = false
+		}
+		totalBytes += float64(job.Bytes)
+		succeededBytes += float64(job.Bytes) * ratio
+	}
+	if total == 0 {
+		// Nothing was copied, as the run would report
+		perJob.Achieved = 0
+		bytes.Available = false
+	} else {
+		objects.Achieved = float32(float64(succeeded) / float64(total))
+	}
+	if bytes.Available && totalBytes > 0 {
+		bytes.Achieved = float32(succeededBytes / totalBytes)
+	}
+	perJobBytes := perJob
+	perJobBytes.Basis = ThresholdBasisBytes
+	perJobBytes.Available = bytes.Available
+	return []ThresholdPolicy{objects, perJob, bytes, perJobBytes}
+}
+
+// Read a run report written to --report-file
+func LoadReport(path string) (*Report, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	if err := json.Unmarshal(body, report); err != nil {
+		return nil, fmt.Errorf("report %s is corrupt or malformed: %w", path, err)
+	}
+	return report, nil
+}
+
+// Write a table of whether the run would have met each threshold under each policy
+func WriteThresholdSimulation(report *Report, thresholds []float32, w io.Writer) error {
+	fmt.Fprintf(w, "Run of %s to %s: %d jobs, success ratio %.4f against required %.2f, threshold met: %t\n\n",
+		report.SourceBucket, report.DestinationBucket, len(report.Jobs), report.SuccessRatio, report.RequiredRatio, report.ThresholdMet)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "BASIS\tMODE\tACHIEVED")
+	for _, t := range thresholds {
+		fmt.Fprintf(tw, "\t%.2f", t)
+	}
+	fmt.Fprintf(tw, "\n")
+	for _, p := range SimulateThresholds(report) {
+		if !p.Available {
+			fmt.Fprintf(tw, "%s\t%s\tn/a", p.Basis, p.Mode)
+			for range thresholds {
+				fmt.Fprintf(tw, "\t-")
+			}
+			fmt.Fprintf(tw, "\n")
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.4f", p.Basis, p.Mode, p.Achieved)
+		for _, t := range thresholds {
+			outcome := "fail"
+			if p.Met(t) {
+				outcome = "pass"
+			}
+			fmt.Fprintf(tw, "\t%s", outcome)
+		}
+		fmt.Fprintf(tw, "\n")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,64 @@
+package migration
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulateThresholds(t *testing.T) {
+	report := &Report{Jobs: []JobSummary{
+		{JobID: "a", Total: 100, Succeeded: 100, Bytes: 100 << 30},
+		{JobID: "b", Total: 100, Succeeded: 90, Failed: 10, Bytes: 1 << 30},
+		{JobID: "empty"},
+	}}
+	policies := SimulateThresholds(report)
+	assert.Len(t, policies, 4)
+	byPolicy := map[string]ThresholdPolicy{}
+	for _, p := range policies {
+		assert.True(t, p.Available, p.Basis+" "+p.Mode)
+		byPolicy[p.Basis+" "+p.Mode] = p
+	}
+	assert.InDelta(t, 0.95, byPolicy["objects aggregate"].Achieved, 0.0001)
+	assert.InDelta(t, 0.9, byPolicy["objects per-job"].Achieved, 0.0001)
+	assert.InDelta(t, 0.9990, byPolicy["bytes aggregate"].Achieved, 0.0001)
+	assert.InDelta(t, 0.9, byPolicy["bytes per-job"].Achieved, 0.0001)
+	assert.True(t, byPolicy["bytes aggregate"].Met(0.99))
+	assert.False(t, byPolicy["objects aggregate"].Met(0.99))
+
+	// Without job bytes only the objects basis can be simulated
+	report.Jobs[1].Bytes = 0
+	for _, p := range SimulateThresholds(report) {
+		assert.Equal(t, p.Basis == ThresholdBasisObjects, p.Available, p.Basis+" "+p.Mode)
+		assert.False(t, p.Basis == ThresholdBasisBytes && p.Met(0))
+	}
+
+	// Nothing copied never meets a threshold
+	for _, p := range SimulateThresholds(&Report{}) {
+		assert.False(t, p.Met(0.5), p.Basis+" "+p.Mode)
+	}
+}
+
+func TestWriteThresholdSimulation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"sourceBucket": "src", "destinationBucket": "dst", "successRatio": 0.95, "requiredRatio": 0.8, "thresholdMet": true,
+		"jobs": [{"jobId": "a", "total": 100, "succeeded": 100}, {"jobId": "b", "total": 100, "succeeded": 90, "failed": 10}]}`), 0600))
+	report, err := LoadReport(path)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteThresholdSimulation(report, []float32{0.9, 0.95, 0.99}, &out))
+	assert.Equal(t, "Run of src to dst: 2 jobs, success ratio 0.9500 against required 0.80, threshold met: true\n\n"+
+		"BASIS    MODE       ACHIEVED  0.90  0.95  0.99\n"+
+		"objects  aggregate  0.9500    pass  pass  fail\n"+
+		"objects  per-job    0.9000    pass  fail  fail\n"+
+		"bytes    aggregate  n/a       -     -     -\n"+
+		"bytes    per-job    n/a       -     -     -\n", out.String())
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{`), 0600))
+	_, err = LoadReport(path)
+	assert.Error(t, err)
+}
@@ -2,17 +2,57 @@ package migration
 
 import (
 	"context"
+	"s3migration/util"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+// Formats of the manifest filtered from an inventory report
+const (
+	ManifestFormatInventory = "inventory" // Inventory CSV columns as selected by S3 Select
+	ManifestFormatBatch     = "batch"     // S3BatchOperations_CSV_20180820 with Bucket, Key and VersionId selected by name
+)
+
+// --kms-id value encrypting uploads with S3 managed keys
+const KmsSSES3 = "SSE-S3"
+
+// EncryptionStatus values of inventory reports, see --encryption-status
+var EncryptionStatuses = []string{"NOT-SSE", "SSE-S3", "SSE-C", "SSE-KMS", "DSSE-KMS"}
+
+// Optional fields of the inventory configurations the tool creates, see --inventory-fields
+var DefaultInventoryFields = []string{
+	string(s3types.InventoryOptionalFieldLastModifiedDate),
+	string(s3types.InventoryOptionalFieldReplicationStatus),
+	string(s3types.InventoryOptionalFieldSize), // Batch operations has a 5GB limit, can use this to filter those out
+	string(s3types.InventoryOptionalFieldEncryptionStatus),
+	string(s3types.InventoryOptionalFieldETag),              // Compared by diff --compare-etag
+	string(s3types.InventoryOptionalFieldChecksumAlgorithm), // Checked by verify --checksum-algorithm
+}
+
+// Canned ACL selections in addition to the S3 canned ACL values
+const (
+	CannedACLAuto = "auto" // bucket-owner-full-control when destination ownership is enforced
+	CannedACLNone = "none" // Never set a canned ACL
 )
 
 type inventoryManifestFinderArgs struct {
-	BucketName string
-	Prefix     string
-	DateWindow int
+	BucketName   string                     // Bucket the inventory reports are delivered to, which may be shared with other source buckets
+	Prefix       string                     // Destination prefix, source bucket and configuration name, ie. where this config's manifests are
+	Frequency    s3types.InventoryFrequency // Of the reports' deliveries, the existing configuration's when it was already enabled
+	DateWindow   int                        // Periods of 48 hours searched for a manifest, see inventoryDateWindow
+	SourceBucket string                     // Source bucket a manifest must list to be used
+	Created      bool                       // The configuration was created, or enabled, for this run
+}
+
+// Inventory report the batch manifests are filtered from, with the bucket it was delivered to
+type inventoryReport struct {
+	Bucket   string
+	Manifest s3types.Object
+	Created  bool // The inventory configuration was created for this run, see --cleanup-inventory
 }
 
 type MigrationArgs struct {
@@ -20,51 +60,152 @@ type MigrationArgs struct {
 	AccountID           string
 	SourceBucket        string
 	RoleArn             string
+	CreateRole          string // Name of the role created or updated for the jobs, whose ARN replaces RoleArn
 	DestinationBucket   string
 	RetryInterval       string
+	MaxWait             time.Duration
 	ConfigName          string
+	InventoryBucket     string // Bucket inventory is delivered to and manifests are written to, instead of the source bucket
+	InventoryPolicy     bool   // Add the statement letting S3 deliver inventory to the inventory bucket's policy when missing
+	LocalFilter         bool   // Filter inventory data files locally instead of with S3 Select
+	SelectConcurrency   int    // Inventory data files filtered at once
 	StartDt             time.Time
 	EndDt               time.Time
+	Modified            util.ModifiedRange // --modified-after (inclusive) and --modified-before (exclusive)
 	LatestOnly          string
-	KmsID               string
+	OrderVersions       bool     // Copy non-current versions in passes, oldest first, see splitStepsByVersionOrder
+	MaxVersions         int      // Copy at most this many versions of each key, the newest. Zero copies every version
+	FilterSQL           string   // S3 Select WHERE clause over inventory field names, eg. StorageClass <> 'GLACIER'
+	EncryptionStatuses  []string // Only copy objects with one of these inventory EncryptionStatus values
+	SkipReplicated      bool     // Skip objects whose replication status is COMPLETED
+	SkipExisting        bool     // Skip objects already in the destination with the same size and ETag, see skipExisting
+	KmsID               string   // KMS key manifests and other uploads are encrypted with, or KmsSSES3
 	ReqSuccessThreshold float32
+	MaxFailedObjects    int64   // Fail the threshold when more objects fail, even when the ratio is met. Zero disables
+	CancelFailureRatio  float64 // Cancel a running job when more of its completed tasks fail, see cancelOnFailureSpike
+	CancelMinTasks      int64
 	Region              string
+	Quiet               bool
+	Heartbeat           *util.Heartbeat `json:"-"`
+	ConfirmMode         string
+	PollInterval        time.Duration
+	PollTimeout         time.Duration
+	MaxAPITPS           float64 // AWS requests per second, 0 is unlimited
+	SDKMaxAttempts      int     // Attempts of each request, 0 keeps the SDK default
+	SDKRetryMode        string  // standard or adaptive, "" keeps the SDK default
+	RequestPayer        string  // requester to read from Requester Pays buckets
+	CreateDestination   bool    // Create the destination bucket when missing, see ensureDestinationBucket
+	ReportFile          string
+	CannedACL           string
+	AccessAnalyzer      bool
+	AnalyzerArn         string
+	StateFile           string
+	ListMode            bool
+	ListInventory       bool // Build the inventory report by listing the source bucket, see listInventory
+	LocalInventory      string
+	KeysFile            string
+	PlanOnly            bool
+	PlanFile            string // File the resolved plan is written to as JSON, "-" for stdout, see PlanDocument
+	Chunks              int
+	ManifestFormat      string
+	CleanupOlderThan    time.Duration
+	DriftSample         int
+	DriftKeysFile       string
+	MetadataFilter      *MetadataFilter
+	ManifestGenerator   bool
+	ManifestArn         string // Existing manifest.json or S3 Batch Operations CSV copied as-is instead of building one
+	ManifestETag        string // Of the existing manifest, read from it when empty
+	ReplicationStatuses []string
+	InventoryFrequency  string
+	InventoryFields     []string // Optional fields of the inventory configuration created, DefaultInventoryFields when empty
+	ReplayDeletes       bool
+	AnalyzeMarkers      bool
+	PurgeEligibleFile   string
+	Mode                string
+	FunctionArn         string // Lambda function invoked for each object with Mode lambda
+	Move                bool
+	MoveReportFile      string
+	PreserveObjectLock  bool
+	Timeline            time.Duration
+	PreserveACL         bool
+	Grants              []s3controltypes.S3Grant
+	ChecksumAlgorithm   string
+	NewMetadata         *s3controltypes.S3ObjectMetadata // Metadata copies get instead of their source object's, see ParseObjectMetadata
+	MetricsNamespace    string
+	MetricsFile         string
+	AssertOwnership     s3types.ObjectOwnership
+	EventBus            string
+	EventStream         string // File, or fd:N file descriptor, NDJSON progress events are written to
+	AccessGrants        bool
+	StateTable          string // DynamoDB table the state is checkpointed to, keyed by StateFile
+	NoWait              bool   `json:"-"` // Exit once the first jobs are created, leaving them to watch --resume
+	FailureReport       bool   // Write completion reports of failed tasks, summarized by error code in the report
+	FailedObjectsFile   string // CSV file the failed tasks of the completion reports are written to
+	CleanupInventory    bool   // Once the copy succeeds, remove the inventory configuration the run created and its reports
 }
 type batchJobArgs struct {
-	AccountId          *string // Account hosting the batch job
-	RoleArn            *string // IAM role used by S3 Batch operation
-	SourceBucketName   *string // S3 bucket that content is being copied from
-	TargetBucketName   *string // S3 bucket that content is being copied to
-	ManifestArn        *string // ARN pointing to manifest.json created by inventory process
-	ManifestETag       *string // ETag of manifest.json created by inventory process
-	VersioningDisabled bool    // True if versioning is disable on source bucket
+	AccountId          *string                          // Account hosting the batch job
+	RoleArn            *string                          // IAM role used by S3 Batch operation
+	SourceBucketName   *string                          // S3 bucket that content is being copied from
+	TargetBucketName   *string                          // S3 bucket that content is being copied to
+	TargetRegion       string                           // Region of the target, for directory bucket ARNs
+	ManifestArn        *string                          // ARN pointing to manifest.json created by inventory process
+	ManifestETag       *string                          // ETag of manifest.json created by inventory process
+	VersioningDisabled bool                             // True if versioning is disable on source bucket
+	CannedACL          string                           // Canned ACL selection for the copy operation, see CannedACLAuto
+	ManifestFields     []string                         // When set, the manifest is an S3 Batch Operations CSV with these fields
+	SingleManifest     bool                             // Manifest lists exact objects, so one job copies them all regardless of versioning
+	Replicate          bool                             // Replicate objects with the source bucket's replication configuration instead of copying them
+	Grants             []s3controltypes.S3Grant         // Explicit grants for copied objects, instead of a canned ACL
+	PreserveACL        bool                             // Copied objects get their source ACL, so no canned ACL is set
+	ChecksumAlgorithm  string                           // Additional checksum calculated for copied objects, eg. SHA256
+	NewMetadata        *s3controltypes.S3ObjectMetadata // When set, replaces the metadata of copied objects
+	FunctionArn        string                           // Lambda function invoked for each object instead of copying it
 }
 
 // Expected format of S3 inventory manifest.json
 type manifestJson struct {
-	Files []struct {
+	SourceBucket string `json:"sourceBucket"`
+	Files        []struct {
 		Key string `json:"key"`
 	} `json:"files"`
 	FileSchema string `json:"fileSchema"`
 }
 
+// Keys of the manifest's data files
+func (m *manifestJson) dataFileKeys() []string {
+	keys := make([]string, len(m.Files))
+	for i, f := range m.Files {
+		keys[i] = f.Key
+	}
+	return keys
+}
+
 type userFilters struct {
 	StartDate  time.Time
 	EndDate    time.Time
+	Modified   util.ModifiedRange
 	LatestOnly string
-	kmsID      string
+	SQL        string   // User WHERE clause, see util.AddSQLFilter
+	Encryption []string // EncryptionStatus values of the objects to copy, any when empty
+	// Skip objects whose ReplicationStatus is COMPLETED, ie. already replicated to the destination
+	SkipReplicated bool
+	kmsID          string
+}
+
+// Reports whether an object last modified at t passes both the start/end and the modified range filters
+func (f userFilters) matchesDate(t time.Time) bool {
+	return util.MatchesDateFilter(t, f.StartDate, f.EndDate) && f.Modified.Matches(t)
 }
 
+// Produces the manifest object for a batch job from the user filters
+type manifestBuilder func(ctx context.Context, jobArgs *batchJobArgs, filters userFilters) (*s3types.Object, error)
+
 type jobInputParams struct {
 	versionJobParam    *s3control.CreateJobInput
 	nonVersionJobParam *s3control.CreateJobInput
 }
 
-type jobResults struct {
-	versionJobResult    *s3control.DescribeJobOutput
-	nonVersionJobResult *s3control.DescribeJobOutput
-}
-
 // https://pkg.go.dev/slices#SortFunc
 // slices.SortFunc is easier than sort interface
 func objectDateDescending(a, b s3types.Object) int {
@@ -75,6 +216,7 @@ type s3API interface {
 	PutBucketInventoryConfiguration(ctx context.Context, params *s3.PutBucketInventoryConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketInventoryConfigurationOutput, error)
 	GetBucketInventoryConfiguration(ctx context.Context, params *s3.GetBucketInventoryConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketInventoryConfigurationOutput, error)
 	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
@@ -85,9 +227,37 @@ type s3API interface {
 	CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
 	AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
 	GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error)
+	GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error)
+	PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	GetBucketReplication(ctx context.Context, params *s3.GetBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	GetObjectAcl(ctx context.Context, params *s3.GetObjectAclInput, optFns ...func(*s3.Options)) (*s3.GetObjectAclOutput, error)
+	GetObjectLockConfiguration(ctx context.Context, params *s3.GetObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error)
+	GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error)
+	DeleteBucketInventoryConfiguration(ctx context.Context, params *s3.DeleteBucketInventoryConfigurationInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketInventoryConfigurationOutput, error)
+	CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error)
+	PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error)
+	PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error)
+	PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error)
+	GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error)
+	PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error)
+	GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	GetBucketNotificationConfiguration(ctx context.Context, params *s3.GetBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketNotificationConfigurationOutput, error)
+	PutBucketNotificationConfiguration(ctx context.Context, params *s3.PutBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketNotificationConfigurationOutput, error)
+	GetBucketCors(ctx context.Context, params *s3.GetBucketCorsInput, optFns ...func(*s3.Options)) (*s3.GetBucketCorsOutput, error)
+	PutBucketCors(ctx context.Context, params *s3.PutBucketCorsInput, optFns ...func(*s3.Options)) (*s3.PutBucketCorsOutput, error)
+	GetBucketWebsite(ctx context.Context, params *s3.GetBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.GetBucketWebsiteOutput, error)
+	PutBucketWebsite(ctx context.Context, params *s3.PutBucketWebsiteInput, optFns ...func(*s3.Options)) (*s3.PutBucketWebsiteOutput, error)
+	GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error)
+	PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error)
+	GetBucketLogging(ctx context.Context, params *s3.GetBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketLoggingOutput, error)
+	PutBucketLogging(ctx context.Context, params *s3.PutBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketLoggingOutput, error)
 }
 
 type s3ControlAPI interface {
 	CreateJob(ctx context.Context, params *s3control.CreateJobInput, optFns ...func(*s3control.Options)) (*s3control.CreateJobOutput, error)
 	DescribeJob(ctx context.Context, params *s3control.DescribeJobInput, optFns ...func(*s3control.Options)) (*s3control.DescribeJobOutput, error)
+	UpdateJobStatus(ctx context.Context, params *s3control.UpdateJobStatusInput, optFns ...func(*s3control.Options)) (*s3control.UpdateJobStatusOutput, error)
 }
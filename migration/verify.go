@@ -0,0 +1,153 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"s3migration/util"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+// Inventory field with the additional checksum algorithm of each object
+const checksumColumn = "ChecksumAlgorithm"
+
+// Returned by Verify when the destination has no inventory report delivered after the source's one yet
+var ErrInventoryPending = errors.New("destination inventory report not delivered yet")
+
+// Returned by Verify when objects are missing in the destination or differ from the source
+var ErrVerifyMismatch = errors.New("destination objects missing or differing from the source")
+
+type VerifyArgs struct {
+	SourceRegion       string
+	SourceBucket       string
+	DestinationBucket  string
+	ConfigName         string // Inventory configuration read on the source, and created on the destination when the default
+	InventoryBucket    string // Bucket inventory reports are delivered to, see --inventory-dest-bucket
+	InventoryPolicy    bool   // Add the statement letting S3 deliver the destination's reports when missing
+	InventoryFrequency string // Of the destination's inventory configuration when created, Daily or Weekly
+	CompareETag        bool
+	ChecksumAlgorithm  string        // Additional checksum every destination object must have, eg. SHA256
+	RetryInterval      time.Duration // Between checks for the destination's report
+	MaxWait            time.Duration // For the destination's report, zero checks once
+	Heartbeat          *util.Heartbeat
+}
+
+// Check the copy end to end: join the destination's inventory report, delivered after the source's latest
+// one, with the source's and write the objects missing in the destination or differing from the source to w
+// as CSV, like Diff.  The destination's inventory configuration is created when missing, so the first run
+// usually returns ErrInventoryPending, to be rerun once the report is delivered a day or two later.  Returns
+// ErrVerifyMismatch when any object is reported.
+func Verify(args VerifyArgs, w io.Writer) (*DiffSummary, error) {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", args.SourceRegion),
+			zap.Error(err),
+		)
+	}
+	s3mig := &s3migration{s3Client: s3.NewFromConfig(cfg), inventoryBucket: args.InventoryBucket, heartbeat: args.Heartbeat}
+	return s3mig.verify(ctx, args, w)
+}
+
+func (s3obj *s3migration) verify(ctx context.Context, args VerifyArgs, w io.Writer) (*DiffSummary, error) {
+	finder, err := s3obj.ensureS3InventoryConfig(ctx, args.SourceBucket, args.ConfigName, false, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to find the source inventory configuration: %w", err)
+	}
+	source, err := s3obj.getLatestManifest(ctx, finder)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, fmt.Errorf("no inventory report of source bucket %s found", args.SourceBucket)
+	}
+
+	destFinder, err := s3obj.ensureS3InventoryConfig(ctx, args.DestinationBucket, args.ConfigName, args.ConfigName == inventoryConfigName,
+		s3types.InventoryFrequency(args.InventoryFrequency))
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up the destination inventory configuration: %w", err)
+	}
+	if err := s3obj.ensureInventoryDeliveryPolicy(ctx, args.DestinationBucket, destFinder, args.InventoryPolicy); err != nil {
+		return nil, err
+	}
+	destination, err := s3obj.waitForNewerManifest(ctx, destFinder, aws.ToTime(source.LastModified), args)
+	if err != nil {
+		return nil, err
+	}
+	if args.ChecksumAlgorithm != "" {
+		manifestJson, merr := s3obj.readInventoryManifest(ctx, destFinder.BucketName, *destination)
+		if merr != nil {
+			return nil, merr
+		}
+		if !slices.ContainsFunc(strings.Split(manifestJson.FileSchema, ","), func(col string) bool { return strings.TrimSpace(col) == checksumColumn }) {
+			return nil, fmt.Errorf("destination inventory configuration %s doesn't include the %s field", args.ConfigName, checksumColumn)
+		}
+	}
+	zap.L().Info("Comparing inventory reports",
+		zap.String("source", aws.ToString(source.Key)),
+		zap.String("destination", aws.ToString(destination.Key)),
+	)
+
+	summary, err := s3obj.compareObjects(
+		s3obj.inventoryObjects(ctx, finder.BucketName, *source),
+		s3obj.inventoryObjects(ctx, destFinder.BucketName, *destination),
+		DiffArgs{CompareETag: args.CompareETag, ChecksumAlgorithm: args.ChecksumAlgorithm}, w)
+	if err != nil {
+		return nil, err
+	}
+	logger := zap.L().Info
+	if summary.Missing+summary.Different > 0 {
+		logger = zap.L().Warn
+	}
+	logger("Verified destination against source inventory",
+		zap.String("source", args.SourceBucket),
+		zap.String("destination", args.DestinationBucket),
+		zap.Int("sourceObjects", summary.Source),
+		zap.Int("destinationObjects", summary.Destination),
+		zap.Int("missing", summary.Missing),
+		zap.Int("different", summary.Different),
+	)
+	if summary.Missing+summary.Different > 0 {
+		return summary, fmt.Errorf("%w: %d missing, %d different", ErrVerifyMismatch, summary.Missing, summary.Different)
+	}
+	return summary, nil
+}
+
+// Wait up to the maximum wait for a manifest delivered after the given time, as an older report of the
+// destination doesn't list what was copied since.  The sleeps never pass the deadline, so a last check is
+// made when it's reached.
+func (s3obj *s3migration) waitForNewerManifest(ctx context.Context, finder *inventoryManifestFinderArgs, after time.Time, args VerifyArgs) (*s3types.Object, error) {
+	deadline := time.Now().Add(args.MaxWait)
+	for {
+		s3obj.heartbeat.Beat()
+		manifest, err := s3obj.getLatestManifest(ctx, finder)
+		if err != nil {
+			return nil, err
+		}
+		if manifest != nil && aws.ToTime(manifest.LastModified).After(after) {
+			return manifest, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: no report of %s under s3://%s/%s after %s", ErrInventoryPending,
+				args.DestinationBucket, finder.BucketName, finder.Prefix, after.UTC().Format(time.RFC3339))
+		}
+		sleep := max(min(args.RetryInterval, time.Until(deadline)), 0)
+		zap.L().Info("No destination inventory report newer than the source's yet, sleeping before retry",
+			zap.Duration("retryInterval", sleep),
+		)
+		time.Sleep(sleep)
+	}
+}
@@ -0,0 +1,71 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForNewerManifest(t *testing.T) {
+	delivered := time.Now().Add(-time.Hour)
+	m := &mock{listObjectsV2Output: &s3.ListObjectsV2Output{Contents: []s3types.Object{
+		{Key: aws.String("dst/bulk-copy-inventory/2024-01-02T01-00Z/manifest.json"), LastModified: aws.Time(delivered)},
+	}}}
+	s3mig := &s3migration{s3Client: m}
+	finder := &inventoryManifestFinderArgs{BucketName: "dst", Prefix: "dst/bulk-copy-inventory/", DateWindow: -1}
+	args := VerifyArgs{DestinationBucket: "dst", RetryInterval: time.Millisecond}
+
+	manifest, err := s3mig.waitForNewerManifest(context.TODO(), finder, delivered.Add(-time.Hour), args)
+	assert.NoError(t, err)
+	assert.Equal(t, "dst/bulk-copy-inventory/2024-01-02T01-00Z/manifest.json", *manifest.Key)
+
+	// A report delivered before the source's doesn't list the copies
+	_, err = s3mig.waitForNewerManifest(context.TODO(), finder, delivered.Add(time.Minute), args)
+	assert.ErrorIs(t, err, ErrInventoryPending)
+
+	// A report delivered when the wait is up is still found, by a last check at the deadline
+	dm := &deliveryMock{mock: m, deliveredAt: 2}
+	s3mig = &s3migration{s3Client: dm}
+	args.RetryInterval, args.MaxWait = 20*time.Millisecond, 20*time.Millisecond
+	manifest, err = s3mig.waitForNewerManifest(context.TODO(), finder, delivered.Add(-time.Hour), args)
+	assert.NoError(t, err)
+	assert.NotNil(t, manifest)
+	assert.Equal(t, 2, dm.listings)
+
+	// Otherwise the wait gives up at the deadline, not an interval early, and never sleeps past it
+	dm = &deliveryMock{mock: m, deliveredAt: 1000}
+	s3mig = &s3migration{s3Client: dm}
+	args.RetryInterval, args.MaxWait = 3*time.Millisecond, 10*time.Millisecond
+	start := time.Now()
+	_, err = s3mig.waitForNewerManifest(context.TODO(), finder, delivered.Add(-time.Hour), args)
+	assert.ErrorIs(t, err, ErrInventoryPending)
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, dm.listings, 2)
+	assert.LessOrEqual(t, dm.listings, 5)
+}
+
+func TestCompareChecksums(t *testing.T) {
+	obj := func(key string, checksum ...s3types.ChecksumAlgorithm) s3types.Object {
+		return s3types.Object{Key: aws.String(key), Size: aws.Int64(10), ETag: aws.String(`"a"`), ChecksumAlgorithm: checksum}
+	}
+	m := &bucketListMock{mock: &mock{}, listings: map[string][]s3types.Object{
+		"src": {obj("sha.txt"), obj("crc.txt"), obj("none.txt")},
+		"dst": {obj("sha.txt", s3types.ChecksumAlgorithmSha256), obj("crc.txt", s3types.ChecksumAlgorithmCrc32), obj("none.txt")},
+	}}
+	s3mig := &s3migration{s3Client: m}
+
+	var out bytes.Buffer
+	summary, err := s3mig.compareObjects(s3mig.listedObjects(context.TODO(), "src"), s3mig.listedObjects(context.TODO(), "dst"),
+		DiffArgs{CompareETag: true, ChecksumAlgorithm: "SHA256"}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, &DiffSummary{Source: 3, Destination: 3, Different: 2}, summary)
+	assert.Equal(t, "Key,Reason,SourceSize,DestinationSize,SourceETag,DestinationETag\n"+
+		"crc.txt,checksum,10,10,a,a\n"+
+		"none.txt,checksum,10,10,a,a\n", out.String())
+}
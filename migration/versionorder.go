@@ -0,0 +1,131 @@
+package migration
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Last modified time of an object version, read for every manifest row like the copy settings
+type versionModified time.Time
+
+func (v versionModified) key() string {
+	return time.Time(v).UTC().Format(time.RFC3339Nano)
+}
+
+func (v versionModified) apply(*s3controltypes.S3CopyObjectOperation) {}
+
+func (s3obj *s3migration) headModified(ctx context.Context, bucket, key, versionID string) (copySetting, error) {
+	input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+	head, err := s3obj.s3Client.HeadObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read version last modified time: %w", err)
+	}
+	return versionModified(aws.ToTime(head.LastModified)), nil
+}
+
+// Whether two steps belong to the same wave, ie. run concurrently
+func sameWave(a, b *jobStep) bool {
+	return a.Kind == b.Kind && a.Pass == b.Pass
+}
+
+// Split the non-version jobs into passes so the destination version stacks keep the source's order.  A
+// batch job copies its objects in no particular order, so several non-current versions of a key copied
+// by one job can land in any order.  Pass n copies the nth oldest version of each key, sorted by their
+// last modified time, and runs once the previous pass completes.  The passes replace the non-version
+// jobs at the start of the plan, the version jobs then copy the current versions last.
+func (s3obj *s3migration) splitStepsByVersionOrder(ctx context.Context, steps []*jobStep, concurrency int) ([]*jobStep, error) {
+	var passes [][]*jobStep
+	rest := []*jobStep{}
+	for _, step := range steps {
+		if step.Kind != jobKindNonVersion {
+			rest = append(rest, step)
+			continue
+		}
+		rows, err := s3obj.readManifestRows(ctx, step.Input)
+		if err != nil {
+			return nil, err
+		}
+		modified, err := s3obj.readSettings(ctx, rows, concurrency, s3obj.headModified)
+		if err != nil {
+			return nil, err
+		}
+		rowPass, n, err := versionPasses(rows, modified)
+		if err != nil {
+			return nil, err
+		}
+		groups := make([][][]string, n)
+		for i, row := range rows {
+			groups[rowPass[i]] = append(groups[rowPass[i]], row)
+		}
+
+		manifestArn := *step.Input.Manifest.Location.ObjectArn
+		bucket, manifestKey, err := ParseObjectArn(manifestArn)
+		if err != nil {
+			return nil, err
+		}
+		for p, group := range groups {
+			key := fmt.Sprintf("%s-pass-%03d.csv", strings.TrimSuffix(manifestKey, ".csv"), p+1)
+			obj, uerr := s3obj.uploadRows(ctx, bucket, key, group)
+			if uerr != nil {
+				return nil, uerr
+			}
+			input, cerr := cloneJobInput(step.Input)
+			if cerr != nil {
+				return nil, cerr
+			}
+			input.ClientRequestToken = aws.String(uuid.NewString())
+			input.Manifest.Location.ObjectArn = objectArnLike(manifestArn, bucket, key)
+			input.Manifest.Location.ETag = obj.ETag
+			if p == len(passes) {
+				passes = append(passes, nil)
+			}
+			passes[p] = append(passes[p], &jobStep{Kind: step.Kind, Input: input, Pass: p + 1})
+			zap.L().Info("Planned version ordering pass",
+				zap.Int("pass", p+1),
+				zap.String("manifest", key),
+				zap.Int("rows", len(group)),
+			)
+		}
+	}
+	ordered := []*jobStep{}
+	for _, pass := range passes {
+		ordered = append(ordered, pass...)
+	}
+	return append(ordered, rest...), nil
+}
+
+// Pass of each row, 0 for the oldest version of its key, and the number of passes
+func versionPasses(rows [][]string, modified []copySetting) ([]int, int, error) {
+	byKey := map[string][]int{}
+	for i, row := range rows {
+		if len(row) < 2 {
+			return nil, 0, fmt.Errorf("invalid manifest row %v", row)
+		}
+		byKey[row[1]] = append(byKey[row[1]], i)
+	}
+	rowPass := make([]int, len(rows))
+	passes := 0
+	for _, versions := range byKey {
+		slices.SortStableFunc(versions, func(a, b int) int {
+			return cmp.Compare(modified[a].key(), modified[b].key())
+		})
+		for p, i := range versions {
+			rowPass[i] = p
+		}
+		passes = max(passes, len(versions))
+	}
+	return rowPass, passes, nil
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// Serves the last modified time of each version
+type versionHeadMock struct {
+	*mock
+	modified map[string]time.Time
+}
+
+func (m *versionHeadMock) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if t, ok := m.modified[aws.ToString(params.VersionId)]; ok {
+		return &s3.HeadObjectOutput{LastModified: aws.Time(t)}, nil
+	}
+	return m.mock.HeadObject(ctx, params, optFns...)
+}
+
+func TestSplitStepsByVersionOrder(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := &versionHeadMock{
+		mock: &mock{objects: map[string]string{"noncurrent.csv": "src,a,a3\nsrc,a,a1\nsrc,b,b1\nsrc,a,a2\n"}},
+		modified: map[string]time.Time{
+			"a1": day, "a2": day.Add(time.Hour), "a3": day.Add(2 * time.Hour), "b1": day.Add(time.Minute),
+		},
+	}
+	s3mig := &s3migration{s3Client: m}
+	noncurrent := NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/noncurrent.csv")})
+	latest := NewCreateJobInput(&batchJobArgs{TargetBucketName: aws.String("dst"), ManifestArn: aws.String("arn:aws:s3:::src/latest.csv")})
+	steps := []*jobStep{{Kind: jobKindNonVersion, Input: noncurrent}, {Kind: jobKindVersion, Input: latest}}
+
+	split, err := s3mig.splitStepsByVersionOrder(context.TODO(), steps, 2)
+	assert.NoError(t, err)
+	assert.Len(t, split, 4)
+	for i, manifest := range []string{"noncurrent-pass-001.csv", "noncurrent-pass-002.csv", "noncurrent-pass-003.csv"} {
+		assert.Equal(t, "arn:aws:s3:::src/"+manifest, *split[i].Input.Manifest.Location.ObjectArn)
+		assert.Equal(t, i+1, split[i].Pass)
+	}
+	// Oldest version of each key first
+	assert.Equal(t, "src,a,a1\nsrc,b,b1\n", m.objects["noncurrent-pass-001.csv"])
+	assert.Equal(t, "src,a,a2\n", m.objects["noncurrent-pass-002.csv"])
+	assert.Equal(t, "src,a,a3\n", m.objects["noncurrent-pass-003.csv"])
+	assert.Same(t, steps[1], split[3])
+
+	// Each pass is a wave of its own, before the current versions
+	assert.False(t, sameWave(split[0], split[1]))
+	assert.False(t, sameWave(split[2], split[3]))
+}
@@ -0,0 +1,37 @@
+package migration
+
+import (
+	"context"
+	"s3migration/util"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"go.uber.org/zap"
+)
+
+// Kind of a batch job the tool didn't plan, eg. one created by run --no-wait on another runner or by hand
+const jobKindExternal = "external"
+
+// Watch existing batch jobs to a terminal status and evaluate the success threshold across them, reporting
+// as run does.  The jobs are watched concurrently, and nothing else of a run's plan applies to them.
+func Wait(args MigrationArgs, jobIDs []string) error {
+	defer util.ZapLogSync()
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(args.SourceRegion))
+	if err != nil {
+		zap.L().Fatal(
+			"Failed to load AWS client config",
+			zap.String("region", args.SourceRegion),
+			zap.Error(err),
+		)
+	}
+	return newS3Migration(cfg, args).waitJobs(ctx, args, jobIDs)
+}
+
+func (s3obj *s3migration) waitJobs(ctx context.Context, args MigrationArgs, jobIDs []string) error {
+	st := &runState{Args: args}
+	for _, id := range jobIDs {
+		st.Steps = append(st.Steps, &jobStep{Kind: jobKindExternal, JobID: id})
+	}
+	return s3obj.executeJobs(ctx, st)
+}
@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	s3controltypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitJobs(t *testing.T) {
+	args := MigrationArgs{AccountID: "111122223333", ReqSuccessThreshold: 0.8, PollInterval: time.Millisecond}
+	ctr := &ctrMock{status: s3controltypes.JobStatusComplete}
+	s3mig := &s3migration{s3Client: new(mock), s3CtrClient: ctr, pollInterval: args.PollInterval, report: newReport(args)}
+	assert.NoError(t, s3mig.waitJobs(context.TODO(), args, []string{"a", "b"}))
+	assert.Len(t, s3mig.report.Jobs, 2)
+	assert.True(t, s3mig.report.ThresholdMet)
+
+	args.ReqSuccessThreshold = 1.1
+	s3mig = &s3migration{s3Client: new(mock), s3CtrClient: ctr, pollInterval: args.PollInterval, report: newReport(args)}
+	assert.ErrorIs(t, s3mig.waitJobs(context.TODO(), args, []string{"a"}), ErrThresholdNotMet)
+}
+
+func TestWaitJobsSuccessThreshold(t *testing.T) {
+	// The first job copied nothing, so the jobs copied half the objects between them
+	ctr := &ctrMock{status: s3controltypes.JobStatusComplete, succeeded: map[string]int64{"a": 0}}
+	testCases := []struct {
+		threshold float32
+		maxFailed int64
+		met       bool
+	}{
+		{threshold: 0.5, met: true},
+		{threshold: 0.8, met: false},
+		{threshold: 1, met: false},
+		{threshold: 0.5, maxFailed: 9, met: false},
+		{threshold: 0.5, maxFailed: 10, met: true},
+	}
+	for _, tc := range testCases {
+		args := MigrationArgs{AccountID: "111122223333", ReqSuccessThreshold: tc.threshold, MaxFailedObjects: tc.maxFailed, PollInterval: time.Millisecond}
+		s3mig := &s3migration{s3Client: new(mock), s3CtrClient: ctr, pollInterval: args.PollInterval, report: newReport(args)}
+		err := s3mig.waitJobs(context.TODO(), args, []string{"a", "b"})
+		if tc.met {
+			assert.NoError(t, err, "threshold %v, max failed %v", tc.threshold, tc.maxFailed)
+		} else {
+			assert.Error(t, err, "threshold %v, max failed %v", tc.threshold, tc.maxFailed)
+		}
+		assert.Equal(t, float32(0.5), s3mig.report.SuccessRatio)
+		assert.Equal(t, tc.met, s3mig.report.ThresholdMet)
+	}
+}
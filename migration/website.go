@@ -0,0 +1,56 @@
+package migration
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"go.uber.org/zap"
+)
+
+func (s3obj *s3migration) copyCORS(ctx context.Context, source, destination string) (string, error) {
+	cors, err := s3obj.s3Client.GetBucketCors(ctx, &s3.GetBucketCorsInput{Bucket: aws.String(source)})
+	if isAPIErrorCode(err, "NoSuchCORSConfiguration") {
+		return settingAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(cors.CORSRules) == 0 {
+		return settingAbsent, nil
+	}
+	if _, err := s3obj.s3Client.PutBucketCors(ctx, &s3.PutBucketCorsInput{
+		Bucket:            aws.String(destination),
+		CORSConfiguration: &s3types.CORSConfiguration{CORSRules: cors.CORSRules},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied CORS rules to destination bucket", zap.String("bucket", destination), zap.Int("rules", len(cors.CORSRules)))
+	return settingCopied, nil
+}
+
+// The index and error documents, redirects and routing rules are copied as they are, the destination is only
+// served once the public access block and bucket policy allow it too
+func (s3obj *s3migration) copyWebsite(ctx context.Context, source, destination string) (string, error) {
+	website, err := s3obj.s3Client.GetBucketWebsite(ctx, &s3.GetBucketWebsiteInput{Bucket: aws.String(source)})
+	if isAPIErrorCode(err, "NoSuchWebsiteConfiguration") {
+		return settingAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := s3obj.s3Client.PutBucketWebsite(ctx, &s3.PutBucketWebsiteInput{
+		Bucket: aws.String(destination),
+		WebsiteConfiguration: &s3types.WebsiteConfiguration{
+			IndexDocument:         website.IndexDocument,
+			ErrorDocument:         website.ErrorDocument,
+			RedirectAllRequestsTo: website.RedirectAllRequestsTo,
+			RoutingRules:          website.RoutingRules,
+		},
+	}); err != nil {
+		return "", err
+	}
+	zap.L().Info("Copied website configuration to destination bucket", zap.String("bucket", destination))
+	return settingCopied, nil
+}
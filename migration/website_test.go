@@ -0,0 +1,39 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyCORSAndWebsite(t *testing.T) {
+	rules := []s3types.CORSRule{{AllowedMethods: []string{"GET"}, AllowedOrigins: []string{"https://example.com"}, MaxAgeSeconds: aws.Int32(3000)}}
+	website := &s3types.WebsiteConfiguration{
+		IndexDocument: &s3types.IndexDocument{Suffix: aws.String("index.html")},
+		ErrorDocument: &s3types.ErrorDocument{Key: aws.String("error.html")},
+		RoutingRules: []s3types.RoutingRule{{
+			Condition: &s3types.Condition{KeyPrefixEquals: aws.String("docs/")},
+			Redirect:  &s3types.Redirect{ReplaceKeyPrefixWith: aws.String("documents/")},
+		}},
+	}
+	m := &mock{corsRules: rules, website: website}
+	s3mig := &s3migration{s3Client: m}
+
+	summary, err := s3mig.migrateBucketConfig(context.TODO(), BucketConfigArgs{SourceBucket: "src", DestinationBucket: "dst",
+		Configs: []string{BucketConfigCORS, BucketConfigWebsite}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigCORS, BucketConfigWebsite}, summary.Copied)
+	assert.Equal(t, []string{"PutBucketCors dst", "PutBucketWebsite dst"}, m.bucketCalls)
+	assert.Equal(t, rules, m.corsRules)
+	assert.Equal(t, website, m.website)
+
+	// Nothing to copy without them
+	m.corsRules, m.website = nil, nil
+	summary, err = s3mig.migrateBucketConfig(context.TODO(), BucketConfigArgs{SourceBucket: "src", DestinationBucket: "dst",
+		Configs: []string{BucketConfigCORS, BucketConfigWebsite}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BucketConfigCORS, BucketConfigWebsite}, summary.Absent)
+}
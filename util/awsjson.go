@@ -0,0 +1,221 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// SigV4 signed JSON client for the AWS APIs this project has no SDK service module for, IAM Access Analyzer
+// and SQS.  Requests go through an SDK middleware stack built from the config like an SDK client's, so they
+// are retried with the config's retryer and the config's APIOptions, eg. a RateLimiter, apply to them.
+type AWSJSONClient struct {
+	Config         aws.Config
+	Service        string            // Signing name, eg. access-analyzer
+	EndpointPrefix string            // eg. access-analyzer for https://access-analyzer.us-east-1.amazonaws.com
+	Headers        map[string]string // Extra headers sent with every request, eg. Content-Type
+}
+
+// Create a client for the given signing name, using the regional endpoint <endpointPrefix>.<region>.<partition domain>,
+// or the config's BaseEndpoint when it is set
+func NewAWSJSONClient(cfg aws.Config, service, endpointPrefix string) *AWSJSONClient {
+	return &AWSJSONClient{
+		Config:         cfg,
+		Service:        service,
+		EndpointPrefix: endpointPrefix,
+		Headers:        map[string]string{"Content-Type": "application/json"},
+	}
+}
+
+// Send in as a JSON body to path, signing the request, and decode the JSON response into out (if not nil)
+func (c *AWSJSONClient) Do(ctx context.Context, method, path string, headers map[string]string, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	respBody, err := c.send(ctx, method, path, headers, body)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (c *AWSJSONClient) endpoint(ctx context.Context) string {
+	if c.Config.BaseEndpoint != nil {
+		return strings.TrimSuffix(*c.Config.BaseEndpoint, "/")
+	}
+	prefix := c.EndpointPrefix
+	if useFIPSEndpoint(ctx, c.Config) {
+		prefix += "-fips"
+	}
+	return fmt.Sprintf("https://%s.%s.%s", prefix, c.Config.Region, DNSSuffix(c.Config.Region))
+}
+
+// Whether the config's sources, eg. AWS_USE_FIPS_ENDPOINT, ask for FIPS endpoints
+func useFIPSEndpoint(ctx context.Context, cfg aws.Config) bool {
+	for _, source := range cfg.ConfigSources {
+		if s, ok := source.(interface {
+			GetUseFIPSEndpoint(context.Context) (aws.FIPSEndpointState, bool, error)
+		}); ok {
+			if state, found, err := s.GetUseFIPSEndpoint(ctx); err == nil && found {
+				return state == aws.FIPSEndpointStateEnabled
+			}
+		}
+	}
+	return false
+}
+
+// Retryer of the config, as an SDK client resolves it
+func (c *AWSJSONClient) retryer() aws.Retryer {
+	var r aws.Retryer
+	switch {
+	case c.Config.RetryMode == aws.RetryModeAdaptive:
+		r = retry.NewAdaptiveMode()
+	case c.Config.Retryer != nil:
+		r = c.Config.Retryer()
+	default:
+		r = retry.NewStandard()
+	}
+	if c.Config.RetryMaxAttempts > 0 {
+		r = retry.AddWithMaxAttempts(r, c.Config.RetryMaxAttempts)
+	}
+	return r
+}
+
+func (c *AWSJSONClient) send(ctx context.Context, method, path string, headers map[string]string, body []byte) ([]byte, error) {
+	endpoint, err := url.Parse(c.endpoint(ctx) + path)
+	if err != nil {
+		return nil, err
+	}
+	stack := middleware.NewStack(c.Service, smithyhttp.NewStackRequest)
+	err = stack.Serialize.Add(middleware.SerializeMiddlewareFunc("OperationSerializer",
+		func(ctx context.Context, in middleware.SerializeInput, next middleware.SerializeHandler) (middleware.SerializeOutput, middleware.Metadata, error) {
+			req := in.Request.(*smithyhttp.Request)
+			req.Method = method
+			req.URL = endpoint
+			for k, v := range c.Headers {
+				req.Header.Set(k, v)
+			}
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			var serr error
+			if in.Request, serr = req.SetStream(bytes.NewReader(body)); serr != nil {
+				return middleware.SerializeOutput{}, middleware.Metadata{}, serr
+			}
+			return next.HandleSerialize(ctx, in)
+		}), middleware.After)
+	if err != nil {
+		return nil, err
+	}
+	if err = smithyhttp.AddComputeContentLengthMiddleware(stack); err != nil {
+		return nil, err
+	}
+	err = stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("Signing",
+		func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			req := in.Request.(*smithyhttp.Request)
+			creds, cerr := c.Config.Credentials.Retrieve(ctx)
+			if cerr != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, cerr
+			}
+			hash := sha256.Sum256(body)
+			if serr := v4.NewSigner().SignHTTP(ctx, creds, req.Request, hex.EncodeToString(hash[:]), c.Service, c.Config.Region, time.Now()); serr != nil {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, serr
+			}
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)
+	if err != nil {
+		return nil, err
+	}
+	if err = retry.AddRetryMiddlewares(stack, retry.AddRetryMiddlewaresOptions{Retryer: c.retryer()}); err != nil {
+		return nil, err
+	}
+	err = stack.Deserialize.Add(middleware.DeserializeMiddlewareFunc("OperationDeserializer",
+		func(ctx context.Context, in middleware.DeserializeInput, next middleware.DeserializeHandler) (middleware.DeserializeOutput, middleware.Metadata, error) {
+			out, metadata, derr := next.HandleDeserialize(ctx, in)
+			if derr != nil {
+				return out, metadata, derr
+			}
+			resp := out.RawResponse.(*smithyhttp.Response)
+			defer resp.Body.Close()
+			respBody, derr := io.ReadAll(resp.Body)
+			if derr != nil {
+				return out, metadata, derr
+			}
+			if resp.StatusCode >= 300 {
+				return out, metadata, &awshttp.ResponseError{
+					ResponseError: &smithyhttp.ResponseError{Response: resp, Err: responseAPIError(resp, respBody)},
+					RequestID:     resp.Header.Get("X-Amzn-Requestid"),
+				}
+			}
+			out.Result = respBody
+			return out, metadata, nil
+		}), middleware.After)
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range c.Config.APIOptions {
+		if err = fn(stack); err != nil {
+			return nil, err
+		}
+	}
+
+	var client smithyhttp.ClientDo = awshttp.NewBuildableClient()
+	if c.Config.HTTPClient != nil {
+		client = c.Config.HTTPClient
+	}
+	result, _, err := middleware.DecorateHandler(smithyhttp.NewClientHandler(client), stack).Handle(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s%s failed: %w", method, c.Service, path, err)
+	}
+	return result.([]byte), nil
+}
+
+// Error of a JSON protocol error response, with the code in its X-Amzn-ErrorType header or __type field,
+// eg. com.amazonaws.sqs#QueueDoesNotExist, so the retryer recognizes throttling
+func responseAPIError(resp *smithyhttp.Response, body []byte) error {
+	var fields struct {
+		Type    string `json:"__type"`
+		Code    string `json:"code"`
+		Message string `json:"message"` // Or Message, which json matches too
+	}
+	_ = json.Unmarshal(body, &fields)
+	code := resp.Header.Get("X-Amzn-Errortype")
+	for _, c := range []string{fields.Type, fields.Code} {
+		if code == "" {
+			code = c
+		}
+	}
+	if i := strings.Index(code, ":"); i >= 0 {
+		code = code[:i]
+	}
+	if i := strings.LastIndex(code, "#"); i >= 0 {
+		code = code[i+1:]
+	}
+	message := fields.Message
+	if message == "" {
+		message = string(body)
+	}
+	return &smithy.GenericAPIError{Code: code, Message: fmt.Sprintf("status %d: %s", resp.StatusCode, message)}
+}
@@ -0,0 +1,45 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 4, 15, 10, 30, 20, 0, time.UTC) // A Monday
+	testCases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: "* * * * *", expected: time.Date(2024, 4, 15, 10, 31, 0, 0, time.UTC)},
+		{expr: "0 2 * * *", expected: time.Date(2024, 4, 16, 2, 0, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", expected: time.Date(2024, 4, 15, 10, 45, 0, 0, time.UTC)},
+		{expr: "30 10 * * *", expected: time.Date(2024, 4, 16, 10, 30, 0, 0, time.UTC)},
+		{expr: "0 9-17/4 * * 1-5", expected: time.Date(2024, 4, 15, 13, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 0", expected: time.Date(2024, 4, 21, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", expected: time.Date(2024, 4, 21, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1,15 * *", expected: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", expected: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either restricted day field matches
+		{expr: "0 0 20 * 3", expected: time.Date(2024, 4, 17, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", expected: time.Time{}},
+	}
+	for _, tc := range testCases {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) error = %v", tc.expr, err)
+			continue
+		}
+		if got := c.Next(from); !got.Equal(tc.expected) {
+			t.Errorf("ParseCron(%q).Next() = %v, expected %v", tc.expr, got, tc.expected)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Exit codes of the commands, so scripts and schedulers can tell why a migration stopped
+const (
+	ExitCompleted         = 0
+	ExitFailed            = 1 // Any failure without a code of its own
+	ExitThresholdNotMet   = 2
+	ExitStopped           = 3 // Stopped by a signal while the batch jobs were running, which keep running
+	ExitInvalidArgs       = 4
+	ExitInventoryTimeout  = 5 // No inventory manifest was delivered within the maximum wait
+	ExitJobCreationFailed = 6
+	ExitPartialSuccess    = 7 // The threshold was met but some tasks failed
+)
+
+const exitCodeKey = "exitCode"
+
+// Field of a Fatal log entry setting the code the process exits with, rather than ExitFailed
+func ExitCode(code int) zap.Field {
+	return zap.Int(exitCodeKey, code)
+}
+
+// Exits after a Fatal entry is written, with the code of its ExitCode field
+type exitCodeHook struct{}
+
+func (exitCodeHook) OnWrite(_ *zapcore.CheckedEntry, fields []zapcore.Field) {
+	code := ExitFailed
+	for _, f := range fields {
+		if f.Key == exitCodeKey && f.Type == zapcore.Int64Type {
+			code = int(f.Integer)
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Heartbeat tracks the last time a long running loop made progress.  It backs the
+// /healthz endpoint and the optional liveness file used by container schedulers.
+// A nil Heartbeat is valid and does nothing.
+type Heartbeat struct {
+	mu           sync.Mutex
+	last         time.Time
+	staleAfter   time.Duration
+	livenessFile string
+}
+
+func NewHeartbeat(staleAfter time.Duration, livenessFile string) *Heartbeat {
+	return &Heartbeat{
+		last:         time.Now(),
+		staleAfter:   staleAfter,
+		livenessFile: livenessFile,
+	}
+}
+
+// Record loop progress and touch the liveness file if one is configured
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	now := time.Now()
+	h.mu.Lock()
+	h.last = now
+	h.mu.Unlock()
+
+	if h.livenessFile == "" {
+		return
+	}
+	if err := os.Chtimes(h.livenessFile, now, now); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			zap.L().Warn("Unable to touch liveness file", zap.String("file", h.livenessFile), zap.Error(err))
+			return
+		}
+		f, ferr := os.Create(h.livenessFile)
+		if ferr != nil {
+			zap.L().Warn("Unable to create liveness file", zap.String("file", h.livenessFile), zap.Error(ferr))
+			return
+		}
+		f.Close()
+	}
+}
+
+// Healthy is false once no beat has been recorded within the stale threshold
+func (h *Heartbeat) Healthy() (bool, time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.staleAfter <= 0 || time.Since(h.last) <= h.staleAfter, h.last
+}
+
+func (h *Heartbeat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	healthy, last := h.Healthy()
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintf(w, `{"healthy":%t,"lastBeat":"%s"}`, healthy, last.UTC().Format(time.RFC3339))
+}
+
+// Serve /healthz, and /metrics from DefaultMetrics, on the given address in the background
+func (h *Heartbeat) ListenAndServe(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", h)
+	mux.Handle("/metrics", DefaultMetrics)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			zap.L().Error("Health endpoint stopped", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+	zap.L().Info("Serving health endpoint", zap.String("addr", addr), zap.Strings("paths", []string{"/healthz", "/metrics"}))
+}
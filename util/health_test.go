@@ -0,0 +1,37 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	livenessFile := filepath.Join(t.TempDir(), "alive")
+	hb := NewHeartbeat(time.Hour, livenessFile)
+	hb.Beat()
+	if _, err := os.Stat(livenessFile); err != nil {
+		t.Errorf("liveness file not created: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	hb.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	stale := NewHeartbeat(time.Nanosecond, "")
+	time.Sleep(time.Millisecond)
+	rec = httptest.NewRecorder()
+	stale.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// A nil heartbeat must be safe to use
+	var none *Heartbeat
+	none.Beat()
+}
@@ -3,6 +3,9 @@ package util
 import (
 	"fmt"
 	"io"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,9 +18,34 @@ import (
 	"go.uber.org/zap"
 )
 
-// Convert given string to S3 ARN
-func GetArn(s string) *string {
-	return aws.String(fmt.Sprintf("arn:aws:s3:::%s", s))
+// Convert given string to S3 ARN in the partition of the region, eg. arn:aws-cn:s3::: for cn-north-1
+func GetArn(region, s string) *string {
+	return aws.String(fmt.Sprintf("arn:%s:s3:::%s", Partition(region), s))
+}
+
+// Reports whether the destination is a Multi-Region Access Point, given by its ARN or alias
+func IsMultiRegionAccessPoint(destination string) bool {
+	return strings.HasPrefix(destination, "arn:") && strings.Contains(destination, ":accesspoint/") ||
+		strings.HasSuffix(destination, ".mrap")
+}
+
+// Reports whether the bucket is an S3 Express One Zone directory bucket, named <base>--<az-id>--x-s3
+func IsDirectoryBucket(bucket string) bool {
+	return strings.HasSuffix(bucket, "--x-s3")
+}
+
+// ARN of the batch copy destination: a bucket, a directory bucket in the region of the account, or a
+// Multi-Region Access Point given by its ARN or by its alias, which is qualified with the account owning it
+func GetTargetArn(destination, region, accountID string) *string {
+	switch {
+	case strings.HasPrefix(destination, "arn:"):
+		return aws.String(destination)
+	case strings.HasSuffix(destination, ".mrap"):
+		return aws.String(fmt.Sprintf("arn:%s:s3::%s:accesspoint/%s", Partition(region), accountID, destination))
+	case IsDirectoryBucket(destination):
+		return aws.String(fmt.Sprintf("arn:%s:s3express:%s:%s:bucket/%s", Partition(region), region, accountID, destination))
+	}
+	return GetArn(region, destination)
 }
 
 // An S3 Batch job with a terminal status is one in which there will be no further updates
@@ -92,8 +120,8 @@ func (r *S3SelectReader) Read(b []byte) (n int, err error) {
 func GetJobSuccessThreshold(jobs ...*s3control.DescribeJobOutput) float32 {
 	var (
 		totalSuccessThreshold float32
-		jobSuccessThreshold   int32
-		totalNumberOfTasks    int32
+		jobSuccessThreshold   int64
+		totalNumberOfTasks    int64
 	)
 	for _, job := range jobs {
 		if job == nil {
@@ -106,21 +134,26 @@ func GetJobSuccessThreshold(jobs ...*s3control.DescribeJobOutput) float32 {
 			)
 			continue
 		}
-		jobSuccessThreshold = +int32(*job.Job.ProgressSummary.NumberOfTasksSucceeded)
-		totalNumberOfTasks = +int32(*job.Job.ProgressSummary.TotalNumberOfTasks)
+		jobSuccessThreshold += *job.Job.ProgressSummary.NumberOfTasksSucceeded
+		totalNumberOfTasks += *job.Job.ProgressSummary.TotalNumberOfTasks
 	}
 	if totalNumberOfTasks > 0 {
-		totalSuccessThreshold = float32(jobSuccessThreshold) / float32(totalNumberOfTasks)
+		totalSuccessThreshold = float32(float64(jobSuccessThreshold) / float64(totalNumberOfTasks))
 	}
 
 	return totalSuccessThreshold
 }
 
 const (
-	LastUpdatedColumn = "LastUpdated"
-	IsLatestColumn    = "IsLatest"
-	IsLatestYes       = "Yes"
-	IsLatestNo        = "No"
+	LastUpdatedColumn    = "LastUpdated"
+	LastModifiedColumn   = "LastModifiedDate"
+	IsLatestColumn       = "IsLatest"
+	IsDeleteMarkerColumn = "IsDeleteMarker"
+	SizeColumn           = "Size"
+	EncryptionColumn     = "EncryptionStatus"
+	ReplicationColumn    = "ReplicationStatus"
+	IsLatestYes          = "Yes"
+	IsLatestNo           = "No"
 )
 
 func GetQueryExpression(fileSchema string, startDt, endDt time.Time, latestOnly string, versioningDisabled bool) (string, error) {
@@ -135,7 +168,97 @@ func GetQueryExpression(fileSchema string, startDt, endDt time.Time, latestOnly
 	if err != nil {
 		return "", err
 	}
+	// Delete markers can't be copied, so tasks for them would only fail
+	if col, ok := fileSchemaMap[IsDeleteMarkerColumn]; ok {
+		sql = sql.Where(fmt.Sprintf("%s = 'false'", col))
+	}
+	return filterQuery(sql, fileSchema, fileSchemaMap, startDt, endDt, latestOnly)
+}
+
+// Build an S3 Select expression counting the rows GetQueryExpression selects with the same filters, and
+// summing their sizes when the inventory has a Size column
+func GetScopeQueryExpression(fileSchema string, startDt, endDt time.Time, latestOnly string, versioningDisabled bool) (string, error) {
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	columns := []string{"COUNT(*)"}
+	if col, ok := fileSchemaMap[SizeColumn]; ok {
+		columns = append(columns, fmt.Sprintf("SUM(CAST(%s AS INT))", col))
+	}
+	sql := sq.Select(columns...).From("s3object s")
+	if versioningDisabled {
+		query, _, err := sql.ToSql()
+		return query, err
+	}
+	if col, ok := fileSchemaMap[IsDeleteMarkerColumn]; ok {
+		sql = sql.Where(fmt.Sprintf("%s = 'false'", col))
+	}
+	return filterQuery(sql, fileSchema, fileSchemaMap, startDt, endDt, latestOnly)
+}
+
+// Build an S3 Select expression returning the Key, VersionId, IsLatest and IsDeleteMarker columns of every
+// row, used to analyze the version stacks of a bucket with many delete markers
+func GetVersionStackQueryExpression(fileSchema string) (string, error) {
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	columns := []string{}
+	for _, field := range []string{"Key", "VersionId", IsLatestColumn, IsDeleteMarkerColumn} {
+		col, ok := fileSchemaMap[field]
+		if !ok {
+			return "", fmt.Errorf("file schema does not contain field '%s', Provided file schema: '%s'", field, fileSchema)
+		}
+		columns = append(columns, col)
+	}
+	query, _, err := sq.Select(columns...).From("s3object s").ToSql()
+	return query, err
+}
 
+// Build an S3 Select expression returning the given inventory fields, by name, in order.  Used to produce
+// an S3 Batch Operations CSV manifest (eg. Bucket, Key, VersionId) whatever the inventory column order.
+// Delete markers are excluded as they can't be copied.
+func GetBatchQueryExpression(fileSchema string, fields []string, startDt, endDt time.Time, latestOnly string) (string, error) {
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	columns := []string{}
+	for _, field := range fields {
+		col, ok := fileSchemaMap[field]
+		if !ok {
+			return "", fmt.Errorf("file schema does not contain field '%s', Provided file schema: '%s'", field, fileSchema)
+		}
+		columns = append(columns, col)
+	}
+	sql := sq.Select(columns...).From("s3object s")
+	if col, ok := fileSchemaMap[IsDeleteMarkerColumn]; ok {
+		sql = sql.Where(fmt.Sprintf("%s = 'false'", col))
+	}
+	return filterQuery(sql, fileSchema, fileSchemaMap, startDt, endDt, latestOnly)
+}
+
+// Build an S3 Select expression returning the key of every object whose latest version is a delete marker
+func GetDeleteMarkerQueryExpression(fileSchema string, startDt, endDt time.Time) (string, error) {
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	keyCol, ok := fileSchemaMap["Key"]
+	if !ok {
+		return "", fmt.Errorf("file schema does not contain field 'Key', Provided file schema: '%s'", fileSchema)
+	}
+	markerCol, ok := fileSchemaMap[IsDeleteMarkerColumn]
+	if !ok {
+		return "", fmt.Errorf("file schema does not contain field '%s', Provided file schema: '%s'", IsDeleteMarkerColumn, fileSchema)
+	}
+	sql := sq.Select(keyCol).From("s3object s").Where(fmt.Sprintf("%s = 'true'", markerCol))
+	return filterQuery(sql, fileSchema, fileSchemaMap, startDt, endDt, IsLatestYes)
+}
+
+// Add the latest version and date filters to the query
+func filterQuery(sql sq.SelectBuilder, fileSchema string, fileSchemaMap map[string]string, startDt, endDt time.Time, latestOnly string) (string, error) {
 	getColumnName := func(colName string) (string, error) {
 		col, ok := fileSchemaMap[colName]
 		if !ok {
@@ -144,8 +267,9 @@ func GetQueryExpression(fileSchema string, startDt, endDt time.Time, latestOnly
 		return col, nil
 	}
 
+	// Inventory dates are UTC
 	toISO := func(t time.Time) string {
-		return t.Format("2006-01-02T15:04:05")
+		return t.UTC().Format("2006-01-02T15:04:05")
 	}
 
 	if len(strings.TrimSpace(latestOnly)) > 0 {
@@ -190,6 +314,162 @@ func GetQueryExpression(fileSchema string, startDt, endDt time.Time, latestOnly
 	return query, err
 }
 
+// Keywords a --filter-sql clause may use, every other identifier names an inventory field
+var sqlFilterKeywords = []string{"AND", "OR", "NOT", "BETWEEN", "IN", "LIKE", "IS", "NULL", "CAST", "AS", "INT", "INTEGER"}
+
+// Combine a user supplied WHERE clause with an S3 Select expression built from the same file schema.  The
+// clause names inventory fields, eg. "Size > 0 AND StorageClass <> 'GLACIER'", which are mapped to their
+// s._N columns, and is rejected unless it only uses the SQL subset the local evaluator also supports.
+func AddSQLFilter(expression, fileSchema, clause string) (string, error) {
+	if strings.TrimSpace(clause) == "" {
+		return expression, nil
+	}
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	columns := map[string]string{}
+	for field, col := range fileSchemaMap {
+		columns[strings.ToUpper(field)] = col
+	}
+	p := &selectParser{}
+	if err := p.tokenize(clause); err != nil {
+		return "", err
+	}
+	parts, depth := []string{}, 0
+	for _, t := range p.tokens {
+		switch t.kind {
+		case '(':
+			depth++
+		case ')':
+			// Closing the parentheses the clause is wrapped in would escape the other filters
+			if depth--; depth < 0 {
+				return "", fmt.Errorf("invalid SQL filter '%s': unbalanced parentheses", clause)
+			}
+		}
+		switch {
+		case t.kind == 's':
+			parts = append(parts, "'"+strings.ReplaceAll(t.text, "'", "''")+"'")
+		case t.kind != 'i', slices.Contains(sqlFilterKeywords, t.upper):
+			parts = append(parts, t.text)
+		case strings.HasPrefix(t.upper, "S._"):
+			parts = append(parts, t.text)
+		default:
+			col, ok := columns[strings.TrimPrefix(t.upper, "S.")]
+			if !ok {
+				return "", fmt.Errorf("file schema does not contain field '%s', Provided file schema: '%s'", t.text, fileSchema)
+			}
+			parts = append(parts, col)
+		}
+	}
+	where := "(" + strings.Join(parts, " ") + ")"
+	if _, err := ParseLocalSelect("SELECT s._1 FROM s3object s WHERE " + where); err != nil {
+		return "", fmt.Errorf("invalid SQL filter '%s': %w", clause, err)
+	}
+	return andWhere(expression, where), nil
+}
+
+// Reports whether an object's last modified time passes the user date filters, using the
+// same semantics as the S3 Select expression built by GetQueryExpression
+func MatchesDateFilter(lastModified, startDt, endDt time.Time) bool {
+	switch {
+	case !startDt.IsZero() && !endDt.IsZero():
+		return !lastModified.Before(startDt) && !lastModified.After(endDt)
+	case !startDt.IsZero():
+		return lastModified.Before(startDt)
+	case !endDt.IsZero():
+		return lastModified.After(endDt)
+	}
+	return true
+}
+
+// Last modified time range of --modified-after and --modified-before.  After is inclusive and Before is
+// exclusive, so consecutive ranges sharing a bound select every object exactly once.  Zero bounds are open.
+type ModifiedRange struct {
+	After  time.Time
+	Before time.Time
+}
+
+func (r ModifiedRange) IsZero() bool {
+	return r.After.IsZero() && r.Before.IsZero()
+}
+
+// Reports whether an object last modified at t is in the range
+func (r ModifiedRange) Matches(t time.Time) bool {
+	return (r.After.IsZero() || !t.Before(r.After)) && (r.Before.IsZero() || t.Before(r.Before))
+}
+
+// Add the range to an S3 Select expression built from the same file schema, comparing the inventory's
+// LastModifiedDate, an ISO 8601 UTC timestamp such as 2024-01-31T23:59:59.000Z, as a string
+func AddModifiedFilter(expression, fileSchema string, r ModifiedRange) (string, error) {
+	if r.IsZero() {
+		return expression, nil
+	}
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	col, ok := fileSchemaMap[LastModifiedColumn]
+	if !ok {
+		return "", fmt.Errorf("file schema does not contain field '%s', Provided file schema: '%s'", LastModifiedColumn, fileSchema)
+	}
+	toISO := func(t time.Time) string {
+		return t.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+	conditions := []string{}
+	if !r.After.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s >= '%s'", col, toISO(r.After)))
+	}
+	if !r.Before.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("%s < '%s'", col, toISO(r.Before)))
+	}
+	return andWhere(expression, strings.Join(conditions, " AND ")), nil
+}
+
+// Restrict an S3 Select expression built from the same file schema to the rows whose field is one of the
+// values, or none of them with exclude set, eg. EncryptionStatus IN ('NOT-SSE')
+func AddFieldFilter(expression, fileSchema, field string, values []string, exclude bool) (string, error) {
+	if len(values) == 0 {
+		return expression, nil
+	}
+	fileSchemaMap, err := parseFileSchema(fileSchema)
+	if err != nil {
+		return "", err
+	}
+	col, ok := fileSchemaMap[field]
+	if !ok {
+		return "", fmt.Errorf("file schema does not contain field '%s', Provided file schema: '%s'", field, fileSchema)
+	}
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	op := "IN"
+	if exclude {
+		op = "NOT IN"
+	}
+	return andWhere(expression, fmt.Sprintf("%s %s (%s)", col, op, strings.Join(quoted, ", "))), nil
+}
+
+// Add a condition to the expression's WHERE clause, or start one
+func andWhere(expression, condition string) string {
+	if strings.Contains(expression, " WHERE ") {
+		return expression + " AND " + condition
+	}
+	return expression + " WHERE " + condition
+}
+
+// S3 Batch Operations CSV manifests require URL-encoded object keys.  Path escaping is used so that
+// spaces become %20, and "+" is escaped explicitly so it is never decoded as a space.
+func EncodeManifestKey(key string) string {
+	return strings.ReplaceAll(url.PathEscape(key), "+", "%2B")
+}
+
+// Decode an object key read from an inventory report or S3 Batch Operations CSV manifest
+func DecodeManifestKey(key string) (string, error) {
+	return url.QueryUnescape(key)
+}
+
 func parseFileSchema(fileSchema string) (map[string]string, error) {
 	fileSchemaMap := make(map[string]string)
 	if strings.LastIndex(fileSchema, ",") < 1 {
@@ -202,6 +482,18 @@ func parseFileSchema(fileSchema string) (map[string]string, error) {
 	return fileSchemaMap, nil
 }
 
+// Parse an age such as 7d or 36h.  Accepts Go durations plus a "d" (24 hour day) suffix.
+func ParseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age '%s'", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
 func ParseDateTime(tstr string) (time.Time, error) {
 	if len(strings.TrimSpace(tstr)) < 1 {
 		return time.Time{}, fmt.Errorf("found invalid input date time string")
@@ -209,6 +501,21 @@ func ParseDateTime(tstr string) (time.Time, error) {
 	return time.Parse(time.DateTime, tstr)
 }
 
+// Parse a date, or date and time, in loc unless it has an offset, eg. 2024-01-31, 2024-01-31 12:00:00 or
+// 2024-01-31T12:00:00+01:00
+func ParseDateTimeIn(tstr string, loc *time.Location) (time.Time, error) {
+	tstr = strings.TrimSpace(tstr)
+	if t, err := time.Parse(time.RFC3339, tstr); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateTime, "2006-01-02T15:04:05", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, tstr, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date time '%s', eg. 2024-01-31, 2024-01-31 12:00:00 or 2024-01-31T12:00:00Z", tstr)
+}
+
 func ZapLogSync() {
 	if err := zap.L().Sync(); err != nil {
 		fmt.Println(err)
@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3control"
 	s3ctrtypes "github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/aws/smithy-go"
 )
 
 func TestGetQueryExpression(t *testing.T) {
@@ -73,6 +74,312 @@ func TestGetQueryExpression(t *testing.T) {
 
 }
 
+func TestGetQueryExpressionExcludesDeleteMarkers(t *testing.T) {
+	testCases := []struct {
+		name               string
+		fileSchema         string
+		versioningDisabled bool
+		expected           string
+	}{
+		{
+			name:       "Versioned",
+			fileSchema: "Bucket, Key, VersionId, IsLatest, IsDeleteMarker",
+			expected:   "SELECT s._1, s._2 FROM s3object s WHERE s._5 = 'false'",
+		},
+		{
+			name:       "NoDeleteMarkerColumn",
+			fileSchema: "Bucket, Key, VersionId, IsLatest",
+			expected:   "SELECT s._1, s._2 FROM s3object s",
+		},
+		{
+			name:               "VersioningDisabled",
+			fileSchema:         "Bucket, Key, Size",
+			versioningDisabled: true,
+			expected:           "SELECT s._1, s._2 FROM s3object s",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := GetQueryExpression(tc.fileSchema, time.Time{}, time.Time{}, "", tc.versioningDisabled)
+			if err != nil {
+				t.Errorf("GetQueryExpression() error = %v", err)
+			}
+			if q != tc.expected {
+				t.Errorf("GetQueryExpression() = %q, expected %q", q, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetVersionStackQueryExpression(t *testing.T) {
+	q, err := GetVersionStackQueryExpression("Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size")
+	if err != nil || q != "SELECT s._2, s._3, s._4, s._5 FROM s3object s" {
+		t.Errorf("GetVersionStackQueryExpression() = %q, %v", q, err)
+	}
+	if _, err := GetVersionStackQueryExpression("Bucket, Key, Size"); err == nil {
+		t.Error("GetVersionStackQueryExpression() expected error for unversioned inventory")
+	}
+}
+
+func TestGetScopeQueryExpression(t *testing.T) {
+	testCases := []struct {
+		name               string
+		fileSchema         string
+		latestOnly         string
+		versioningDisabled bool
+		expected           string
+	}{
+		{
+			name:       "CountAndSize",
+			fileSchema: "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size",
+			latestOnly: IsLatestYes,
+			expected:   "SELECT COUNT(*), SUM(CAST(s._6 AS INT)) FROM s3object s WHERE s._5 = 'false' AND s._4 = 'true'",
+		},
+		{
+			name:               "VersioningDisabled",
+			fileSchema:         "Bucket, Key, Size",
+			versioningDisabled: true,
+			expected:           "SELECT COUNT(*), SUM(CAST(s._3 AS INT)) FROM s3object s",
+		},
+		{
+			name:               "NoSizeColumn",
+			fileSchema:         "Bucket, Key, LastModifiedDate",
+			versioningDisabled: true,
+			expected:           "SELECT COUNT(*) FROM s3object s",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := GetScopeQueryExpression(tc.fileSchema, time.Time{}, time.Time{}, tc.latestOnly, tc.versioningDisabled)
+			if err != nil {
+				t.Errorf("GetScopeQueryExpression() error = %v", err)
+			}
+			if q != tc.expected {
+				t.Errorf("GetScopeQueryExpression() = %q, expected %q", q, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetBatchQueryExpression(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fileSchema string
+		fields     []string
+		latestOnly string
+		expected   string
+		wantErr    bool
+	}{
+		{
+			name:       "ColumnsSelectedByName",
+			fileSchema: "Key, Bucket, VersionId, IsLatest, IsDeleteMarker",
+			fields:     []string{"Bucket", "Key", "VersionId"},
+			latestOnly: IsLatestNo,
+			expected:   "SELECT s._2, s._1, s._3 FROM s3object s WHERE s._5 = 'false' AND s._4 = 'false'",
+		},
+		{
+			name:       "NoDeleteMarkerColumn",
+			fileSchema: "Bucket, Key, Size",
+			fields:     []string{"Bucket", "Key"},
+			expected:   "SELECT s._1, s._2 FROM s3object s",
+		},
+		{
+			name:       "MissingField",
+			fileSchema: "Bucket, Key, Size",
+			fields:     []string{"Bucket", "Key", "VersionId"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := GetBatchQueryExpression(tc.fileSchema, tc.fields, time.Time{}, time.Time{}, tc.latestOnly)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("GetBatchQueryExpression() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if q != tc.expected {
+				t.Errorf("GetBatchQueryExpression() = %q, expected %q", q, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGetDeleteMarkerQueryExpression(t *testing.T) {
+	testCases := []struct {
+		name       string
+		fileSchema string
+		expected   string
+		wantErr    bool
+	}{
+		{
+			name:       "LatestDeleteMarkers",
+			fileSchema: "Bucket, Key, VersionId, IsLatest, IsDeleteMarker",
+			expected:   "SELECT s._2 FROM s3object s WHERE s._5 = 'true' AND s._4 = 'true'",
+		},
+		{
+			name:       "NoDeleteMarkerColumn",
+			fileSchema: "Bucket, Key, Size",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := GetDeleteMarkerQueryExpression(tc.fileSchema, time.Time{}, time.Time{})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("GetDeleteMarkerQueryExpression() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if q != tc.expected {
+				t.Errorf("GetDeleteMarkerQueryExpression() = %q, expected %q", q, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAddSQLFilter(t *testing.T) {
+	const schema = "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, StorageClass"
+	testCases := []struct {
+		name       string
+		expression string
+		clause     string
+		expected   string
+		wantErr    bool
+	}{
+		{
+			name:       "NoClause",
+			expression: "SELECT s._1, s._2 FROM s3object s",
+			expected:   "SELECT s._1, s._2 FROM s3object s",
+		},
+		{
+			name:       "NoWhere",
+			expression: "SELECT s._1, s._2 FROM s3object s",
+			clause:     "storageclass <> 'GLACIER'",
+			expected:   "SELECT s._1, s._2 FROM s3object s WHERE (s._7 <> 'GLACIER')",
+		},
+		{
+			name:       "CombinedWithFilters",
+			expression: "SELECT s._1, s._2 FROM s3object s WHERE s._5 = 'false'",
+			clause:     "CAST(s.Size AS INT) > 1024 OR Key LIKE 'it''s/%'",
+			expected:   "SELECT s._1, s._2 FROM s3object s WHERE s._5 = 'false' AND (CAST ( s._6 AS INT ) > 1024 OR s._2 LIKE 'it''s/%')",
+		},
+		{
+			name:       "UnknownField",
+			expression: "SELECT s._1, s._2 FROM s3object s",
+			clause:     "ETag = 'abc'",
+			wantErr:    true,
+		},
+		{
+			name:       "Unsupported",
+			expression: "SELECT s._1, s._2 FROM s3object s",
+			clause:     "Key = 'a') OR (Key = 'b'",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := AddSQLFilter(tc.expression, schema, tc.clause)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("AddSQLFilter() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if q != tc.expected {
+				t.Errorf("AddSQLFilter() = %q, expected %q", q, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAddModifiedFilter(t *testing.T) {
+	const schema = "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate"
+	paris, _ := time.LoadLocation("Europe/Paris")
+	after := time.Date(2024, 1, 1, 1, 0, 0, 0, paris)
+	before := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	q, err := AddModifiedFilter("SELECT s._1, s._2 FROM s3object s WHERE s._5 = 'false'", schema, ModifiedRange{After: after, Before: before})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "SELECT s._1, s._2 FROM s3object s WHERE s._5 = 'false' AND s._7 >= '2024-01-01T00:00:00.000Z' AND s._7 < '2024-02-01T00:00:00.000Z'"
+	if q != expected {
+		t.Errorf("AddModifiedFilter() = %q, expected %q", q, expected)
+	}
+	if q, _ = AddModifiedFilter("SELECT s._1 FROM s3object s", schema, ModifiedRange{Before: before}); q != "SELECT s._1 FROM s3object s WHERE s._7 < '2024-02-01T00:00:00.000Z'" {
+		t.Errorf("AddModifiedFilter() = %q", q)
+	}
+	if _, err = AddModifiedFilter("SELECT s._1 FROM s3object s", "Bucket, Key", ModifiedRange{After: after}); err == nil {
+		t.Errorf("AddModifiedFilter() expected an error without a LastModifiedDate field")
+	}
+
+	// After is inclusive and Before exclusive, for the inventory and listings alike
+	r := ModifiedRange{After: after, Before: before}
+	for tm, expected := range map[time.Time]bool{after: true, after.Add(-time.Millisecond): false, before: false, before.Add(-time.Millisecond): true} {
+		if r.Matches(tm) != expected {
+			t.Errorf("Matches(%v) = %v, expected %v", tm, !expected, expected)
+		}
+	}
+}
+
+func TestAddFieldFilter(t *testing.T) {
+	const schema = "Bucket, Key, Size, EncryptionStatus, ReplicationStatus"
+	q, err := AddFieldFilter("SELECT s._1, s._2 FROM s3object s", schema, EncryptionColumn, []string{"NOT-SSE", "SSE-S3"}, false)
+	if expected := "SELECT s._1, s._2 FROM s3object s WHERE s._4 IN ('NOT-SSE', 'SSE-S3')"; err != nil || q != expected {
+		t.Errorf("AddFieldFilter() = %q, %v, expected %q", q, err, expected)
+	}
+	q, err = AddFieldFilter(q, schema, "ReplicationStatus", []string{"COMPLETED"}, true)
+	if expected := "SELECT s._1, s._2 FROM s3object s WHERE s._4 IN ('NOT-SSE', 'SSE-S3') AND s._5 NOT IN ('COMPLETED')"; err != nil || q != expected {
+		t.Errorf("AddFieldFilter() = %q, %v, expected %q", q, err, expected)
+	}
+	if _, err = AddFieldFilter(q, "Bucket, Key", EncryptionColumn, []string{"SSE-KMS"}, false); err == nil {
+		t.Errorf("AddFieldFilter() expected an error without an %s field", EncryptionColumn)
+	}
+	if _, err = ParseLocalSelect(q); err != nil {
+		t.Errorf("ParseLocalSelect(%q) error = %v", q, err)
+	}
+}
+
+func TestGetArn(t *testing.T) {
+	testCases := []struct {
+		region   string
+		expected string
+	}{
+		{region: "us-east-1", expected: "arn:aws:s3:::bucket/key"},
+		{region: "", expected: "arn:aws:s3:::bucket/key"},
+		{region: "cn-north-1", expected: "arn:aws-cn:s3:::bucket/key"},
+		{region: "us-gov-west-1", expected: "arn:aws-us-gov:s3:::bucket/key"},
+	}
+	for _, tc := range testCases {
+		if arn := *GetArn(tc.region, "bucket/key"); arn != tc.expected {
+			t.Errorf("GetArn(%q) = %q, expected %q", tc.region, arn, tc.expected)
+		}
+	}
+	if arn := *GetTargetArn("dest-bucket", "cn-northwest-1", "111111111111"); arn != "arn:aws-cn:s3:::dest-bucket" {
+		t.Errorf("GetTargetArn() in cn-northwest-1 = %q, expected the aws-cn partition", arn)
+	}
+}
+
+func TestGetTargetArn(t *testing.T) {
+	testCases := []struct {
+		destination string
+		expected    string
+		mrap        bool
+	}{
+		{destination: "dest-bucket", expected: "arn:aws:s3:::dest-bucket"},
+		{destination: "mfzwi23gnjvgw.mrap", expected: "arn:aws:s3::111111111111:accesspoint/mfzwi23gnjvgw.mrap", mrap: true},
+		{destination: "arn:aws:s3::222222222222:accesspoint/mfzwi23gnjvgw.mrap", expected: "arn:aws:s3::222222222222:accesspoint/mfzwi23gnjvgw.mrap", mrap: true},
+		{destination: "dest--use1-az4--x-s3", expected: "arn:aws:s3express:us-east-1:111111111111:bucket/dest--use1-az4--x-s3"},
+	}
+	for _, tc := range testCases {
+		if arn := *GetTargetArn(tc.destination, "us-east-1", "111111111111"); arn != tc.expected {
+			t.Errorf("GetTargetArn(%q) = %q, expected %q", tc.destination, arn, tc.expected)
+		}
+		if mrap := IsMultiRegionAccessPoint(tc.destination); mrap != tc.mrap {
+			t.Errorf("IsMultiRegionAccessPoint(%q) = %v, expected %v", tc.destination, mrap, tc.mrap)
+		}
+	}
+}
+
 func TestGetJobSuccessThreshold(t *testing.T) {
 	// Initialize a logger for testing
 	// logger, _ := zap.NewDevelopment()
@@ -144,7 +451,60 @@ func TestGetJobSuccessThreshold(t *testing.T) {
 					},
 				},
 			},
-			expected: 0.75,
+			expected: float32(23.0 / 30.0),
+		},
+		{
+			name: "EarlierJobsFailed",
+			jobs: []*s3control.DescribeJobOutput{
+				{
+					Job: &s3ctrtypes.JobDescriptor{
+						JobArn: aws.String("test"),
+						JobId:  aws.String("test"),
+						ProgressSummary: &s3ctrtypes.JobProgressSummary{
+							TotalNumberOfTasks:     aws.Int64(10),
+							NumberOfTasksSucceeded: aws.Int64(0),
+						},
+					},
+				},
+				{
+					Job: &s3ctrtypes.JobDescriptor{
+						JobArn: aws.String("test"),
+						JobId:  aws.String("test"),
+						ProgressSummary: &s3ctrtypes.JobProgressSummary{
+							TotalNumberOfTasks:     aws.Int64(30),
+							NumberOfTasksSucceeded: aws.Int64(0),
+						},
+					},
+				},
+				nil,
+				{
+					Job: &s3ctrtypes.JobDescriptor{
+						JobArn: aws.String("test"),
+						JobId:  aws.String("test"),
+						ProgressSummary: &s3ctrtypes.JobProgressSummary{
+							TotalNumberOfTasks:     aws.Int64(40),
+							NumberOfTasksSucceeded: aws.Int64(40),
+						},
+					},
+				},
+			},
+			expected: 0.5,
+		},
+		{
+			name: "TaskCountsBeyondInt32",
+			jobs: []*s3control.DescribeJobOutput{
+				{
+					Job: &s3ctrtypes.JobDescriptor{
+						JobArn: aws.String("test"),
+						JobId:  aws.String("test"),
+						ProgressSummary: &s3ctrtypes.JobProgressSummary{
+							TotalNumberOfTasks:     aws.Int64(6_000_000_000),
+							NumberOfTasksSucceeded: aws.Int64(3_000_000_000),
+						},
+					},
+				},
+			},
+			expected: 0.5,
 		},
 	}
 
@@ -213,3 +573,84 @@ func TestParseDateTime(t *testing.T) {
 	}
 
 }
+
+func TestParseDateTimeIn(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	testCases := map[string]time.Time{
+		"2024-01-31":                time.Date(2024, 1, 31, 0, 0, 0, 0, paris),
+		"2024-01-31 12:00:00":       time.Date(2024, 1, 31, 12, 0, 0, 0, paris),
+		"2024-01-31T12:00:00":       time.Date(2024, 1, 31, 12, 0, 0, 0, paris),
+		"2024-01-31T12:00:00Z":      time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+		"2024-01-31T12:00:00-05:00": time.Date(2024, 1, 31, 17, 0, 0, 0, time.UTC),
+	}
+	for s, expected := range testCases {
+		dt, err := ParseDateTimeIn(s, paris)
+		if err != nil || !dt.Equal(expected) {
+			t.Errorf("ParseDateTimeIn(%q) = %v, %v, expected %v", s, dt, err, expected)
+		}
+	}
+	if _, err := ParseDateTimeIn("31/01/2024", paris); err == nil {
+		t.Errorf("ParseDateTimeIn() expected an error")
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 40; attempt++ {
+		d := BackoffDelay(attempt, time.Second, time.Minute)
+		if d < 0 || d > time.Minute {
+			t.Errorf("attempt %d: got delay %s, want between 0 and 1m", attempt, d)
+		}
+	}
+	if d := BackoffDelay(0, time.Second, time.Minute); d > time.Second {
+		t.Errorf("got delay %s for first attempt, want at most 1s", d)
+	}
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	if !IsThrottlingError(&smithy.GenericAPIError{Code: "SlowDown"}) {
+		t.Error("SlowDown should be treated as throttling")
+	}
+	if IsThrottlingError(&smithy.GenericAPIError{Code: "AccessDenied"}) {
+		t.Error("AccessDenied should not be treated as throttling")
+	}
+	if IsThrottlingError(fmt.Errorf("some error")) {
+		t.Error("plain errors should not be treated as throttling")
+	}
+}
+
+func TestEncodeManifestKey(t *testing.T) {
+	useCases := map[string]string{
+		"plain/key.txt":    "plain%2Fkey.txt",
+		"with space.txt":   "with%20space.txt",
+		"with+plus.txt":    "with%2Bplus.txt",
+		"comma,in,key.csv": "comma%2Cin%2Ckey.csv",
+	}
+	for key, expected := range useCases {
+		if got := EncodeManifestKey(key); got != expected {
+			t.Errorf("EncodeManifestKey(%q) = %q, want %q", key, got, expected)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	testCases := []struct {
+		age      string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{age: "7d", expected: 7 * 24 * time.Hour},
+		{age: "1.5d", expected: 36 * time.Hour},
+		{age: "36h", expected: 36 * time.Hour},
+		{age: "d", wantErr: true},
+		{age: "7days", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseAge(tc.age)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseAge(%q) error = %v, wantErr %v", tc.age, err, tc.wantErr)
+		}
+		if got != tc.expected {
+			t.Errorf("ParseAge(%q) = %v, expected %v", tc.age, got, tc.expected)
+		}
+	}
+}
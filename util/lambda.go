@@ -0,0 +1,85 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Handles a Lambda invocation's event, returning the response payload
+type LambdaHandler func(ctx context.Context, event []byte) ([]byte, error)
+
+// Client of the Lambda Runtime API, for running as a function with a custom runtime (provided.al2023)
+// without the Lambda Go library
+type LambdaRuntime struct {
+	Endpoint   string // eg. http://127.0.0.1:9001/2018-06-01/runtime/invocation/
+	HTTPClient *http.Client
+}
+
+// Runtime API client of the function this process runs as, from AWS_LAMBDA_RUNTIME_API
+func NewLambdaRuntime() (*LambdaRuntime, error) {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		return nil, errors.New("AWS_LAMBDA_RUNTIME_API is not set, not running as a Lambda function")
+	}
+	return &LambdaRuntime{Endpoint: "http://" + api + "/2018-06-01/runtime/invocation/", HTTPClient: http.DefaultClient}, nil
+}
+
+// Serve invocations until the runtime API fails, ie. the function's execution environment is shut down
+func (r *LambdaRuntime) Serve(handler LambdaHandler) error {
+	for {
+		if err := r.Invoke(handler); err != nil {
+			return err
+		}
+	}
+}
+
+// Wait for the next invocation, handle it and send its response or error
+func (r *LambdaRuntime) Invoke(handler LambdaHandler) error {
+	resp, err := r.HTTPClient.Get(r.Endpoint + "next")
+	if err != nil {
+		return err
+	}
+	event, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("next invocation: %s: %s", resp.Status, event)
+	}
+	requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+	ctx := context.Background()
+	if ms, perr := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); perr == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+		defer cancel()
+	}
+	out, herr := handler(ctx, event)
+	if herr != nil {
+		body, _ := json.Marshal(map[string]string{"errorMessage": herr.Error(), "errorType": "MigrationStepError"})
+		return r.post(requestID+"/error", body)
+	}
+	return r.post(requestID+"/response", out)
+}
+
+func (r *LambdaRuntime) post(path string, body []byte) error {
+	resp, err := r.HTTPClient.Post(r.Endpoint+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("invocation %s: %s: %s", path, resp.Status, msg)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLambdaRuntimeInvoke(t *testing.T) {
+	posted := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", "req-1")
+			w.Header().Set("Lambda-Runtime-Deadline-Ms", "4102444800000")
+			_, _ = w.Write([]byte(`{"step":"check-job"}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		posted[r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	runtime := &LambdaRuntime{Endpoint: server.URL + "/2018-06-01/runtime/invocation/", HTTPClient: server.Client()}
+	err := runtime.Invoke(func(ctx context.Context, event []byte) ([]byte, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("invocation has no deadline")
+		}
+		return append([]byte(`{"echo":`), append(event, '}')...), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := posted["/2018-06-01/runtime/invocation/req-1/response"]; got != `{"echo":{"step":"check-job"}}` {
+		t.Errorf("got response %s", got)
+	}
+
+	err = runtime.Invoke(func(ctx context.Context, event []byte) ([]byte, error) {
+		return nil, errors.New("manifest not found")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := posted["/2018-06-01/runtime/invocation/req-1/error"]; !strings.Contains(got, `"errorMessage":"manifest not found"`) {
+		t.Errorf("got error %s", got)
+	}
+}
@@ -0,0 +1,606 @@
+package util
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A local stand-in for S3 Select over gzipped, headerless inventory CSV files, for regions, partitions and
+// accounts where S3 Select isn't available.  It supports the SQL subset of the expressions this tool builds:
+// SELECT of columns (s._N), COUNT(*) and SUM(CAST(s._N AS INT)) FROM s3object s, with a WHERE clause of
+// comparisons, BETWEEN, IN, LIKE and IS [NOT] NULL combined with AND, OR, NOT and parentheses.  Rows are
+// streamed, so memory use doesn't grow with the size of the file.
+type LocalSelect struct {
+	columns   []selectColumn
+	where     selectExpr // nil selects every row
+	aggregate bool
+}
+
+// Compile an S3 Select expression for NewLocalSelectReader
+func ParseLocalSelect(expression string) (*LocalSelect, error) {
+	p := &selectParser{}
+	if err := p.tokenize(expression); err != nil {
+		return nil, err
+	}
+	sel, err := p.parseSelect()
+	if err != nil {
+		return nil, fmt.Errorf("unsupported S3 Select expression '%s': %w", expression, err)
+	}
+	return sel, nil
+}
+
+// Stream the rows of the gzipped CSV read from r that the expression selects, as CSV.  r is closed once read.
+func NewLocalSelectReader(r io.ReadCloser, expression string) (io.Reader, error) {
+	sel, err := ParseLocalSelect(expression)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer r.Close()
+		pw.CloseWithError(sel.Run(r, pw))
+	}()
+	return pr, nil
+}
+
+// Filter the gzipped CSV read from r to w
+func (s *LocalSelect) Run(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	in := csv.NewReader(gz)
+	in.FieldsPerRecord = -1
+	in.ReuseRecord = true
+	out := csv.NewWriter(w)
+
+	var (
+		count int64
+		sums  = make([]int64, len(s.columns))
+		seen  bool // A row was selected, SUM of no rows is empty
+	)
+	row := make([]string, len(s.columns))
+	for {
+		rec, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if s.where != nil {
+			v, err := s.where.eval(rec)
+			if err != nil {
+				return err
+			}
+			if !v.truth() {
+				continue
+			}
+		}
+		if !s.aggregate {
+			for i, c := range s.columns {
+				v, err := c.expr.eval(rec)
+				if err != nil {
+					return err
+				}
+				row[i] = v.s
+			}
+			if err := out.Write(row); err != nil {
+				return err
+			}
+			continue
+		}
+		count++
+		seen = true
+		for i, c := range s.columns {
+			if !c.sum {
+				continue
+			}
+			v, err := c.expr.eval(rec)
+			if err != nil {
+				return err
+			}
+			n, err := v.int()
+			if err != nil {
+				return err
+			}
+			sums[i] += n
+		}
+	}
+	if s.aggregate {
+		for i, c := range s.columns {
+			switch {
+			case c.count:
+				row[i] = strconv.FormatInt(count, 10)
+			case seen:
+				row[i] = strconv.FormatInt(sums[i], 10)
+			default:
+				row[i] = ""
+			}
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+type selectColumn struct {
+	expr  selectExpr // Column, or the SUM argument
+	count bool       // COUNT(*)
+	sum   bool
+}
+
+// A value of an expression, a string as S3 Select reads every CSV field as one unless CAST
+type selectValue struct {
+	s       string
+	num     bool // Numeric, compared as a number
+	boolean bool // Result of a predicate
+	null    bool // Column beyond the end of the row
+}
+
+func (v selectValue) truth() bool {
+	return v.boolean
+}
+
+func (v selectValue) int() (int64, error) {
+	if v.null || v.s == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v.s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to cast '%s' to INT", v.s)
+	}
+	return n, nil
+}
+
+type selectExpr interface {
+	eval(rec []string) (selectValue, error)
+}
+
+type columnRef int // Zero based column index
+
+func (c columnRef) eval(rec []string) (selectValue, error) {
+	if int(c) >= len(rec) {
+		return selectValue{null: true}, nil
+	}
+	return selectValue{s: rec[c]}, nil
+}
+
+type literal selectValue
+
+func (l literal) eval(rec []string) (selectValue, error) { return selectValue(l), nil }
+
+type castInt struct{ expr selectExpr }
+
+func (c castInt) eval(rec []string) (selectValue, error) {
+	v, err := c.expr.eval(rec)
+	if err != nil || v.null {
+		return v, err
+	}
+	n, err := v.int()
+	return selectValue{s: strconv.FormatInt(n, 10), num: true}, err
+}
+
+// Operators whose operands are predicates
+type logical struct {
+	op          string // AND, OR or NOT
+	left, right selectExpr
+}
+
+func (l logical) eval(rec []string) (selectValue, error) {
+	a, err := l.left.eval(rec)
+	if err != nil {
+		return a, err
+	}
+	switch {
+	case l.op == "NOT":
+		return selectValue{boolean: !a.boolean}, nil
+	case l.op == "AND" && !a.boolean, l.op == "OR" && a.boolean:
+		return a, nil
+	}
+	return l.right.eval(rec)
+}
+
+type predicate struct {
+	op       string // Comparison operator, BETWEEN, IN, LIKE or IS NULL
+	not      bool
+	left     selectExpr
+	operands []selectExpr
+}
+
+func (p predicate) eval(rec []string) (selectValue, error) {
+	a, err := p.left.eval(rec)
+	if err != nil {
+		return a, err
+	}
+	operands := make([]selectValue, len(p.operands))
+	for i, o := range p.operands {
+		if operands[i], err = o.eval(rec); err != nil {
+			return operands[i], err
+		}
+	}
+	var result bool
+	switch p.op {
+	case "IS NULL":
+		result = a.null
+	case "BETWEEN":
+		result = compareValues(a, operands[0]) >= 0 && compareValues(a, operands[1]) <= 0
+	case "IN":
+		for _, o := range operands {
+			if compareValues(a, o) == 0 {
+				result = true
+				break
+			}
+		}
+	case "LIKE":
+		result = matchesLike(operands[0].s, a.s)
+	default:
+		c := compareValues(a, operands[0])
+		switch p.op {
+		case "=":
+			result = c == 0
+		case "<>", "!=":
+			result = c != 0
+		case "<":
+			result = c < 0
+		case "<=":
+			result = c <= 0
+		case ">":
+			result = c > 0
+		case ">=":
+			result = c >= 0
+		}
+	}
+	return selectValue{boolean: result != p.not}, nil
+}
+
+// Compare numerically when either side is numeric, as a string otherwise
+func compareValues(a, b selectValue) int {
+	if a.num || b.num {
+		x, xerr := strconv.ParseFloat(a.s, 64)
+		y, yerr := strconv.ParseFloat(b.s, 64)
+		if xerr == nil && yerr == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a.s, b.s)
+}
+
+// SQL LIKE, where % matches any characters and _ any one
+func matchesLike(pattern, s string) bool {
+	p, v := []rune(pattern), []rune(s)
+	var match func(i, j int) bool
+	match = func(i, j int) bool {
+		for i < len(p) {
+			switch p[i] {
+			case '%':
+				for k := j; k <= len(v); k++ {
+					if match(i+1, k) {
+						return true
+					}
+				}
+				return false
+			case '_':
+				if j >= len(v) {
+					return false
+				}
+			default:
+				if j >= len(v) || v[j] != p[i] {
+					return false
+				}
+			}
+			i++
+			j++
+		}
+		return j == len(v)
+	}
+	return match(0, 0)
+}
+
+type selectToken struct {
+	kind  rune // 'i' identifier or keyword, 's' string, 'n' number, otherwise the operator's first rune
+	text  string
+	upper string // Identifiers and keywords upper-cased
+}
+
+type selectParser struct {
+	tokens []selectToken
+	pos    int
+}
+
+func (p *selectParser) tokenize(expression string) error {
+	r := []rune(expression)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			var b strings.Builder
+			i++
+			for ; ; i++ {
+				if i >= len(r) {
+					return fmt.Errorf("unterminated string in '%s'", expression)
+				}
+				if r[i] == '\'' {
+					if i+1 < len(r) && r[i+1] == '\'' {
+						b.WriteRune('\'')
+						i++
+						continue
+					}
+					break
+				}
+				b.WriteRune(r[i])
+			}
+			i++
+			p.tokens = append(p.tokens, selectToken{kind: 's', text: b.String()})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(r) && unicode.IsDigit(r[i+1])):
+			j := i + 1
+			for j < len(r) && (unicode.IsDigit(r[j]) || r[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, selectToken{kind: 'n', text: string(r[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '.') {
+				j++
+			}
+			text := string(r[i:j])
+			p.tokens = append(p.tokens, selectToken{kind: 'i', text: text, upper: strings.ToUpper(text)})
+			i = j
+		case strings.ContainsRune("<>!", c) && i+1 < len(r) && (r[i+1] == '=' || (c == '<' && r[i+1] == '>')):
+			p.tokens = append(p.tokens, selectToken{kind: c, text: string(r[i : i+2])})
+			i += 2
+		case strings.ContainsRune("=<>(),*", c):
+			p.tokens = append(p.tokens, selectToken{kind: c, text: string(c)})
+			i++
+		default:
+			return fmt.Errorf("unexpected '%c' in '%s'", c, expression)
+		}
+	}
+	return nil
+}
+
+func (p *selectParser) peek() selectToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return selectToken{}
+}
+
+func (p *selectParser) next() selectToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// Consume the keyword or operator when it is next
+func (p *selectParser) accept(word string) bool {
+	t := p.peek()
+	if (t.kind == 'i' && t.upper == word) || (t.kind != 'i' && t.kind != 's' && t.kind != 0 && t.text == word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *selectParser) expect(word string) error {
+	if !p.accept(word) {
+		return fmt.Errorf("expected %s, found '%s'", word, p.peek().text)
+	}
+	return nil
+}
+
+func (p *selectParser) parseSelect() (*LocalSelect, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	sel := &LocalSelect{}
+	for {
+		col, err := p.parseColumn()
+		if err != nil {
+			return nil, err
+		}
+		sel.aggregate = sel.aggregate || col.count || col.sum
+		sel.columns = append(sel.columns, col)
+		if !p.accept(",") {
+			break
+		}
+	}
+	for _, c := range sel.columns {
+		if sel.aggregate && !c.count && !c.sum {
+			return nil, fmt.Errorf("columns can't be selected with aggregates")
+		}
+	}
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != 'i' || t.upper != "S3OBJECT" {
+		return nil, fmt.Errorf("expected s3object, found '%s'", t.text)
+	}
+	if t := p.peek(); t.kind == 'i' && t.upper != "WHERE" {
+		p.pos++ // Alias, column references are checked against "s." only
+	}
+	if p.accept("WHERE") {
+		where, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		sel.where = where
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek().text)
+	}
+	return sel, nil
+}
+
+func (p *selectParser) parseColumn() (selectColumn, error) {
+	switch {
+	case p.accept("COUNT"):
+		for _, w := range []string{"(", "*", ")"} {
+			if err := p.expect(w); err != nil {
+				return selectColumn{}, err
+			}
+		}
+		return selectColumn{count: true}, nil
+	case p.accept("SUM"):
+		if err := p.expect("("); err != nil {
+			return selectColumn{}, err
+		}
+		expr, err := p.parseOperand()
+		if err != nil {
+			return selectColumn{}, err
+		}
+		return selectColumn{expr: expr, sum: true}, p.expect(")")
+	}
+	expr, err := p.parseOperand()
+	return selectColumn{expr: expr}, err
+}
+
+func (p *selectParser) parseOr() (selectExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("OR") {
+		var right selectExpr
+		if right, err = p.parseAnd(); err == nil {
+			left = logical{op: "OR", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *selectParser) parseAnd() (selectExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("AND") {
+		var right selectExpr
+		if right, err = p.parseNot(); err == nil {
+			left = logical{op: "AND", left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *selectParser) parseNot() (selectExpr, error) {
+	if p.accept("NOT") {
+		expr, err := p.parseNot()
+		return logical{op: "NOT", left: expr}, err
+	}
+	return p.parsePredicate()
+}
+
+func (p *selectParser) parsePredicate() (selectExpr, error) {
+	if p.peek().kind == '(' {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return predicate{op: "IS NULL", not: not, left: left}, nil
+	}
+	pred := predicate{left: left, not: p.accept("NOT")}
+	switch {
+	case p.accept("BETWEEN"):
+		pred.op = "BETWEEN"
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		pred.operands = []selectExpr{low, high}
+		return pred, err
+	case p.accept("IN"):
+		pred.op = "IN"
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			o, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			pred.operands = append(pred.operands, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return pred, p.expect(")")
+	case p.accept("LIKE"):
+		pred.op = "LIKE"
+	case !pred.not:
+		t := p.next()
+		switch t.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			pred.op = t.text
+		default:
+			return nil, fmt.Errorf("expected a comparison, found '%s'", t.text)
+		}
+	default:
+		return nil, fmt.Errorf("expected BETWEEN, IN or LIKE after NOT, found '%s'", p.peek().text)
+	}
+	right, err := p.parseOperand()
+	pred.operands = []selectExpr{right}
+	return pred, err
+}
+
+func (p *selectParser) parseOperand() (selectExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return literal{s: t.text}, nil
+	case 'n':
+		return literal{s: t.text, num: true}, nil
+	case 'i':
+		if t.upper == "CAST" {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			expr, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("AS"); err != nil {
+				return nil, err
+			}
+			if typ := p.next(); typ.upper != "INT" && typ.upper != "INTEGER" {
+				return nil, fmt.Errorf("unsupported CAST to '%s'", typ.text)
+			}
+			return castInt{expr: expr}, p.expect(")")
+		}
+		if rest, ok := strings.CutPrefix(t.upper, "S._"); ok {
+			n, err := strconv.Atoi(rest)
+			if err == nil && n > 0 {
+				return columnRef(n - 1), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s'", t.text)
+}
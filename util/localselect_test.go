@@ -0,0 +1,77 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+)
+
+func gzipped(t *testing.T, s string) io.ReadCloser {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return io.NopCloser(&b)
+}
+
+func TestLocalSelect(t *testing.T) {
+	const schema = "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate"
+	inventory := `"src","a.txt","v1","true","false","10","2024-01-01T00:00:00.000Z"
+"src","a.txt","v0","false","false","5","2023-06-01T00:00:00.000Z"
+"src","b.txt","v2","true","true","","2024-02-01T00:00:00.000Z"
+"src","c%2Cd.txt","v3","true","false","20","2024-03-01T00:00:00.000Z"
+`
+	start := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)
+	latest, _ := GetQueryExpression(schema, time.Time{}, time.Time{}, IsLatestYes, false)
+	scope, _ := GetScopeQueryExpression(schema, time.Time{}, time.Time{}, "", false)
+	dated, _ := GetQueryExpression(schema+", LastUpdated", start, end, "", false)
+	markers, _ := GetDeleteMarkerQueryExpression(schema, time.Time{}, time.Time{})
+	testCases := []struct {
+		expression string
+		expected   string
+	}{
+		{expression: latest, expected: "src,a.txt\nsrc,c%2Cd.txt\n"},
+		{expression: scope, expected: "3,35\n"},
+		{expression: "SELECT COUNT(*), SUM(CAST(s._6 AS INT)) FROM s3object s WHERE s._2 = 'none'", expected: "0,\n"},
+		{expression: dated, expected: ""}, // The inventory has no LastUpdated column, so s._8 is missing
+		{expression: markers, expected: "b.txt\n"},
+		{expression: "SELECT s._2 FROM s3object s WHERE s._7 BETWEEN '2023-12-01' AND '2024-02-15' AND NOT s._5 = 'true'", expected: "a.txt\n"},
+		{expression: "SELECT s._3 FROM s3object s WHERE (s._2 LIKE 'a%' OR s._2 IN ('c%2Cd.txt')) AND CAST(s._6 AS INT) >= 10", expected: "v1\nv3\n"},
+		{expression: "SELECT s._2 FROM s3object s WHERE s._9 IS NULL AND s._6 <> ''", expected: "a.txt\na.txt\nc%2Cd.txt\n"},
+	}
+	for _, tc := range testCases {
+		r, err := NewLocalSelectReader(gzipped(t, inventory), tc.expression)
+		if err != nil {
+			t.Errorf("NewLocalSelectReader(%q) error = %v", tc.expression, err)
+			continue
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("NewLocalSelectReader(%q) read error = %v", tc.expression, err)
+		}
+		if string(out) != tc.expected {
+			t.Errorf("NewLocalSelectReader(%q) = %q, expected %q", tc.expression, out, tc.expected)
+		}
+	}
+}
+
+func TestParseLocalSelectErrors(t *testing.T) {
+	for _, expression := range []string{
+		"SELECT s._1 FROM s3object s WHERE s._1 = 'unterminated",
+		"SELECT s._1, COUNT(*) FROM s3object s",
+		"SELECT s._1 FROM s3object s WHERE s._1",
+		"SELECT s._1 FROM s3object s WHERE s._1 = 'a' LIMIT 1",
+		"SELECT * FROM s3object s",
+	} {
+		if _, err := ParseLocalSelect(expression); err == nil {
+			t.Errorf("ParseLocalSelect(%q) expected an error", expression)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migration.log")
+	rf, err := NewRotatingFile(path, 10, time.Hour, 2)
+	assert.NoError(t, err)
+	defer rf.Close()
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	rf.now = func() time.Time { return now }
+
+	// Rotated by size once the next entry wouldn't fit
+	for _, entry := range []string{"first\n", "second\n", "third\n"} {
+		now = now.Add(time.Second)
+		_, err = rf.Write([]byte(entry))
+		assert.NoError(t, err)
+	}
+	body, _ := os.ReadFile(path)
+	assert.Equal(t, "third\n", string(body))
+	backups, _ := filepath.Glob(path + ".*")
+	assert.Len(t, backups, 2)
+
+	// Rotated by age, keeping only the newest backups
+	now = now.Add(time.Hour)
+	_, err = rf.Write([]byte("4\n"))
+	assert.NoError(t, err)
+	backups, _ = filepath.Glob(path + ".*")
+	assert.Len(t, backups, 2)
+	body, _ = os.ReadFile(backups[1])
+	assert.Equal(t, "third\n", string(body))
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Log encodings of LogOptions.Format
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console" // Human-friendly, for watching a migration from a terminal
+)
+
+// Logging behaviour requested on the command line
+type LogOptions struct {
+	Level              string // debug, info, warn or error, defaults to info
+	Format             string // LogFormatJSON or LogFormatConsole, defaults to JSON
+	SamplingInitial    int    // Entries with the same message logged per second before sampling kicks in
+	SamplingThereafter int    // After the initial entries, log every Nth entry. Zero disables sampling
+
+	File           string        // Also write every entry, as JSON, to this file
+	FileMaxSize    int           // Rotate the file once it reaches this many MB, zero disables
+	FileMaxAge     time.Duration // Rotate the file once it has been written to for this long, zero disables
+	FileMaxBackups int           // Rotated files kept, zero keeps them all
+}
+
+// Build the global zap logger according to the given options.  Fatal entries exit with their ExitCode.
+func InitLogger(opts LogOptions) error {
+	cfg := zap.NewProductionConfig()
+	if opts.Level != "" {
+		level, err := zapcore.ParseLevel(opts.Level)
+		if err != nil {
+			return err
+		}
+		cfg.Level = zap.NewAtomicLevelAt(level)
+	}
+	switch opts.Format {
+	case "", LogFormatJSON:
+	case LogFormatConsole:
+		cfg.Encoding = LogFormatConsole
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return fmt.Errorf("unknown log format %q, valid formats are '%s' or '%s'", opts.Format, LogFormatJSON, LogFormatConsole)
+	}
+	cfg.Sampling = nil
+	if opts.SamplingThereafter > 0 {
+		cfg.Sampling = &zap.SamplingConfig{
+			Initial:    opts.SamplingInitial,
+			Thereafter: opts.SamplingThereafter,
+		}
+	}
+	logger, err := cfg.Build(zap.WithFatalHook(exitCodeHook{}))
+	if err != nil {
+		return err
+	}
+	if opts.File != "" {
+		rf, ferr := NewRotatingFile(opts.File, int64(opts.FileMaxSize)<<20, opts.FileMaxAge, opts.FileMaxBackups)
+		if ferr != nil {
+			return fmt.Errorf("unable to open log file: %w", ferr)
+		}
+		// Not sampled, so the file is a complete record of the migration
+		fileCore := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), rf, cfg.Level)
+		logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, fileCore)
+		}))
+	}
+	zap.ReplaceGlobals(logger)
+	return nil
+}
@@ -0,0 +1,23 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestInitLogger(t *testing.T) {
+	defer zap.ReplaceGlobals(zap.NewNop())
+
+	assert.NoError(t, InitLogger(LogOptions{Level: "warn", Format: LogFormatConsole}))
+	assert.False(t, zap.L().Core().Enabled(zapcore.InfoLevel))
+	assert.True(t, zap.L().Core().Enabled(zapcore.WarnLevel))
+
+	assert.NoError(t, InitLogger(LogOptions{Level: "debug"}))
+	assert.True(t, zap.L().Core().Enabled(zapcore.DebugLevel))
+
+	assert.Error(t, InitLogger(LogOptions{Level: "verbose"}))
+	assert.Error(t, InitLogger(LogOptions{Format: "xml"}))
+}
@@ -0,0 +1,17 @@
+package util
+
+import "testing"
+
+func TestPartition(t *testing.T) {
+	for region, want := range map[string][2]string{
+		"us-east-1":      {"aws", "amazonaws.com"},
+		"cn-northwest-1": {"aws-cn", "amazonaws.com.cn"},
+		"us-gov-west-1":  {"aws-us-gov", "amazonaws.com"},
+		"us-iso-east-1":  {"aws-iso", "c2s.ic.gov"},
+		"us-isob-east-1": {"aws-iso-b", "sc2s.sgov.gov"},
+	} {
+		if got := [2]string{Partition(region), DNSSuffix(region)}; got != want {
+			t.Errorf("region %s: got %v, expected %v", region, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Label names and values of a metric series
+type Labels map[string]string
+
+// Metric types of the Prometheus text format
+const (
+	MetricGauge   = "gauge"
+	MetricCounter = "counter"
+)
+
+type metricSeries struct {
+	labels string // Rendered labels, eg. {job_id="1"}
+	value  float64
+}
+
+type metricFamily struct {
+	help   string
+	typ    string
+	series map[string]*metricSeries
+}
+
+// Gauges and counters served in the Prometheus text exposition format on /metrics.  A nil Metrics is
+// valid and records nothing.
+type Metrics struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// Metrics of the process, served by the health endpoint
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{families: map[string]*metricFamily{}}
+}
+
+func renderLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%s", name, strconv.Quote(labels[name]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *Metrics) series(name, help, typ string, labels Labels) *metricSeries {
+	family, ok := m.families[name]
+	if !ok {
+		family = &metricFamily{help: help, typ: typ, series: map[string]*metricSeries{}}
+		m.families[name] = family
+	}
+	key := renderLabels(labels)
+	s, ok := family.series[key]
+	if !ok {
+		s = &metricSeries{labels: key}
+		family.series[key] = s
+	}
+	return s
+}
+
+// Set a gauge
+func (m *Metrics) Set(name, help string, labels Labels, value float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name, help, MetricGauge, labels).value = value
+}
+
+// Add to a counter
+func (m *Metrics) Add(name, help string, labels Labels, delta float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.series(name, help, MetricCounter, labels).value += delta
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		family := m.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.typ)
+		keys := make([]string, 0, len(family.series))
+		for key := range family.series {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s%s %s\n", name, key, strconv.FormatFloat(family.series[key].value, 'g', -1, 64))
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.Set("s3migration_job_tasks", "Tasks of a batch job", Labels{"job_id": "b", "result": "total"}, 10)
+	m.Set("s3migration_job_tasks", "Tasks of a batch job", Labels{"job_id": "a", "result": "total"}, 5)
+	m.Set("s3migration_job_tasks", "Tasks of a batch job", Labels{"job_id": "a", "result": "total"}, 6)
+	m.Add("s3migration_retries_total", "Retries", Labels{"operation": `describe "job"`}, 1)
+	m.Add("s3migration_retries_total", "Retries", Labels{"operation": `describe "job"`}, 2)
+	m.Add("s3migration_jobs_created_total", "Jobs created", nil, 1)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	expected := `# HELP s3migration_job_tasks Tasks of a batch job
+# TYPE s3migration_job_tasks gauge
+s3migration_job_tasks{job_id="a",result="total"} 6
+s3migration_job_tasks{job_id="b",result="total"} 10
+# HELP s3migration_jobs_created_total Jobs created
+# TYPE s3migration_jobs_created_total counter
+s3migration_jobs_created_total 1
+# HELP s3migration_retries_total Retries
+# TYPE s3migration_retries_total counter
+s3migration_retries_total{operation="describe \"job\""} 3
+`
+	if rec.Body.String() != expected {
+		t.Errorf("got metrics\n%s\nwant\n%s", rec.Body.String(), expected)
+	}
+
+	// Nil metrics must be safe to use
+	var none *Metrics
+	none.Set("x", "", nil, 1)
+	none.Add("x", "", nil, 1)
+}
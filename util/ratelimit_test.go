@@ -0,0 +1,38 @@
+package util
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if err := l.Wait(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// 20 calls at 100 per second, the first immediately
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("20 calls took %v, expected at least 190ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := NewRateLimiter(0.001)
+	slow.Wait(ctx)
+	if err := slow.Wait(ctx); err == nil {
+		t.Error("expected the cancelled context's error")
+	}
+}
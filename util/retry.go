@@ -0,0 +1,49 @@
+package util
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// Error codes returned by S3 and S3 Control when requests are being throttled
+var throttlingErrorCodes = []string{
+	"Throttling",
+	"ThrottlingException",
+	"ThrottledException",
+	"RequestThrottledException",
+	"TooManyRequestsException",
+	"RequestLimitExceeded",
+	"SlowDown",
+	"ServiceUnavailable",
+}
+
+// Reports whether err is a throttling or transient 503 response that is worth retrying
+func IsThrottlingError(err error) bool {
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		for _, code := range throttlingErrorCodes {
+			if ae.ErrorCode() == code {
+				return true
+			}
+		}
+	}
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) {
+		return re.HTTPStatusCode() == http.StatusServiceUnavailable || re.HTTPStatusCode() == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Exponential backoff with full jitter: a random delay between zero and base*2^attempt, capped at maxDelay
+func BackoffDelay(attempt int, base, maxDelay time.Duration) time.Duration {
+	delay := maxDelay
+	if attempt < 32 && base<<attempt > 0 && base<<attempt < maxDelay {
+		delay = base << attempt
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// The Systems Manager API GetSSMParameter calls, implemented by *ssm.Client
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// Value of a Parameter Store parameter, decrypting SecureString parameters
+func GetSSMParameter(ctx context.Context, client SSMAPI, name string) (string, error) {
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(true)})
+	if err != nil || out.Parameter == nil {
+		return "", err
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
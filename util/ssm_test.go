@@ -0,0 +1,38 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+func TestGetSSMParameter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]any
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &in)
+		if r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParameter" || in["Name"] != "/s3migration/logs" || in["WithDecryption"] != true {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Parameter": {"Name": "/s3migration/logs", "Value": "{\"chunks\": 4}"}}`))
+	}))
+	defer server.Close()
+
+	client := ssm.NewFromConfig(aws.Config{Region: "us-east-1", BaseEndpoint: aws.String(server.URL), Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})})
+	value, err := GetSSMParameter(context.TODO(), client, "/s3migration/logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != `{"chunks": 4}` {
+		t.Errorf("got value %s", value)
+	}
+}